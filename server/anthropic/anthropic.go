@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,6 +25,7 @@ const (
 )
 
 type messageState struct {
+	ctx      context.Context
 	messages []anthropicSDK.MessageParam
 	system   string
 	output   chan<- string
@@ -41,6 +43,7 @@ type Anthropic struct {
 	inputTokenLimit  int
 	metricsService   metrics.LLMetrics
 	outputTokenLimit int
+	sampling         llm.SamplingParameters
 }
 
 func New(llmService llm.ServiceConfig, httpClient *http.Client, metricsService metrics.LLMetrics) *Anthropic {
@@ -55,6 +58,7 @@ func New(llmService llm.ServiceConfig, httpClient *http.Client, metricsService m
 		inputTokenLimit:  llmService.InputTokenLimit,
 		metricsService:   metricsService,
 		outputTokenLimit: llmService.OutputTokenLimit,
+		sampling:         llmService.SamplingParameters,
 	}
 }
 
@@ -152,7 +156,8 @@ func conversationToMessages(posts []llm.Post) (string, []anthropicSDK.MessagePar
 
 func (a *Anthropic) GetDefaultConfig() llm.LanguageModelConfig {
 	config := llm.LanguageModelConfig{
-		Model: a.defaultModel,
+		Model:              a.defaultModel,
+		SamplingParameters: a.sampling,
 	}
 	if a.outputTokenLimit == 0 {
 		config.MaxGeneratedTokens = DefaultMaxTokens
@@ -170,12 +175,37 @@ func (a *Anthropic) createConfig(opts []llm.LanguageModelOption) llm.LanguageMod
 	return cfg
 }
 
+// validateSampling rejects sampling parameters the Anthropic API can't honor.
+func validateSampling(cfg llm.LanguageModelConfig) error {
+	if cfg.Seed != nil {
+		return fmt.Errorf("anthropic does not support a sampling seed: %w", llm.ErrUnsupportedSamplingParameter)
+	}
+	if cfg.Temperature != nil && (*cfg.Temperature < 0 || *cfg.Temperature > 1) {
+		return fmt.Errorf("anthropic temperature must be between 0 and 1, got %v: %w", *cfg.Temperature, llm.ErrUnsupportedSamplingParameter)
+	}
+	return nil
+}
+
+// applySampling sets the sampling parameters from the config on the request.
+func applySampling(params *anthropicSDK.MessageNewParams, cfg llm.LanguageModelConfig) {
+	cfg.ApplyDeterministicSampling(nil)
+	if cfg.Temperature != nil {
+		params.Temperature = anthropicSDK.F(float64(*cfg.Temperature))
+	}
+	if cfg.TopP != nil {
+		params.TopP = anthropicSDK.F(float64(*cfg.TopP))
+	}
+	if len(cfg.StopSequences) > 0 {
+		params.StopSequences = anthropicSDK.F(cfg.StopSequences)
+	}
+}
+
 func (a *Anthropic) streamChatWithTools(state messageState) error {
 	if state.depth >= MaxToolResolutionDepth {
-		return fmt.Errorf("max tool resolution depth (%d) exceeded", MaxToolResolutionDepth)
+		return fmt.Errorf("max tool resolution depth (%d) exceeded: %w", MaxToolResolutionDepth, llm.ErrToolCall)
 	}
 
-	stream := a.client.Messages.NewStreaming(context.Background(), anthropicSDK.MessageNewParams{
+	params := anthropicSDK.MessageNewParams{
 		Model:     anthropicSDK.F(state.config.Model),
 		MaxTokens: anthropicSDK.F(int64(state.config.MaxGeneratedTokens)),
 		Messages:  anthropicSDK.F(state.messages),
@@ -184,7 +214,10 @@ func (a *Anthropic) streamChatWithTools(state messageState) error {
 			Text: anthropicSDK.F(state.system),
 		}}),
 		Tools: anthropicSDK.F(convertTools(state.tools)),
-	})
+	}
+	applySampling(&params, state.config)
+
+	stream := a.client.Messages.NewStreaming(state.ctx, params)
 
 	message := anthropicSDK.Message{}
 	var toolResults []anthropicSDK.ContentBlockParamUnion
@@ -207,6 +240,7 @@ func (a *Anthropic) streamChatWithTools(state messageState) error {
 	if err := stream.Err(); err != nil {
 		return fmt.Errorf("error from anthropic stream: %w", err)
 	}
+	a.metricsService.AddTokens(state.config.Operation, int(message.Usage.InputTokens), int(message.Usage.OutputTokens))
 
 	// Check for tool usage after message is complete
 	for _, block := range message.Content {
@@ -217,8 +251,10 @@ func (a *Anthropic) streamChatWithTools(state messageState) error {
 			}, state.context)
 
 			if err != nil {
-				return fmt.Errorf("tool resolution error: %w", err)
+				a.metricsService.IncrementToolCalls(block.Name, metrics.ToolCallFailed)
+				return fmt.Errorf("tool resolution error: %w: %w", llm.ErrToolCall, err)
 			}
+			a.metricsService.IncrementToolCalls(block.Name, metrics.ToolCallSucceeded)
 
 			toolResults = append(toolResults, anthropicSDK.NewToolResultBlock(block.ID, result, false))
 		}
@@ -236,6 +272,7 @@ func (a *Anthropic) streamChatWithTools(state messageState) error {
 		)
 
 		newState := messageState{
+			ctx:      state.ctx,
 			messages: state.messages,
 			system:   state.system,
 			output:   state.output,
@@ -257,16 +294,22 @@ func (a *Anthropic) streamChatWithTools(state messageState) error {
 }
 
 func (a *Anthropic) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
-	a.metricsService.IncrementLLMRequests()
+	cfg := a.createConfig(opts)
+	a.metricsService.IncrementLLMRequests(cfg.Operation)
+
+	if err := validateSampling(cfg); err != nil {
+		return nil, err
+	}
 
 	output := make(chan string)
 	errChan := make(chan error)
 
-	cfg := a.createConfig(opts)
-
 	system, messages := conversationToMessages(conversation.Posts)
 
+	ctx, cancelRequest := context.WithCancel(context.Background())
+	cancel, canceled := llm.NewCancel(cancelRequest)
 	initialState := messageState{
+		ctx:      ctx,
 		messages: messages,
 		system:   system,
 		output:   output,
@@ -281,13 +324,14 @@ func (a *Anthropic) ChatCompletion(conversation llm.BotConversation, opts ...llm
 	go func() {
 		defer close(output)
 		defer close(errChan)
+		defer cancelRequest()
 
 		if err := a.streamChatWithTools(initialState); err != nil {
 			errChan <- err
 		}
 	}()
 
-	return &llm.TextStreamResult{Stream: output, Err: errChan}, nil
+	return &llm.TextStreamResult{Stream: output, Err: errChan, Cancel: cancel, Canceled: canceled, Model: func() string { return cfg.Model }}, nil
 }
 
 func (a *Anthropic) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
@@ -299,6 +343,21 @@ func (a *Anthropic) ChatCompletionNoStream(conversation llm.BotConversation, opt
 	return result.ReadAll(), nil
 }
 
+// CheckModel looks up the model, which fails if the API key is rejected.
+func (a *Anthropic) CheckModel(ctx context.Context, model string) error {
+	if model == "" {
+		model = a.defaultModel
+	}
+
+	if _, err := a.client.Models.Get(ctx, model); err != nil {
+		if apiErr := (*anthropicSDK.Error)(nil); errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", llm.ErrModelNotFound, model)
+		}
+		return fmt.Errorf("unable to get model: %w", err)
+	}
+	return nil
+}
+
 func (a *Anthropic) CountTokens(text string) int {
 	return 0
 }
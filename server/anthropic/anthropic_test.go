@@ -351,3 +351,51 @@ func TestConversationToMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestSamplingParameters(t *testing.T) {
+	temperature := float32(0.3)
+	seed := 7
+
+	t.Run("seed is rejected", func(t *testing.T) {
+		err := validateSampling(llm.LanguageModelConfig{SamplingParameters: llm.SamplingParameters{Seed: &seed}})
+		assert.ErrorIs(t, err, llm.ErrUnsupportedSamplingParameter)
+	})
+
+	t.Run("temperature above one is rejected", func(t *testing.T) {
+		tooHot := float32(1.5)
+		err := validateSampling(llm.LanguageModelConfig{SamplingParameters: llm.SamplingParameters{Temperature: &tooHot}})
+		assert.ErrorIs(t, err, llm.ErrUnsupportedSamplingParameter)
+	})
+
+	t.Run("explicit parameters are mapped", func(t *testing.T) {
+		cfg := llm.LanguageModelConfig{SamplingParameters: llm.SamplingParameters{
+			Temperature:   &temperature,
+			StopSequences: []string{"STOP"},
+		}}
+		assert.NoError(t, validateSampling(cfg))
+
+		params := anthropicSDK.MessageNewParams{}
+		applySampling(&params, cfg)
+		assert.Equal(t, anthropicSDK.F(float64(temperature)), params.Temperature)
+		assert.Equal(t, anthropicSDK.F([]string{"STOP"}), params.StopSequences)
+		assert.False(t, params.TopP.Present)
+	})
+
+	t.Run("deterministic hint sets temperature to zero", func(t *testing.T) {
+		params := anthropicSDK.MessageNewParams{}
+		applySampling(&params, llm.LanguageModelConfig{Deterministic: true})
+		assert.Equal(t, anthropicSDK.F(0.0), params.Temperature)
+	})
+
+	t.Run("deterministic hint overrides the service temperature", func(t *testing.T) {
+		a := &Anthropic{sampling: llm.SamplingParameters{Temperature: &temperature}}
+
+		params := anthropicSDK.MessageNewParams{}
+		applySampling(&params, a.createConfig([]llm.LanguageModelOption{llm.WithDeterministicSampling()}))
+		assert.Equal(t, anthropicSDK.F(0.0), params.Temperature)
+
+		params = anthropicSDK.MessageNewParams{}
+		applySampling(&params, a.createConfig([]llm.LanguageModelOption{llm.WithTemperature(0.5), llm.WithDeterministicSampling()}))
+		assert.Equal(t, anthropicSDK.F(0.5), params.Temperature)
+	})
+}
@@ -7,11 +7,8 @@ import (
 	"fmt"
 	"net/http"
 
-	"errors"
-
 	"github.com/gin-gonic/gin"
 	"github.com/mattermost/mattermost-plugin-ai/server/llm"
-	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 )
 
@@ -24,11 +21,22 @@ const (
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
 	router := gin.Default()
 	router.Use(p.ginlogger)
+	router.Use(p.tracingMiddleware)
+	router.Use(p.rejectDuringShutdown)
 	router.Use(p.MattermostAuthorizationRequired)
 	router.Use(p.metricsMiddleware)
 
 	router.GET("/ai_threads", p.handleGetAIThreads)
 	router.GET("/ai_bots", p.handleGetAIBots)
+	router.POST("/feedback/ids", p.handleGetFeedbackForPosts)
+
+	threadRouter := router.Group("/ai_threads/:threadid")
+	threadRouter.Use(p.aiThreadAuthorizationRequired)
+	threadRouter.POST("/rename", p.handleRenameAIThread)
+	threadRouter.POST("/regenerate_title", p.handleRegenerateAIThreadTitle)
+	threadRouter.POST("/archive", p.handleArchiveAIThread)
+	threadRouter.POST("/unarchive", p.handleUnarchiveAIThread)
+	threadRouter.DELETE("", p.handleDeleteAIThread)
 
 	botRequiredRouter := router.Group("")
 	botRequiredRouter.Use(p.aiBotRequired)
@@ -41,7 +49,18 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 	postRouter.POST("/summarize_transcription", p.handleSummarizeTranscription)
 	postRouter.POST("/stop", p.handleStop)
 	postRouter.POST("/regenerate", p.handleRegenerate)
-	postRouter.POST("/postback_summary", p.handlePostbackSummary)
+	postRouter.POST("/continue", p.handleContinue)
+	postRouter.GET("/versions", p.handleGetResponseVersions)
+	postRouter.POST("/versions/:version/select", p.handleSelectResponseVersion)
+	postRouter.POST("/feedback", p.handleSaveFeedback)
+	postRouter.DELETE("/feedback", p.handleDeleteFeedback)
+	postRouter.GET("/postback", p.handleGetPostbackTarget)
+	postRouter.POST("/postback", p.handlePostback)
+	postRouter.POST("/postback_summary", p.handlePostback)
+	postRouter.GET("/export", p.handleExportThread)
+	postRouter.POST("/export/attach", p.handleAttachThreadExport)
+	postRouter.GET("/job", p.handleGetJob)
+	postRouter.POST("/job/cancel", p.handleCancelJob)
 
 	channelRouter := botRequiredRouter.Group("/channel/:channelid")
 	channelRouter.Use(p.channelAuthorizationRequired)
@@ -49,6 +68,15 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 
 	adminRouter := router.Group("/admin")
 	adminRouter.Use(p.mattermostAdminAuthorizationRequired)
+	adminRouter.GET("/audit_log", p.handleSearchAuditLog)
+	adminRouter.GET("/audit_log/export", p.handleExportAuditLog)
+	adminRouter.GET("/feedback/stats", p.handleGetFeedbackStats)
+	adminRouter.GET("/feedback/export", p.handleExportFeedback)
+	adminRouter.GET("/health", p.handleGetHealth)
+	adminRouter.GET("/health/bots/:botname", p.handleGetBotHealth)
+	adminRouter.POST("/health/test", p.handleTestBotConnection)
+	adminRouter.GET("/config/validation", p.handleGetConfigValidation)
+	adminRouter.POST("/config/validation", p.handleValidateConfig)
 
 	router.ServeHTTP(w, r)
 }
@@ -79,37 +107,6 @@ func (p *Plugin) MattermostAuthorizationRequired(c *gin.Context) {
 	}
 }
 
-func (p *Plugin) handleGetAIThreads(c *gin.Context) {
-	userID := c.GetHeader("Mattermost-User-Id")
-
-	p.botsLock.RLock()
-	defer p.botsLock.RUnlock()
-	dmChannelIDs := []string{}
-	for _, bot := range p.bots {
-		botDMChannel, err := p.pluginAPI.Channel.GetDirect(userID, bot.mmBot.UserId)
-		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get DM with AI bot: %w", err))
-			return
-		}
-
-		// Extra permissions checks are not totally necessary since a user should always have permission to read their own DMs
-		if !p.pluginAPI.User.HasPermissionToChannel(userID, botDMChannel.Id, model.PermissionReadChannel) {
-			c.AbortWithError(http.StatusForbidden, errors.New("user doesn't have permission to read channel"))
-			return
-		}
-
-		dmChannelIDs = append(dmChannelIDs, botDMChannel.Id)
-	}
-
-	threads, err := p.getAIThreads(dmChannelIDs)
-	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to get posts for bot DM: %w", err))
-		return
-	}
-
-	c.JSON(http.StatusOK, threads)
-}
-
 type AIBotInfo struct {
 	ID                 string                 `json:"id"`
 	DisplayName        string                 `json:"displayName"`
@@ -4,14 +4,29 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"errors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
+const (
+	auditLogDefaultPerPage   = 60
+	auditLogMaxPerPage       = 200
+	auditLogExportBatchSize  = 1000
+	auditLogExportFormatCSV  = "csv"
+	auditLogExportFormatJSON = "jsonl"
+)
+
 func (p *Plugin) mattermostAdminAuthorizationRequired(c *gin.Context) {
 	userID := c.GetHeader("Mattermost-User-Id")
 
@@ -20,3 +35,305 @@ func (p *Plugin) mattermostAdminAuthorizationRequired(c *gin.Context) {
 		return
 	}
 }
+
+func auditLogFilterFromQuery(c *gin.Context) (AuditLogFilter, error) {
+	filter := AuditLogFilter{
+		UserID:    c.Query("user_id"),
+		BotName:   c.Query("bot"),
+		ChannelID: c.Query("channel_id"),
+		Operation: c.Query("operation"),
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = strconv.ParseInt(since, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = strconv.ParseInt(until, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func (p *Plugin) handleSearchAuditLog(c *gin.Context) {
+	filter, err := auditLogFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+	if err != nil || page < 0 {
+		c.AbortWithError(http.StatusBadRequest, errors.New("invalid page"))
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(auditLogDefaultPerPage)))
+	if err != nil || perPage <= 0 || perPage > auditLogMaxPerPage {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("per_page must be between 1 and %d", auditLogMaxPerPage))
+		return
+	}
+
+	records, err := p.searchAuditLog(filter, page*perPage, perPage)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if records == nil {
+		records = []AuditRecord{}
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+func (p *Plugin) handleExportAuditLog(c *gin.Context) {
+	filter, err := auditLogFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	// Records saved during the export would shift the pages
+	if filter.Until == 0 {
+		filter.Until = model.GetMillis()
+	}
+
+	format := c.DefaultQuery("format", auditLogExportFormatJSON)
+	var write func(record AuditRecord) error
+	var flush func() error
+	switch format {
+	case auditLogExportFormatJSON:
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		write = func(record AuditRecord) error { return encoder.Encode(record) }
+		flush = func() error { return nil }
+	case auditLogExportFormatCSV:
+		c.Header("Content-Type", "text/csv")
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(auditRecordCSVHeader); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		write = func(record AuditRecord) error { return writer.Write(auditRecordCSVRow(record)) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("unsupported export format: %s", format))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"ai_audit_log_%s.%s\"", time.Now().UTC().Format("20060102T150405Z"), format))
+	c.Status(http.StatusOK)
+
+	for offset := 0; ; offset += auditLogExportBatchSize {
+		records, err := p.searchAuditLog(filter, offset, auditLogExportBatchSize)
+		if err != nil {
+			// The response has already started so the export can only be cut short.
+			p.pluginAPI.Log.Error("Failed to export audit log", "error", err)
+			return
+		}
+		for _, record := range records {
+			if err := write(record); err != nil {
+				p.pluginAPI.Log.Warn("Failed to write audit log export", "error", err)
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			p.pluginAPI.Log.Warn("Failed to write audit log export", "error", err)
+			return
+		}
+		if len(records) < auditLogExportBatchSize {
+			return
+		}
+	}
+}
+
+var auditRecordCSVHeader = []string{
+	"id", "create_at", "user_id", "bot_id", "bot_name", "channel_id", "post_id", "operation", "model",
+	"tools_used", "input_tokens", "output_tokens", "duration_ms", "status", "error_type", "prompt", "response",
+}
+
+func auditRecordCSVRow(record AuditRecord) []string {
+	row := []string{
+		record.ID,
+		strconv.FormatInt(record.CreateAt, 10),
+		record.UserID,
+		record.BotID,
+		record.BotName,
+		record.ChannelID,
+		record.PostID,
+		record.Operation,
+		record.Model,
+		record.ToolsUsed,
+		strconv.Itoa(record.InputTokens),
+		strconv.Itoa(record.OutputTokens),
+		strconv.FormatInt(record.DurationMs, 10),
+		record.Status,
+		record.ErrorType,
+		record.Prompt,
+		record.Response,
+	}
+	for i, cell := range row {
+		row[i] = escapeCSVFormula(cell)
+	}
+	return row
+}
+
+// escapeCSVFormula keeps spreadsheets from evaluating cells as formulas, since prompts and responses are
+// written by users and LLMs.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func feedbackFilterFromQuery(c *gin.Context) (FeedbackFilter, error) {
+	filter := FeedbackFilter{
+		BotName:        c.Query("bot"),
+		Model:          c.Query("model"),
+		PromptTemplate: c.Query("prompt_template"),
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = strconv.ParseInt(since, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = strconv.ParseInt(until, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func (p *Plugin) handleGetFeedbackStats(c *gin.Context) {
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	stats, err := p.getFeedbackStats(filter)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if stats == nil {
+		stats = []FeedbackStats{}
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleExportFeedback writes the feedback as JSON lines, each with the conversation up to the rated response.
+func (p *Plugin) handleExportFeedback(c *gin.Context) {
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	// Feedback updated during the export would be exported again at its new position
+	if filter.Until == 0 {
+		filter.Until = model.GetMillis()
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"ai_feedback_%s.jsonl\"", time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	var after *feedbackCursor
+	for {
+		// Conversations are only reused within a batch to bound the memory used by large exports.
+		threads := map[string]*ThreadExport{}
+		feedback, err := p.searchFeedback(filter, after, auditLogExportBatchSize)
+		if err != nil {
+			// The response has already started so the export can only be cut short.
+			p.pluginAPI.Log.Error("Failed to export feedback", "error", err)
+			return
+		}
+		for _, item := range feedback {
+			thread, ok := threads[item.RootID]
+			if !ok {
+				if thread, err = p.buildThreadExport(item.RootID); err != nil {
+					p.pluginAPI.Log.Warn("Unable to export conversation of feedback", "root_id", item.RootID, "error", err)
+				}
+				threads[item.RootID] = thread
+			}
+
+			record := FeedbackExportRecord{Feedback: item, Conversation: []ExportedMessage{}}
+			if thread != nil {
+				record.Conversation = feedbackConversation(thread, item.PostID)
+			}
+			if err := encoder.Encode(record); err != nil {
+				p.pluginAPI.Log.Warn("Failed to write feedback export", "error", err)
+				return
+			}
+		}
+		if len(feedback) < auditLogExportBatchSize {
+			return
+		}
+		after = feedback[len(feedback)-1].cursor()
+	}
+}
+
+func (p *Plugin) handleGetHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, p.checkHealth(c.Request.Context()))
+}
+
+func (p *Plugin) handleGetBotHealth(c *gin.Context) {
+	botConfig, err := p.GetBotConfig(c.Param("botname"))
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p.checkBotHealth(c.Request.Context(), botConfig))
+}
+
+// handleTestBotConnection checks a bot configuration before it is saved, for instance to try a new API key.
+func (p *Plugin) handleTestBotConnection(c *gin.Context) {
+	var botConfig llm.BotConfig
+	if err := json.NewDecoder(c.Request.Body).Decode(&botConfig); err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid bot configuration: %w", err))
+		return
+	}
+	if botConfig.Service.Type == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("the bot has no service type"))
+		return
+	}
+
+	c.JSON(http.StatusOK, p.checkBotHealth(c.Request.Context(), botConfig))
+}
+
+// handleGetConfigValidation validates the configuration saved in the server, which may have been rejected.
+func (p *Plugin) handleGetConfigValidation(c *gin.Context) {
+	var saved configuration
+	if err := p.API.LoadPluginConfiguration(&saved); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to load plugin configuration: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, validateConfig(saved.Config))
+}
+
+// handleValidateConfig validates a configuration before it is saved.
+func (p *Plugin) handleValidateConfig(c *gin.Context) {
+	var cfg Config
+	if err := json.NewDecoder(c.Request.Body).Decode(&cfg); err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid configuration: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, validateConfig(cfg))
+}
@@ -87,7 +87,7 @@ func (p *Plugin) handleSince(c *gin.Context) {
 
 	formattedThread := formatThread(threadData)
 
-	context := p.MakeConversationContext(bot, user, channel, nil)
+	context := p.MakeConversationContext(c.Request.Context(), bot, user, channel, nil)
 	context.PromptParameters = map[string]string{
 		"Posts": formattedThread,
 	}
@@ -113,7 +113,7 @@ func (p *Plugin) handleSince(c *gin.Context) {
 		return
 	}
 
-	resultStream, err := p.getLLM(bot.cfg).ChatCompletion(prompt)
+	resultStream, err := p.getLLM(bot.cfg).ChatCompletion(prompt, llm.WithTask(bot.cfg, llm.TaskThreadAnalysis))
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -121,6 +121,8 @@ func (p *Plugin) handleSince(c *gin.Context) {
 
 	post := &model.Post{}
 	post.AddProp(NoRegen, "true")
+	post.AddProp(ReferencedChannelIDProp, channel.Id)
+	post.AddProp(PromptTemplateProp, promptPreset)
 	if err := p.streamResultToNewDM(bot.mmBot.UserId, resultStream, user.Id, post); err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
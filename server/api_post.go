@@ -4,11 +4,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"errors"
 
@@ -62,7 +68,7 @@ func (p *Plugin) handleReact(c *gin.Context) {
 		return
 	}
 
-	conversationContext := p.MakeConversationContext(bot, user, channel, post)
+	conversationContext := p.MakeConversationContext(c.Request.Context(), bot, user, channel, post)
 	conversationContext.PromptParameters = map[string]string{"Message": post.Message}
 	prompt, err := p.prompts.ChatCompletion(llm.PromptEmojiSelect, conversationContext, llm.NewNoTools())
 	if err != nil {
@@ -70,7 +76,11 @@ func (p *Plugin) handleReact(c *gin.Context) {
 		return
 	}
 
-	emojiName, err := p.getLLM(bot.cfg).ChatCompletionNoStream(prompt, llm.WithMaxGeneratedTokens(25))
+	emojiName, err := p.getLLM(bot.cfg).ChatCompletionNoStream(prompt,
+		llm.WithTask(bot.cfg, llm.TaskEmoji),
+		llm.WithMaxGeneratedTokens(25),
+		llm.WithDeterministicSampling(),
+	)
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -137,7 +147,7 @@ func (p *Plugin) handleThreadAnalysis(c *gin.Context) {
 		return
 	}
 
-	createdPost, err := p.startNewAnalysisThread(bot, post.Id, data.AnalysisType, p.MakeConversationContext(bot, user, channel, nil))
+	createdPost, err := p.startNewAnalysisThread(bot, post.Id, data.AnalysisType, p.MakeConversationContext(c.Request.Context(), bot, user, channel, nil))
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to perform analysis: %w", err))
 		return
@@ -215,9 +225,13 @@ func (p *Plugin) handleSummarizeTranscription(c *gin.Context) {
 		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get calls user: %w", err))
 		return
 	}
-	if !targetPostUser.IsBot || (targetPostUser.Username != CallsBotUsername && targetPostUser.Username != ZoomBotUsername) {
-		c.AbortWithError(http.StatusBadRequest, errors.New("not a calls or zoom bot post"))
-		return
+	isMeetingBotPost := targetPostUser.IsBot && (targetPostUser.Username == CallsBotUsername || targetPostUser.Username == ZoomBotUsername)
+	if !isMeetingBotPost {
+		// Transcripts uploaded from other meeting tools
+		if _, err := p.getTranscriptFileID(post); err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("not a calls or zoom bot post and no transcript attached"))
+			return
+		}
 	}
 
 	createdPost, err := p.newCallTranscriptionSummaryThread(bot, user, post, channel)
@@ -238,6 +252,49 @@ func (p *Plugin) handleSummarizeTranscription(c *gin.Context) {
 	c.Render(http.StatusOK, render.JSON{Data: data})
 }
 
+func (p *Plugin) handleGetJob(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	job, err := p.getLatestJobForPost(post.Id)
+	if errors.Is(err, ErrJobNotFound) {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+func (p *Plugin) handleCancelJob(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	job, err := p.getLatestJobForPost(post.Id)
+	if errors.Is(err, ErrJobNotFound) {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if job.UserID != userID {
+		c.AbortWithError(http.StatusForbidden, errors.New("only the requesting user can cancel the job"))
+		return
+	}
+
+	if err := p.jobQueue.Cancel(job); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
 func (p *Plugin) handleStop(c *gin.Context) {
 	userID := c.GetHeader("Mattermost-User-Id")
 	post := c.MustGet(ContextPostKey).(*model.Post)
@@ -282,37 +339,47 @@ func (p *Plugin) handleRegenerate(c *gin.Context) {
 		return
 	}
 
-	if err := p.regeneratePost(bot, post, user, channel); err != nil {
+	if err := p.regeneratePost(c.Request.Context(), bot, post, user, channel); err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 }
 
-func (p *Plugin) regeneratePost(bot *Bot, post *model.Post, user *model.User, channel *model.Channel) error {
+func (p *Plugin) regeneratePost(requestCtx context.Context, bot *Bot, post *model.Post, user *model.User, channel *model.Channel) error {
 	ctx, err := p.getPostStreamingContext(context.Background(), post.Id)
 	if err != nil {
 		return err
 	}
 	defer p.finishPostStreaming(post.Id)
 
+	// The response is kept as it was displayed, including how it ended.
+	if err = p.startResponseVersion(post); err != nil {
+		return err
+	}
+	clearPostInterrupted(post)
+	post.DelProp(ModeratedProp)
+
 	threadIDProp := post.GetProp(ThreadIDProp)
 	analysisTypeProp := post.GetProp(AnalysisTypeProp)
 	referenceRecordingFileIDProp := post.GetProp(ReferencedRecordingFileID)
 	referencedTranscriptPostProp := post.GetProp(ReferencedTranscriptPostID)
 	var result *llm.TextStreamResult
+	task := llm.TaskChat
 	switch {
 	case threadIDProp != nil:
+		task = llm.TaskThreadAnalysis
 		threadID := threadIDProp.(string)
 		analysisType := analysisTypeProp.(string)
 		siteURL := p.API.GetConfig().ServiceSettings.SiteURL
 		post.Message = p.analysisPostMessage(user.Locale, threadID, analysisType, *siteURL)
 
 		var err error
-		result, err = p.analyzeThread(bot, threadID, analysisType, p.MakeConversationContext(bot, user, channel, nil))
+		result, err = p.analyzeThread(bot, threadID, analysisType, p.MakeConversationContext(requestCtx, bot, user, channel, nil))
 		if err != nil {
 			return fmt.Errorf("could not summarize post on regen: %w", err)
 		}
 	case referenceRecordingFileIDProp != nil:
+		task = llm.TaskFinalSummary
 		post.Message = ""
 		referencedRecordingFileID := referenceRecordingFileIDProp.(string)
 
@@ -339,12 +406,13 @@ func (p *Plugin) regeneratePost(bot *Bot, post *model.Post, user *model.User, ch
 			return fmt.Errorf("could not get channel of original recording on regen: %w", err)
 		}
 
-		context := p.MakeConversationContext(bot, user, originalFileChannel, nil)
+		context := p.MakeConversationContext(requestCtx, bot, user, originalFileChannel, nil)
 		result, err = p.summarizeTranscription(bot, transcription, context)
 		if err != nil {
 			return fmt.Errorf("could not summarize transcription on regen: %w", err)
 		}
 	case referencedTranscriptPostProp != nil:
+		task = llm.TaskFinalSummary
 		post.Message = ""
 		referencedTranscriptionPostID := referencedTranscriptPostProp.(string)
 		referencedTranscriptionPost, err := p.pluginAPI.Post.GetPost(referencedTranscriptionPostID)
@@ -352,7 +420,7 @@ func (p *Plugin) regeneratePost(bot *Bot, post *model.Post, user *model.User, ch
 			return fmt.Errorf("could not get transcription post on regen: %w", err)
 		}
 
-		transcriptionFileID, err := getCaptionsFileIDFromProps(referencedTranscriptionPost)
+		transcriptionFileID, err := p.getTranscriptFileID(referencedTranscriptionPost)
 		if err != nil {
 			return fmt.Errorf("unable to get transcription file id: %w", err)
 		}
@@ -361,12 +429,12 @@ func (p *Plugin) regeneratePost(bot *Bot, post *model.Post, user *model.User, ch
 			return fmt.Errorf("unable to read calls file: %w", err)
 		}
 
-		transcription, err := subtitles.NewSubtitlesFromVTT(transcriptionFileReader)
+		transcription, err := parseTranscription(referencedTranscriptionPost, transcriptionFileReader)
 		if err != nil {
 			return fmt.Errorf("unable to parse transcription file: %w", err)
 		}
 
-		context := p.MakeConversationContext(bot, user, channel, nil)
+		context := p.MakeConversationContext(requestCtx, bot, user, channel, nil)
 		result, err = p.summarizeTranscription(bot, transcription, context)
 		if err != nil {
 			return fmt.Errorf("unable to summarize transcription: %w", err)
@@ -386,28 +454,31 @@ func (p *Plugin) regeneratePost(bot *Bot, post *model.Post, user *model.User, ch
 			threadData.cutoffAtPostID(respondingToPostID)
 		}
 		postToRegenerate := threadData.latestPost()
-		context := p.MakeConversationContext(bot, user, channel, postToRegenerate)
+		context := p.MakeConversationContext(requestCtx, bot, user, channel, postToRegenerate)
 
 		if result, err = p.continueConversation(bot, threadData, context); err != nil {
 			return fmt.Errorf("could not continue conversation on regen: %w", err)
 		}
 	}
 
+	locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
 	if channel.Type == model.ChannelTypeDirect {
 		if channel.Name == bot.mmBot.UserId+"__"+user.Id || channel.Name == user.Id+"__"+bot.mmBot.UserId {
-			p.streamResultToPost(ctx, result, post, user.Locale)
-			return nil
+			locale = user.Locale
 		}
 	}
 
-	p.streamResultToPost(ctx, result, post, *p.API.GetConfig().LocalizationSettings.DefaultServerLocale)
+	// Streaming failures are shown on the post, the version records how the generation ended.
+	streamErr := p.streamResultToPost(ctx, result, post, locale)
+	p.saveDisplayedResponseVersion(post, generatedModel(result, bot.cfg, task), streamErr, user.Id)
 
 	return nil
 }
 
-func (p *Plugin) handlePostbackSummary(c *gin.Context) {
+func (p *Plugin) handleContinue(c *gin.Context) {
 	userID := c.GetHeader("Mattermost-User-Id")
 	post := c.MustGet(ContextPostKey).(*model.Post)
+	channel := c.MustGet(ContextChannelKey).(*model.Channel)
 
 	bot := p.GetBotByID(post.UserId)
 	if bot == nil {
@@ -416,52 +487,495 @@ func (p *Plugin) handlePostbackSummary(c *gin.Context) {
 	}
 
 	if post.GetProp(LLMRequesterUserID) != userID {
-		c.AbortWithError(http.StatusForbidden, errors.New("only the original requester can post back"))
+		c.AbortWithError(http.StatusForbidden, errors.New("only the original poster can continue"))
 		return
 	}
 
-	transcriptThreadRootPost, err := p.pluginAPI.Post.GetPost(post.RootId)
+	interrupted, _ := post.GetProp(StreamInterruptedProp).(string)
+	if interrupted == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("post was not interrupted"))
+		return
+	}
+
+	user, err := p.pluginAPI.User.Get(userID)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get transcript thread root post: %w", err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Only plain conversations can pick up from a partial response, everything else starts over.
+	isConversation := post.GetProp(ThreadIDProp) == nil &&
+		post.GetProp(ReferencedRecordingFileID) == nil &&
+		post.GetProp(ReferencedTranscriptPostID) == nil
+	if interrupted != StreamInterruptedPartial || !isConversation {
+		if post.GetProp(NoRegen) != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("taged no regen"))
+			return
+		}
+		if err := p.regeneratePost(c.Request.Context(), bot, post, user, channel); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
 		return
 	}
 
-	originalTranscriptPostID, ok := transcriptThreadRootPost.GetProp(ReferencedTranscriptPostID).(string)
-	if !ok || originalTranscriptPostID == "" {
-		c.AbortWithError(http.StatusBadRequest, errors.New("post missing reference to transcription post ID"))
+	if err := p.continuePost(c.Request.Context(), bot, post, user, channel); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+}
+
+// continuePost asks the LLM to carry on from the partial response of an interrupted post.
+func (p *Plugin) continuePost(requestCtx context.Context, bot *Bot, post *model.Post, user *model.User, channel *model.Channel) error {
+	ctx, err := p.getPostStreamingContext(context.Background(), post.Id)
+	if err != nil {
+		return err
+	}
+	defer p.finishPostStreaming(post.Id)
+
+	clearPostInterrupted(post)
+	post.DelProp(ModeratedProp)
+
+	threadData, err := p.getThreadAndMeta(post.Id)
+	if err != nil {
+		return err
+	}
+	threadData.cutoffAtPostID(post.Id)
+	if len(threadData.Posts) < 2 {
+		return errors.New("nothing to continue from")
+	}
+	threadData.Posts[len(threadData.Posts)-1].Message = post.Message
+	requestPost := threadData.Posts[len(threadData.Posts)-2]
+
+	T := i18nLocalizerFunc(p.i18n, user.Locale)
+	threadData.Posts = append(threadData.Posts, &model.Post{
+		UserId:  user.Id,
+		Message: T("copilot.continue_interrupted_request", "Your previous response was cut off. Continue it exactly where it stopped, without repeating anything."),
+	})
+
+	context := p.MakeConversationContext(requestCtx, bot, user, channel, requestPost)
+	result, err := p.continueConversation(bot, threadData, context)
+	if err != nil {
+		return fmt.Errorf("could not continue conversation: %w", err)
+	}
 
-	transcriptionPost, err := p.pluginAPI.Post.GetPost(originalTranscriptPostID)
+	// Streaming failures are shown on the post, the version records how the generation ended.
+	streamErr := p.streamResultToPost(ctx, result, post, user.Locale)
+	p.saveDisplayedResponseVersion(post, generatedModel(result, bot.cfg, llm.TaskChat), streamErr, user.Id)
+
+	return nil
+}
+
+func (p *Plugin) handleGetResponseVersions(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	versions, err := p.getResponseVersions(post.Id)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get transcription post: %w", err))
+		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+	if versions == nil {
+		versions = []ResponseVersion{}
+	}
 
-	if !p.pluginAPI.User.HasPermissionToChannel(userID, transcriptionPost.ChannelId, model.PermissionCreatePost) {
-		c.AbortWithError(http.StatusForbidden, errors.New("user doesn't have permission to create a post in the transcript channel"))
+	c.JSON(http.StatusOK, struct {
+		Selected int               `json:"selected"`
+		Versions []ResponseVersion `json:"versions"`
+	}{
+		Selected: responseVersionOf(post),
+		Versions: versions,
+	})
+}
+
+// handleSelectResponseVersion displays another version of a regenerated response. The conversation
+// continues from the displayed version.
+func (p *Plugin) handleSelectResponseVersion(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if post.GetProp(LLMRequesterUserID) != userID {
+		c.AbortWithError(http.StatusForbidden, errors.New("only the original poster can select a version"))
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid version: %w", err))
+		return
+	}
+
+	version, err := p.getResponseVersion(post.Id, versionNumber)
+	if errors.Is(err, errResponseVersionNotFound) {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Holding the streaming context keeps a regeneration from writing to the post at the same time.
+	if _, err = p.getPostStreamingContext(context.Background(), post.Id); err != nil {
+		c.AbortWithError(http.StatusConflict, err)
+		return
+	}
+	defer p.finishPostStreaming(post.Id)
+
+	countProp, _ := post.GetProp(ResponseVersionCountProp).(string)
+	versionCount, _ := strconv.Atoi(countProp)
+	clearPostInterrupted(post)
+	post.Message = version.Message
+	post.DelProp(ModeratedProp)
+	if version.Status == ResponseVersionStatusModerated {
+		post.AddProp(ModeratedProp, "true")
+	}
+	setResponseVersion(post, version.Version, max(versionCount, version.Version))
+	if err = p.pluginAPI.Post.UpdatePost(post); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to update post: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// handleGetFeedback returns the rating the user gave to the response, with an empty rating if there is none.
+// feedbackMaxPostIDs bounds the number of responses whose feedback is requested at once.
+const feedbackMaxPostIDs = 200
+
+// handleGetFeedbackForPosts returns the ratings of the user on the given responses, so clients showing a
+// list of posts make one request. Responses the user didn't rate are left out.
+func (p *Plugin) handleGetFeedbackForPosts(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+
+	var data struct {
+		PostIDs []string `json:"post_ids" binding:"required"`
+	}
+	if bindErr := c.ShouldBindJSON(&data); bindErr != nil {
+		c.AbortWithError(http.StatusBadRequest, bindErr)
+		return
+	}
+	if len(data.PostIDs) > feedbackMaxPostIDs {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("at most %d posts can be requested at once", feedbackMaxPostIDs))
+		return
+	}
+
+	feedback, err := p.getUserFeedback(userID, data.PostIDs)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	type postFeedback struct {
+		Rating  string `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	result := make(map[string]postFeedback, len(feedback))
+	for _, f := range feedback {
+		result[f.PostID] = postFeedback{Rating: f.Rating, Comment: f.Comment}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (p *Plugin) handleSaveFeedback(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	bot := p.GetBotByID(post.UserId)
+	if bot == nil {
+		c.AbortWithError(http.StatusBadRequest, errors.New("only bot responses can be rated"))
+		return
+	}
+
+	var data struct {
+		Rating  string `json:"rating" binding:"required"`
+		Comment string `json:"comment"`
+	}
+	if bindErr := c.ShouldBindJSON(&data); bindErr != nil {
+		c.AbortWithError(http.StatusBadRequest, bindErr)
+		return
+	}
+	if data.Rating != FeedbackRatingUp && data.Rating != FeedbackRatingDown {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("rating must be %q or %q", FeedbackRatingUp, FeedbackRatingDown))
+		return
+	}
+	comment := strings.TrimSpace(data.Comment)
+	if utf8.RuneCountInString(comment) > feedbackCommentMaxLength {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("comment must be at most %d characters", feedbackCommentMaxLength))
 		return
 	}
 
-	postedSummary := &model.Post{
+	feedback, err := p.newFeedback(bot, post, userID, data.Rating, comment)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	previous, err := p.getFeedback(post.Id, userID)
+	if err != nil && !errors.Is(err, errFeedbackNotFound) {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = p.saveFeedback(feedback); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Only count changes of rating, editing the comment isn't new feedback. The metric counts rating
+	// events, the current ratings come from the feedback stats.
+	if previous.Rating != feedback.Rating {
+		p.metricsService.GetMetricsForAIService(bot.cfg.Name, bot.cfg.Service.Type).IncrementFeedback(feedback.Model, feedback.Rating)
+	}
+}
+
+func (p *Plugin) handleDeleteFeedback(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if err := p.deleteFeedback(post.Id, userID); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// postbackSourceRequired only lets the user who requested a response in their DM with a bot share it.
+func (p *Plugin) postbackSourceRequired(c *gin.Context) (*Bot, bool) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+	channel := c.MustGet(ContextChannelKey).(*model.Channel)
+
+	bot := p.GetBotForDMChannel(channel)
+	if bot == nil || bot.mmBot.UserId != post.UserId {
+		c.AbortWithError(http.StatusBadRequest, errors.New("only bot responses in a DM with the bot can be posted back"))
+		return nil, false
+	}
+
+	if post.GetProp(LLMRequesterUserID) != userID {
+		c.AbortWithError(http.StatusForbidden, errors.New("only the original requester can post back"))
+		return nil, false
+	}
+
+	return bot, true
+}
+
+func (p *Plugin) handleGetPostbackTarget(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if _, ok := p.postbackSourceRequired(c); !ok {
+		return
+	}
+
+	target, err := p.defaultPostbackTarget(post)
+	if err != nil && !errors.Is(err, errNoDefaultPostbackTarget) {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// handlePostback shares a bot response to a channel or thread, by default the one the response is about.
+func (p *Plugin) handlePostback(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	bot, ok := p.postbackSourceRequired(c)
+	if !ok {
+		return
+	}
+
+	var data struct {
+		ChannelID string `json:"channel_id"`
+		RootID    string `json:"root_id"`
+		Message   string `json:"message"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	defer c.Request.Body.Close()
+
+	var target PostbackTarget
+	var err error
+	if data.ChannelID == "" && data.RootID == "" {
+		target, err = p.defaultPostbackTarget(post)
+	} else {
+		target, err = p.requestedPostbackTarget(data.ChannelID, data.RootID)
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid post back target: %w", err))
+		return
+	}
+
+	if !p.pluginAPI.User.HasPermissionToChannel(userID, target.ChannelID, model.PermissionCreatePost) {
+		c.AbortWithError(http.StatusForbidden, errors.New("user doesn't have permission to create a post in the target channel"))
+		return
+	}
+
+	targetChannel, err := p.pluginAPI.Channel.Get(target.ChannelID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get target channel: %w", err))
+		return
+	}
+	if err = p.checkUsageRestrictions(userID, bot, targetChannel); err != nil {
+		c.AbortWithError(http.StatusForbidden, err)
+		return
+	}
+
+	message := post.Message
+	if edited := strings.TrimSpace(data.Message); edited != "" {
+		message = edited
+	}
+	edited := message != post.Message
+
+	postback := &model.Post{
 		UserId:    bot.mmBot.UserId,
-		ChannelId: transcriptionPost.ChannelId,
-		RootId:    transcriptionPost.RootId,
-		Message:   post.Message,
-		Type:      "custom_llm_postback",
+		ChannelId: target.ChannelID,
+		RootId:    target.RootID,
+		Message:   message,
+		Type:      PostbackPostType,
+	}
+	postback.AddProp(PostbackUserIDProp, userID)
+	postback.AddProp(PostbackSourcePostIDProp, post.Id)
+	if edited {
+		postback.AddProp(PostbackEditedProp, "true")
+	}
+
+	if err = p.moderatePostback(post, postback, userID); err != nil {
+		if errors.Is(err, errPostbackModerated) || errors.Is(err, errPostbackFlagged) {
+			c.AbortWithError(http.StatusForbidden, err)
+			return
+		}
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err := p.pluginAPI.User.Get(userID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get user: %w", err))
+		return
 	}
-	postedSummary.AddProp("userid", userID)
-	if err := p.pluginAPI.Post.CreatePost(postedSummary); err != nil {
-		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to post back summary: %w", err))
+	T := i18nLocalizerFunc(p.i18n, user.Locale)
+	postback.Message = postbackMessage(T, message, bot.mmBot.Username, user.Username, edited)
+	if utf8.RuneCountInString(postback.Message) > model.PostMessageMaxRunesV2 {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("message must be at most %d characters", model.PostMessageMaxRunesV2))
 		return
 	}
 
-	data := struct {
-		PostID    string `json:"rootid"`
+	if err = p.pluginAPI.Post.CreatePost(postback); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to post back: %w", err))
+		return
+	}
+
+	rootID := postback.RootId
+	if rootID == "" {
+		rootID = postback.Id
+	}
+	result := struct {
+		PostID    string `json:"postid"`
+		RootID    string `json:"rootid"`
 		ChannelID string `json:"channelid"`
 	}{
-		PostID:    postedSummary.RootId,
-		ChannelID: postedSummary.ChannelId,
+		PostID:    postback.Id,
+		RootID:    rootID,
+		ChannelID: postback.ChannelId,
 	}
-	c.Render(http.StatusOK, render.JSON{Data: data})
+	c.Render(http.StatusOK, render.JSON{Data: result})
+}
+
+// threadExportFromRequest builds the export of the thread of the post in the context.
+func (p *Plugin) threadExportFromRequest(c *gin.Context, format string) (*ThreadExport, []byte, bool) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if _, ok := threadExportContentTypes[format]; !ok {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid format %q", format))
+		return nil, nil, false
+	}
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+
+	export, err := p.buildThreadExport(rootID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to export conversation: %w", err))
+		return nil, nil, false
+	}
+	data, err := export.Render(format)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to export conversation: %w", err))
+		return nil, nil, false
+	}
+
+	return export, data, true
+}
+
+func (p *Plugin) handleExportThread(c *gin.Context) {
+	format := c.DefaultQuery("format", ThreadExportFormatMarkdown)
+	export, data, ok := p.threadExportFromRequest(c, format)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.Filename(format)}))
+	c.Data(http.StatusOK, threadExportContentTypes[format], data)
+}
+
+// handleAttachThreadExport has the bot send the export to the user in their DM.
+func (p *Plugin) handleAttachThreadExport(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	bot := c.MustGet(ContextBotKey).(*Bot)
+
+	var data struct {
+		Format string `json:"format"`
+	}
+	if bindErr := c.ShouldBindJSON(&data); bindErr != nil {
+		c.AbortWithError(http.StatusBadRequest, bindErr)
+		return
+	}
+	if data.Format == "" {
+		data.Format = ThreadExportFormatMarkdown
+	}
+
+	export, exported, ok := p.threadExportFromRequest(c, data.Format)
+	if !ok {
+		return
+	}
+
+	user, err := p.pluginAPI.User.Get(userID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dmChannel, err := p.pluginAPI.Channel.GetDirect(userID, bot.mmBot.UserId)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get DM with AI bot: %w", err))
+		return
+	}
+
+	fileInfo, err := p.pluginAPI.File.Upload(bytes.NewReader(exported), export.Filename(data.Format), dmChannel.Id)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to upload export: %w", err))
+		return
+	}
+
+	T := i18nLocalizerFunc(p.i18n, user.Locale)
+	exportPost := &model.Post{
+		ChannelId: dmChannel.Id,
+		Message:   T("copilot.export_attached", "Here is the export of the conversation \"%s\".", export.DisplayTitle()),
+		FileIds:   []string{fileInfo.Id},
+	}
+	exportPost.AddProp(NoRegen, "true")
+	if err := p.botCreatePost(bot.mmBot.UserId, userID, exportPost); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to post export: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, struct {
+		PostID    string `json:"postid"`
+		ChannelID string `json:"channelid"`
+	}{
+		PostID:    exportPost.Id,
+		ChannelID: exportPost.ChannelId,
+	})
 }
@@ -30,6 +30,13 @@ func TestPostRouter(t *testing.T) {
 		"summarize_transcription": "/post/postid/summarize_transcription",
 		"stop":                    "/post/postid/stop",
 		"regenerate":              "/post/postid/regenerate",
+		"cancel_job":              "/post/postid/job/cancel",
+		"continue":                "/post/postid/continue",
+		"select_version":          "/post/postid/versions/2/select",
+		"feedback":                "/post/postid/feedback",
+		"export_attach":           "/post/postid/export/attach",
+		"postback":                "/post/postid/postback",
+		"postback_summary":        "/post/postid/postback_summary",
 	} {
 		for name, test := range map[string]struct {
 			request        *http.Request
@@ -100,7 +107,13 @@ func TestAdminRouter(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DefaultWriter = io.Discard
 
-	for urlName, url := range map[string]string{} {
+	for urlName, url := range map[string]string{
+		"health":            "/admin/health",
+		"bot health":        "/admin/health/bots/ai",
+		"config validation": "/admin/config/validation",
+		"feedback stats":    "/admin/feedback/stats",
+		"feedback export":   "/admin/feedback/export",
+	} {
 		for name, test := range map[string]struct {
 			request        *http.Request
 			expectedStatus int
@@ -204,3 +217,62 @@ func TestChannelRouter(t *testing.T) {
 		}
 	}
 }
+
+func TestAIThreadRouter(t *testing.T) {
+	// This just makes gin not output a whole bunch of debug stuff.
+	// maybe pipe this to the test log?
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+
+	for urlName, request := range map[string]struct {
+		method string
+		url    string
+	}{
+		"rename":           {method: http.MethodPost, url: "/ai_threads/postid/rename"},
+		"regenerate title": {method: http.MethodPost, url: "/ai_threads/postid/regenerate_title"},
+		"archive":          {method: http.MethodPost, url: "/ai_threads/postid/archive"},
+		"unarchive":        {method: http.MethodPost, url: "/ai_threads/postid/unarchive"},
+		"delete":           {method: http.MethodDelete, url: "/ai_threads/postid"},
+	} {
+		for name, test := range map[string]struct {
+			post           *model.Post
+			channel        *model.Channel
+			expectedStatus int
+		}{
+			"not a bot DM": {
+				post:           &model.Post{Id: "postid", ChannelId: "channelid"},
+				channel:        &model.Channel{Id: "channelid", Type: model.ChannelTypeOpen, TeamId: "teamid"},
+				expectedStatus: http.StatusForbidden,
+			},
+			"bot DM of another user": {
+				post:           &model.Post{Id: "postid", ChannelId: "channelid"},
+				channel:        &model.Channel{Id: "channelid", Type: model.ChannelTypeDirect, Name: model.GetDMNameFromIds("someoneelse", "botid")},
+				expectedStatus: http.StatusForbidden,
+			},
+			"reply instead of a conversation": {
+				post:           &model.Post{Id: "postid", ChannelId: "channelid", RootId: "rootid"},
+				channel:        &model.Channel{Id: "channelid", Type: model.ChannelTypeDirect, Name: model.GetDMNameFromIds("userid", "botid")},
+				expectedStatus: http.StatusBadRequest,
+			},
+		} {
+			t.Run(urlName+" "+name, func(t *testing.T) {
+				e := SetupTestEnvironment(t)
+				defer e.Cleanup(t)
+
+				e.plugin.setConfiguration(makeConfig(Config{}))
+				e.plugin.bots = []*Bot{NewBot(llm.BotConfig{Name: "permtest"}, &model.Bot{UserId: "botid"})}
+
+				e.mockAPI.On("GetPost", "postid").Return(test.post, nil)
+				e.mockAPI.On("GetChannel", "channelid").Return(test.channel, nil).Maybe()
+				e.mockAPI.On("LogError", mock.Anything).Maybe()
+
+				req := httptest.NewRequest(request.method, request.url, nil)
+				req.Header.Add("Mattermost-User-ID", "userid")
+				recorder := httptest.NewRecorder()
+				e.plugin.ServeHTTP(&plugin.Context{}, recorder, req)
+				resp := recorder.Result()
+				require.Equal(t, test.expectedStatus, resp.StatusCode)
+			})
+		}
+	}
+}
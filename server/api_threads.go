@@ -0,0 +1,242 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost-plugin-ai/server/mmapi"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	aiThreadsDefaultPerPage = 60
+	aiThreadsMaxPerPage     = 200
+	aiThreadTitleMaxLength  = 256
+)
+
+// AIThreadsPage is a page of conversations. NextCursor is empty on the last page.
+type AIThreadsPage struct {
+	Threads    []AIThread `json:"threads"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+func aiThreadFilterFromQuery(c *gin.Context) (AIThreadFilter, error) {
+	filter := AIThreadFilter{
+		Search: strings.TrimSpace(c.Query("search")),
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = strconv.ParseInt(since, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = strconv.ParseInt(until, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if archived := c.Query("archived"); archived != "" {
+		if filter.Archived, err = strconv.ParseBool(archived); err != nil {
+			return filter, fmt.Errorf("invalid archived: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func (p *Plugin) handleGetAIThreads(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+
+	filter, err := aiThreadFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(aiThreadsDefaultPerPage)))
+	if err != nil || perPage <= 0 || perPage > aiThreadsMaxPerPage {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("per_page must be between 1 and %d", aiThreadsMaxPerPage))
+		return
+	}
+
+	var after *aiThreadCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		parsed, parseErr := parseAIThreadCursor(cursor)
+		if parseErr != nil {
+			c.AbortWithError(http.StatusBadRequest, parseErr)
+			return
+		}
+		after = &parsed
+	}
+
+	botUsername := c.Query("bot")
+
+	p.botsLock.RLock()
+	defer p.botsLock.RUnlock()
+	dmChannelIDs := []string{}
+	for _, bot := range p.bots {
+		if botUsername != "" && bot.mmBot.Username != botUsername {
+			continue
+		}
+
+		botDMChannel, err := p.pluginAPI.Channel.GetDirect(userID, bot.mmBot.UserId)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("unable to get DM with AI bot: %w", err))
+			return
+		}
+
+		// Extra permissions checks are not totally necessary since a user should always have permission to read their own DMs
+		if !p.pluginAPI.User.HasPermissionToChannel(userID, botDMChannel.Id, model.PermissionReadChannel) {
+			c.AbortWithError(http.StatusForbidden, errors.New("user doesn't have permission to read channel"))
+			return
+		}
+
+		dmChannelIDs = append(dmChannelIDs, botDMChannel.Id)
+	}
+	filter.ChannelIDs = dmChannelIDs
+
+	page := AIThreadsPage{Threads: []AIThread{}}
+	if len(dmChannelIDs) == 0 {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	// One extra conversation tells whether there is another page.
+	threads, err := p.getAIThreads(filter, after, perPage+1)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to get posts for bot DM: %w", err))
+		return
+	}
+	if len(threads) > perPage {
+		threads = threads[:perPage]
+		last := threads[len(threads)-1]
+		page.NextCursor = aiThreadCursor{CreateAt: last.CreateAt, ID: last.ID}.String()
+	}
+	if threads != nil {
+		page.Threads = threads
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// aiThreadAuthorizationRequired only lets users manage the conversations of their own DMs with the bots.
+func (p *Plugin) aiThreadAuthorizationRequired(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	threadID := c.Param("threadid")
+
+	post, err := p.pluginAPI.Post.GetPost(threadID)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, fmt.Errorf("unable to get conversation: %w", err))
+		return
+	}
+	if post.RootId != "" || post.DeleteAt != 0 {
+		c.AbortWithError(http.StatusBadRequest, errors.New("post is not the start of a conversation"))
+		return
+	}
+	c.Set(ContextPostKey, post)
+
+	channel, err := p.pluginAPI.Channel.Get(post.ChannelId)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Set(ContextChannelKey, channel)
+
+	bot := p.GetBotForDMChannel(channel)
+	if bot == nil || !mmapi.IsDMWith(userID, channel) {
+		c.AbortWithError(http.StatusForbidden, errors.New("conversation is not in a DM between the user and a bot"))
+		return
+	}
+	c.Set(ContextBotKey, bot)
+}
+
+func (p *Plugin) handleRenameAIThread(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	var data struct {
+		Title string `json:"title" binding:"required"`
+	}
+	if bindErr := c.ShouldBindJSON(&data); bindErr != nil {
+		c.AbortWithError(http.StatusBadRequest, bindErr)
+		return
+	}
+
+	title := strings.TrimSpace(data.Title)
+	if title == "" || utf8.RuneCountInString(title) > aiThreadTitleMaxLength {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("title must be between 1 and %d characters", aiThreadTitleMaxLength))
+		return
+	}
+
+	if err := p.saveTitle(post.Id, title); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to save title: %w", err))
+		return
+	}
+}
+
+func (p *Plugin) handleRegenerateAIThreadTitle(c *gin.Context) {
+	userID := c.GetHeader("Mattermost-User-Id")
+	post := c.MustGet(ContextPostKey).(*model.Post)
+	channel := c.MustGet(ContextChannelKey).(*model.Channel)
+	bot := c.MustGet(ContextBotKey).(*Bot)
+
+	user, err := p.pluginAPI.User.Get(userID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	context := p.MakeConversationContext(c.Request.Context(), bot, user, channel, post)
+	title, err := p.generateTitle(bot, conversationTitleRequest(post.Message), context)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to regenerate title: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, struct {
+		Title string `json:"title"`
+	}{
+		Title: title,
+	})
+}
+
+func (p *Plugin) handleArchiveAIThread(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if err := p.setThreadArchived(post.Id, true); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to archive conversation: %w", err))
+		return
+	}
+}
+
+func (p *Plugin) handleUnarchiveAIThread(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if err := p.setThreadArchived(post.Id, false); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to unarchive conversation: %w", err))
+		return
+	}
+}
+
+// handleDeleteAIThread deletes the root post, which deletes the replies with it.
+func (p *Plugin) handleDeleteAIThread(c *gin.Context) {
+	post := c.MustGet(ContextPostKey).(*model.Post)
+
+	if err := p.pluginAPI.Post.DeletePost(post.Id); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to delete conversation: %w", err))
+		return
+	}
+
+	if err := p.deleteThreadMeta(post.Id); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to delete conversation metadata: %w", err))
+		return
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIThreadCursor(t *testing.T) {
+	cursor := aiThreadCursor{CreateAt: 1700000000000, ID: model.NewId()}
+
+	parsed, err := parseAIThreadCursor(cursor.String())
+	require.NoError(t, err)
+	require.Equal(t, cursor, parsed)
+
+	for _, invalid := range []string{"", "not base64!", aiThreadCursor{CreateAt: 1, ID: "short"}.String(), "MTIzNA"} {
+		_, err := parseAIThreadCursor(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -4,6 +4,9 @@
 package asksage
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -17,6 +20,7 @@ type AskSage struct {
 	inputTokenLimit  int
 	metric           metrics.LLMetrics
 	outputTokenLimit int
+	sampling         llm.SamplingParameters
 }
 
 func New(llmService llm.ServiceConfig, httpClient *http.Client, metric metrics.LLMetrics) *AskSage {
@@ -34,6 +38,7 @@ func New(llmService llm.ServiceConfig, httpClient *http.Client, metric metrics.L
 		inputTokenLimit:  llmService.InputTokenLimit,
 		metric:           metric,
 		outputTokenLimit: llmService.OutputTokenLimit,
+		sampling:         llmService.SamplingParameters,
 	}
 }
 
@@ -60,6 +65,7 @@ func (s *AskSage) GetDefaultConfig() llm.LanguageModelConfig {
 	return llm.LanguageModelConfig{
 		Model:              s.defaultModel,
 		MaxGeneratedTokens: s.outputTokenLimit,
+		SamplingParameters: s.sampling,
 	}
 }
 
@@ -71,10 +77,22 @@ func (s *AskSage) createConfig(opts []llm.LanguageModelOption) llm.LanguageModel
 	return cfg
 }
 
-func (s *AskSage) queryParamsFromConfig(cfg llm.LanguageModelConfig) QueryParams {
-	return QueryParams{
+func (s *AskSage) queryParamsFromConfig(cfg llm.LanguageModelConfig) (QueryParams, error) {
+	cfg.ApplyDeterministicSampling(nil)
+
+	// Ask Sage only exposes temperature.
+	if cfg.TopP != nil || cfg.Seed != nil || len(cfg.StopSequences) > 0 {
+		return QueryParams{}, fmt.Errorf("ask sage only supports the temperature sampling parameter: %w", llm.ErrUnsupportedSamplingParameter)
+	}
+
+	params := QueryParams{
 		Model: cfg.Model,
 	}
+	if cfg.Temperature != nil {
+		params.Temperature = float64(*cfg.Temperature)
+	}
+
+	return params, nil
 }
 
 func (s *AskSage) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
@@ -83,13 +101,20 @@ func (s *AskSage) ChatCompletion(conversation llm.BotConversation, opts ...llm.L
 	if err != nil {
 		return nil, err
 	}
-	return llm.NewStreamFromString(result), nil
+	stream := llm.NewStreamFromString(result)
+	model := s.createConfig(opts).Model
+	stream.Model = func() string { return model }
+	return stream, nil
 }
 
 func (s *AskSage) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
-	s.metric.IncrementLLMRequests()
+	cfg := s.createConfig(opts)
+	s.metric.IncrementLLMRequests(cfg.Operation)
 
-	params := s.queryParamsFromConfig(s.createConfig(opts))
+	params, err := s.queryParamsFromConfig(cfg)
+	if err != nil {
+		return "", err
+	}
 	params.Message = conversationToMessagesList(conversation)
 	params.SystemPrompt = conversation.ExtractSystemMessage()
 	params.Persona = "default"
@@ -98,10 +123,26 @@ func (s *AskSage) ChatCompletionNoStream(conversation llm.BotConversation, opts
 	if err != nil {
 		return "", err
 	}
+
+	// Ask Sage doesn't report usage, so the tokens are estimated.
+	inputTokens := s.CountTokens(params.SystemPrompt)
+	for _, message := range params.Message {
+		inputTokens += s.CountTokens(message.Message)
+	}
+	s.metric.AddTokens(cfg.Operation, inputTokens, s.CountTokens(response.Message))
+
 	return response.Message, nil
 }
 
 // TODO: Implement actual token counting. For now just estimated based off OpenAI estimations
+// CheckModel reports if logging in succeeded. Ask Sage has no way to look up a model.
+func (s *AskSage) CheckModel(_ context.Context, _ string) error {
+	if s == nil {
+		return errors.New("unable to log in to Ask Sage")
+	}
+	return nil
+}
+
 func (s *AskSage) CountTokens(text string) int {
 	charCount := float64(len(text)) / 4.0
 	wordCount := float64(len(strings.Fields(text))) / 0.75
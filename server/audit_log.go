@@ -0,0 +1,336 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// What the audit log keeps of the prompts and responses.
+const (
+	AuditLogContentNone     = "none"
+	AuditLogContentRedacted = "redacted"
+	AuditLogContentFull     = "full"
+)
+
+// Outcomes of an audited request.
+const (
+	AuditStatusSuccess = "success"
+	AuditStatusError   = "error"
+	AuditStatusFlagged = "flagged"
+)
+
+const (
+	defaultAuditLogRetentionDays = 90
+	auditLogRetentionInterval    = time.Hour
+)
+
+// AuditRecord describes a single request to a language model.
+type AuditRecord struct {
+	ID           string `json:"id"`
+	CreateAt     int64  `json:"create_at"`
+	UserID       string `json:"user_id"`
+	BotID        string `json:"bot_id"`
+	BotName      string `json:"bot_name"`
+	ChannelID    string `json:"channel_id"`
+	PostID       string `json:"post_id"`
+	Operation    string `json:"operation"`
+	Model        string `json:"model"`
+	ToolsUsed    string `json:"tools_used"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	DurationMs   int64  `json:"duration_ms"`
+	Status       string `json:"status"`
+	ErrorType    string `json:"error_type"`
+	Prompt       string `json:"prompt"`
+	Response     string `json:"response"`
+}
+
+// AuditLogFilter selects the records returned by a search. Zero values match everything.
+type AuditLogFilter struct {
+	UserID    string
+	BotName   string
+	ChannelID string
+	Operation string
+	Since     int64
+	Until     int64
+}
+
+// LLMAuditWrapper records every request made to a language model in the audit log.
+// Token counts are measured with the tokenizer of the service on what was actually sent.
+type LLMAuditWrapper struct {
+	wrapped     llm.LanguageModel
+	botName     string
+	contentMode string
+	save        func(record *AuditRecord)
+}
+
+func NewLLMAuditWrapper(wrapped llm.LanguageModel, botConfig llm.BotConfig, contentMode string, save func(record *AuditRecord)) *LLMAuditWrapper {
+	return &LLMAuditWrapper{
+		wrapped:     wrapped,
+		botName:     botConfig.Name,
+		contentMode: contentMode,
+		save:        save,
+	}
+}
+
+// auditedRequest collects what is known about a request while it is in flight.
+type auditedRequest struct {
+	record *AuditRecord
+	start  time.Time
+
+	toolsLock sync.Mutex
+	tools     []string
+}
+
+func (w *LLMAuditWrapper) startRequest(conversation *llm.BotConversation, opts []llm.LanguageModelOption) *auditedRequest {
+	cfg := configFromOptions(opts)
+	request := &auditedRequest{
+		record: &AuditRecord{
+			ID:        model.NewId(),
+			CreateAt:  model.GetMillis(),
+			BotID:     conversation.Context.BotID,
+			BotName:   w.botName,
+			Operation: cfg.Operation,
+			Model:     cfg.Model,
+		},
+		start: time.Now(),
+	}
+	if conversation.Context.RequestingUser != nil {
+		request.record.UserID = conversation.Context.RequestingUser.Id
+	}
+	if conversation.Context.Channel != nil {
+		request.record.ChannelID = conversation.Context.Channel.Id
+	}
+	if conversation.Context.Post != nil {
+		request.record.PostID = conversation.Context.Post.Id
+	}
+
+	prompt := formatAuditPrompt(*conversation)
+	request.record.InputTokens = w.wrapped.CountTokens(prompt)
+	request.record.Prompt = auditContent(w.contentMode, prompt)
+
+	conversation.Tools = conversation.Tools.WithResolvedCallback(func(name string, _ error) {
+		request.toolsLock.Lock()
+		defer request.toolsLock.Unlock()
+		if !slices.Contains(request.tools, name) {
+			request.tools = append(request.tools, name)
+		}
+	})
+
+	return request
+}
+
+func (w *LLMAuditWrapper) finishRequest(request *auditedRequest, response string, err error) {
+	record := request.record
+	record.DurationMs = time.Since(request.start).Milliseconds()
+	record.OutputTokens = w.wrapped.CountTokens(response)
+	record.Response = auditContent(w.contentMode, response)
+	record.Status = AuditStatusSuccess
+	if err != nil {
+		record.Status = AuditStatusError
+		record.ErrorType = llmErrorType(err)
+	}
+
+	request.toolsLock.Lock()
+	record.ToolsUsed = strings.Join(request.tools, ",")
+	request.toolsLock.Unlock()
+
+	w.save(record)
+}
+
+// auditContent returns what the audit log keeps of a prompt or response in the given content mode.
+func auditContent(contentMode, text string) string {
+	switch contentMode {
+	case AuditLogContentFull:
+		return text
+	case AuditLogContentRedacted:
+		return maskPII(text)
+	default:
+		return ""
+	}
+}
+
+func (w *LLMAuditWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	request := w.startRequest(&conversation, opts)
+
+	result, err := w.wrapped.ChatCompletion(conversation, opts...)
+	if err != nil {
+		w.finishRequest(request, "", err)
+		return nil, err
+	}
+
+	var response strings.Builder
+	var streamErr error
+	return result.Observe(llm.StreamObserver{
+		OnText: func(text string) {
+			response.WriteString(text)
+		},
+		OnError: func(err error) {
+			streamErr = err
+		},
+		OnDone: func() {
+			w.finishRequest(request, response.String(), streamErr)
+		},
+	}), nil
+}
+
+func (w *LLMAuditWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	request := w.startRequest(&conversation, opts)
+
+	response, err := w.wrapped.ChatCompletionNoStream(conversation, opts...)
+	w.finishRequest(request, response, err)
+
+	return response, err
+}
+
+func (w *LLMAuditWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMAuditWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+// formatAuditPrompt renders the posts of a conversation without the context the plugin adds around them.
+func formatAuditPrompt(conversation llm.BotConversation) string {
+	var result strings.Builder
+	for i, post := range conversation.Posts {
+		if i > 0 {
+			result.WriteString("\n\n")
+		}
+		switch post.Role {
+		case llm.PostRoleSystem:
+			result.WriteString("system: ")
+		case llm.PostRoleBot:
+			result.WriteString("assistant: ")
+		default:
+			result.WriteString("user: ")
+		}
+		result.WriteString(post.Message)
+	}
+	return result.String()
+}
+
+func (p *Plugin) saveAuditRecordAsync(record *AuditRecord) {
+	p.goBackground(func() {
+		if err := p.saveAuditRecord(record); err != nil {
+			p.pluginAPI.Log.Error("Failed to save audit record", "error", err)
+		}
+	})
+}
+
+func (p *Plugin) saveAuditRecord(record *AuditRecord) error {
+	_, err := p.execBuilder(p.builder.Insert("LLM_AuditLog").SetMap(map[string]interface{}{
+		"ID":           record.ID,
+		"CreateAt":     record.CreateAt,
+		"UserID":       record.UserID,
+		"BotID":        record.BotID,
+		"BotName":      record.BotName,
+		"ChannelID":    record.ChannelID,
+		"PostID":       record.PostID,
+		"Operation":    record.Operation,
+		"Model":        record.Model,
+		"ToolsUsed":    record.ToolsUsed,
+		"InputTokens":  record.InputTokens,
+		"OutputTokens": record.OutputTokens,
+		"DurationMs":   record.DurationMs,
+		"Status":       record.Status,
+		"ErrorType":    record.ErrorType,
+		"Prompt":       record.Prompt,
+		"Response":     record.Response,
+	}))
+	return err
+}
+
+// searchAuditLog returns the matching records, most recent first.
+func (p *Plugin) searchAuditLog(filter AuditLogFilter, offset, limit int) ([]AuditRecord, error) {
+	query := p.builder.Select("*").
+		From("LLM_AuditLog").
+		OrderBy("CreateAt DESC", "ID DESC").
+		Offset(uint64(offset)).
+		Limit(uint64(limit))
+
+	if filter.UserID != "" {
+		query = query.Where(sq.Eq{"UserID": filter.UserID})
+	}
+	if filter.BotName != "" {
+		query = query.Where(sq.Eq{"BotName": filter.BotName})
+	}
+	if filter.ChannelID != "" {
+		query = query.Where(sq.Eq{"ChannelID": filter.ChannelID})
+	}
+	if filter.Operation != "" {
+		query = query.Where(sq.Eq{"Operation": filter.Operation})
+	}
+	if filter.Since != 0 {
+		query = query.Where(sq.GtOrEq{"CreateAt": filter.Since})
+	}
+	if filter.Until != 0 {
+		query = query.Where(sq.Lt{"CreateAt": filter.Until})
+	}
+
+	var records []AuditRecord
+	if err := p.doQuery(&records, query); err != nil {
+		return nil, fmt.Errorf("failed to search audit log: %w", err)
+	}
+
+	return records, nil
+}
+
+// getToolsUsedByPost returns the tools the bots used to respond to each of the given posts.
+func (p *Plugin) getToolsUsedByPost(postIDs []string) (map[string][]string, error) {
+	var records []AuditRecord
+	if err := p.doQuery(&records, p.builder.Select("PostID", "ToolsUsed").
+		From("LLM_AuditLog").
+		Where(sq.Eq{"PostID": postIDs}).
+		Where(sq.NotEq{"ToolsUsed": ""}).
+		OrderBy("CreateAt ASC"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to get tools used: %w", err)
+	}
+
+	toolsByPost := map[string][]string{}
+	for _, record := range records {
+		toolsByPost[record.PostID] = append(toolsByPost[record.PostID], strings.Split(record.ToolsUsed, ",")...)
+	}
+	return toolsByPost, nil
+}
+
+// runAuditLogRetention periodically deletes the records older than the retention period.
+func (p *Plugin) runAuditLogRetention(stop <-chan struct{}) {
+	ticker := time.NewTicker(auditLogRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		p.deleteExpiredAuditRecords()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Plugin) deleteExpiredAuditRecords() {
+	retentionDays := p.getConfiguration().AuditLogRetentionDays
+	if retentionDays <= 0 {
+		retentionDays = defaultAuditLogRetentionDays
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).UnixMilli()
+	if _, err := p.execBuilder(p.builder.Delete("LLM_AuditLog").
+		Where(sq.Lt{"CreateAt": cutoff})); err != nil {
+		p.pluginAPI.Log.Error("Failed to delete expired audit records", "error", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+	"github.com/mattermost/mattermost/server/public/model"
+	openaiClient "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMAuditWrapper(t *testing.T) {
+	conversationContext := llm.NewConversationContext("botid", &model.User{Id: "userid"}, &model.Channel{Id: "channelid"}, &model.Post{Id: "postid"})
+	tools := llm.NewNoTools()
+	tools.AddTools([]llm.Tool{{
+		Name: "lookup",
+		Resolver: func(context llm.ConversationContext, argsGetter llm.ToolArgumentGetter) (string, error) {
+			return "found", nil
+		},
+	}})
+	conversation := llm.BotConversation{
+		Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "Be helpful"},
+			{Role: llm.PostRoleUser, Message: "Email bob@example.com"},
+		},
+		Tools:   tools,
+		Context: conversationContext,
+	}
+	botConfig := llm.BotConfig{Name: "ai"}
+
+	t.Run("records the request without content by default", func(t *testing.T) {
+		var saved *AuditRecord
+		languageModel := newScriptedLanguageModel(scriptedTurn{Response: "done", Tool: "lookup"})
+		wrapper := NewLLMAuditWrapper(languageModel, botConfig, "", func(record *AuditRecord) {
+			saved = record
+		})
+
+		_, err := wrapper.ChatCompletionNoStream(conversation, llm.WithOperation(llm.OperationChat), llm.WithModel("gpt-4o"))
+		require.NoError(t, err)
+
+		require.NotNil(t, saved)
+		require.Equal(t, "userid", saved.UserID)
+		require.Equal(t, "botid", saved.BotID)
+		require.Equal(t, "ai", saved.BotName)
+		require.Equal(t, "channelid", saved.ChannelID)
+		require.Equal(t, "postid", saved.PostID)
+		require.Equal(t, llm.OperationChat, saved.Operation)
+		require.Equal(t, "gpt-4o", saved.Model)
+		require.Equal(t, "lookup", saved.ToolsUsed)
+		require.Equal(t, languageModel.CountTokens("done found"), saved.OutputTokens)
+		require.Positive(t, saved.InputTokens)
+		require.Equal(t, AuditStatusSuccess, saved.Status)
+		require.Empty(t, saved.Prompt)
+		require.Empty(t, saved.Response)
+	})
+
+	t.Run("redacts content of streamed responses", func(t *testing.T) {
+		saved := make(chan *AuditRecord, 1)
+		wrapper := NewLLMAuditWrapper(newScriptedLanguageModel(scriptedTurn{Response: "Mailed bob@example.com"}), botConfig, AuditLogContentRedacted, func(record *AuditRecord) {
+			saved <- record
+		})
+
+		result, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+		require.Equal(t, "Mailed bob@example.com", result.ReadAll())
+
+		var record *AuditRecord
+		select {
+		case record = <-saved:
+		case <-time.After(time.Second):
+			require.FailNow(t, "audit record was not saved")
+		}
+		require.Equal(t, "system: Be helpful\n\nuser: Email [EMAIL]", record.Prompt)
+		require.Equal(t, "Mailed [EMAIL]", record.Response)
+	})
+
+	t.Run("records the type of stream errors", func(t *testing.T) {
+		saved := make(chan *AuditRecord, 1)
+		wrapper := NewLLMAuditWrapper(newScriptedLanguageModel(scriptedTurn{Response: "partial", StreamErr: &openaiClient.APIError{HTTPStatusCode: http.StatusTooManyRequests}}), botConfig, AuditLogContentFull, func(record *AuditRecord) {
+			saved <- record
+		})
+
+		result, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+		require.Equal(t, "partial", <-result.Stream)
+		require.Error(t, <-result.Err)
+
+		record := <-saved
+		require.Equal(t, AuditStatusError, record.Status)
+		require.Equal(t, metrics.ErrorTypeRateLimit, record.ErrorType)
+		require.Equal(t, "partial", record.Response)
+	})
+}
+
+func TestAuditRecordCSVRow(t *testing.T) {
+	row := auditRecordCSVRow(AuditRecord{ID: "id", ToolsUsed: "lookup,search", InputTokens: 12})
+	require.Len(t, row, len(auditRecordCSVHeader))
+	require.Equal(t, "12", row[10])
+	require.Equal(t, "lookup,search", row[9])
+
+	row = auditRecordCSVRow(AuditRecord{Prompt: "=HYPERLINK(\"https://example.com\")", Response: "-1", Model: "gpt-4o"})
+	require.Equal(t, "'=HYPERLINK(\"https://example.com\")", row[15])
+	require.Equal(t, "'-1", row[16])
+	require.Equal(t, "gpt-4o", row[8])
+}
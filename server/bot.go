@@ -131,8 +131,10 @@ func (p *Plugin) EnsureBots() error {
 
 	aiBotConfigsByUsername := make(map[string]llm.BotConfig)
 	for _, bot := range cfgBots {
-		if !bot.IsValid() {
-			p.pluginAPI.Log.Error("Configured bot is not valid", "bot_name", bot.Name, "bot_display_name", bot.DisplayName)
+		if problems := bot.Validate(); len(problems) > 0 {
+			for _, problem := range problems {
+				p.pluginAPI.Log.Error("Configured bot is not valid", "bot_name", bot.Name, "bot_display_name", bot.DisplayName, "field", problem.Field, "problem", problem.Message)
+			}
 			continue
 		}
 		if _, ok := aiBotConfigsByUsername[bot.Name]; ok {
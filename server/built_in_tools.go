@@ -197,7 +197,7 @@ func (p *Plugin) toolGetGithubIssue(context llm.ConversationContext, argsGetter
 		return "internal failure", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return formatGithubIssue(&issue), nil
+	return llm.FormatUntrusted(llm.UntrustedSourceTool, formatGithubIssue(&issue)), nil
 }
 
 type GetJiraIssueArgs struct {
@@ -394,7 +394,7 @@ func (p *Plugin) toolGetJiraIssue(context llm.ConversationContext, argsGetter ll
 		result.WriteString("------\n")
 	}
 
-	return result.String(), nil
+	return llm.FormatUntrusted(llm.UntrustedSourceTool, result.String()), nil
 }
 
 // getBuiltInTools returns the built-in tools that are available to all users.
@@ -0,0 +1,123 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+)
+
+// ConfigValidation holds what is wrong with a plugin configuration. A configuration with errors is
+// unsafe to apply and is rejected. Warnings only disable the bot or feature they concern.
+type ConfigValidation struct {
+	Errors   []llm.ValidationError `json:"errors"`
+	Warnings []llm.ValidationError `json:"warnings"`
+}
+
+// Err returns the errors of the validation joined together, nil if there are none.
+func (v ConfigValidation) Err() error {
+	errs := make([]error, 0, len(v.Errors))
+	for _, validationError := range v.Errors {
+		errs = append(errs, validationError)
+	}
+	return errors.Join(errs...)
+}
+
+// asValidationError keeps the field of errors that already name it.
+func asValidationError(err error, field string) llm.ValidationError {
+	var validationError llm.ValidationError
+	if errors.As(err, &validationError) {
+		return validationError
+	}
+	return llm.ValidationError{Field: field, Message: err.Error()}
+}
+
+func validateConfig(cfg Config) ConfigValidation {
+	validation := ConfigValidation{
+		Errors:   []llm.ValidationError{},
+		Warnings: []llm.ValidationError{},
+	}
+	addError := func(bot, field, message string) {
+		validation.Errors = append(validation.Errors, llm.ValidationError{Bot: bot, Field: field, Message: message})
+	}
+	addWarning := func(bot, field, message string) {
+		validation.Warnings = append(validation.Warnings, llm.ValidationError{Bot: bot, Field: field, Message: message})
+	}
+
+	// Duplicate names would make EnsureBots modify the wrong bot.
+	botsByName := map[string]llm.BotConfig{}
+	for _, bot := range cfg.Bots {
+		validation.Warnings = append(validation.Warnings, bot.Validate()...)
+		_, secretProblems := bot.Service.ResolveSecrets(nil)
+		for _, problem := range secretProblems {
+			addWarning(bot.Name, problem.Field, problem.Message)
+		}
+		if bot.Name == "" {
+			continue
+		}
+		if _, ok := botsByName[bot.Name]; ok {
+			addError(bot.Name, "name", "is used by more than one bot")
+			continue
+		}
+		botsByName[bot.Name] = bot
+	}
+
+	if cfg.DefaultBotName != "" {
+		if _, ok := botsByName[cfg.DefaultBotName]; !ok {
+			addWarning("", "defaultBotName", fmt.Sprintf("no bot is named %q, the first bot is used instead", cfg.DefaultBotName))
+		}
+	}
+
+	if cfg.TranscriptGenerator != "" {
+		if bot, ok := botsByName[cfg.TranscriptGenerator]; !ok {
+			addWarning("", "transcriptBackend", fmt.Sprintf("no bot is named %q, recordings can't be transcribed", cfg.TranscriptGenerator))
+		} else if !serviceSupportsTranscription(bot.Service.Type) {
+			addWarning("", "transcriptBackend", fmt.Sprintf("bot %q uses the %s service which can't transcribe recordings", bot.Name, bot.Service.Type))
+		}
+	}
+
+	// A pattern that can't match only blocks traffic, which is safe to apply.
+	for _, pattern := range parseAllowedHostnames(cfg.AllowedUpstreamHostnames) {
+		if err := validateHostnamePattern(pattern); err != nil {
+			addWarning("", "allowedUpstreamHostnames", err.Error()+", no upstream service matches it")
+		}
+	}
+
+	if _, err := piiDetectorsFromConfig(cfg); err != nil {
+		validation.Errors = append(validation.Errors, asValidationError(err, "piiRedactionPatterns"))
+	}
+
+	switch cfg.AuditLogContent {
+	case "", AuditLogContentNone, AuditLogContentRedacted, AuditLogContentFull:
+	default:
+		addWarning("", "auditLogContent", fmt.Sprintf("%q is not a known option, prompts and responses are not stored", cfg.AuditLogContent))
+	}
+
+	if _, err := parseModerationBlocklist(cfg.ModerationBlocklist); err != nil {
+		validation.Errors = append(validation.Errors, asValidationError(err, "moderationBlocklist"))
+	}
+	switch cfg.ModerationAction {
+	case "", ModerationActionReplace, ModerationActionRedact:
+	default:
+		addWarning("", "moderationAction", fmt.Sprintf("%q is not a known action, responses are withheld instead", cfg.ModerationAction))
+	}
+	if cfg.EnableModeration {
+		switch cfg.ModerationClassifier {
+		case ModerationClassifierNone:
+		case ModerationClassifierOpenAI, ModerationClassifierLLM:
+			bot, ok := botsByName[cfg.ModerationBot]
+			if !ok {
+				addWarning("", "moderationBot", fmt.Sprintf("no bot is named %q, every response will be withheld", cfg.ModerationBot))
+			} else if cfg.ModerationClassifier == ModerationClassifierOpenAI && bot.Service.Type != llm.ServiceTypeOpenAI && bot.Service.Type != llm.ServiceTypeOpenAICompatible {
+				addWarning("", "moderationBot", fmt.Sprintf("bot %q uses the %s service which has no moderation endpoint, every response will be withheld", bot.Name, bot.Service.Type))
+			}
+		default:
+			addWarning("", "moderationClassifier", fmt.Sprintf("%q is not a known classifier, every response will be withheld", cfg.ModerationClassifier))
+		}
+	}
+
+	return validation
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	validBot := func(name, serviceType string) llm.BotConfig {
+		return llm.BotConfig{
+			Name:        name,
+			DisplayName: name,
+			Service: llm.ServiceConfig{
+				Type:   serviceType,
+				APIKey: "key",
+				APIURL: "https://example.com/v1",
+			},
+		}
+	}
+	fields := func(problems []llm.ValidationError) []string {
+		result := []string{}
+		for _, problem := range problems {
+			result = append(result, problem.Field)
+		}
+		return result
+	}
+
+	t.Run("valid configuration", func(t *testing.T) {
+		validation := validateConfig(Config{
+			Bots:                     []llm.BotConfig{validBot("ai", llm.ServiceTypeOpenAI)},
+			DefaultBotName:           "ai",
+			TranscriptGenerator:      "ai",
+			AllowedUpstreamHostnames: "mattermost.atlassian.net, *.example.com",
+		})
+		require.Empty(t, validation.Errors)
+		require.Empty(t, validation.Warnings)
+		require.NoError(t, validation.Err())
+	})
+
+	t.Run("unsafe configurations are errors", func(t *testing.T) {
+		validation := validateConfig(Config{
+			Bots:                 []llm.BotConfig{validBot("ai", llm.ServiceTypeOpenAI), validBot("ai", llm.ServiceTypeAnthropic)},
+			EnablePIIRedaction:   true,
+			PIIRedactionPatterns: "ticket=/[unclosed/",
+			ModerationBlocklist:  "/[unclosed/",
+		})
+		require.Equal(t, []string{"name", "piiRedactionPatterns", "moderationBlocklist"}, fields(validation.Errors))
+		require.Error(t, validation.Err())
+	})
+
+	t.Run("hostname patterns that can't match are warnings", func(t *testing.T) {
+		validation := validateConfig(Config{
+			Bots:                     []llm.BotConfig{validBot("ai", llm.ServiceTypeOpenAI)},
+			AllowedUpstreamHostnames: "https://api.openai.com, api.openai.com:443, *.example.com",
+		})
+		require.NoError(t, validation.Err())
+		require.Equal(t, []string{"allowedUpstreamHostnames", "allowedUpstreamHostnames"}, fields(validation.Warnings))
+	})
+
+	t.Run("problems limited to a bot or feature are warnings", func(t *testing.T) {
+		invalidBot := validBot("Not Valid", llm.ServiceTypeOpenAI)
+		invalidBot.Service.APIKey = ""
+		validation := validateConfig(Config{
+			Bots:                 []llm.BotConfig{invalidBot, validBot("claude", llm.ServiceTypeAnthropic)},
+			DefaultBotName:       "missing",
+			TranscriptGenerator:  "claude",
+			EnableModeration:     true,
+			ModerationClassifier: ModerationClassifierOpenAI,
+			ModerationBot:        "claude",
+		})
+		require.Empty(t, validation.Errors)
+		require.Equal(t, []string{"name", "service.apiKey", "defaultBotName", "transcriptBackend", "moderationBot"}, fields(validation.Warnings))
+		require.Equal(t, "Not Valid", validation.Warnings[0].Bot)
+	})
+}
@@ -6,17 +6,33 @@ package main
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 
 	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 )
 
 type Config struct {
-	Services                 []llm.ServiceConfig `json:"services"`
-	Bots                     []llm.BotConfig     `json:"bots"`
-	DefaultBotName           string              `json:"defaultBotName"`
-	TranscriptGenerator      string              `json:"transcriptBackend"`
-	EnableLLMTrace           bool                `json:"enableLLMTrace"`
-	AllowedUpstreamHostnames string              `json:"allowedUpstreamHostnames"`
+	Services                       []llm.ServiceConfig `json:"services"`
+	Bots                           []llm.BotConfig     `json:"bots"`
+	DefaultBotName                 string              `json:"defaultBotName"`
+	TranscriptGenerator            string              `json:"transcriptBackend"`
+	EnableLLMTrace                 bool                `json:"enableLLMTrace"`
+	AllowedUpstreamHostnames       string              `json:"allowedUpstreamHostnames"`
+	EnableTracing                  bool                `json:"enableTracing"`
+	TracingEndpoint                string              `json:"tracingEndpoint"`
+	EnableAuditLog                 bool                `json:"enableAuditLog"`
+	AuditLogContent                string              `json:"auditLogContent"`
+	AuditLogRetentionDays          int                 `json:"auditLogRetentionDays"`
+	EnablePIIRedaction             bool                `json:"enablePIIRedaction"`
+	PIIRedactionDetectors          string              `json:"piiRedactionDetectors"`
+	PIIRedactionPatterns           string              `json:"piiRedactionPatterns"`
+	EnableModeration               bool                `json:"enableModeration"`
+	ModerationBlocklist            string              `json:"moderationBlocklist"`
+	ModerationClassifier           string              `json:"moderationClassifier"`
+	ModerationBot                  string              `json:"moderationBot"`
+	ModerationPolicy               string              `json:"moderationPolicy"`
+	ModerationAction               string              `json:"moderationAction"`
+	ModerationBufferPublicChannels bool                `json:"moderationBufferPublicChannels"`
 }
 
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
@@ -32,6 +48,12 @@ type Config struct {
 // copy appropriate for your types.
 type configuration struct {
 	Config `json:"config"`
+
+	// piiDetectors are compiled from the redaction settings.
+	piiDetectors []PIIDetector
+
+	// moderationBlocklist is compiled from the blocklist of the moderation settings.
+	moderationBlocklist []*regexp.Regexp
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -91,17 +113,50 @@ func (p *Plugin) OnConfigurationChange() error {
 		return fmt.Errorf("failed to load plugin configuration: %w", err)
 	}
 
+	// Unsafe configurations are rejected and the previous one stays active.
+	validation := validateConfig(configuration.Config)
+	if err := validation.Err(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	piiDetectors, err := piiDetectorsFromConfig(configuration.Config)
+	if err != nil {
+		return fmt.Errorf("invalid PII redaction configuration: %w", err)
+	}
+	configuration.piiDetectors = piiDetectors
+
+	moderationBlocklist, err := parseModerationBlocklist(configuration.ModerationBlocklist)
+	if err != nil {
+		return fmt.Errorf("invalid moderation configuration: %w", err)
+	}
+	configuration.moderationBlocklist = moderationBlocklist
+
+	// Referenced secrets are resolved before the configuration is used so rotated values apply right away.
+	secretRefresh := p.secrets.refresh(configuration.Bots)
+
 	p.setConfiguration(configuration)
+	p.configureServiceLimiters(configuration.Bots)
 
 	// If OnActivate hasn't run yet then don't do the change tasks
 	if p.pluginAPI == nil {
 		return nil
 	}
 
+	for _, warning := range validation.Warnings {
+		p.pluginAPI.Log.Warn("Configuration problem", "problem", warning.Error())
+	}
+	// Secrets that can't be resolved were already reported as configuration problems.
+	secretRefresh.Failed = nil
+	p.logSecretRefresh(secretRefresh)
+
 	// Extra config change tasks
 	if err := p.EnsureBots(); err != nil {
 		return fmt.Errorf("failed on config change: %w", err)
 	}
 
+	if err := p.configureTracing(configuration.Config); err != nil {
+		p.pluginAPI.Log.Error("Failed to configure tracing", "error", err)
+	}
+
 	return nil
 }
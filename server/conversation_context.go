@@ -4,12 +4,15 @@
 package main
 
 import (
+	"context"
+
 	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
-func (p *Plugin) MakeConversationContext(bot *Bot, user *model.User, channel *model.Channel, post *model.Post) llm.ConversationContext {
-	context := llm.NewConversationContext(bot.mmBot.UserId, user, channel, post)
+// MakeConversationContext creates the context of a conversation, traced under the span of ctx.
+func (p *Plugin) MakeConversationContext(ctx context.Context, bot *Bot, user *model.User, channel *model.Channel, post *model.Post) llm.ConversationContext {
+	context := llm.NewConversationContext(bot.mmBot.UserId, user, channel, post).WithTraceContext(ctx)
 	if p.pluginAPI.Configuration.GetConfig().TeamSettings.SiteName != nil {
 		context.ServerName = *p.pluginAPI.Configuration.GetConfig().TeamSettings.SiteName
 	}
@@ -51,7 +51,7 @@ func (p *Plugin) newConversation(bot *Bot, context llm.ConversationContext) erro
 	}
 	conversation.AddPost(p.PostToAIPost(bot, context.Post))
 
-	result, err := p.getLLM(bot.cfg).ChatCompletion(conversation)
+	result, err := p.getLLM(bot.cfg).ChatCompletion(conversation, llm.WithTask(bot.cfg, llm.TaskChat))
 	if err != nil {
 		return err
 	}
@@ -64,34 +64,42 @@ func (p *Plugin) newConversation(bot *Bot, context llm.ConversationContext) erro
 		return err
 	}
 
-	go func() {
-		request := "Write a short title for the following request. Include only the title and nothing else, no quotations. Request:\n" + context.Post.Message
-		if err := p.generateTitle(bot, request, context); err != nil {
+	p.goBackground(func() {
+		if _, err := p.generateTitle(bot, conversationTitleRequest(context.Post.Message), context); err != nil {
 			p.API.LogError("Failed to generate title", "error", err.Error())
 			return
 		}
-	}()
+	})
 
 	return nil
 }
 
-func (p *Plugin) generateTitle(bot *Bot, request string, context llm.ConversationContext) error {
+func conversationTitleRequest(message string) string {
+	return "Write a short title for the following request. Include only the title and nothing else, no quotations. Request:\n" + message
+}
+
+// generateTitle asks the bot for a title of the conversation started by context.Post and saves it.
+func (p *Plugin) generateTitle(bot *Bot, request string, context llm.ConversationContext) (string, error) {
 	titleRequest := llm.BotConversation{
 		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: request}},
 		Context: context,
 	}
-	conversationTitle, err := p.getLLM(bot.cfg).ChatCompletionNoStream(titleRequest, llm.WithMaxGeneratedTokens(25))
+	conversationTitle, err := p.getLLM(bot.cfg).ChatCompletionNoStream(titleRequest,
+		llm.WithTask(bot.cfg, llm.TaskTitle),
+		llm.WithMaxGeneratedTokens(25),
+		llm.WithDeterministicSampling(),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to get title: %w", err)
+		return "", fmt.Errorf("failed to get title: %w", err)
 	}
 
 	conversationTitle = strings.Trim(conversationTitle, "\n \"'")
 
 	if err := p.saveTitle(context.Post.Id, conversationTitle); err != nil {
-		return fmt.Errorf("failed to save title: %w", err)
+		return "", fmt.Errorf("failed to save title: %w", err)
 	}
 
-	return nil
+	return conversationTitle, nil
 }
 
 func (p *Plugin) continueConversation(bot *Bot, threadData *ThreadData, context llm.ConversationContext) (*llm.TextStreamResult, error) {
@@ -133,7 +141,7 @@ func (p *Plugin) continueConversation(bot *Bot, threadData *ThreadData, context
 		}
 		prompt.AppendConversation(p.ThreadToBotConversation(bot, threadData.Posts))
 
-		result, err = p.getLLM(bot.cfg).ChatCompletion(prompt)
+		result, err = p.getLLM(bot.cfg).ChatCompletion(prompt, llm.WithTask(bot.cfg, llm.TaskChat))
 		if err != nil {
 			return nil, err
 		}
@@ -156,7 +164,7 @@ func (p *Plugin) continueThreadConversation(bot *Bot, questionThreadData *Thread
 	}
 	prompt.AppendConversation(p.ThreadToBotConversation(bot, questionThreadData.Posts))
 
-	result, err := p.getLLM(bot.cfg).ChatCompletion(prompt)
+	result, err := p.getLLM(bot.cfg).ChatCompletion(prompt, llm.WithTask(bot.cfg, llm.TaskChat))
 	if err != nil {
 		return nil, err
 	}
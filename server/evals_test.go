@@ -0,0 +1,399 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm/subtitles"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+)
+
+// The prompt evaluations render the fixtures in testdata/evals through the prompt templates and score
+// the responses. By default the responses recorded in the fixtures are replayed, which checks that the
+// templates still get their inputs. To evaluate a change of prompt against a real model, point
+// COPILOT_EVAL_BOT to a JSON bot configuration; secrets can be env: or file: references. The results are
+// written to COPILOT_EVAL_REPORT when it is set.
+const (
+	evalBotEnv    = "COPILOT_EVAL_BOT"
+	evalReportEnv = "COPILOT_EVAL_REPORT"
+	evalFixtures  = "testdata/evals/*.json"
+)
+
+// Types of checks of an evaluation.
+const (
+	evalCheckContains       = "contains"
+	evalCheckNotContains    = "not_contains"
+	evalCheckPromptContains = "prompt_contains"
+	evalCheckSchema         = "schema"
+	evalCheckJudge          = "judge"
+)
+
+// evalFixture is a recorded conversation, the prompt template to evaluate with it and the checks its
+// response must pass.
+type evalFixture struct {
+	Name               string         `json:"name"`
+	Template           string         `json:"template"`
+	CustomInstructions string         `json:"custom_instructions,omitempty"`
+	Thread             []evalPost     `json:"thread,omitempty"`
+	Transcript         string         `json:"transcript,omitempty"`
+	Recorded           []scriptedTurn `json:"recorded"`
+	Checks             []evalCheck    `json:"checks"`
+}
+
+type evalPost struct {
+	Username string `json:"username"`
+	Message  string `json:"message"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+type evalCheck struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	// Schema is the JSON schema the response must follow, for schema checks.
+	Schema *evalSchema `json:"schema,omitempty"`
+	// Criteria is what the judge looks for, and RecordedVerdict its recorded answer, for judge checks.
+	Criteria        string `json:"criteria,omitempty"`
+	RecordedVerdict string `json:"recorded_verdict,omitempty"`
+}
+
+// evalSchema is the subset of JSON schema used by the fixtures.
+type evalSchema struct {
+	Type       string                 `json:"type"`
+	Required   []string               `json:"required,omitempty"`
+	Properties map[string]*evalSchema `json:"properties,omitempty"`
+	Items      *evalSchema            `json:"items,omitempty"`
+}
+
+type evalCheckResult struct {
+	Type   string `json:"type"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type evalResult struct {
+	Fixture  string            `json:"fixture"`
+	Template string            `json:"template"`
+	Passed   bool              `json:"passed"`
+	Error    string            `json:"error,omitempty"`
+	Output   string            `json:"output"`
+	Checks   []evalCheckResult `json:"checks"`
+}
+
+type evalReport struct {
+	Model   string       `json:"model"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Results []evalResult `json:"results"`
+}
+
+func loadEvalFixtures(t *testing.T) []evalFixture {
+	paths, err := filepath.Glob(evalFixtures)
+	require.NoError(t, err)
+	require.NotEmpty(t, paths, "no evaluation fixtures found")
+	sort.Strings(paths)
+
+	fixtures := make([]evalFixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		var fixture evalFixture
+		require.NoError(t, json.Unmarshal(data, &fixture), path)
+		if fixture.Name == "" {
+			fixture.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures
+}
+
+// evalLanguageModel returns the configured model, or nil when the recorded responses are replayed.
+func evalLanguageModel(t *testing.T, e *TestEnvironment) (llm.LanguageModel, string) {
+	path := os.Getenv(evalBotEnv)
+	if path == "" {
+		return nil, "recorded"
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var botConfig llm.BotConfig
+	require.NoError(t, json.Unmarshal(data, &botConfig))
+
+	service, problems := botConfig.Service.ResolveSecrets(nil)
+	require.Empty(t, problems, "unable to resolve the secrets of the evaluated bot")
+	botConfig.Service = service
+
+	e.plugin.llmUpstreamHTTPClient = http.DefaultClient
+	languageModel := e.plugin.newLanguageModel(botConfig, newFakeLLMetrics())
+	require.NotNil(t, languageModel, "unsupported service type %q", botConfig.Service.Type)
+	return languageModel, botConfig.ModelForTask(llm.TaskChat)
+}
+
+// renderEvalFixture builds the conversation sent to the model the way the plugin does for the template.
+func (e *TestEnvironment) renderEvalFixture(fixture evalFixture) (llm.BotConversation, error) {
+	bot := e.plugin.bots[0]
+	user := &model.User{Id: "userid", Username: "evaluser", Locale: "en"}
+	channel := &model.Channel{Id: "channelid", Name: "town-square", DisplayName: "Town Square", Type: model.ChannelTypeOpen}
+
+	threadData := &ThreadData{UsersByID: map[string]*model.User{
+		user.Id:          user,
+		bot.mmBot.UserId: {Id: bot.mmBot.UserId, Username: bot.mmBot.Username},
+	}}
+	for i, post := range fixture.Thread {
+		userID := fmt.Sprintf("user%d", i)
+		if post.Bot {
+			userID = bot.mmBot.UserId
+		} else if _, ok := threadData.UsersByID[userID]; !ok {
+			threadData.UsersByID[userID] = &model.User{Id: userID, Username: post.Username}
+		}
+		threadData.Posts = append(threadData.Posts, &model.Post{Id: fmt.Sprintf("post%d", i), UserId: userID, Message: post.Message})
+	}
+
+	context := llm.NewConversationContext(bot.mmBot.UserId, user, channel, nil)
+	context.ServerName = "Evaluation Server"
+	context.CustomInstructions = fixture.CustomInstructions
+
+	switch fixture.Template {
+	case llm.PromptSummarizeThread, llm.PromptFindActionItems, llm.PromptFindOpenQuestions:
+		context.PromptParameters = map[string]string{"Thread": formatThread(threadData)}
+	case llm.PromptSummarizeChannelSince, llm.PromptFindActionItemsSince, llm.PromptFindOpenQuestionsSince:
+		context.PromptParameters = map[string]string{"Posts": formatThread(threadData)}
+	case llm.PromptMeetingSummary:
+		transcription, err := subtitles.NewSubtitlesFromVTT(strings.NewReader(fixture.Transcript))
+		if err != nil {
+			return llm.BotConversation{}, fmt.Errorf("invalid transcript: %w", err)
+		}
+		context.PromptParameters = map[string]string{
+			"Transcription": llm.FormatUntrusted(llm.UntrustedSourceTranscription, transcription.FormatForLLM()),
+			"IsChunked":     "false",
+			"HasSpeakers":   fmt.Sprintf("%t", transcription.HasSpeakers()),
+		}
+	case llm.PromptDirectMessageQuestion:
+		prompt, err := e.plugin.prompts.ChatCompletion(fixture.Template, context, llm.NewNoTools())
+		if err != nil {
+			return prompt, err
+		}
+		prompt.AppendConversation(e.plugin.ThreadToBotConversation(bot, threadData.Posts))
+		return prompt, nil
+	default:
+		return llm.BotConversation{}, fmt.Errorf("template %q can't be evaluated", fixture.Template)
+	}
+
+	return e.plugin.prompts.ChatCompletion(fixture.Template, context, llm.NewNoTools())
+}
+
+func TestPromptEvals(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	configured, modelName := evalLanguageModel(t, e)
+	report := evalReport{Model: modelName}
+
+	for _, fixture := range loadEvalFixtures(t) {
+		t.Run(fixture.Name, func(t *testing.T) {
+			languageModel, judge := configured, configured
+			if languageModel == nil {
+				languageModel = newScriptedLanguageModel(fixture.Recorded...)
+				var verdicts []scriptedTurn
+				for _, check := range fixture.Checks {
+					if check.Type == evalCheckJudge {
+						verdicts = append(verdicts, scriptedTurn{Response: check.RecordedVerdict})
+					}
+				}
+				judge = newScriptedLanguageModel(verdicts...)
+			}
+
+			result := runEval(e, fixture, languageModel, judge)
+			report.Results = append(report.Results, result)
+			if result.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+
+			require.Empty(t, result.Error)
+			for _, check := range result.Checks {
+				require.True(t, check.Passed, "%s check failed: %s\noutput:\n%s", check.Type, check.Detail, result.Output)
+			}
+		})
+	}
+
+	t.Logf("prompt evaluations with %s: %d passed, %d failed", report.Model, report.Passed, report.Failed)
+	if path := os.Getenv(evalReportEnv); path != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+	}
+}
+
+func runEval(e *TestEnvironment, fixture evalFixture, languageModel, judge llm.LanguageModel) evalResult {
+	result := evalResult{Fixture: fixture.Name, Template: fixture.Template}
+
+	prompt, err := e.renderEvalFixture(fixture)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	stream, err := languageModel.ChatCompletion(prompt)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Output = stream.ReadAll()
+
+	result.Passed = true
+	for _, check := range fixture.Checks {
+		checkResult := runEvalCheck(check, conversationText(prompt), result.Output, judge)
+		result.Passed = result.Passed && checkResult.Passed
+		result.Checks = append(result.Checks, checkResult)
+	}
+	return result
+}
+
+func runEvalCheck(check evalCheck, prompt, output string, judge llm.LanguageModel) evalCheckResult {
+	result := evalCheckResult{Type: check.Type}
+	switch check.Type {
+	case evalCheckContains:
+		result.Passed = strings.Contains(strings.ToLower(output), strings.ToLower(check.Value))
+		result.Detail = fmt.Sprintf("response should mention %q", check.Value)
+	case evalCheckNotContains:
+		result.Passed = !strings.Contains(strings.ToLower(output), strings.ToLower(check.Value))
+		result.Detail = fmt.Sprintf("response shouldn't mention %q", check.Value)
+	case evalCheckPromptContains:
+		result.Passed = strings.Contains(prompt, check.Value)
+		result.Detail = fmt.Sprintf("prompt should contain %q", check.Value)
+	case evalCheckSchema:
+		var value any
+		if err := json.Unmarshal([]byte(stripCodeFence(output)), &value); err != nil {
+			result.Detail = fmt.Sprintf("response isn't JSON: %v", err)
+			return result
+		}
+		if err := check.Schema.validate(value, "$"); err != nil {
+			result.Detail = err.Error()
+			return result
+		}
+		result.Passed = true
+	case evalCheckJudge:
+		verdict, err := judge.ChatCompletionNoStream(llm.BotConversation{Posts: []llm.Post{
+			{Role: llm.PostRoleSystem, Message: "You grade the responses of an assistant. Answer PASS if the response meets the criteria. Otherwise answer FAIL followed by the reason."},
+			{Role: llm.PostRoleUser, Message: fmt.Sprintf("Criteria: %s\n\nResponse:\n%s", check.Criteria, output)},
+		}})
+		if err != nil {
+			result.Detail = fmt.Sprintf("judge failed: %v", err)
+			return result
+		}
+		result.Passed = strings.HasPrefix(strings.ToUpper(strings.TrimSpace(verdict)), "PASS")
+		result.Detail = strings.TrimSpace(verdict)
+	default:
+		result.Detail = fmt.Sprintf("unknown check type %q", check.Type)
+	}
+	return result
+}
+
+// stripCodeFence removes the markdown code block models often wrap JSON in.
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.Index(text, "\n"); newline >= 0 {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+func (s *evalSchema) validate(value any, path string) error {
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s should be an object", path)
+		}
+		for _, key := range s.Required {
+			if _, ok := object[key]; !ok {
+				return fmt.Errorf("%s is missing %q", path, key)
+			}
+		}
+		for key, property := range s.Properties {
+			if propertyValue, ok := object[key]; ok {
+				if err := property.validate(propertyValue, path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s should be an array", path)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s should be a string", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s should be a number", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s should be a boolean", path)
+		}
+	case "":
+	default:
+		return fmt.Errorf("unsupported schema type %q", s.Type)
+	}
+	return nil
+}
+
+func TestEvalChecks(t *testing.T) {
+	schema := &evalSchema{
+		Type:     "object",
+		Required: []string{"items"},
+		Properties: map[string]*evalSchema{
+			"items": {Type: "array", Items: &evalSchema{Type: "string"}},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		check    evalCheck
+		output   string
+		expected bool
+	}{
+		"contains ignores case":     {check: evalCheck{Type: evalCheckContains, Value: "database"}, output: "The Database failed.", expected: true},
+		"not contains":              {check: evalCheck{Type: evalCheckNotContains, Value: "password"}, output: "The password is hunter2", expected: false},
+		"prompt contains":           {check: evalCheck{Type: evalCheckPromptContains, Value: "alice"}, output: "", expected: true},
+		"schema in a code block":    {check: evalCheck{Type: evalCheckSchema, Schema: schema}, output: "```json\n{\"items\": [\"a\"]}\n```", expected: true},
+		"schema with a wrong type":  {check: evalCheck{Type: evalCheckSchema, Schema: schema}, output: `{"items": [1]}`, expected: false},
+		"schema with missing field": {check: evalCheck{Type: evalCheckSchema, Schema: schema}, output: `{}`, expected: false},
+		"judge passes":              {check: evalCheck{Type: evalCheckJudge, Criteria: "mentions the outage", RecordedVerdict: "PASS"}, output: "The outage is over.", expected: true},
+		"judge fails":               {check: evalCheck{Type: evalCheckJudge, Criteria: "mentions the outage", RecordedVerdict: "FAIL: no outage"}, output: "All good.", expected: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			judge := newScriptedLanguageModel(scriptedTurn{Response: test.check.RecordedVerdict})
+			result := runEvalCheck(test.check, "alice: the database is down", test.output, judge)
+			require.Equal(t, test.expected, result.Passed, result.Detail)
+		})
+	}
+}
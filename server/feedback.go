@@ -0,0 +1,301 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Ratings users can give to a response.
+const (
+	FeedbackRatingUp   = "up"
+	FeedbackRatingDown = "down"
+)
+
+const feedbackCommentMaxLength = 2000
+
+// PromptTemplateProp records the prompt template of responses whose template can't be told from their
+// other props, such as summaries of unread posts.
+const PromptTemplateProp = "llm_prompt_template"
+
+var errFeedbackNotFound = errors.New("feedback not found")
+
+// Feedback is the rating one user gave to one bot response.
+type Feedback struct {
+	PostID         string `json:"post_id"`
+	UserID         string `json:"user_id"`
+	BotID          string `json:"bot_id"`
+	BotName        string `json:"bot_name"`
+	ChannelID      string `json:"channel_id"`
+	RootID         string `json:"root_id"`
+	PromptTemplate string `json:"prompt_template"`
+	Model          string `json:"model"`
+	Rating         string `json:"rating"`
+	Comment        string `json:"comment"`
+	CreateAt       int64  `json:"create_at"`
+	UpdateAt       int64  `json:"update_at"`
+}
+
+// FeedbackFilter selects the feedback that is aggregated or exported. Zero values match everything.
+type FeedbackFilter struct {
+	BotName        string
+	Model          string
+	PromptTemplate string
+	Since          int64
+	Until          int64
+}
+
+// FeedbackStats aggregates the ratings of the responses of a bot made with one model and prompt template.
+type FeedbackStats struct {
+	BotName        string  `json:"bot_name"`
+	Model          string  `json:"model"`
+	PromptTemplate string  `json:"prompt_template"`
+	Up             int     `json:"up"`
+	Down           int     `json:"down"`
+	Satisfaction   float64 `json:"satisfaction"`
+}
+
+func (f FeedbackFilter) apply(query sq.SelectBuilder) sq.SelectBuilder {
+	if f.BotName != "" {
+		query = query.Where(sq.Eq{"BotName": f.BotName})
+	}
+	if f.Model != "" {
+		query = query.Where(sq.Eq{"Model": f.Model})
+	}
+	if f.PromptTemplate != "" {
+		query = query.Where(sq.Eq{"PromptTemplate": f.PromptTemplate})
+	}
+	if f.Since != 0 {
+		query = query.Where(sq.GtOrEq{"UpdateAt": f.Since})
+	}
+	if f.Until != 0 {
+		query = query.Where(sq.Lt{"UpdateAt": f.Until})
+	}
+	return query
+}
+
+func (p *Plugin) getFeedback(postID, userID string) (Feedback, error) {
+	var feedback []Feedback
+	if err := p.doQuery(&feedback, p.builder.Select("*").
+		From("LLM_Feedback").
+		Where(sq.Eq{"PostID": postID, "UserID": userID}),
+	); err != nil {
+		return Feedback{}, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	if len(feedback) == 0 {
+		return Feedback{}, errFeedbackNotFound
+	}
+	return feedback[0], nil
+}
+
+// getUserFeedback returns the feedback of the user on the given responses, for the ones they rated.
+func (p *Plugin) getUserFeedback(userID string, postIDs []string) ([]Feedback, error) {
+	var feedback []Feedback
+	if err := p.doQuery(&feedback, p.getUserFeedbackQuery(userID, postIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	return feedback, nil
+}
+
+func (p *Plugin) getUserFeedbackQuery(userID string, postIDs []string) sq.SelectBuilder {
+	return p.builder.Select("*").
+		From("LLM_Feedback").
+		Where(sq.Eq{"UserID": userID, "PostID": postIDs})
+}
+
+// saveFeedback replaces the previous feedback of the user on the same response. The response may have been
+// regenerated since, so the model and prompt template are replaced as well.
+func (p *Plugin) saveFeedback(feedback Feedback) error {
+	_, err := p.execBuilder(p.saveFeedbackQuery(feedback))
+	if err != nil {
+		return fmt.Errorf("failed to save feedback: %w", err)
+	}
+	return nil
+}
+
+func (p *Plugin) saveFeedbackQuery(feedback Feedback) sq.InsertBuilder {
+	return p.builder.Insert("LLM_Feedback").
+		SetMap(map[string]interface{}{
+			"PostID":         feedback.PostID,
+			"UserID":         feedback.UserID,
+			"BotID":          feedback.BotID,
+			"BotName":        feedback.BotName,
+			"ChannelID":      feedback.ChannelID,
+			"RootID":         feedback.RootID,
+			"PromptTemplate": feedback.PromptTemplate,
+			"Model":          feedback.Model,
+			"Rating":         feedback.Rating,
+			"Comment":        feedback.Comment,
+			"CreateAt":       feedback.CreateAt,
+			"UpdateAt":       feedback.UpdateAt,
+		}).
+		Suffix("ON CONFLICT (PostID, UserID) DO UPDATE SET Rating = EXCLUDED.Rating, Comment = EXCLUDED.Comment, " +
+			"Model = EXCLUDED.Model, PromptTemplate = EXCLUDED.PromptTemplate, UpdateAt = EXCLUDED.UpdateAt")
+}
+
+func (p *Plugin) deleteFeedback(postID, userID string) error {
+	if _, err := p.execBuilder(p.builder.Delete("LLM_Feedback").
+		Where(sq.Eq{"PostID": postID, "UserID": userID}),
+	); err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+	return nil
+}
+
+func (p *Plugin) getFeedbackStats(filter FeedbackFilter) ([]FeedbackStats, error) {
+	var stats []FeedbackStats
+	if err := p.doQuery(&stats, filter.apply(p.builder.
+		Select(
+			"BotName",
+			"Model",
+			"PromptTemplate",
+			"COUNT(*) FILTER (WHERE Rating = 'up') AS Up",
+			"COUNT(*) FILTER (WHERE Rating = 'down') AS Down",
+		).
+		From("LLM_Feedback").
+		GroupBy("BotName", "Model", "PromptTemplate").
+		OrderBy("BotName", "Model", "PromptTemplate")),
+	); err != nil {
+		return nil, fmt.Errorf("failed to get feedback stats: %w", err)
+	}
+
+	for i := range stats {
+		if total := stats[i].Up + stats[i].Down; total > 0 {
+			stats[i].Satisfaction = float64(stats[i].Up) / float64(total)
+		}
+	}
+	return stats, nil
+}
+
+// feedbackCursor is the position of a feedback in the order searchFeedback returns them.
+type feedbackCursor struct {
+	UpdateAt int64
+	PostID   string
+	UserID   string
+}
+
+func (f Feedback) cursor() *feedbackCursor {
+	return &feedbackCursor{UpdateAt: f.UpdateAt, PostID: f.PostID, UserID: f.UserID}
+}
+
+// searchFeedback returns the matching feedback, oldest first so exports can be resumed. Only feedback
+// after the cursor is returned when it is given.
+func (p *Plugin) searchFeedback(filter FeedbackFilter, after *feedbackCursor, limit int) ([]Feedback, error) {
+	var feedback []Feedback
+	if err := p.doQuery(&feedback, p.searchFeedbackQuery(filter, after, limit)); err != nil {
+		return nil, fmt.Errorf("failed to search feedback: %w", err)
+	}
+	return feedback, nil
+}
+
+func (p *Plugin) searchFeedbackQuery(filter FeedbackFilter, after *feedbackCursor, limit int) sq.SelectBuilder {
+	query := filter.apply(p.builder.Select("*").
+		From("LLM_Feedback").
+		OrderBy("UpdateAt ASC", "PostID ASC", "UserID ASC").
+		Limit(uint64(limit)))
+	if after != nil {
+		query = query.Where(sq.Expr("(UpdateAt, PostID, UserID) > (?, ?, ?)", after.UpdateAt, after.PostID, after.UserID))
+	}
+	return query
+}
+
+// responsePromptTemplate tells which prompt template and task produced a bot response. Replies in a
+// conversation about a thread continue with the template of the thread analysis.
+func (p *Plugin) responsePromptTemplate(post *model.Post) (string, llm.Task, error) {
+	if template, ok := post.GetProp(PromptTemplateProp).(string); ok && template != "" {
+		return template, llm.TaskThreadAnalysis, nil
+	}
+
+	if post.GetProp(ThreadIDProp) != nil {
+		switch post.GetProp(AnalysisTypeProp) {
+		case "action_items":
+			return llm.PromptFindActionItems, llm.TaskThreadAnalysis, nil
+		case "open_questions":
+			return llm.PromptFindOpenQuestions, llm.TaskThreadAnalysis, nil
+		}
+		return llm.PromptSummarizeThread, llm.TaskThreadAnalysis, nil
+	}
+
+	if post.GetProp(ReferencedRecordingFileID) != nil || post.GetProp(ReferencedTranscriptPostID) != nil {
+		return llm.PromptMeetingSummary, llm.TaskFinalSummary, nil
+	}
+
+	if post.RootId != "" {
+		root, err := p.pluginAPI.Post.GetPost(post.RootId)
+		if err != nil {
+			return "", llm.TaskChat, fmt.Errorf("unable to get root post: %w", err)
+		}
+		if root.GetProp(ThreadIDProp) != nil {
+			return llm.PromptSummarizeThread, llm.TaskChat, nil
+		}
+	}
+
+	return llm.PromptDirectMessageQuestion, llm.TaskChat, nil
+}
+
+// newFeedback describes the rating of a response. The model is the one recorded with the displayed version
+// of the response, or the one the bot is configured with for the task when the response was never
+// regenerated.
+func (p *Plugin) newFeedback(bot *Bot, post *model.Post, userID, rating, comment string) (Feedback, error) {
+	template, task, err := p.responsePromptTemplate(post)
+	if err != nil {
+		return Feedback{}, err
+	}
+
+	modelName := responseModelOf(post)
+	if modelName == "" {
+		modelName = bot.cfg.ModelForTask(task)
+	}
+	if version := responseVersionOf(post); version != 0 {
+		displayed, err := p.getResponseVersion(post.Id, version)
+		if err != nil && !errors.Is(err, errResponseVersionNotFound) {
+			return Feedback{}, err
+		}
+		if displayed.Model != "" {
+			modelName = displayed.Model
+		}
+	}
+
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+	now := model.GetMillis()
+	return Feedback{
+		PostID:         post.Id,
+		UserID:         userID,
+		BotID:          bot.mmBot.UserId,
+		BotName:        bot.cfg.Name,
+		ChannelID:      post.ChannelId,
+		RootID:         rootID,
+		PromptTemplate: template,
+		Model:          modelName,
+		Rating:         rating,
+		Comment:        comment,
+		CreateAt:       now,
+		UpdateAt:       now,
+	}, nil
+}
+
+// FeedbackExportRecord is one line of the feedback dataset: the rating and the conversation up to the
+// rated response.
+type FeedbackExportRecord struct {
+	Feedback
+	Conversation []ExportedMessage `json:"conversation"`
+}
+
+// feedbackConversation returns the messages of the thread up to and including the rated response.
+func feedbackConversation(export *ThreadExport, postID string) []ExportedMessage {
+	for i, message := range export.Messages {
+		if message.ID == postID {
+			return export.Messages[:i+1]
+		}
+	}
+	return export.Messages
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponsePromptTemplate(t *testing.T) {
+	withProps := func(post *model.Post, props map[string]any) *model.Post {
+		for key, value := range props {
+			post.AddProp(key, value)
+		}
+		return post
+	}
+
+	for name, test := range map[string]struct {
+		post             *model.Post
+		root             *model.Post
+		expectedTemplate string
+		expectedTask     llm.Task
+	}{
+		"direct message": {
+			post:             &model.Post{Id: "responseid", RootId: "rootid"},
+			root:             &model.Post{Id: "rootid"},
+			expectedTemplate: llm.PromptDirectMessageQuestion,
+			expectedTask:     llm.TaskChat,
+		},
+		"thread analysis": {
+			post:             withProps(&model.Post{Id: "responseid"}, map[string]any{ThreadIDProp: "threadid", AnalysisTypeProp: "action_items"}),
+			expectedTemplate: llm.PromptFindActionItems,
+			expectedTask:     llm.TaskThreadAnalysis,
+		},
+		"question about an analyzed thread": {
+			post:             &model.Post{Id: "responseid", RootId: "rootid"},
+			root:             withProps(&model.Post{Id: "rootid"}, map[string]any{ThreadIDProp: "threadid", AnalysisTypeProp: "summarize_thread"}),
+			expectedTemplate: llm.PromptSummarizeThread,
+			expectedTask:     llm.TaskChat,
+		},
+		"meeting summary": {
+			post:             withProps(&model.Post{Id: "responseid", RootId: "rootid"}, map[string]any{ReferencedTranscriptPostID: "transcriptionid"}),
+			expectedTemplate: llm.PromptMeetingSummary,
+			expectedTask:     llm.TaskFinalSummary,
+		},
+		"summary of unreads": {
+			post:             withProps(&model.Post{Id: "responseid"}, map[string]any{PromptTemplateProp: llm.PromptSummarizeChannelSince}),
+			expectedTemplate: llm.PromptSummarizeChannelSince,
+			expectedTask:     llm.TaskThreadAnalysis,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := SetupTestEnvironment(t)
+			defer e.Cleanup(t)
+
+			if test.root != nil {
+				e.mockAPI.On("GetPost", test.root.Id).Return(test.root, nil)
+			}
+
+			template, task, err := e.plugin.responsePromptTemplate(test.post)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedTemplate, template)
+			require.Equal(t, test.expectedTask, task)
+		})
+	}
+}
+
+func TestFeedbackConversation(t *testing.T) {
+	export := &ThreadExport{Messages: []ExportedMessage{{ID: "question"}, {ID: "answer"}, {ID: "followup"}}}
+
+	require.Equal(t, []ExportedMessage{{ID: "question"}, {ID: "answer"}}, feedbackConversation(export, "answer"))
+	require.Len(t, feedbackConversation(export, "unknown"), 3)
+}
+
+func TestSearchFeedbackQuery(t *testing.T) {
+	p := &Plugin{builder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar)}
+	filter := FeedbackFilter{BotName: "ai", Until: 2000}
+
+	query, args, err := p.searchFeedbackQuery(filter, nil, 100).ToSql()
+	require.NoError(t, err)
+	require.NotContains(t, query, "OFFSET")
+	require.Equal(t, []interface{}{"ai", int64(2000)}, args)
+
+	after := Feedback{PostID: "postid", UserID: "userid", UpdateAt: 1000}.cursor()
+	query, args, err = p.searchFeedbackQuery(filter, after, 100).ToSql()
+	require.NoError(t, err)
+	require.Contains(t, query, "(UpdateAt, PostID, UserID) > ($3, $4, $5)")
+	require.Contains(t, query, "ORDER BY UpdateAt ASC, PostID ASC, UserID ASC LIMIT 100")
+	require.Equal(t, []interface{}{"ai", int64(2000), int64(1000), "postid", "userid"}, args)
+}
+
+func TestGetUserFeedbackQuery(t *testing.T) {
+	p := &Plugin{builder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar)}
+
+	query, args, err := p.getUserFeedbackQuery("userid", []string{"post1", "post2"}).ToSql()
+	require.NoError(t, err)
+	require.Contains(t, query, "PostID IN ($1,$2)")
+	require.Contains(t, query, "UserID = $3")
+	require.Equal(t, []interface{}{"post1", "post2", "userid"}, args)
+}
+
+func TestSaveFeedbackQuery(t *testing.T) {
+	p := &Plugin{builder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar)}
+
+	query, _, err := p.saveFeedbackQuery(Feedback{PostID: "postid", UserID: "userid", Model: "regenerated"}).ToSql()
+	require.NoError(t, err)
+	require.Contains(t, query, "Model = EXCLUDED.Model", "the rating applies to the response displayed now")
+	require.Contains(t, query, "PromptTemplate = EXCLUDED.PromptTemplate")
+}
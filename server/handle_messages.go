@@ -4,11 +4,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -34,7 +38,25 @@ func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
 	}
 }
 
-func (p *Plugin) handleMessages(post *model.Post) error {
+func (p *Plugin) handleMessages(post *model.Post) (err error) {
+	ctx, span := llm.Tracer().Start(context.Background(), "handleMessages", trace.WithAttributes(
+		attribute.String("post.id", post.Id),
+		attribute.String("channel.id", post.ChannelId),
+		attribute.String("user.id", post.UserId),
+	))
+	defer func() {
+		// Ignoring a post is not a failure
+		if errors.Is(err, ErrNoResponse) {
+			span.End()
+			return
+		}
+		llm.EndSpan(span, err)
+	}()
+
+	if p.isShuttingDown() {
+		return fmt.Errorf("shutting down: %w", ErrNoResponse)
+	}
+
 	// Don't respond to ourselves
 	if p.IsAnyBot(post.UserId) {
 		return fmt.Errorf("not responding to ourselves: %w", ErrNoResponse)
@@ -77,35 +99,35 @@ func (p *Plugin) handleMessages(post *model.Post) error {
 
 	// Check we are mentioned like @ai
 	if bot := p.GetBotMentioned(post.Message); bot != nil {
-		return p.handleMentions(bot, post, postingUser, channel)
+		return p.handleMentions(ctx, bot, post, postingUser, channel)
 	}
 
 	// Check if this is post in the DM channel with any bot
 	if bot := p.GetBotForDMChannel(channel); bot != nil {
-		return p.handleDMs(bot, channel, postingUser, post)
+		return p.handleDMs(ctx, bot, channel, postingUser, post)
 	}
 
 	return nil
 }
 
-func (p *Plugin) handleMentions(bot *Bot, post *model.Post, postingUser *model.User, channel *model.Channel) error {
+func (p *Plugin) handleMentions(ctx context.Context, bot *Bot, post *model.Post, postingUser *model.User, channel *model.Channel) error {
 	if err := p.checkUsageRestrictions(postingUser.Id, bot, channel); err != nil {
 		return err
 	}
 
-	if err := p.processUserRequestToBot(bot, p.MakeConversationContext(bot, postingUser, channel, post)); err != nil {
+	if err := p.processUserRequestToBot(bot, p.MakeConversationContext(ctx, bot, postingUser, channel, post)); err != nil {
 		return fmt.Errorf("unable to process bot mention: %w", err)
 	}
 
 	return nil
 }
 
-func (p *Plugin) handleDMs(bot *Bot, channel *model.Channel, postingUser *model.User, post *model.Post) error {
+func (p *Plugin) handleDMs(ctx context.Context, bot *Bot, channel *model.Channel, postingUser *model.User, post *model.Post) error {
 	if err := p.checkUsageRestrictionsForUser(bot, postingUser.Id); err != nil {
 		return err
 	}
 
-	if err := p.processUserRequestToBot(bot, p.MakeConversationContext(bot, postingUser, channel, post)); err != nil {
+	if err := p.processUserRequestToBot(bot, p.MakeConversationContext(ctx, bot, postingUser, channel, post)); err != nil {
 		return fmt.Errorf("unable to process bot DM: %w", err)
 	}
 
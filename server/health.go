@@ -0,0 +1,327 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+)
+
+// Outcomes of a health check.
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusError   = "error"
+	HealthStatusSkipped = "skipped"
+)
+
+// Names of the health checks.
+const (
+	HealthCheckAuth             = "auth"
+	HealthCheckModel            = "model"
+	HealthCheckCompletion       = "completion"
+	HealthCheckTranscription    = "transcription"
+	HealthCheckFFmpeg           = "ffmpeg"
+	HealthCheckUpstreamHostname = "upstream_hostname"
+)
+
+const (
+	healthCheckTimeout          = 30 * time.Second
+	healthCheckCompletionPrompt = "Reply with the word OK and nothing else."
+	healthCheckCompletionTokens = 10
+)
+
+// HealthCheck is the outcome of testing one thing a bot or the plugin depends on.
+type HealthCheck struct {
+	Name       string `json:"name"`
+	Target     string `json:"target,omitempty"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// BotHealth holds the checks of the service of a bot.
+type BotHealth struct {
+	BotName     string        `json:"bot_name"`
+	DisplayName string        `json:"display_name"`
+	ServiceType string        `json:"service_type"`
+	Model       string        `json:"model"`
+	Healthy     bool          `json:"healthy"`
+	Checks      []HealthCheck `json:"checks"`
+}
+
+// HealthReport holds the checks of every bot and of what the plugin needs regardless of the bot.
+type HealthReport struct {
+	Healthy           bool          `json:"healthy"`
+	Bots              []BotHealth   `json:"bots"`
+	FFmpeg            HealthCheck   `json:"ffmpeg"`
+	UpstreamHostnames []HealthCheck `json:"upstream_hostnames"`
+}
+
+// timedHealthCheck runs check and records how long it took. The check returns a message and an error.
+func timedHealthCheck(name, target string, check func() (string, error)) HealthCheck {
+	start := time.Now()
+	message, err := check()
+	result := HealthCheck{
+		Name:       name,
+		Target:     target,
+		Status:     HealthStatusOK,
+		Message:    message,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = HealthStatusError
+		result.Message = err.Error()
+	}
+	return result
+}
+
+func skippedHealthCheck(name, reason string) HealthCheck {
+	return HealthCheck{
+		Name:    name,
+		Status:  HealthStatusSkipped,
+		Message: reason,
+	}
+}
+
+func healthy(checks ...HealthCheck) bool {
+	for _, check := range checks {
+		if check.Status == HealthStatusError {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHealth runs every check for the configured bots and the plugin.
+func (p *Plugin) checkHealth(ctx context.Context) HealthReport {
+	cfg := p.getConfiguration()
+
+	report := HealthReport{
+		Bots: make([]BotHealth, len(cfg.Bots)),
+	}
+
+	var wg sync.WaitGroup
+	for i, botConfig := range cfg.Bots {
+		wg.Add(1)
+		go func(i int, botConfig llm.BotConfig) {
+			defer wg.Done()
+			report.Bots[i] = p.checkBotHealth(ctx, botConfig)
+		}(i, botConfig)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		report.UpstreamHostnames = p.checkUpstreamHostnames(ctx, cfg.AllowedUpstreamHostnames)
+	}()
+	report.FFmpeg = p.checkFFmpeg(ctx)
+	wg.Wait()
+
+	report.Healthy = report.FFmpeg.Status != HealthStatusError && healthy(report.UpstreamHostnames...)
+	for _, bot := range report.Bots {
+		report.Healthy = report.Healthy && bot.Healthy
+	}
+
+	return report
+}
+
+// checkBotHealth tests the service of a bot, which doesn't have to be saved in the configuration yet.
+// The credentials and the model are checked first, and a tiny completion is only requested if they work.
+func (p *Plugin) checkBotHealth(ctx context.Context, botConfig llm.BotConfig) BotHealth {
+	health := BotHealth{
+		BotName:     botConfig.Name,
+		DisplayName: botConfig.DisplayName,
+		ServiceType: botConfig.Service.Type,
+		Model:       botConfig.Service.DefaultModel,
+	}
+
+	authCheck, modelCheck := p.checkBotCredentials(ctx, botConfig)
+	health.Checks = append(health.Checks, authCheck, modelCheck)
+
+	if authCheck.Status == HealthStatusError {
+		health.Checks = append(health.Checks, skippedHealthCheck(HealthCheckCompletion, "the service could not be reached with these credentials"))
+	} else {
+		health.Checks = append(health.Checks, timedHealthCheck(HealthCheckCompletion, "", func() (string, error) {
+			return p.checkBotCompletion(ctx, botConfig)
+		}))
+	}
+
+	if botConfig.Name != "" && botConfig.Name == p.getConfiguration().TranscriptGenerator {
+		health.Checks = append(health.Checks, timedHealthCheck(HealthCheckTranscription, "", func() (string, error) {
+			if !serviceSupportsTranscription(botConfig.Service.Type) {
+				return "", fmt.Errorf("the %s service can't transcribe recordings", botConfig.Service.Type)
+			}
+			if authCheck.Status == HealthStatusError {
+				return "", errors.New("the service could not be reached with these credentials")
+			}
+			return "this bot transcribes recordings with the whisper-1 model", nil
+		}))
+	}
+
+	// Errors of the services may quote the credentials they were sent.
+	resolved, _ := p.resolveBotSecrets(botConfig)
+	for i := range health.Checks {
+		health.Checks[i].Message = p.secrets.redact(health.Checks[i].Message, resolved.Service.SecretValues()...)
+	}
+
+	health.Healthy = healthy(health.Checks...)
+	return health
+}
+
+// checkBotCredentials returns the auth and model checks, which come from the same request to the service.
+func (p *Plugin) checkBotCredentials(ctx context.Context, botConfig llm.BotConfig) (HealthCheck, HealthCheck) {
+	if _, problems := p.resolveBotSecrets(botConfig); len(problems) > 0 {
+		authCheck := HealthCheck{
+			Name:    HealthCheckAuth,
+			Status:  HealthStatusError,
+			Message: problems[0].Error(),
+		}
+		return authCheck, skippedHealthCheck(HealthCheckModel, "the credentials could not be verified")
+	}
+
+	llmMetrics := p.metricsService.GetMetricsForAIService(botConfig.Name, botConfig.Service.Type)
+	languageModel := p.newLanguageModel(botConfig, llmMetrics)
+	if languageModel == nil {
+		authCheck := HealthCheck{
+			Name:    HealthCheckAuth,
+			Status:  HealthStatusError,
+			Message: fmt.Sprintf("unknown service type %q", botConfig.Service.Type),
+		}
+		return authCheck, skippedHealthCheck(HealthCheckModel, "the credentials could not be verified")
+	}
+
+	checker, ok := languageModel.(llm.ModelChecker)
+	if !ok {
+		reason := fmt.Sprintf("not supported by the %q service", botConfig.Service.Type)
+		return skippedHealthCheck(HealthCheckAuth, reason), skippedHealthCheck(HealthCheckModel, reason)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.CheckModel(ctx, botConfig.Service.DefaultModel)
+	duration := time.Since(start).Milliseconds()
+
+	authCheck := HealthCheck{Name: HealthCheckAuth, Status: HealthStatusOK, DurationMs: duration}
+	modelCheck := HealthCheck{Name: HealthCheckModel, Target: botConfig.Service.DefaultModel, Status: HealthStatusOK, DurationMs: duration}
+	switch {
+	case err == nil:
+	case errors.Is(err, llm.ErrModelNotFound) || upstreamStatusCode(err) == http.StatusNotFound:
+		modelCheck.Status = HealthStatusError
+		modelCheck.Message = err.Error()
+	default:
+		authCheck.Status = HealthStatusError
+		authCheck.Message = err.Error()
+		if upstreamStatusCode(err) == http.StatusUnauthorized || upstreamStatusCode(err) == http.StatusForbidden {
+			authCheck.Message = "the credentials were rejected: " + err.Error()
+		}
+		modelCheck = skippedHealthCheck(HealthCheckModel, "the credentials could not be verified")
+	}
+
+	return authCheck, modelCheck
+}
+
+// checkBotCompletion asks for a few tokens through the same path as every other request of the bot.
+func (p *Plugin) checkBotCompletion(ctx context.Context, botConfig llm.BotConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	type completion struct {
+		response string
+		err      error
+	}
+	done := make(chan completion, 1)
+	go func() {
+		conversation := llm.BotConversation{
+			Posts: []llm.Post{{Role: llm.PostRoleUser, Message: healthCheckCompletionPrompt}},
+			Tools: llm.NewNoTools(),
+		}
+		response, err := p.getLLM(botConfig).ChatCompletionNoStream(conversation,
+			llm.WithOperation(llm.OperationHealthCheck),
+			llm.WithMaxGeneratedTokens(healthCheckCompletionTokens),
+		)
+		done <- completion{response: response, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return "", result.err
+		}
+		if strings.TrimSpace(result.response) == "" {
+			return "", errors.New("the model returned an empty response")
+		}
+		return fmt.Sprintf("the model answered %q", strings.TrimSpace(result.response)), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("no response within %s", healthCheckTimeout)
+	}
+}
+
+func (p *Plugin) checkFFmpeg(ctx context.Context) HealthCheck {
+	if p.ffmpegPath == "" {
+		return HealthCheck{
+			Name:    HealthCheckFFmpeg,
+			Status:  HealthStatusError,
+			Message: "ffmpeg was not found, recordings can't be transcribed",
+		}
+	}
+
+	return timedHealthCheck(HealthCheckFFmpeg, p.ffmpegPath, func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+
+		output, err := p.ffmpegCommand(ctx, "-version").Output()
+		if err != nil {
+			return "", fmt.Errorf("unable to run ffmpeg: %w", err)
+		}
+		version, _, _ := strings.Cut(string(output), "\n")
+		return version, nil
+	})
+}
+
+// checkUpstreamHostnames makes a request to each allowed hostname. Any HTTP response means the host is
+// reachable. Wildcard patterns can't be checked.
+func (p *Plugin) checkUpstreamHostnames(ctx context.Context, allowedHostnames string) []HealthCheck {
+	hostnames := parseAllowedHostnames(allowedHostnames)
+	checks := make([]HealthCheck, len(hostnames))
+
+	client := p.createExternalHTTPClient()
+	client.Timeout = healthCheckTimeout
+
+	var wg sync.WaitGroup
+	for i, hostname := range hostnames {
+		if strings.Contains(hostname, "*") {
+			checks[i] = skippedHealthCheck(HealthCheckUpstreamHostname, "wildcard patterns can't be checked")
+			checks[i].Target = hostname
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, hostname string) {
+			defer wg.Done()
+			checks[i] = timedHealthCheck(HealthCheckUpstreamHostname, hostname, func() (string, error) {
+				request, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://"+hostname+"/", nil)
+				if err != nil {
+					return "", err
+				}
+				response, err := client.Do(request)
+				if err != nil {
+					return "", err
+				}
+				response.Body.Close()
+				return response.Status, nil
+			})
+		}(i, hostname)
+	}
+	wg.Wait()
+
+	return checks
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeOpenAIServer serves the model list and streamed completions of an OpenAI compatible service.
+func newFakeOpenAIServer(t *testing.T, apiKey string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+apiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/models":
+			fmt.Fprint(w, `{"object": "list", "data": [{"id": "good-model", "object": "model"}]}`)
+		case "/chat/completions":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": \"OK\"}}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckBotHealth(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	server := newFakeOpenAIServer(t, "goodkey")
+	e.plugin.llmUpstreamHTTPClient = server.Client()
+	e.plugin.metricsService = metrics.NewMetrics(metrics.InstanceInfo{})
+	e.plugin.setConfiguration(makeConfig(Config{}))
+
+	botConfig := func(apiKey, model string) llm.BotConfig {
+		return llm.BotConfig{
+			Name: "ai",
+			Service: llm.ServiceConfig{
+				Type:         llm.ServiceTypeOpenAICompatible,
+				APIURL:       server.URL,
+				APIKey:       apiKey,
+				DefaultModel: model,
+			},
+		}
+	}
+	statuses := func(health BotHealth) map[string]string {
+		result := map[string]string{}
+		for _, check := range health.Checks {
+			result[check.Name] = check.Status
+		}
+		return result
+	}
+
+	t.Run("working service", func(t *testing.T) {
+		health := e.plugin.checkBotHealth(context.Background(), botConfig("goodkey", "good-model"))
+		require.True(t, health.Healthy)
+		require.Equal(t, map[string]string{
+			HealthCheckAuth:       HealthStatusOK,
+			HealthCheckModel:      HealthStatusOK,
+			HealthCheckCompletion: HealthStatusOK,
+		}, statuses(health))
+	})
+
+	t.Run("rejected key", func(t *testing.T) {
+		health := e.plugin.checkBotHealth(context.Background(), botConfig("badkey", "good-model"))
+		require.False(t, health.Healthy)
+		require.Equal(t, map[string]string{
+			HealthCheckAuth:       HealthStatusError,
+			HealthCheckModel:      HealthStatusSkipped,
+			HealthCheckCompletion: HealthStatusSkipped,
+		}, statuses(health))
+		require.Contains(t, health.Checks[0].Message, "credentials were rejected")
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		health := e.plugin.checkBotHealth(context.Background(), botConfig("goodkey", "missing-model"))
+		require.False(t, health.Healthy)
+		require.Equal(t, HealthStatusOK, statuses(health)[HealthCheckAuth])
+		require.Equal(t, HealthStatusError, statuses(health)[HealthCheckModel])
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		e.plugin.setConfiguration(makeConfig(Config{TranscriptGenerator: "other"}))
+		defer e.plugin.setConfiguration(makeConfig(Config{}))
+
+		health := e.plugin.checkBotHealth(context.Background(), llm.BotConfig{
+			Name:    "other",
+			Service: llm.ServiceConfig{Type: "other"},
+		})
+		require.Equal(t, map[string]string{
+			HealthCheckAuth:          HealthStatusError,
+			HealthCheckModel:         HealthStatusSkipped,
+			HealthCheckCompletion:    HealthStatusSkipped,
+			HealthCheckTranscription: HealthStatusError,
+		}, statuses(health))
+	})
+}
+
+func TestCheckFFmpegMissing(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	check := e.plugin.checkFFmpeg(context.Background())
+	require.Equal(t, HealthStatusError, check.Status)
+}
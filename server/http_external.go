@@ -5,7 +5,9 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/mattermost/mattermost/server/public/shared/httpservice"
@@ -64,6 +66,36 @@ func parseAllowedHostnames(allowedHostnames string) []string {
 	return cleaned
 }
 
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9\-_]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9\-_]*[A-Za-z0-9])?)*$`)
+
+// validateHostnamePattern reports patterns that can never match, such as URLs or hostnames with a port.
+func validateHostnamePattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+
+	hostname := strings.TrimPrefix(pattern, "*.")
+	if net.ParseIP(hostname) != nil {
+		if hostname != pattern {
+			return fmt.Errorf("%q: wildcards can't be used with IP addresses", pattern)
+		}
+		return nil
+	}
+	if strings.Contains(hostname, "://") || strings.Contains(hostname, "/") {
+		return fmt.Errorf("%q: must be a hostname, not a URL", pattern)
+	}
+	if strings.Contains(hostname, ":") {
+		return fmt.Errorf("%q: must not include a port", pattern)
+	}
+	if strings.Contains(hostname, "*") {
+		return fmt.Errorf("%q: wildcards are only supported as a leading \"*.\"", pattern)
+	}
+	if !hostnamePattern.MatchString(hostname) {
+		return fmt.Errorf("%q: is not a valid hostname", pattern)
+	}
+	return nil
+}
+
 // restrictedTransport wraps an http.RoundTripper to enforce hostname restrictions
 type restrictedTransport struct {
 	wrapped      http.RoundTripper
@@ -0,0 +1,539 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCanceled  JobStatus = "canceled"
+)
+
+const (
+	JobTypeSummarizeRecording     = "summarize_recording"
+	JobTypeSummarizeTranscription = "summarize_transcription"
+)
+
+// Post props used to show the state of the job working on a post.
+const (
+	JobIDProp       = "llm_job_id"
+	JobStatusProp   = "llm_job_status"
+	JobProgressProp = "llm_job_progress"
+)
+
+const (
+	DefaultJobMaxAttempts = 3
+
+	// A running job holds a lease on its row which is renewed while it runs. If the node running it dies
+	// the lease expires and another node picks the job up again.
+	jobLeaseDuration     = 2 * time.Minute
+	jobHeartbeatInterval = 30 * time.Second
+	jobPollInterval      = 10 * time.Second
+	jobRetryBaseDelay    = 30 * time.Second
+	jobWorkers           = 2
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type Job struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Status      JobStatus `json:"status"`
+	PostID      string    `json:"post_id"`
+	UserID      string    `json:"user_id"`
+	BotID       string    `json:"bot_id"`
+	Payload     string    `json:"-"`
+	State       string    `json:"-"`
+	Progress    string    `json:"progress"`
+	Error       string    `json:"-"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	RunAt       int64     `json:"run_at"`
+	LockedBy    string    `json:"-"`
+	LockedUntil int64     `json:"-"`
+	CreateAt    int64     `json:"create_at"`
+	UpdateAt    int64     `json:"update_at"`
+}
+
+// JobErrorFailed is what users are told about a failed attempt of a job. The error itself may contain
+// upstream URLs or responses, so it is only logged.
+const JobErrorFailed = "failed"
+
+// JobResponse is a job as reported to users.
+type JobResponse struct {
+	*Job
+	Error string `json:"error,omitempty"`
+}
+
+func newJobResponse(job *Job) JobResponse {
+	response := JobResponse{Job: job}
+	if job.Error != "" {
+		response.Error = JobErrorFailed
+	}
+	return response
+}
+
+// JobContext is handed to a running job to report progress.
+type JobContext struct {
+	context.Context
+	Job *Job
+
+	plugin *Plugin
+}
+
+// SetProgress records a human readable progress message on the job and its post.
+func (c *JobContext) SetProgress(progress string) {
+	c.Job.Progress = progress
+	if _, err := c.plugin.execBuilder(c.plugin.builder.Update("LLM_Jobs").
+		Set("Progress", progress).
+		Set("UpdateAt", model.GetMillis()).
+		Where(sq.Eq{"ID": c.Job.ID})); err != nil {
+		c.plugin.pluginAPI.Log.Error("Unable to save job progress", "job_id", c.Job.ID, "error", err)
+	}
+	c.plugin.updateJobPost(c.Job)
+}
+
+// SaveState records what the job has done so far, so that a retry or a resume on another node picks up
+// from there instead of repeating it.
+func (c *JobContext) SaveState(state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to marshal job state: %w", err)
+	}
+
+	if _, err := c.plugin.execBuilder(c.plugin.builder.Update("LLM_Jobs").
+		Set("State", string(data)).
+		Set("UpdateAt", model.GetMillis()).
+		Where(sq.Eq{"ID": c.Job.ID})); err != nil {
+		return fmt.Errorf("unable to save job state: %w", err)
+	}
+	c.Job.State = string(data)
+
+	return nil
+}
+
+// LoadState reads the state saved by a previous attempt of the job. state is left untouched when there is none.
+func (c *JobContext) LoadState(state any) error {
+	if c.Job.State == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(c.Job.State), state); err != nil {
+		return fmt.Errorf("unable to parse job state: %w", err)
+	}
+	return nil
+}
+
+type jobHandler func(jobCtx *JobContext) error
+
+// JobQueue runs jobs stored in the database. Every node of a cluster runs a queue and the
+// nodes compete for pending jobs, so a job survives plugin restarts and node failures.
+type JobQueue struct {
+	plugin   *Plugin
+	nodeID   string
+	handlers map[string]jobHandler
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	runningLock sync.Mutex
+	running     map[string]context.CancelCauseFunc
+}
+
+func NewJobQueue(p *Plugin) *JobQueue {
+	return &JobQueue{
+		plugin:   p,
+		nodeID:   p.nodeID,
+		handlers: map[string]jobHandler{},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		running:  map[string]context.CancelCauseFunc{},
+	}
+}
+
+func (q *JobQueue) RegisterHandler(jobType string, handler jobHandler) {
+	q.handlers[jobType] = handler
+}
+
+// Start launches the workers. Jobs left behind by a previous activation are resumed once their lease expires.
+func (q *JobQueue) Start() {
+	for i := 0; i < jobWorkers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Stop cancels the running jobs with ErrServerShutdown and waits for the workers to exit. Jobs that were
+// interrupted are released so they can be resumed right away by another node or the next activation.
+func (q *JobQueue) Stop() {
+	close(q.stop)
+
+	q.runningLock.Lock()
+	for _, cancel := range q.running {
+		cancel(ErrServerShutdown)
+	}
+	q.runningLock.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.failExhaustedJobs()
+		for q.runNext() {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue stores a new job and wakes up the local workers.
+func (q *JobQueue) Enqueue(jobType string, postID string, userID string, botID string, payload any) (*Job, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal job payload: %w", err)
+	}
+
+	now := model.GetMillis()
+	job := &Job{
+		ID:          model.NewId(),
+		Type:        jobType,
+		Status:      JobStatusPending,
+		PostID:      postID,
+		UserID:      userID,
+		BotID:       botID,
+		Payload:     string(payloadJSON),
+		MaxAttempts: DefaultJobMaxAttempts,
+		RunAt:       now,
+		CreateAt:    now,
+		UpdateAt:    now,
+	}
+
+	if _, err := q.plugin.execBuilder(q.plugin.builder.Insert("LLM_Jobs").
+		Columns("ID", "Type", "Status", "PostID", "UserID", "BotID", "Payload", "MaxAttempts", "RunAt", "CreateAt", "UpdateAt").
+		Values(job.ID, job.Type, job.Status, job.PostID, job.UserID, job.BotID, job.Payload, job.MaxAttempts, job.RunAt, job.CreateAt, job.UpdateAt)); err != nil {
+		return nil, fmt.Errorf("unable to save job: %w", err)
+	}
+
+	q.plugin.updateJobPost(job)
+	q.notify()
+
+	return job, nil
+}
+
+// claimNext atomically takes the next runnable job, either pending or abandoned by a node whose lease expired.
+func (q *JobQueue) claimNext() (*Job, error) {
+	now := model.GetMillis()
+	var job Job
+	err := q.plugin.db.Get(&job, q.plugin.db.Rebind(`
+		UPDATE LLM_Jobs
+		SET Status = ?, LockedBy = ?, LockedUntil = ?, Attempts = Attempts + 1, UpdateAt = ?
+		WHERE ID = (
+			SELECT ID FROM LLM_Jobs
+			WHERE ((Status = ? AND RunAt <= ?) OR (Status = ? AND LockedUntil < ?))
+			AND Attempts < MaxAttempts
+			ORDER BY RunAt
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`), JobStatusRunning, q.nodeID, now+jobLeaseDuration.Milliseconds(), now, JobStatusPending, now, JobStatusRunning, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// runNext runs a single job if one is available and reports whether it did.
+func (q *JobQueue) runNext() bool {
+	job, err := q.claimNext()
+	if err != nil {
+		q.plugin.pluginAPI.Log.Error("Unable to claim job", "error", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	q.runJob(job)
+	return true
+}
+
+func (q *JobQueue) runJob(job *Job) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	q.runningLock.Lock()
+	q.running[job.ID] = cancel
+	q.runningLock.Unlock()
+	defer func() {
+		q.runningLock.Lock()
+		delete(q.running, job.ID)
+		q.runningLock.Unlock()
+	}()
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go q.heartbeat(job, cancel, heartbeatDone)
+
+	q.plugin.updateJobPost(job)
+
+	err := q.handle(&JobContext{Context: ctx, Job: job, plugin: q.plugin})
+	if err != nil && (errors.Is(err, ErrServerShutdown) || errors.Is(context.Cause(ctx), ErrServerShutdown)) {
+		// Interrupted by deactivation, let the job be resumed without spending an attempt.
+		q.release(job)
+		return
+	}
+
+	q.finish(job, err)
+}
+
+func (q *JobQueue) handle(jobCtx *JobContext) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	handler, ok := q.handlers[jobCtx.Job.Type]
+	if !ok {
+		return fmt.Errorf("no handler for job type %s", jobCtx.Job.Type)
+	}
+
+	return handler(jobCtx)
+}
+
+// heartbeat renews the lease of a running job and cancels it when the lease is lost,
+// which happens when the job is canceled through the API.
+func (q *JobQueue) heartbeat(job *Job, cancel context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			result, err := q.plugin.execBuilder(q.plugin.builder.Update("LLM_Jobs").
+				Set("LockedUntil", model.GetMillis()+jobLeaseDuration.Milliseconds()).
+				Where(sq.Eq{"ID": job.ID, "LockedBy": q.nodeID, "Status": JobStatusRunning}))
+			if err != nil {
+				q.plugin.pluginAPI.Log.Warn("Unable to renew job lease", "job_id", job.ID, "error", err)
+				continue
+			}
+			if rows, _ := result.RowsAffected(); rows == 0 {
+				cancel(nil)
+				return
+			}
+		}
+	}
+}
+
+func (q *JobQueue) finish(job *Job, jobErr error) {
+	now := model.GetMillis()
+	update := q.plugin.builder.Update("LLM_Jobs").
+		Set("LockedBy", "").
+		Set("LockedUntil", 0).
+		Set("UpdateAt", now).
+		Where(sq.Eq{"ID": job.ID, "LockedBy": q.nodeID, "Status": JobStatusRunning})
+
+	switch {
+	case jobErr == nil:
+		job.Status = JobStatusSucceeded
+		job.Error = ""
+	case job.Attempts < job.MaxAttempts:
+		q.plugin.pluginAPI.Log.Warn("Job failed, will retry", "job_id", job.ID, "type", job.Type, "attempt", job.Attempts, "error", jobErr)
+		job.Status = JobStatusPending
+		job.Error = jobErr.Error()
+		update = update.Set("RunAt", now+jobRetryDelay(job.Attempts).Milliseconds())
+	default:
+		q.plugin.pluginAPI.Log.Error("Job failed", "job_id", job.ID, "type", job.Type, "error", jobErr)
+		job.Status = JobStatusFailed
+		job.Error = jobErr.Error()
+	}
+
+	result, err := q.plugin.execBuilder(update.Set("Status", job.Status).Set("Error", job.Error))
+	if err != nil {
+		q.plugin.pluginAPI.Log.Error("Unable to save job result", "job_id", job.ID, "error", err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// The job was canceled or taken over by another node while it ran.
+		return
+	}
+
+	q.plugin.updateJobPost(job)
+	if job.Status == JobStatusPending {
+		q.notify()
+	}
+}
+
+func (q *JobQueue) release(job *Job) {
+	if _, err := q.plugin.execBuilder(q.plugin.builder.Update("LLM_Jobs").
+		Set("Status", JobStatusPending).
+		Set("Attempts", sq.Expr("GREATEST(Attempts - 1, 0)")).
+		Set("LockedBy", "").
+		Set("LockedUntil", 0).
+		Set("RunAt", model.GetMillis()).
+		Where(sq.Eq{"ID": job.ID, "LockedBy": q.nodeID, "Status": JobStatusRunning})); err != nil {
+		q.plugin.pluginAPI.Log.Error("Unable to release job", "job_id", job.ID, "error", err)
+	}
+}
+
+// failExhaustedJobs marks jobs as failed when their last attempt was abandoned by a node that went away.
+func (q *JobQueue) failExhaustedJobs() {
+	var jobs []Job
+	if err := q.plugin.doQuery(&jobs, q.plugin.builder.
+		Select("*").
+		From("LLM_Jobs").
+		Where(sq.Eq{"Status": JobStatusRunning}).
+		Where(sq.Lt{"LockedUntil": model.GetMillis()}).
+		Where("Attempts >= MaxAttempts")); err != nil {
+		q.plugin.pluginAPI.Log.Error("Unable to get abandoned jobs", "error", err)
+		return
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		result, err := q.plugin.execBuilder(q.plugin.builder.Update("LLM_Jobs").
+			Set("Status", JobStatusFailed).
+			Set("Error", "job was abandoned").
+			Set("UpdateAt", model.GetMillis()).
+			Where(sq.Eq{"ID": job.ID, "Status": JobStatusRunning, "LockedUntil": job.LockedUntil}))
+		if err != nil {
+			q.plugin.pluginAPI.Log.Error("Unable to fail abandoned job", "job_id", job.ID, "error", err)
+			continue
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+		job.Status = JobStatusFailed
+		q.plugin.updateJobPost(job)
+	}
+}
+
+// Cancel stops a pending or running job. A job running on another node notices on its next heartbeat.
+func (q *JobQueue) Cancel(job *Job) error {
+	result, err := q.plugin.execBuilder(q.plugin.builder.Update("LLM_Jobs").
+		Set("Status", JobStatusCanceled).
+		Set("LockedBy", "").
+		Set("LockedUntil", 0).
+		Set("UpdateAt", model.GetMillis()).
+		Where(sq.Eq{"ID": job.ID, "Status": []JobStatus{JobStatusPending, JobStatusRunning}}))
+	if err != nil {
+		return fmt.Errorf("unable to cancel job: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("job is not pending or running")
+	}
+
+	q.runningLock.Lock()
+	if cancel, ok := q.running[job.ID]; ok {
+		cancel(nil)
+	}
+	q.runningLock.Unlock()
+
+	job.Status = JobStatusCanceled
+	q.plugin.updateJobPost(job)
+
+	return nil
+}
+
+// jobRetryDelay grows quadratically with the number of attempts made.
+func jobRetryDelay(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * jobRetryBaseDelay
+}
+
+func (p *Plugin) getLatestJobForPost(postID string) (*Job, error) {
+	var jobs []Job
+	if err := p.doQuery(&jobs, p.builder.
+		Select("*").
+		From("LLM_Jobs").
+		Where(sq.Eq{"PostID": postID}).
+		OrderBy("CreateAt DESC").
+		Limit(1)); err != nil {
+		return nil, fmt.Errorf("failed to get job for post: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	return &jobs[0], nil
+}
+
+// updateJobPost reflects the job state on its post. Failed and canceled jobs replace the post message
+// so the user is not left waiting on a post that will never be completed.
+func (p *Plugin) updateJobPost(job *Job) {
+	post, err := p.pluginAPI.Post.GetPost(job.PostID)
+	if err != nil {
+		p.pluginAPI.Log.Warn("Unable to get post of job", "job_id", job.ID, "error", err)
+		return
+	}
+
+	locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
+	if user, userErr := p.pluginAPI.User.Get(job.UserID); userErr == nil {
+		locale = user.Locale
+	}
+	T := i18nLocalizerFunc(p.i18n, locale)
+
+	post.AddProp(JobIDProp, job.ID)
+	post.AddProp(JobStatusProp, string(job.Status))
+	post.AddProp(JobProgressProp, job.Progress)
+	switch job.Status {
+	case JobStatusFailed:
+		post.Message = T("copilot.job_failed", "Sorry! Something went wrong. Check the server logs for details.")
+	case JobStatusCanceled:
+		post.Message = T("copilot.job_canceled", "This request was canceled.")
+	case JobStatusPending:
+		if job.Attempts > 0 {
+			post.AddProp(JobProgressProp, T("copilot.job_retrying", "Something went wrong, retrying (attempt %d of %d)...", job.Attempts+1, job.MaxAttempts))
+		}
+	}
+
+	if err := p.pluginAPI.Post.UpdatePost(post); err != nil {
+		p.pluginAPI.Log.Warn("Unable to update post of job", "job_id", job.ID, "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobRetryDelay(t *testing.T) {
+	require.Equal(t, 30*time.Second, jobRetryDelay(1))
+	require.Equal(t, 2*time.Minute, jobRetryDelay(2))
+	require.Equal(t, 270*time.Second, jobRetryDelay(3))
+}
+
+func TestJobQueueHandle(t *testing.T) {
+	q := NewJobQueue(&Plugin{})
+
+	t.Run("unknown job type", func(t *testing.T) {
+		err := q.handle(&JobContext{Job: &Job{Type: "unknown"}})
+		require.Error(t, err)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		expected := errors.New("failed")
+		q.RegisterHandler("failing", func(jobCtx *JobContext) error {
+			return expected
+		})
+		require.ErrorIs(t, q.handle(&JobContext{Job: &Job{Type: "failing"}}), expected)
+	})
+
+	t.Run("handler panic", func(t *testing.T) {
+		q.RegisterHandler("panicking", func(jobCtx *JobContext) error {
+			panic("boom")
+		})
+		err := q.handle(&JobContext{Job: &Job{Type: "panicking"}})
+		require.ErrorContains(t, err, "boom")
+	})
+}
+
+func TestJobContextLoadState(t *testing.T) {
+	type state struct {
+		PostID string `json:"post_id"`
+	}
+
+	t.Run("first attempt", func(t *testing.T) {
+		loaded := state{PostID: "unchanged"}
+		require.NoError(t, (&JobContext{Job: &Job{}}).LoadState(&loaded))
+		require.Equal(t, "unchanged", loaded.PostID)
+	})
+
+	t.Run("saved by a previous attempt", func(t *testing.T) {
+		var loaded state
+		require.NoError(t, (&JobContext{Job: &Job{State: `{"post_id":"postid"}`}}).LoadState(&loaded))
+		require.Equal(t, "postid", loaded.PostID)
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		var loaded state
+		require.Error(t, (&JobContext{Job: &Job{State: "{"}}).LoadState(&loaded))
+	})
+}
+
+func TestJobResponseHidesError(t *testing.T) {
+	job := &Job{ID: "jobid", Status: JobStatusFailed, Error: "POST https://llm.internal/v1/chat: 500 upstream body"}
+	data, err := json.Marshal(newJobResponse(job))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "llm.internal")
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, JobErrorFailed, decoded["error"])
+	require.Equal(t, "jobid", decoded["id"])
+
+	data, err = json.Marshal(newJobResponse(&Job{ID: "jobid", Status: JobStatusSucceeded}))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"error"`)
+}
@@ -3,6 +3,12 @@
 
 package llm
 
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
 type ServiceConfig struct {
 	Name         string `json:"name"`
 	Type         string `json:"type"`
@@ -20,6 +26,23 @@ type ServiceConfig struct {
 
 	// Otherwise known as maxTokens
 	OutputTokenLimit int `json:"outputTokenLimit"`
+
+	// Maximum number of requests sent to the service at the same time, further requests wait in a queue.
+	// Zero uses DefaultMaxConcurrentRequests.
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+
+	// Default sampling parameters for every request, can be overridden per call.
+	SamplingParameters
+}
+
+const DefaultMaxConcurrentRequests = 10
+
+// ConcurrencyLimit returns the maximum number of concurrent requests to the service.
+func (c *ServiceConfig) ConcurrencyLimit() int {
+	if c.MaxConcurrentRequests <= 0 {
+		return DefaultMaxConcurrentRequests
+	}
+	return c.MaxConcurrentRequests
 }
 
 type ChannelAccessLevel int
@@ -62,35 +85,176 @@ type BotConfig struct {
 	UserIDs            []string           `json:"userIDs"`
 	TeamIDs            []string           `json:"teamIDs"`
 	MaxFileSize        int64              `json:"maxFileSize"`
+	TaskModels         TaskModels         `json:"taskModels"`
 }
 
-func (c *BotConfig) IsValid() bool {
-	// Basic validation
-	if c.Name == "" || c.DisplayName == "" || c.Service.Type == "" {
-		return false
+// TaskModels lets a bot route individual tasks to a different model than the service default.
+// An empty value means the service default model is used for that task.
+type TaskModels struct {
+	Chat           string `json:"chat"`
+	Title          string `json:"title"`
+	Emoji          string `json:"emoji"`
+	ChunkSummary   string `json:"chunkSummary"`
+	FinalSummary   string `json:"finalSummary"`
+	ThreadAnalysis string `json:"threadAnalysis"`
+}
+
+type Task int
+
+const (
+	TaskChat Task = iota
+	TaskTitle
+	TaskEmoji
+	TaskChunkSummary
+	TaskFinalSummary
+	TaskThreadAnalysis
+)
+
+// Operation returns the operation requests for the task are labeled with in metrics, audit records and traces.
+func (t Task) Operation() string {
+	switch t {
+	case TaskTitle:
+		return OperationTitle
+	case TaskEmoji:
+		return OperationEmoji
+	case TaskChunkSummary, TaskFinalSummary:
+		return OperationSummary
+	case TaskThreadAnalysis:
+		return OperationAnalysis
+	}
+	return OperationChat
+}
+
+// ModelForTask returns the model configured for the given task, falling back to the service default.
+func (c *BotConfig) ModelForTask(task Task) string {
+	var model string
+	switch task {
+	case TaskChat:
+		model = c.TaskModels.Chat
+	case TaskTitle:
+		model = c.TaskModels.Title
+	case TaskEmoji:
+		model = c.TaskModels.Emoji
+	case TaskChunkSummary:
+		model = c.TaskModels.ChunkSummary
+	case TaskFinalSummary:
+		model = c.TaskModels.FinalSummary
+	case TaskThreadAnalysis:
+		model = c.TaskModels.ThreadAnalysis
+	}
+
+	if model == "" {
+		return c.Service.DefaultModel
+	}
+	return model
+}
+
+// ValidationError describes what is wrong with one field of the configuration.
+type ValidationError struct {
+	// Bot is the name of the bot the field belongs to, empty for fields that apply to the whole plugin.
+	Bot     string `json:"bot,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Bot != "" {
+		return fmt.Sprintf("bot %q: %s: %s", e.Bot, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+var botNamePattern = regexp.MustCompile(`^[a-z][a-z0-9.\-_]*$`)
+
+// Validate returns what is wrong with the bot configuration, nothing if it is valid.
+// Fields are named by their JSON names.
+func (c *BotConfig) Validate() []ValidationError {
+	var problems []ValidationError
+	problem := func(field, message string) {
+		problems = append(problems, ValidationError{Bot: c.Name, Field: field, Message: message})
+	}
+
+	if c.Name == "" {
+		problem("name", "is required")
+	} else if !botNamePattern.MatchString(c.Name) {
+		problem("name", "must start with a lowercase letter and only contain lowercase letters, numbers, periods, dashes and underscores")
+	}
+	if c.DisplayName == "" {
+		problem("displayName", "is required")
 	}
 
-	// Validate access levels are within bounds
 	if c.ChannelAccessLevel < ChannelAccessLevelAll || c.ChannelAccessLevel > ChannelAccessLevelNone {
-		return false
+		problem("channelAccessLevel", "is not a known access level")
 	}
 	if c.UserAccessLevel < UserAccessLevelAll || c.UserAccessLevel > UserAccessLevelNone {
-		return false
+		problem("userAccessLevel", "is not a known access level")
+	}
+
+	if c.Service.Temperature != nil && (*c.Service.Temperature < 0 || *c.Service.Temperature > 2) {
+		problem("service.temperature", "must be between 0 and 2")
+	}
+	if c.Service.TopP != nil && (*c.Service.TopP <= 0 || *c.Service.TopP > 1) {
+		problem("service.topP", "must be greater than 0 and at most 1")
+	}
+
+	requireAPIKey := func() {
+		if c.Service.APIKey == "" {
+			problem("service.apiKey", "is required for this service")
+		}
+	}
+	requireAPIURL := func() {
+		if c.Service.APIURL == "" {
+			problem("service.apiURL", "is required for this service")
+			return
+		}
+		if parsed, err := url.Parse(c.Service.APIURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problem("service.apiURL", "must be an http or https URL")
+		}
 	}
 
-	// Service-specific validation
 	switch c.Service.Type {
+	case "":
+		problem("service.type", "is required")
 	case ServiceTypeOpenAI:
-		return c.Service.APIKey != ""
+		requireAPIKey()
+	case ServiceTypeAnthropic:
+		requireAPIKey()
+		// Anthropic has a narrower temperature range than OpenAI and no sampling seed.
+		if c.Service.Temperature != nil && *c.Service.Temperature > 1 {
+			problem("service.temperature", "must be between 0 and 1 for this service")
+		}
+		if c.Service.Seed != nil {
+			problem("service.seed", "is not supported by this service")
+		}
 	case ServiceTypeOpenAICompatible:
-		return c.Service.APIURL != ""
+		requireAPIURL()
 	case ServiceTypeAzure:
-		return c.Service.APIKey != "" && c.Service.APIURL != ""
-	case ServiceTypeAnthropic:
-		return c.Service.APIKey != ""
+		requireAPIKey()
+		requireAPIURL()
 	case ServiceTypeAskSage:
-		return c.Service.Username != "" && c.Service.Password != ""
+		if c.Service.Username == "" {
+			problem("service.username", "is required for this service")
+		}
+		if c.Service.Password == "" {
+			problem("service.password", "is required for this service")
+		}
+		// Ask Sage only exposes temperature.
+		if c.Service.TopP != nil {
+			problem("service.topP", "is not supported by this service")
+		}
+		if c.Service.Seed != nil {
+			problem("service.seed", "is not supported by this service")
+		}
+		if len(c.Service.StopSequences) > 0 {
+			problem("service.stopSequences", "are not supported by this service")
+		}
 	default:
-		return false
+		problem("service.type", fmt.Sprintf("%q is not a known service", c.Service.Type))
 	}
+
+	return problems
+}
+
+func (c *BotConfig) IsValid() bool {
+	return len(c.Validate()) == 0
 }
@@ -305,6 +305,62 @@ func TestBotConfig_IsValid(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "Valid OpenAI configuration with sampling parameters",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Type:   "openai",
+					APIKey: "sk-xyz",
+					SamplingParameters: SamplingParameters{
+						Temperature:   floatPtr(0.2),
+						TopP:          floatPtr(0.9),
+						StopSequences: []string{"###"},
+					},
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: true,
+		},
+		{
+			name: "Temperature out of range",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Type:   "openai",
+					APIKey: "sk-xyz",
+					SamplingParameters: SamplingParameters{
+						Temperature: floatPtr(2.5), // bad
+					},
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: false,
+		},
+		{
+			name: "TopP out of range",
+			fields: fields{
+				ID:          "xxx",
+				Name:        "xxx",
+				DisplayName: "xxx",
+				Service: ServiceConfig{
+					Type:   "anthropic",
+					APIKey: "sk-xyz",
+					SamplingParameters: SamplingParameters{
+						TopP: floatPtr(0), // bad
+					},
+				},
+				ChannelAccessLevel: ChannelAccessLevelAll,
+				UserAccessLevel:    UserAccessLevelAll,
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -327,3 +383,128 @@ func TestBotConfig_IsValid(t *testing.T) {
 		})
 	}
 }
+
+func floatPtr(f float32) *float32 {
+	return &f
+}
+
+func TestBotConfig_ModelForTask(t *testing.T) {
+	cfg := BotConfig{
+		Service: ServiceConfig{DefaultModel: "large-model"},
+		TaskModels: TaskModels{
+			Title:        "small-model",
+			Emoji:        "small-model",
+			ChunkSummary: "medium-model",
+		},
+	}
+
+	assert.Equal(t, "large-model", cfg.ModelForTask(TaskChat))
+	assert.Equal(t, "small-model", cfg.ModelForTask(TaskTitle))
+	assert.Equal(t, "small-model", cfg.ModelForTask(TaskEmoji))
+	assert.Equal(t, "medium-model", cfg.ModelForTask(TaskChunkSummary))
+	assert.Equal(t, "large-model", cfg.ModelForTask(TaskFinalSummary))
+	assert.Equal(t, "large-model", cfg.ModelForTask(TaskThreadAnalysis))
+}
+
+func TestWithModelEmptyKeepsDefault(t *testing.T) {
+	cfg := LanguageModelConfig{Model: "default"}
+	WithModel("")(&cfg)
+	assert.Equal(t, "default", cfg.Model)
+	WithModel("other")(&cfg)
+	assert.Equal(t, "other", cfg.Model)
+}
+
+func TestWithTask(t *testing.T) {
+	botConfig := BotConfig{
+		Service:    ServiceConfig{DefaultModel: "large-model"},
+		TaskModels: TaskModels{Title: "small-model"},
+	}
+
+	cfg := LanguageModelConfig{Model: "default"}
+	WithTask(botConfig, TaskTitle)(&cfg)
+	assert.Equal(t, "small-model", cfg.Model)
+	assert.Equal(t, OperationTitle, cfg.Operation)
+
+	WithTask(botConfig, TaskFinalSummary)(&cfg)
+	assert.Equal(t, "large-model", cfg.Model)
+	assert.Equal(t, OperationSummary, cfg.Operation)
+
+	WithTask(botConfig, TaskThreadAnalysis)(&cfg)
+	assert.Equal(t, OperationAnalysis, cfg.Operation)
+}
+
+func TestApplyDeterministicSampling(t *testing.T) {
+	serviceTemperature := float32(0.9)
+	serviceSeed := 3
+	deterministicSeed := 42
+	service := SamplingParameters{Temperature: &serviceTemperature, Seed: &serviceSeed}
+
+	t.Run("overrides the service defaults", func(t *testing.T) {
+		cfg := LanguageModelConfig{SamplingParameters: service}
+		WithDeterministicSampling()(&cfg)
+		cfg.ApplyDeterministicSampling(&deterministicSeed)
+		assert.Equal(t, float32(0), *cfg.Temperature)
+		assert.Equal(t, deterministicSeed, *cfg.Seed)
+	})
+
+	t.Run("keeps explicit options", func(t *testing.T) {
+		cfg := LanguageModelConfig{SamplingParameters: service}
+		WithTemperature(0.5)(&cfg)
+		WithSeed(7)(&cfg)
+		WithDeterministicSampling()(&cfg)
+		cfg.ApplyDeterministicSampling(&deterministicSeed)
+		assert.Equal(t, float32(0.5), *cfg.Temperature)
+		assert.Equal(t, 7, *cfg.Seed)
+	})
+
+	t.Run("keeps the service defaults without the hint", func(t *testing.T) {
+		cfg := LanguageModelConfig{SamplingParameters: service}
+		cfg.ApplyDeterministicSampling(&deterministicSeed)
+		assert.Equal(t, serviceTemperature, *cfg.Temperature)
+		assert.Equal(t, serviceSeed, *cfg.Seed)
+	})
+}
+
+func TestBotConfig_Validate(t *testing.T) {
+	cfg := BotConfig{
+		Name:        "Copilot",
+		DisplayName: "Copilot",
+		Service: ServiceConfig{
+			Type:   ServiceTypeAzure,
+			APIURL: "mycompany.openai.azure.com",
+		},
+		UserAccessLevel: 7,
+	}
+
+	fields := []string{}
+	for _, problem := range cfg.Validate() {
+		assert.Equal(t, "Copilot", problem.Bot)
+		fields = append(fields, problem.Field)
+	}
+	assert.Equal(t, []string{"name", "userAccessLevel", "service.apiKey", "service.apiURL"}, fields)
+
+	cfg = BotConfig{Name: "copilot", DisplayName: "Copilot", Service: ServiceConfig{Type: "bard"}}
+	assert.Equal(t, []ValidationError{{Bot: "copilot", Field: "service.type", Message: `"bard" is not a known service`}}, cfg.Validate())
+
+	seed := 42
+	cfg = BotConfig{Name: "claude", DisplayName: "Claude", Service: ServiceConfig{
+		Type:               ServiceTypeAnthropic,
+		APIKey:             "sk-xyz",
+		SamplingParameters: SamplingParameters{Temperature: floatPtr(1.5), Seed: &seed},
+	}}
+	assert.Equal(t, []ValidationError{
+		{Bot: "claude", Field: "service.temperature", Message: "must be between 0 and 1 for this service"},
+		{Bot: "claude", Field: "service.seed", Message: "is not supported by this service"},
+	}, cfg.Validate())
+
+	cfg.Service.Type = ServiceTypeOpenAI
+	assert.Empty(t, cfg.Validate())
+
+	cfg = BotConfig{Name: "sage", DisplayName: "Sage", Service: ServiceConfig{
+		Type:               ServiceTypeAskSage,
+		Username:           "user",
+		Password:           "pass",
+		SamplingParameters: SamplingParameters{Temperature: floatPtr(0.5), StopSequences: []string{"###"}},
+	}}
+	assert.Equal(t, []ValidationError{{Bot: "sage", Field: "service.stopSequences", Message: "are not supported by this service"}}, cfg.Validate())
+}
@@ -4,6 +4,7 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/mattermost/mattermost-plugin-ai/server/mmapi"
 	"github.com/mattermost/mattermost/server/public/model"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PostRole int
@@ -47,6 +49,8 @@ type ConversationContext struct {
 	Post               *model.Post
 	PromptParameters   map[string]string
 	CustomInstructions string
+
+	traceContext context.Context
 }
 
 func NewConversationContext(botID string, requestingUser *model.User, channel *model.Channel, post *model.Post) ConversationContext {
@@ -70,6 +74,21 @@ func NewConversationContext(botID string, requestingUser *model.User, channel *m
 	}
 }
 
+// TraceContext returns the context carrying the tracing span the conversation is handled under.
+func (c ConversationContext) TraceContext() context.Context {
+	if c.traceContext == nil {
+		return context.Background()
+	}
+	return c.traceContext
+}
+
+// WithTraceContext returns a copy of the conversation context handled under the span of ctx.
+// Only the span is kept so the cancellation of ctx doesn't carry over.
+func (c ConversationContext) WithTraceContext(ctx context.Context) ConversationContext {
+	c.traceContext = trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	return c
+}
+
 func (c *ConversationContext) IsDMWithBot() bool {
 	return mmapi.IsDMWith(c.BotID, c.Channel)
 }
@@ -3,6 +3,11 @@
 
 package llm
 
+import (
+	"context"
+	"errors"
+)
+
 type LanguageModel interface {
 	ChatCompletion(conversation BotConversation, opts ...LanguageModelOption) (*TextStreamResult, error)
 	ChatCompletionNoStream(conversation BotConversation, opts ...LanguageModelOption) (string, error)
@@ -11,16 +16,71 @@ type LanguageModel interface {
 	InputTokenLimit() int
 }
 
+// ModelChecker is implemented by language models that can verify their credentials and the model
+// they use with the upstream service without generating anything. An empty model means the default one.
+type ModelChecker interface {
+	CheckModel(ctx context.Context, model string) error
+}
+
+// ErrModelNotFound is wrapped by the errors of a ModelChecker when the service doesn't offer the model.
+var ErrModelNotFound = errors.New("model not found")
+
+// ErrUnsupportedSamplingParameter is returned by a LanguageModel when a sampling parameter
+// was explicitly set that the upstream service or model is not able to honor.
+var ErrUnsupportedSamplingParameter = errors.New("unsupported sampling parameter")
+
 type LanguageModelConfig struct {
 	Model              string
 	MaxGeneratedTokens int
 	EnableVision       bool
+
+	SamplingParameters
+
+	// Deterministic is a hint that the caller prefers reproducible output over creativity.
+	// Unlike the explicit sampling parameters it is applied on a best effort basis and never
+	// causes a request to be rejected.
+	Deterministic bool
+
+	// explicitTemperature and explicitSeed record that the sampling was set by a per-call option
+	// rather than taken from the defaults of the service.
+	explicitTemperature bool
+	explicitSeed        bool
+
+	// Operation describes what the request is for. It is only used to label metrics.
+	Operation string
+}
+
+// Operations a language model is used for.
+const (
+	OperationChat        = "chat"
+	OperationSummary     = "summary"
+	OperationAnalysis    = "analysis"
+	OperationTitle       = "title"
+	OperationEmoji       = "emoji"
+	OperationModeration  = "moderation"
+	OperationHealthCheck = "health_check"
+)
+
+// ErrToolCall is wrapped by errors caused by the tools called by the language model.
+var ErrToolCall = errors.New("tool call failed")
+
+// SamplingParameters control how the upstream model samples its output.
+// Nil or empty values mean the upstream default is used.
+type SamplingParameters struct {
+	Temperature   *float32 `json:"temperature,omitempty"`
+	TopP          *float32 `json:"topP,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
 }
 
 type LanguageModelOption func(*LanguageModelConfig)
 
+// WithModel overrides the model used for the request. An empty model leaves the default in place.
 func WithModel(model string) LanguageModelOption {
 	return func(cfg *LanguageModelConfig) {
+		if model == "" {
+			return
+		}
 		cfg.Model = model
 	}
 }
@@ -29,3 +89,64 @@ func WithMaxGeneratedTokens(maxGeneratedTokens int) LanguageModelOption {
 		cfg.MaxGeneratedTokens = maxGeneratedTokens
 	}
 }
+func WithTemperature(temperature float32) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Temperature = &temperature
+		cfg.explicitTemperature = true
+	}
+}
+func WithTopP(topP float32) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.TopP = &topP
+	}
+}
+func WithSeed(seed int) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Seed = &seed
+		cfg.explicitSeed = true
+	}
+}
+func WithStopSequences(stopSequences ...string) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.StopSequences = stopSequences
+	}
+}
+
+// WithDeterministicSampling asks for the most reproducible output the service supports.
+// Used for internal tasks such as title generation and emoji selection.
+func WithDeterministicSampling() LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Deterministic = true
+	}
+}
+
+// ApplyDeterministicSampling replaces the temperature and seed taken from the service defaults with
+// deterministic ones if the caller asked for deterministic sampling. Sampling set by per-call options
+// is kept. A nil seed leaves the seed unset for services that don't support one.
+func (cfg *LanguageModelConfig) ApplyDeterministicSampling(seed *int) {
+	if !cfg.Deterministic {
+		return
+	}
+	if !cfg.explicitTemperature {
+		temperature := float32(0)
+		cfg.Temperature = &temperature
+	}
+	if !cfg.explicitSeed {
+		cfg.Seed = seed
+	}
+}
+
+// WithTask sends the request to the model the bot uses for the task and labels it with the operation of the task.
+func WithTask(botConfig BotConfig, task Task) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		WithModel(botConfig.ModelForTask(task))(cfg)
+		cfg.Operation = task.Operation()
+	}
+}
+
+// WithOperation labels the request with what it is for. Requests made for a task of the bot use WithTask instead.
+func WithOperation(operation string) LanguageModelOption {
+	return func(cfg *LanguageModelConfig) {
+		cfg.Operation = operation
+	}
+}
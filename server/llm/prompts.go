@@ -10,6 +10,9 @@ import (
 	"text/template"
 
 	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Prompts struct {
@@ -38,6 +41,15 @@ func withPromptExtension(filename string) string {
 }
 
 func (p *Prompts) ChatCompletion(templateName string, context ConversationContext, tools ToolStore) (BotConversation, error) {
+	_, span := Tracer().Start(context.TraceContext(), "Prompts.ChatCompletion", trace.WithAttributes(
+		attribute.String("prompt.template", templateName),
+	))
+	conversation, err := p.chatCompletion(templateName, context, tools)
+	EndSpan(span, err)
+	return conversation, err
+}
+
+func (p *Prompts) chatCompletion(templateName string, context ConversationContext, tools ToolStore) (BotConversation, error) {
 	conversation := BotConversation{
 		Posts:   []Post{},
 		Context: context,
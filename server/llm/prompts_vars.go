@@ -14,9 +14,11 @@ const (
 	PromptLocale                           = "locale"
 	PromptMeetingSummary                   = "meeting_summary"
 	PromptMeetingSummaryGeneral            = "meeting_summary_general"
+	PromptModerationClassifier             = "moderation_classifier"
 	PromptStandardPersonality              = "standard_personality"
 	PromptStandardPersonalityWithoutLocale = "standard_personality_without_locale"
 	PromptSummarizeChannelSince            = "summarize_channel_since"
 	PromptSummarizeChunk                   = "summarize_chunk"
 	PromptSummarizeThread                  = "summarize_thread"
+	PromptUntrustedContent                 = "untrusted_content"
 )
@@ -0,0 +1,154 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secrets of a service can be kept out of the Mattermost configuration by referencing an environment
+// variable, like env:MM_PLUGIN_AI_OPENAI_KEY, or a file, like file:/run/secrets/openai.
+const (
+	SecretReferenceEnv  = "env:"
+	SecretReferenceFile = "file:"
+)
+
+// References are limited to the environment variables with SecretEnvPrefix and to the files in the secrets
+// directory, so that whoever edits the configuration can't send the other secrets of the server to a service.
+// The directory is set with the SecretsDirEnv environment variable rather than the configuration for the same reason.
+const (
+	SecretEnvPrefix   = "MM_PLUGIN_AI_"
+	SecretsDirEnv     = "MM_PLUGIN_AI_SECRETS_DIR"
+	DefaultSecretsDir = "/run/secrets"
+)
+
+// RedactedSecret replaces secret values in logs and admin views.
+const RedactedSecret = "********"
+
+// IsSecretReference returns whether the value points to a secret stored outside of the configuration.
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, SecretReferenceEnv) || strings.HasPrefix(value, SecretReferenceFile)
+}
+
+// ResolveSecret returns the secret a reference points to, or the value itself if it isn't a reference.
+// Surrounding whitespace is removed from files so a trailing newline isn't sent as part of the secret.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretReferenceEnv):
+		name := strings.TrimPrefix(value, SecretReferenceEnv)
+		if !strings.HasPrefix(name, SecretEnvPrefix) {
+			return "", fmt.Errorf("environment variable %s can't be referenced, its name must start with %s", name, SecretEnvPrefix)
+		}
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretReferenceFile):
+		path, err := secretFilePath(strings.TrimPrefix(value, SecretReferenceFile))
+		if err != nil {
+			return "", err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret file: %w", err)
+		}
+		secret := strings.TrimSpace(string(contents))
+		if secret == "" {
+			return "", fmt.Errorf("secret file %s is empty", path)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// secretsDir returns the directory secret files must be in.
+func secretsDir() string {
+	if dir := os.Getenv(SecretsDirEnv); dir != "" {
+		return dir
+	}
+	return DefaultSecretsDir
+}
+
+// secretFilePath returns the path of a secret file once links are followed, if it is in the secrets directory.
+func secretFilePath(path string) (string, error) {
+	dir := secretsDir()
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("secret file %s must be an absolute path", path)
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(filepath.Clean(dir))
+	if err != nil {
+		return "", fmt.Errorf("unable to read secrets directory %s: %w", dir, err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file: %w", err)
+	}
+
+	relative, err := filepath.Rel(resolvedDir, resolved)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("secret file %s can't be referenced, it must be in the secrets directory %s", path, dir)
+	}
+	return resolved, nil
+}
+
+type secretField struct {
+	field string
+	value *string
+}
+
+func (c *ServiceConfig) secretFields() []secretField {
+	return []secretField{
+		{field: "service.apiKey", value: &c.APIKey},
+		{field: "service.orgId", value: &c.OrgID},
+		{field: "service.password", value: &c.Password},
+	}
+}
+
+// SecretReferences returns the references used by the secrets of the service.
+func (c ServiceConfig) SecretReferences() []string {
+	var references []string
+	for _, secret := range c.secretFields() {
+		if IsSecretReference(*secret.value) {
+			references = append(references, *secret.value)
+		}
+	}
+	return references
+}
+
+// SecretValues returns the secrets of the service that are stored in plain text in the configuration.
+func (c ServiceConfig) SecretValues() []string {
+	var values []string
+	for _, secret := range c.secretFields() {
+		if *secret.value != "" && !IsSecretReference(*secret.value) {
+			values = append(values, *secret.value)
+		}
+	}
+	return values
+}
+
+// ResolveSecrets returns a copy of the service with its secret references replaced by the values returned
+// by resolve, which defaults to ResolveSecret. Secrets that can't be resolved are left empty.
+func (c ServiceConfig) ResolveSecrets(resolve func(reference string) (string, error)) (ServiceConfig, []ValidationError) {
+	if resolve == nil {
+		resolve = ResolveSecret
+	}
+
+	var problems []ValidationError
+	for _, secret := range c.secretFields() {
+		if !IsSecretReference(*secret.value) {
+			continue
+		}
+		value, err := resolve(*secret.value)
+		if err != nil {
+			problems = append(problems, ValidationError{Field: secret.field, Message: err.Error()})
+		}
+		*secret.value = value
+	}
+	return c, problems
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("MM_PLUGIN_AI_TEST_OPENAI_KEY", "sk-from-env")
+	t.Setenv("TEST_SERVER_SECRET", "server-secret")
+	secretsDir := t.TempDir()
+	t.Setenv(SecretsDirEnv, secretsDir)
+	secretFile := filepath.Join(secretsDir, "openai")
+	require.NoError(t, os.WriteFile(secretFile, []byte("sk-from-file\n"), 0600))
+	emptyFile := filepath.Join(secretsDir, "empty")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0600))
+	outsideFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(outsideFile, []byte("server-secret"), 0600))
+	escapingPath, err := filepath.Rel(secretsDir, outsideFile)
+	require.NoError(t, err)
+	linkFile := filepath.Join(secretsDir, "link")
+	require.NoError(t, os.Symlink(outsideFile, linkFile))
+
+	for name, test := range map[string]struct {
+		value       string
+		expected    string
+		expectedErr string
+	}{
+		"plain text":               {value: "sk-plain", expected: "sk-plain"},
+		"environment variable":     {value: "env:MM_PLUGIN_AI_TEST_OPENAI_KEY", expected: "sk-from-env"},
+		"missing variable":         {value: "env:MM_PLUGIN_AI_TEST_MISSING_KEY", expectedErr: "environment variable MM_PLUGIN_AI_TEST_MISSING_KEY is not set"},
+		"file":                     {value: "file:" + secretFile, expected: "sk-from-file"},
+		"missing file":             {value: "file:" + secretFile + ".missing", expectedErr: "unable to read secret file"},
+		"empty file":               {value: "file:" + emptyFile, expectedErr: "is empty"},
+		"variable without prefix":  {value: "env:TEST_SERVER_SECRET", expectedErr: "must start with MM_PLUGIN_AI_"},
+		"file outside directory":   {value: "file:" + outsideFile, expectedErr: "must be in the secrets directory"},
+		"path escaping directory":  {value: "file:" + secretsDir + "/" + escapingPath, expectedErr: "must be in the secrets directory"},
+		"link outside directory":   {value: "file:" + linkFile, expectedErr: "must be in the secrets directory"},
+		"relative path":            {value: "file:openai", expectedErr: "must be an absolute path"},
+		"secrets directory itself": {value: "file:" + secretsDir, expectedErr: "must be in the secrets directory"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			secret, err := ResolveSecret(test.value)
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, secret)
+		})
+	}
+}
+
+func TestServiceConfigResolveSecrets(t *testing.T) {
+	t.Setenv("MM_PLUGIN_AI_TEST_OPENAI_KEY", "sk-from-env")
+
+	service := ServiceConfig{
+		APIKey:   "env:MM_PLUGIN_AI_TEST_OPENAI_KEY",
+		OrgID:    "org-plain",
+		Password: "env:MM_PLUGIN_AI_TEST_MISSING_PASSWORD",
+	}
+	require.ElementsMatch(t, []string{"env:MM_PLUGIN_AI_TEST_OPENAI_KEY", "env:MM_PLUGIN_AI_TEST_MISSING_PASSWORD"}, service.SecretReferences())
+	require.Equal(t, []string{"org-plain"}, service.SecretValues())
+
+	resolved, problems := service.ResolveSecrets(nil)
+	require.Equal(t, "sk-from-env", resolved.APIKey)
+	require.Equal(t, "org-plain", resolved.OrgID)
+	require.Empty(t, resolved.Password)
+	require.Len(t, problems, 1)
+	require.Equal(t, "service.password", problems[0].Field)
+
+	require.Equal(t, "env:MM_PLUGIN_AI_TEST_OPENAI_KEY", service.APIKey, "the configuration itself is left untouched")
+}
@@ -3,9 +3,27 @@
 
 package llm
 
+import "sync"
+
 type TextStreamResult struct {
 	Stream <-chan string
 	Err    <-chan error
+
+	// QueuePosition receives the position of the request while it waits for a free slot with
+	// the upstream service, and zero once it leaves the queue. Nil if the request was never queued.
+	QueuePosition <-chan int
+
+	// Cancel stops the request: one still waiting for a slot is withdrawn and one already sent is aborted
+	// upstream. Nil if the request can't be canceled.
+	Cancel func()
+
+	// Canceled is closed once the request was canceled. Nothing is sent on the stream after that, so the
+	// producer and anything forwarding the stream must stop sending rather than wait for a reader.
+	Canceled <-chan struct{}
+
+	// Model returns the model generating the response, empty while a queued request waits for a slot.
+	// Nil if the service doesn't report it.
+	Model func() string
 }
 
 func NewStreamFromString(text string) *TextStreamResult {
@@ -24,6 +42,28 @@ func NewStreamFromString(text string) *TextStreamResult {
 	}
 }
 
+// NewCancel returns the Cancel function of a result and the Canceled channel it closes. The cancel
+// function can be called more than once and also calls the given cancel functions.
+func NewCancel(cancels ...func()) (func(), <-chan struct{}) {
+	canceled := make(chan struct{})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(canceled)
+			for _, cancel := range cancels {
+				cancel()
+			}
+		})
+	}, canceled
+}
+
+// Close tells the producer the result is no longer read, so the request is withdrawn or aborted.
+func (t *TextStreamResult) Close() {
+	if t.Cancel != nil {
+		t.Cancel()
+	}
+}
+
 func (t *TextStreamResult) ReadAll() string {
 	result := ""
 	for next := range t.Stream {
@@ -32,3 +72,56 @@ func (t *TextStreamResult) ReadAll() string {
 
 	return result
 }
+
+// StreamObserver is notified of the events of a stream as they pass through it. Nil callbacks are skipped.
+type StreamObserver struct {
+	OnText  func(text string)
+	OnError func(err error)
+	OnDone  func()
+}
+
+// Observe returns a stream delivering the events of t while notifying the observer.
+func (t *TextStreamResult) Observe(observer StreamObserver) *TextStreamResult {
+	output := make(chan string)
+	errChan := make(chan error)
+	go func() {
+		defer close(output)
+		defer close(errChan)
+
+		stream, errs := t.Stream, t.Err
+		for stream != nil || errs != nil {
+			select {
+			case text, ok := <-stream:
+				if !ok {
+					stream = nil
+					continue
+				}
+				if observer.OnText != nil {
+					observer.OnText(text)
+				}
+				select {
+				case output <- text:
+				case <-t.Canceled:
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				if observer.OnError != nil {
+					observer.OnError(err)
+				}
+				select {
+				case errChan <- err:
+				case <-t.Canceled:
+				}
+			}
+		}
+
+		if observer.OnDone != nil {
+			observer.OnDone()
+		}
+	}()
+
+	return &TextStreamResult{Stream: output, Err: errChan, QueuePosition: t.QueuePosition, Cancel: t.Cancel, Canceled: t.Canceled, Model: t.Model}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package subtitles
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astisub"
+)
+
+type Format string
+
+const (
+	FormatUnknown         Format = ""
+	FormatWebVTT          Format = "webvtt"
+	FormatZoomVTT         Format = "zoom_vtt"
+	FormatSRT             Format = "srt"
+	FormatZoomChat        Format = "zoom_chat"
+	FormatTimestampedText Format = "timestamped_text"
+)
+
+// DefaultItemDuration is used as the length of an item when the format only has start times.
+const DefaultItemDuration = 5 * time.Second
+
+// Proportion of cues that need a "Name: " prefix for a WebVTT file to be treated as a Zoom transcript.
+const zoomSpeakerPrefixThreshold = 0.8
+
+var ErrUnknownFormat = errors.New("unknown transcript format")
+
+// ParseError reports a malformed line in a transcript.
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+var (
+	srtTimingRegex       = regexp.MustCompile(`^\d{1,2}:\d{2}:\d{2},\d{3}\s*-->`)
+	zoomChatLineRegex    = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}\t`)
+	timestampedLineRegex = regexp.MustCompile(`^\[?((?:\d{1,2}:)?\d{1,2}:\d{2}(?:\.\d+)?)\]?\s*(?:-\s*)?(.*)$`)
+	speakerPrefixRegex   = regexp.MustCompile(`^([^:<>\n]{1,64}?):\s+(.+)$`)
+)
+
+// DetectFormat guesses the transcript format from its contents.
+func DetectFormat(data []byte) Format {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.TrimLeft(text, " \t\r\n")
+	lines := strings.Split(text, "\n")
+	firstLine := strings.TrimRight(lines[0], "\r")
+
+	switch {
+	case strings.HasPrefix(firstLine, "WEBVTT"):
+		// Voice spans, which Teams uses for speakers, are read by the plain WebVTT parser.
+		if strings.Contains(text, "<v ") {
+			return FormatWebVTT
+		}
+		if hasZoomSpeakerPrefixes(lines) {
+			return FormatZoomVTT
+		}
+		return FormatWebVTT
+	case len(lines) > 1 && isInteger(firstLine) && srtTimingRegex.MatchString(strings.TrimSpace(lines[1])):
+		return FormatSRT
+	case zoomChatLineRegex.MatchString(firstLine):
+		return FormatZoomChat
+	case timestampedLineRegex.MatchString(firstLine):
+		return FormatTimestampedText
+	}
+
+	return FormatUnknown
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.Atoi(strings.TrimSpace(s))
+	return err == nil
+}
+
+// hasZoomSpeakerPrefixes checks if most cue texts in a WebVTT file start with a "Name: " speaker prefix.
+func hasZoomSpeakerPrefixes(lines []string) bool {
+	cues, prefixed := 0, 0
+	for i, line := range lines {
+		if !strings.Contains(line, "-->") || i+1 >= len(lines) {
+			continue
+		}
+		cues++
+		if speakerPrefixRegex.MatchString(strings.TrimSpace(lines[i+1])) {
+			prefixed++
+		}
+	}
+	return cues > 0 && float64(prefixed)/float64(cues) >= zoomSpeakerPrefixThreshold
+}
+
+// NewSubtitlesAutoDetect detects the format of the transcript and parses it.
+func NewSubtitlesAutoDetect(transcript io.Reader) (*Subtitles, Format, error) {
+	data, err := io.ReadAll(transcript)
+	if err != nil {
+		return nil, FormatUnknown, fmt.Errorf("unable to read transcript: %w", err)
+	}
+
+	format := DetectFormat(data)
+	if format == FormatUnknown {
+		return nil, FormatUnknown, ErrUnknownFormat
+	}
+
+	subtitles, err := NewSubtitlesFromFormat(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, format, err
+	}
+
+	return subtitles, format, nil
+}
+
+// NewSubtitlesFromFormat parses the transcript in the given format.
+func NewSubtitlesFromFormat(transcript io.Reader, format Format) (*Subtitles, error) {
+	switch format {
+	case FormatWebVTT:
+		return NewSubtitlesFromVTT(transcript)
+	case FormatZoomVTT:
+		return NewSubtitlesFromZoomVTT(transcript)
+	case FormatSRT:
+		return NewSubtitlesFromSRT(transcript)
+	case FormatZoomChat:
+		return NewSubtitlesFromZoomChat(transcript)
+	case FormatTimestampedText:
+		return NewSubtitlesFromTimestampedText(transcript)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+func NewSubtitlesFromSRT(srt io.Reader) (*Subtitles, error) {
+	storage, err := astisub.ReadFromSRT(srt)
+	if err != nil {
+		return nil, err
+	}
+	return &Subtitles{storage: storage}, nil
+}
+
+// NewSubtitlesFromZoomVTT parses a Zoom transcript, a WebVTT file where the speaker prefixes each cue as "Name: text".
+func NewSubtitlesFromZoomVTT(webvtt io.Reader) (*Subtitles, error) {
+	storage, err := astisub.ReadFromWebVTT(webvtt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range storage.Items {
+		for i, line := range item.Lines {
+			if line.VoiceName != "" || len(line.Items) == 0 {
+				continue
+			}
+			match := speakerPrefixRegex.FindStringSubmatch(line.Items[0].Text)
+			if match == nil {
+				continue
+			}
+			item.Lines[i].VoiceName = strings.TrimSpace(match[1])
+			item.Lines[i].Items[0].Text = match[2]
+		}
+	}
+
+	return &Subtitles{storage: storage}, nil
+}
+
+// NewSubtitlesFromTimestampedText parses plain text where each entry starts with a timestamp,
+// such as "[00:01:23] Name: text" or "01:23 text". Entries end when the next one starts.
+// Lines without a timestamp continue the previous entry.
+func NewSubtitlesFromTimestampedText(text io.Reader) (*Subtitles, error) {
+	storage := astisub.NewSubtitles()
+
+	scanner := bufio.NewScanner(text)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		match := timestampedLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			if len(storage.Items) == 0 {
+				return nil, &ParseError{Line: lineNumber, Message: "expected a timestamp"}
+			}
+			lastLine := &storage.Items[len(storage.Items)-1].Lines[0]
+			lastLine.Items[0].Text += " " + line
+			continue
+		}
+
+		startAt, err := parseTimestamp(match[1])
+		if err != nil {
+			return nil, &ParseError{Line: lineNumber, Message: err.Error()}
+		}
+
+		itemLine := astisub.Line{Items: []astisub.LineItem{{Text: match[2]}}}
+		if speakerMatch := speakerPrefixRegex.FindStringSubmatch(match[2]); speakerMatch != nil {
+			itemLine.VoiceName = strings.TrimSpace(speakerMatch[1])
+			itemLine.Items[0].Text = speakerMatch[2]
+		}
+
+		if len(storage.Items) > 0 {
+			previous := storage.Items[len(storage.Items)-1]
+			if startAt > previous.StartAt {
+				previous.EndAt = startAt
+			}
+		}
+		storage.Items = append(storage.Items, &astisub.Item{
+			StartAt: startAt,
+			EndAt:   startAt + DefaultItemDuration,
+			Lines:   []astisub.Line{itemLine},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read transcript: %w", err)
+	}
+
+	return &Subtitles{storage: storage}, nil
+}
+
+// parseTimestamp parses timestamps of the form HH:MM:SS, MM:SS or either with fractional seconds.
+func parseTimestamp(timestamp string) (time.Duration, error) {
+	parts := strings.Split(timestamp, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds >= 60 {
+		return 0, fmt.Errorf("invalid seconds in timestamp %q", timestamp)
+	}
+	minutes, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil || (len(parts) == 3 && minutes >= 60) {
+		return 0, fmt.Errorf("invalid minutes in timestamp %q", timestamp)
+	}
+	hours := 0
+	if len(parts) == 3 {
+		hours, err = strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid hours in timestamp %q", timestamp)
+		}
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), nil
+}
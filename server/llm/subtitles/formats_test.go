@@ -0,0 +1,194 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package subtitles
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSRT = `1
+00:00:01,000 --> 00:00:04,000
+Welcome to the planning meeting.
+
+2
+00:00:04,500 --> 00:00:07,250
+Let's start with the roadmap.
+`
+
+const testTeamsVTT = `WEBVTT
+
+8a3b1c7e-1111-4b2a-9f0e-2d6c3a1b0e9f/12-0
+00:00:01.000 --> 00:00:03.000
+<v Alice Smith>Can everyone hear me?</v>
+
+8a3b1c7e-1111-4b2a-9f0e-2d6c3a1b0e9f/13-0
+00:00:03.500 --> 00:00:05.000
+<v Bob Jones>Yes, loud and clear.</v>
+`
+
+const testZoomVTT = `WEBVTT
+
+1
+00:00:01.000 --> 00:00:03.000
+Alice Smith: Can everyone hear me?
+
+2
+00:00:03.500 --> 00:00:05.000
+Bob Jones: Yes, loud and clear.
+`
+
+const testTimestampedText = `[00:00:01] Alice Smith: Can everyone hear me?
+[00:00:03] Bob Jones: Yes, loud and clear.
+I joined from my phone.
+[00:01:10] Alice Smith: Great.
+`
+
+const testZoomChat = "00:00:01\tAlice Smith:\tHello everyone\n00:00:05\tBob Jones:\tHi\n\tsecond line\n"
+
+func TestDetectFormat(t *testing.T) {
+	for name, test := range map[string]struct {
+		input    string
+		expected Format
+	}{
+		"webvtt":           {input: testSubtitles, expected: FormatWebVTT},
+		"webvtt with bom":  {input: "\ufeff" + testSubtitles, expected: FormatWebVTT},
+		"teams vtt":        {input: testTeamsVTT, expected: FormatWebVTT},
+		"zoom vtt":         {input: testZoomVTT, expected: FormatZoomVTT},
+		"srt":              {input: testSRT, expected: FormatSRT},
+		"srt with crlf":    {input: strings.ReplaceAll(testSRT, "\n", "\r\n"), expected: FormatSRT},
+		"zoom chat":        {input: testZoomChat, expected: FormatZoomChat},
+		"timestamped text": {input: testTimestampedText, expected: FormatTimestampedText},
+		"short timestamps": {input: "01:23 hello\n02:00 world", expected: FormatTimestampedText},
+		"unknown":          {input: "just some notes\nabout a meeting", expected: FormatUnknown},
+		"empty":            {input: "", expected: FormatUnknown},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, DetectFormat([]byte(test.input)))
+		})
+	}
+}
+
+func TestNewSubtitlesAutoDetect(t *testing.T) {
+	expectedWithSpeakers := `00:01 to 00:03 - Alice Smith: Can everyone hear me?
+00:04 to 00:05 - Bob Jones: Yes, loud and clear.`
+
+	for name, test := range map[string]struct {
+		input    string
+		expected string
+	}{
+		"srt": {
+			input: testSRT,
+			expected: `00:01 to 00:04 - Welcome to the planning meeting.
+00:05 to 00:07 - Let's start with the roadmap.`,
+		},
+		"teams vtt": {input: testTeamsVTT, expected: expectedWithSpeakers},
+		"zoom vtt":  {input: testZoomVTT, expected: expectedWithSpeakers},
+		"timestamped text": {
+			input: testTimestampedText,
+			expected: `00:01 to 00:03 - Alice Smith: Can everyone hear me?
+00:03 to 01:10 - Bob Jones: Yes, loud and clear. I joined from my phone.
+01:10 to 01:15 - Alice Smith: Great.`,
+		},
+		"zoom chat": {
+			input: testZoomChat,
+			expected: `00:01 to 00:06 - Alice Smith:	Hello everyone
+00:05 to 00:10 - Bob Jones:	Hi second line`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			subtitles, _, err := NewSubtitlesAutoDetect(strings.NewReader(test.input))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, subtitles.FormatForLLM())
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, _, err := NewSubtitlesAutoDetect(strings.NewReader("not a transcript"))
+		require.ErrorIs(t, err, ErrUnknownFormat)
+	})
+}
+
+func FuzzNewSubtitlesFromFormat(f *testing.F) {
+	for _, seed := range []string{testSubtitles, testTeamsVTT, testZoomVTT, testSRT, testZoomChat, testTimestampedText} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, format := range []Format{FormatWebVTT, FormatZoomVTT, FormatSRT, FormatZoomChat, FormatTimestampedText} {
+			subtitles, err := NewSubtitlesFromFormat(strings.NewReader(input), format)
+			if err == nil {
+				subtitles.FormatForLLM()
+			}
+		}
+	})
+}
+
+func TestMalformedLines(t *testing.T) {
+	t.Run("short zoom chat line", func(t *testing.T) {
+		_, err := NewSubtitlesFromZoomChat(strings.NewReader("00:00:01\tAlice: hi\n00:01\n"))
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr))
+		require.Equal(t, 2, parseErr.Line)
+	})
+
+	t.Run("bad zoom chat timestamp", func(t *testing.T) {
+		_, err := NewSubtitlesFromZoomChat(strings.NewReader("99:99:99\tAlice: hi\n"))
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr))
+		require.Equal(t, 1, parseErr.Line)
+	})
+
+	t.Run("timestamped text without leading timestamp", func(t *testing.T) {
+		_, err := NewSubtitlesFromTimestampedText(strings.NewReader("hello\n00:01 world\n"))
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr))
+		require.Equal(t, 1, parseErr.Line)
+	})
+
+	t.Run("timestamped text with invalid seconds", func(t *testing.T) {
+		_, err := NewSubtitlesFromTimestampedText(strings.NewReader("00:01 hello\n00:75 world\n"))
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr))
+		require.Equal(t, 2, parseErr.Line)
+	})
+}
+
+func FuzzNewSubtitlesAutoDetect(f *testing.F) {
+	for _, seed := range []string{testSubtitles, testSubtitlesWithSpeakers, testSRT, testTeamsVTT, testZoomVTT, testTimestampedText, testZoomChat, "", "WEBVTT", "1\n00:00:01,000 -->"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		subtitles, _, err := NewSubtitlesAutoDetect(strings.NewReader(input))
+		if err == nil {
+			_ = subtitles.FormatForLLM()
+		}
+	})
+}
+
+func FuzzZoomChat(f *testing.F) {
+	for _, seed := range []string{testZoomChat, "", "00:00:01", "00:00:01\t", "\tcontinued", "12345678901"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		subtitles, err := NewSubtitlesFromZoomChat(strings.NewReader(input))
+		if err == nil {
+			_ = subtitles.FormatForLLM()
+		}
+	})
+}
+
+func FuzzTimestampedText(f *testing.F) {
+	for _, seed := range []string{testTimestampedText, "", "[00:00]", "1:2:3:4 x", "00:00:01.5 - Alice: hi"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		subtitles, err := NewSubtitlesFromTimestampedText(strings.NewReader(input))
+		if err == nil {
+			_ = subtitles.FormatForLLM()
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,27 +18,50 @@ type Subtitles struct {
 	storage *astisub.Subtitles
 }
 
+// zoomChatTimestampLength is the length of the "15:04:05" timestamp that starts each Zoom chat line.
+const zoomChatTimestampLength = 8
+
 func readZoomChat(chat io.Reader) (*astisub.Subtitles, error) {
 	storage := astisub.NewSubtitles()
 
+	zeroTime, err := time.Parse("15:04:05", "00:00:00")
+	if err != nil {
+		return nil, err
+	}
+
 	scanner := bufio.NewScanner(chat)
+	lineNumber := 0
 	for scanner.Scan() {
+		lineNumber++
 		line := scanner.Text()
-		text := line[9:]
-		item := &astisub.Item{}
-		startAt, err := time.Parse("15:04:05", line[:8])
-		if err != nil {
-			return nil, err
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Multi-line messages continue on indented lines
+		if (line[0] == ' ' || line[0] == '\t') && len(storage.Items) > 0 {
+			lastLine := &storage.Items[len(storage.Items)-1].Lines[0]
+			lastLine.Items[0].Text += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		if len(line) <= zoomChatTimestampLength {
+			return nil, &ParseError{Line: lineNumber, Message: "line too short for a zoom chat message"}
 		}
-		zeroTime, err := time.Parse("15:04:05", "00:00:00")
+		startAt, err := time.Parse("15:04:05", line[:zoomChatTimestampLength])
 		if err != nil {
-			return nil, err
+			return nil, &ParseError{Line: lineNumber, Message: fmt.Sprintf("invalid timestamp: %v", err)}
 		}
+
+		item := &astisub.Item{}
 		item.StartAt = startAt.Sub(zeroTime)
-		item.EndAt = startAt.Add(5 * time.Second).Sub(zeroTime)
-		item.Lines = append(item.Lines, astisub.Line{Items: []astisub.LineItem{{Text: text}}})
+		item.EndAt = startAt.Add(DefaultItemDuration).Sub(zeroTime)
+		item.Lines = append(item.Lines, astisub.Line{Items: []astisub.LineItem{{Text: line[zoomChatTimestampLength+1:]}}})
 		storage.Items = append(storage.Items, item)
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read zoom chat: %w", err)
+	}
 	return storage, nil
 }
 
@@ -57,6 +81,30 @@ func NewSubtitlesFromVTT(webvtt io.Reader) (*Subtitles, error) {
 	return &Subtitles{storage: storage}, nil
 }
 
+func NewEmptySubtitles() *Subtitles {
+	return &Subtitles{storage: astisub.NewSubtitles()}
+}
+
+// Append adds all the items of other to the end of the subtitles, shifted by offset.
+func (s *Subtitles) Append(other *Subtitles, offset time.Duration) {
+	for _, item := range other.storage.Items {
+		shifted := *item
+		shifted.Lines = slices.Clone(item.Lines)
+		shifted.StartAt += offset
+		shifted.EndAt += offset
+		s.storage.Items = append(s.storage.Items, &shifted)
+	}
+}
+
+// AppendText adds a single item with the given text spanning start to end.
+func (s *Subtitles) AppendText(start, end time.Duration, text string) {
+	s.storage.Items = append(s.storage.Items, &astisub.Item{
+		StartAt: start,
+		EndAt:   end,
+		Lines:   []astisub.Line{{Items: []astisub.LineItem{{Text: text}}}},
+	})
+}
+
 func (s *Subtitles) WebVTT() io.Reader {
 	reader, writer := io.Pipe()
 	go func() {
@@ -78,14 +126,58 @@ func (s *Subtitles) FormatForLLM() string {
 		result.WriteString(formatDurationForLLM(item.EndAt))
 		result.WriteString(" - ")
 
-		// Words
-		result.WriteString(item.String())
+		// Words, prefixed with the speaker if known
+		result.WriteString(formatItemForLLM(item))
 		result.WriteString("\n")
 	}
 
 	return strings.TrimSpace(result.String())
 }
 
+func formatItemForLLM(item *astisub.Item) string {
+	lines := make([]string, 0, len(item.Lines))
+	for _, line := range item.Lines {
+		if line.VoiceName != "" {
+			lines = append(lines, line.VoiceName+": "+line.String())
+			continue
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, " - ")
+}
+
+// Speakers returns the unique speaker names found in the subtitles in order of first appearance.
+func (s *Subtitles) Speakers() []string {
+	seen := make(map[string]bool)
+	var speakers []string
+	for _, item := range s.storage.Items {
+		for _, line := range item.Lines {
+			if line.VoiceName == "" || seen[line.VoiceName] {
+				continue
+			}
+			seen[line.VoiceName] = true
+			speakers = append(speakers, line.VoiceName)
+		}
+	}
+	return speakers
+}
+
+// HasSpeakers returns true if any part of the subtitles is attributed to a speaker.
+func (s *Subtitles) HasSpeakers() bool {
+	return len(s.Speakers()) > 0
+}
+
+// RenameSpeakers replaces speaker names using the provided mapping. Speakers not in the mapping are left as is.
+func (s *Subtitles) RenameSpeakers(names map[string]string) {
+	for _, item := range s.storage.Items {
+		for i := range item.Lines {
+			if newName, ok := names[item.Lines[i].VoiceName]; ok {
+				item.Lines[i].VoiceName = newName
+			}
+		}
+	}
+}
+
 func (s *Subtitles) FormatTextOnly() string {
 	var result strings.Builder
 	for _, item := range s.storage.Items {
@@ -108,6 +200,11 @@ func (s *Subtitles) IsEmpty() bool {
 	return s.storage.IsEmpty()
 }
 
+// FormatTimestamp formats a duration the same way timestamps are formatted for the LLM.
+func FormatTimestamp(dur time.Duration) string {
+	return formatDurationForLLM(dur)
+}
+
 func formatDurationForLLM(dur time.Duration) string {
 	dur = dur.Round(time.Second)
 	hours := dur / time.Hour
@@ -6,6 +6,7 @@ package subtitles
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +54,60 @@ func TestFormatTextOnly(t *testing.T) {
 
 	require.Equal(t, expectedFormatTextOnly, subtitles.FormatTextOnly())
 }
+
+const testSubtitlesWithSpeakers = `WEBVTT
+
+1
+00:00:00.000 --> 00:00:04.000
+<v Alice Smith>I will take the release notes.
+
+2
+00:00:04.500 --> 00:00:07.000
+<v Bob>Great, I'll review them tomorrow.
+
+3
+00:00:07.000 --> 00:00:09.000
+<v Alice Smith>Sounds good.
+`
+
+const expectedFormatForLLMWithSpeakers = `00:00 to 00:04 - Alice Smith: I will take the release notes.
+00:05 to 00:07 - Bob: Great, I'll review them tomorrow.
+00:07 to 00:09 - Alice Smith: Sounds good.`
+
+func TestSpeakers(t *testing.T) {
+	subtitles, err := NewSubtitlesFromVTT(strings.NewReader(testSubtitlesWithSpeakers))
+	require.NoError(t, err)
+
+	require.True(t, subtitles.HasSpeakers())
+	require.Equal(t, []string{"Alice Smith", "Bob"}, subtitles.Speakers())
+	require.Equal(t, expectedFormatForLLMWithSpeakers, subtitles.FormatForLLM())
+
+	subtitles.RenameSpeakers(map[string]string{"Bob": "Bob Jones (@bob)"})
+	require.Equal(t, []string{"Alice Smith", "Bob Jones (@bob)"}, subtitles.Speakers())
+	require.Contains(t, subtitles.FormatForLLM(), "00:05 to 00:07 - Bob Jones (@bob): Great, I'll review them tomorrow.")
+
+	withoutSpeakers, err := NewSubtitlesFromVTT(strings.NewReader(testSubtitles))
+	require.NoError(t, err)
+	require.False(t, withoutSpeakers.HasSpeakers())
+}
+
+func TestAppend(t *testing.T) {
+	first, err := NewSubtitlesFromVTT(strings.NewReader(testSubtitlesWithSpeakers))
+	require.NoError(t, err)
+
+	stitched := NewEmptySubtitles()
+	stitched.Append(first, 0)
+	stitched.AppendText(9*time.Second, 20*time.Minute, "[missing]")
+	stitched.Append(first, 20*time.Minute)
+
+	require.Equal(t, `00:00 to 00:04 - Alice Smith: I will take the release notes.
+00:05 to 00:07 - Bob: Great, I'll review them tomorrow.
+00:07 to 00:09 - Alice Smith: Sounds good.
+00:09 to 20:00 - [missing]
+20:00 to 20:04 - Alice Smith: I will take the release notes.
+20:05 to 20:07 - Bob: Great, I'll review them tomorrow.
+20:07 to 20:09 - Alice Smith: Sounds good.`, stitched.FormatForLLM())
+
+	// The original is not modified
+	require.Equal(t, expectedFormatForLLMWithSpeakers, first.FormatForLLM())
+}
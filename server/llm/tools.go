@@ -7,6 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Tool represents a function that can be called by the language model during a conversation.
@@ -19,15 +22,18 @@ type Tool struct {
 	Name        string
 	Description string
 	Schema      any
-	Resolver    func(context ConversationContext, argsGetter ToolArgumentGetter) (string, error)
+	Resolver    ToolResolver
 }
 
+type ToolResolver func(context ConversationContext, argsGetter ToolArgumentGetter) (string, error)
+
 type ToolArgumentGetter func(args any) error
 
 type ToolStore struct {
-	tools   map[string]Tool
-	log     TraceLog
-	doTrace bool
+	tools      map[string]Tool
+	log        TraceLog
+	doTrace    bool
+	onResolved func(name string, err error)
 }
 
 type TraceLog interface {
@@ -56,13 +62,46 @@ func (s *ToolStore) AddTools(tools []Tool) {
 	}
 }
 
-func (s *ToolStore) ResolveTool(name string, argsGetter ToolArgumentGetter, context ConversationContext) (string, error) {
+// WithResolvedCallback returns a copy of the store that calls onResolved after every tool call it resolves.
+func (s ToolStore) WithResolvedCallback(onResolved func(name string, err error)) ToolStore {
+	previous := s.onResolved
+	s.onResolved = func(name string, err error) {
+		if previous != nil {
+			previous(name, err)
+		}
+		onResolved(name, err)
+	}
+	return s
+}
+
+// WithResolverWrapper returns a copy of the store where the resolver of every tool is replaced by wrap(resolver).
+func (s ToolStore) WithResolverWrapper(wrap func(resolver ToolResolver) ToolResolver) ToolStore {
+	tools := make(map[string]Tool, len(s.tools))
+	for name, tool := range s.tools {
+		tool.Resolver = wrap(tool.Resolver)
+		tools[name] = tool
+	}
+	s.tools = tools
+	return s
+}
+
+func (s *ToolStore) ResolveTool(name string, argsGetter ToolArgumentGetter, context ConversationContext) (results string, err error) {
+	_, span := Tracer().Start(context.TraceContext(), "ToolStore.ResolveTool", trace.WithAttributes(
+		attribute.String("tool.name", name),
+	))
+	defer func() {
+		EndSpan(span, err)
+		if s.onResolved != nil {
+			s.onResolved(name, err)
+		}
+	}()
+
 	tool, ok := s.tools[name]
 	if !ok {
 		s.TraceUnknown(name, argsGetter)
 		return "", errors.New("unknown tool " + name)
 	}
-	results, err := tool.Resolver(context, argsGetter)
+	results, err = tool.Resolver(context, argsGetter)
 	s.TraceResolved(name, argsGetter, results)
 	return results, err
 }
@@ -0,0 +1,32 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName names the tracer of the plugin.
+const TracerName = "github.com/mattermost/mattermost-plugin-ai"
+
+// Tracer returns the tracer of the plugin. Spans are dropped unless tracing was configured.
+// Span attributes must only ever carry IDs and names, never message content.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan ends a span, marking it as failed if there was an error. Only the type of the error
+// is recorded since error messages may quote content.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, "")
+		span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+	}
+	span.End()
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package llm
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Content written by anyone other than the requesting user, or read from files, transcriptions and
+// tools, is untrusted. It is put in delimited blocks that the system prompt tells the model to treat
+// as data only. See untrusted_content.tmpl.
+const (
+	UntrustedSourceThread        = "thread"
+	UntrustedSourceFile          = "file"
+	UntrustedSourceTranscription = "transcription"
+	UntrustedSourceTool          = "tool"
+	UntrustedSourceResponse      = "response"
+)
+
+// SuspectedInjectionFlag prefixes untrusted content that looks like instructions to the model.
+const SuspectedInjectionFlag = "[flagged as a possible prompt injection] "
+
+var untrustedDelimiterPattern = regexp.MustCompile(`(?i)<(/?)(untrusted_content)`)
+
+// suspectedInjectionBlockPattern only matches the opening of a real block since
+// the delimiters within untrusted content are escaped.
+var suspectedInjectionBlockPattern = regexp.MustCompile(`<untrusted_content [^>]*suspected_injection="true"`)
+
+// injectionPatterns are phrases that address the model rather than the people in a conversation.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override|bypass)\b.{0,30}\b(previous|prior|above|earlier|all|any|your|the system)\b.{0,20}\b(instructions?|prompts?|rules|directions|guidelines|messages)\b`),
+	regexp.MustCompile(`(?i)\b(you are now|from now on,? you|pretend (to be|you are)|act as (an?|the) )`),
+	regexp.MustCompile(`(?i)\b(system prompt|developer mode|jailbreak)\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|real|actual) instructions?\s*:`),
+	regexp.MustCompile(`(?i)\b(call|invoke|use|run|execute) the \w+ (tool|function)\b`),
+	regexp.MustCompile(`(?i)\bdo not (tell|inform|mention (this|it) to) the user\b`),
+	regexp.MustCompile(`(?i)(<\|im_start\|>|<\|system\|>|\[/?INST\]|<</?SYS>>|^\s*#{2,}\s*(system|instructions?)\b)`),
+	regexp.MustCompile(`(?im)^\s*(system|assistant)\s*:`),
+}
+
+// DetectInjection reports if text looks like an attempt to instruct the model.
+// It is a heuristic meant to catch the common phrasings, not a guarantee.
+func DetectInjection(text string) bool {
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// EscapeUntrusted neutralizes the block delimiters within untrusted content so it can't close its block early.
+func EscapeUntrusted(text string) string {
+	return untrustedDelimiterPattern.ReplaceAllString(text, "&lt;$1$2")
+}
+
+// WrapUntrusted puts content that was already escaped into an untrusted block.
+func WrapUntrusted(source, escapedContent string, suspectedInjection bool) string {
+	return fmt.Sprintf("<untrusted_content source=%q suspected_injection=\"%t\">\n%s\n</untrusted_content>", source, suspectedInjection, escapedContent)
+}
+
+// FormatUntrusted escapes content, flags it if it looks like instructions and puts it into an untrusted block.
+func FormatUntrusted(source, content string) string {
+	suspected := DetectInjection(content)
+	escaped := EscapeUntrusted(content)
+	if suspected {
+		escaped = SuspectedInjectionFlag + escaped
+	}
+	return WrapUntrusted(source, escaped, suspected)
+}
+
+// ContainsSuspectedInjection reports if text carries an untrusted block flagged as a possible prompt injection.
+func ContainsSuspectedInjection(text string) bool {
+	return suspectedInjectionBlockPattern.MatchString(text)
+}
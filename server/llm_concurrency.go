@@ -0,0 +1,504 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+)
+
+// NoStreamQueueTimeout is how long a request without streaming waits in the queue before it fails.
+const NoStreamQueueTimeout = 2 * time.Minute
+
+// ServiceLimiter bounds the number of concurrent requests to an upstream LLM service.
+// Requests over the limit wait in a queue that is served round robin between users,
+// so a single user making many requests can't starve everyone else. Bots using the same
+// service share its limiter, so queue metrics are reported for the bot each request came from.
+type ServiceLimiter struct {
+	lock   sync.Mutex
+	limit  int
+	active int
+	queues map[string][]*limiterWaiter
+	order  []string
+
+	// queueMetrics are the metrics of every bot that queued a request, so their depth is reset once
+	// their requests left the queue.
+	queueMetrics map[metrics.LLMetrics]struct{}
+}
+
+type limiterWaiter struct {
+	ready      chan struct{}
+	onPosition func(position int)
+	metrics    metrics.LLMetrics
+}
+
+func NewServiceLimiter(limit int) *ServiceLimiter {
+	return &ServiceLimiter{
+		limit:        limit,
+		queues:       map[string][]*limiterWaiter{},
+		queueMetrics: map[metrics.LLMetrics]struct{}{},
+	}
+}
+
+// TryAcquire takes a slot if one is free and nobody is waiting.
+func (l *ServiceLimiter) TryAcquire() (release func(), ok bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.active >= l.limit || len(l.order) > 0 {
+		return nil, false
+	}
+	l.active++
+
+	return l.releaseFunc(), true
+}
+
+// Acquire waits for a slot. onPosition is called with the position of the request whenever it changes while queued.
+// A request whose context is canceled leaves the queue and gets the error of the context. The queue depth and wait
+// time of the request are reported to llmMetrics, which may be nil.
+func (l *ServiceLimiter) Acquire(ctx context.Context, userID string, llmMetrics metrics.LLMetrics, onPosition func(position int)) (release func(), err error) {
+	if release, ok := l.TryAcquire(); ok {
+		return release, nil
+	}
+
+	start := time.Now()
+	waiter := &limiterWaiter{
+		ready:      make(chan struct{}),
+		onPosition: onPosition,
+		metrics:    llmMetrics,
+	}
+
+	l.lock.Lock()
+	if llmMetrics != nil {
+		l.queueMetrics[llmMetrics] = struct{}{}
+	}
+	if _, ok := l.queues[userID]; !ok {
+		l.order = append(l.order, userID)
+	}
+	l.queues[userID] = append(l.queues[userID], waiter)
+	l.dispatch()
+	l.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+	case <-ctx.Done():
+		l.lock.Lock()
+		removed := l.remove(userID, waiter)
+		l.lock.Unlock()
+		if !removed {
+			// The slot was handed over while the request was canceled.
+			l.releaseFunc()()
+		}
+		return nil, ctx.Err()
+	}
+
+	if llmMetrics != nil {
+		llmMetrics.ObserveQueueWaitTime(time.Since(start).Seconds())
+	}
+
+	return l.releaseFunc(), nil
+}
+
+// remove takes a waiter out of the queue and reports if it was still there. Must be called with the lock held.
+func (l *ServiceLimiter) remove(userID string, waiter *limiterWaiter) bool {
+	queue := l.queues[userID]
+	for i, queued := range queue {
+		if queued != waiter {
+			continue
+		}
+
+		if len(queue) > 1 {
+			l.queues[userID] = append(queue[:i:i], queue[i+1:]...)
+		} else {
+			delete(l.queues, userID)
+			for j, queuedUserID := range l.order {
+				if queuedUserID == userID {
+					l.order = append(l.order[:j:j], l.order[j+1:]...)
+					break
+				}
+			}
+		}
+		l.dispatch()
+		return true
+	}
+	return false
+}
+
+// SetLimit changes the limit, starting queued requests if it was raised.
+func (l *ServiceLimiter) SetLimit(limit int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.limit = limit
+	l.dispatch()
+}
+
+// QueueDepth returns the number of requests waiting for a slot.
+func (l *ServiceLimiter) QueueDepth() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.queueDepth()
+}
+
+func (l *ServiceLimiter) queueDepth() int {
+	depth := 0
+	for _, queue := range l.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+func (l *ServiceLimiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			l.active--
+			l.dispatch()
+		})
+	}
+}
+
+// dispatch hands free slots to the next users in the round robin order and updates
+// the positions of the requests still waiting. Must be called with the lock held.
+func (l *ServiceLimiter) dispatch() {
+	for l.active < l.limit && len(l.order) > 0 {
+		userID := l.order[0]
+		l.order = l.order[1:]
+
+		queue := l.queues[userID]
+		waiter := queue[0]
+		if len(queue) > 1 {
+			l.queues[userID] = queue[1:]
+			l.order = append(l.order, userID)
+		} else {
+			delete(l.queues, userID)
+		}
+
+		l.active++
+		close(waiter.ready)
+		if waiter.onPosition != nil {
+			waiter.onPosition(0)
+		}
+	}
+
+	// Positions follow the round robin order, the first request of every user goes before anyone's second.
+	position := 0
+	for round := 0; ; round++ {
+		found := false
+		for _, userID := range l.order {
+			queue := l.queues[userID]
+			if round >= len(queue) {
+				continue
+			}
+			found = true
+			position++
+			if queue[round].onPosition != nil {
+				queue[round].onPosition(position)
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	l.reportQueueDepth()
+}
+
+// reportQueueDepth sets the queue depth of every bot to the number of its requests waiting for a slot.
+// Must be called with the lock held.
+func (l *ServiceLimiter) reportQueueDepth() {
+	depths := make(map[metrics.LLMetrics]int, len(l.queueMetrics))
+	for llmMetrics := range l.queueMetrics {
+		depths[llmMetrics] = 0
+	}
+	for _, queue := range l.queues {
+		for _, waiter := range queue {
+			if waiter.metrics != nil {
+				depths[waiter.metrics]++
+			}
+		}
+	}
+	for llmMetrics, depth := range depths {
+		llmMetrics.SetQueueDepth(depth)
+	}
+}
+
+// LLMConcurrencyWrapper sends requests through the limiter of the service.
+// A slot is held until the upstream service finishes streaming its response.
+type LLMConcurrencyWrapper struct {
+	wrapped llm.LanguageModel
+	limiter *ServiceLimiter
+	metrics metrics.LLMetrics
+
+	// noStreamQueueTimeout bounds the wait in the queue of requests without streaming.
+	noStreamQueueTimeout time.Duration
+}
+
+func NewLLMConcurrencyWrapper(wrapped llm.LanguageModel, limiter *ServiceLimiter, llmMetrics metrics.LLMetrics) *LLMConcurrencyWrapper {
+	return &LLMConcurrencyWrapper{
+		wrapped:              wrapped,
+		limiter:              limiter,
+		metrics:              llmMetrics,
+		noStreamQueueTimeout: NoStreamQueueTimeout,
+	}
+}
+
+func (w *LLMConcurrencyWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	if release, ok := w.limiter.TryAcquire(); ok {
+		result, err := w.wrapped.ChatCompletion(conversation, opts...)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		output := make(chan string)
+		errChan := make(chan error)
+		cancel, canceled := llm.NewCancel(result.Close)
+		go forwardStream(result, release, output, errChan, canceled)
+
+		return &llm.TextStreamResult{Stream: output, Err: errChan, Cancel: cancel, Canceled: canceled, Model: result.Model}, nil
+	}
+
+	output := make(chan string)
+	errChan := make(chan error)
+	queuePosition := make(chan int, 1)
+	// The upstream result is only known once the request leaves the queue.
+	var upstreamLock sync.Mutex
+	var upstream *llm.TextStreamResult
+	ctx, cancelAcquire := context.WithCancel(context.Background())
+	cancel, canceled := llm.NewCancel(cancelAcquire, func() {
+		upstreamLock.Lock()
+		defer upstreamLock.Unlock()
+		if upstream != nil {
+			upstream.Close()
+		}
+	})
+	go func() {
+		defer cancelAcquire()
+		release, err := w.limiter.Acquire(ctx, requestingUserID(conversation), w.metrics, func(position int) {
+			// Only the latest position is of interest to the reader.
+			select {
+			case <-queuePosition:
+			default:
+			}
+			queuePosition <- position
+		})
+		if err != nil {
+			// The reader is gone, the request is dropped without reaching the service.
+			close(output)
+			close(errChan)
+			return
+		}
+
+		result, err := w.wrapped.ChatCompletion(conversation, opts...)
+		if err != nil {
+			release()
+			defer close(output)
+			defer close(errChan)
+			errChan <- err
+			return
+		}
+
+		upstreamLock.Lock()
+		upstream = result
+		upstreamLock.Unlock()
+		// Canceled while the request was being sent.
+		select {
+		case <-canceled:
+			result.Close()
+		default:
+		}
+		forwardStream(result, release, output, errChan, canceled)
+	}()
+
+	model := func() string {
+		upstreamLock.Lock()
+		defer upstreamLock.Unlock()
+		if upstream == nil || upstream.Model == nil {
+			return ""
+		}
+		return upstream.Model()
+	}
+	return &llm.TextStreamResult{Stream: output, Err: errChan, QueuePosition: queuePosition, Cancel: cancel, Canceled: canceled, Model: model}, nil
+}
+
+func (w *LLMConcurrencyWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	// The caller is waiting on the response, so it gives up on a queue that doesn't move.
+	ctx, cancel := context.WithTimeout(conversation.Context.TraceContext(), w.noStreamQueueTimeout)
+	defer cancel()
+
+	release, err := w.limiter.Acquire(ctx, requestingUserID(conversation), w.metrics, nil)
+	if err != nil {
+		return "", fmt.Errorf("request waited too long for the service: %w", err)
+	}
+	defer release()
+
+	return w.wrapped.ChatCompletionNoStream(conversation, opts...)
+}
+
+func (w *LLMConcurrencyWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMConcurrencyWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+func requestingUserID(conversation llm.BotConversation) string {
+	if conversation.Context.RequestingUser == nil {
+		return ""
+	}
+	return conversation.Context.RequestingUser.Id
+}
+
+type streamEvent struct {
+	text string
+	err  error
+}
+
+// forwardStream reads the upstream stream as fast as it is produced, releasing the slot as soon as
+// the upstream service is done, and delivers it to the output channels at the pace of the reader.
+// This keeps a slow or departed reader from holding a slot. Nothing more is delivered once canceled.
+func forwardStream(in *llm.TextStreamResult, release func(), output chan<- string, errChan chan<- error, canceled <-chan struct{}) {
+	var (
+		lock   sync.Mutex
+		cond   = sync.NewCond(&lock)
+		events []streamEvent
+		done   bool
+	)
+
+	go func() {
+		defer func() {
+			release()
+			lock.Lock()
+			done = true
+			cond.Signal()
+			lock.Unlock()
+		}()
+
+		stream, errs := in.Stream, in.Err
+		for stream != nil || errs != nil {
+			var event streamEvent
+			select {
+			case text, ok := <-stream:
+				if !ok {
+					stream = nil
+					continue
+				}
+				event.text = text
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				event.err = err
+			}
+
+			// The upstream stream is still read to the end so its producer can finish.
+			select {
+			case <-canceled:
+				continue
+			default:
+			}
+			lock.Lock()
+			events = append(events, event)
+			cond.Signal()
+			lock.Unlock()
+		}
+	}()
+
+	// Closed in the same order as the upstream services do.
+	defer close(output)
+	defer close(errChan)
+	for {
+		lock.Lock()
+		for len(events) == 0 && !done {
+			cond.Wait()
+		}
+		if len(events) == 0 && done {
+			lock.Unlock()
+			return
+		}
+		event := events[0]
+		events = events[1:]
+		lock.Unlock()
+
+		if event.err != nil {
+			select {
+			case errChan <- event.err:
+			case <-canceled:
+				return
+			}
+		} else {
+			select {
+			case output <- event.text:
+			case <-canceled:
+				return
+			}
+		}
+	}
+}
+
+// serviceLimiterKey identifies the upstream service of a bot. Bots using the same endpoint with the same
+// credentials share the limit of the service.
+func serviceLimiterKey(service llm.ServiceConfig) string {
+	return strings.Join([]string{service.Type, service.APIURL, service.OrgID, service.APIKey, service.Username}, "\x00")
+}
+
+// configureServiceLimiters sets the limit of each service when the configuration changes. Bots sharing a
+// service share its limiter, which uses the lowest limit configured for them.
+func (p *Plugin) configureServiceLimiters(bots []llm.BotConfig) {
+	limits := map[string]int{}
+	for i := range bots {
+		key := serviceLimiterKey(bots[i].Service)
+		limit := bots[i].Service.ConcurrencyLimit()
+		if current, ok := limits[key]; !ok || limit < current {
+			limits[key] = limit
+		}
+	}
+
+	p.llmLimitersLock.Lock()
+	defer p.llmLimitersLock.Unlock()
+
+	if p.llmLimiters == nil {
+		p.llmLimiters = map[string]*ServiceLimiter{}
+	}
+	for key, limit := range limits {
+		if limiter, ok := p.llmLimiters[key]; ok {
+			limiter.SetLimit(limit)
+		} else {
+			p.llmLimiters[key] = NewServiceLimiter(limit)
+		}
+	}
+}
+
+// getServiceLimiter returns the limiter shared by all requests to the service of the bot. Services that are
+// not in the configuration, such as the ones of unsaved bots, get a limiter with the limit of the bot.
+func (p *Plugin) getServiceLimiter(botConfig llm.BotConfig) *ServiceLimiter {
+	p.llmLimitersLock.Lock()
+	defer p.llmLimitersLock.Unlock()
+
+	if p.llmLimiters == nil {
+		p.llmLimiters = map[string]*ServiceLimiter{}
+	}
+
+	key := serviceLimiterKey(botConfig.Service)
+	limiter, ok := p.llmLimiters[key]
+	if !ok {
+		limiter = NewServiceLimiter(botConfig.Service.ConcurrencyLimit())
+		p.llmLimiters[key] = limiter
+	}
+
+	return limiter
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceLimiterFairness(t *testing.T) {
+	limiter := NewServiceLimiter(1)
+	releaseFirst, ok := limiter.TryAcquire()
+	require.True(t, ok)
+
+	var lock sync.Mutex
+	var started []string
+	positions := map[string]int{}
+	releases := make(chan func(), 4)
+
+	enqueue := func(userID, name string) {
+		go func() {
+			release, err := limiter.Acquire(context.Background(), userID, nil, func(position int) {
+				lock.Lock()
+				if _, ok := positions[name]; !ok {
+					positions[name] = position
+				}
+				lock.Unlock()
+			})
+			require.NoError(t, err)
+			lock.Lock()
+			started = append(started, name)
+			lock.Unlock()
+			releases <- release
+		}()
+		require.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			_, ok := positions[name]
+			return ok
+		}, time.Second, time.Millisecond)
+	}
+
+	enqueue("a", "a1")
+	enqueue("a", "a2")
+	enqueue("a", "a3")
+	enqueue("b", "b1")
+	require.Equal(t, 4, limiter.QueueDepth())
+	require.Equal(t, map[string]int{"a1": 1, "a2": 2, "a3": 3, "b1": 2}, positions)
+
+	releaseFirst()
+	for i := 0; i < 4; i++ {
+		release := <-releases
+		release()
+	}
+
+	require.Equal(t, []string{"a1", "b1", "a2", "a3"}, started)
+	require.Equal(t, 0, limiter.QueueDepth())
+}
+
+func TestServiceLimiterSetLimit(t *testing.T) {
+	limiter := NewServiceLimiter(1)
+	release, ok := limiter.TryAcquire()
+	require.True(t, ok)
+	defer release()
+
+	_, ok = limiter.TryAcquire()
+	require.False(t, ok)
+
+	acquired := make(chan func())
+	go func() {
+		secondRelease, _ := limiter.Acquire(context.Background(), "user", nil, nil)
+		acquired <- secondRelease
+	}()
+	require.Eventually(t, func() bool { return limiter.QueueDepth() == 1 }, time.Second, time.Millisecond)
+
+	limiter.SetLimit(2)
+	select {
+	case secondRelease := <-acquired:
+		secondRelease()
+	case <-time.After(time.Second):
+		require.Fail(t, "raising the limit should start the queued request")
+	}
+}
+
+func TestServiceLimiterCancel(t *testing.T) {
+	limiter := NewServiceLimiter(1)
+	release, ok := limiter.TryAcquire()
+	require.True(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() {
+		_, err := limiter.Acquire(ctx, "a", nil, nil)
+		acquired <- err
+	}()
+	go func() {
+		_, _ = limiter.Acquire(context.Background(), "b", nil, nil)
+	}()
+	require.Eventually(t, func() bool { return limiter.QueueDepth() == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-acquired, context.Canceled)
+	require.Equal(t, 1, limiter.QueueDepth())
+
+	release()
+	require.Eventually(t, func() bool { return limiter.QueueDepth() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestServiceLimiterMetricsPerBot(t *testing.T) {
+	limiter := NewServiceLimiter(1)
+	release, ok := limiter.TryAcquire()
+	require.True(t, ok)
+
+	first, second := newFakeLLMetrics(), newFakeLLMetrics()
+	queueDepth := func(llmMetrics *fakeLLMetrics) int {
+		llmMetrics.lock.Lock()
+		defer llmMetrics.lock.Unlock()
+		return llmMetrics.queueDepth
+	}
+
+	acquired := make(chan func(), 3)
+	for _, llmMetrics := range []*fakeLLMetrics{first, second, second} {
+		go func() {
+			queuedRelease, _ := limiter.Acquire(context.Background(), "user", llmMetrics, nil)
+			acquired <- queuedRelease
+		}()
+	}
+	require.Eventually(t, func() bool { return limiter.QueueDepth() == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, 1, queueDepth(first))
+	require.Equal(t, 2, queueDepth(second))
+
+	release()
+	for range 3 {
+		(<-acquired)()
+	}
+	require.Equal(t, 0, queueDepth(first))
+	require.Equal(t, 0, queueDepth(second))
+}
+
+func TestServiceLimiterKey(t *testing.T) {
+	service := llm.ServiceConfig{Type: llm.ServiceTypeOpenAI, APIKey: "key"}
+	other := service
+	other.Name = "renamed"
+	require.Equal(t, serviceLimiterKey(service), serviceLimiterKey(other))
+
+	other.APIKey = "other key"
+	require.NotEqual(t, serviceLimiterKey(service), serviceLimiterKey(other))
+}
+
+func TestConfigureServiceLimiters(t *testing.T) {
+	p := &Plugin{}
+	shared := llm.ServiceConfig{Type: llm.ServiceTypeOpenAI, APIKey: "key", MaxConcurrentRequests: 4}
+	strict := llm.BotConfig{Name: "strict", Service: shared}
+	strict.Service.MaxConcurrentRequests = 2
+	relaxed := llm.BotConfig{Name: "relaxed", Service: shared}
+
+	p.configureServiceLimiters([]llm.BotConfig{relaxed, strict})
+	limiter := p.getServiceLimiter(relaxed)
+	require.Same(t, limiter, p.getServiceLimiter(strict))
+	require.Equal(t, 2, limiter.limit, "bots sharing a service use the lowest limit")
+
+	p.getServiceLimiter(relaxed)
+	require.Equal(t, 2, limiter.limit, "getting the limiter doesn't change its limit")
+
+	strict.Service.MaxConcurrentRequests = 6
+	p.configureServiceLimiters([]llm.BotConfig{relaxed, strict})
+	require.Same(t, limiter, p.getServiceLimiter(relaxed), "the limiter is kept so queued requests aren't lost")
+	require.Equal(t, 4, limiter.limit)
+}
+
+func TestLLMConcurrencyWrapper(t *testing.T) {
+	conversation := llm.BotConversation{
+		Context: llm.ConversationContext{RequestingUser: &model.User{Id: "user"}},
+	}
+
+	t.Run("slot is released when the upstream stream ends even if unread", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapper := NewLLMConcurrencyWrapper(newScriptedLanguageModel(scriptedTurn{Response: "hello"}), limiter, nil)
+
+		_, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			release, ok := limiter.TryAcquire()
+			if ok {
+				release()
+			}
+			return ok
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("queued request reports its position and completes", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapper := NewLLMConcurrencyWrapper(newScriptedLanguageModel(scriptedTurn{Response: "hello"}), limiter, nil)
+
+		release, ok := limiter.TryAcquire()
+		require.True(t, ok)
+
+		result, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+		require.Equal(t, 1, <-result.QueuePosition)
+		require.Empty(t, result.Model(), "the model isn't known while queued")
+
+		release()
+		require.Equal(t, "hello", result.ReadAll())
+		require.Equal(t, scriptedModelName, result.Model())
+	})
+
+	t.Run("request without streaming gives up on a queue that doesn't move", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapped := newScriptedLanguageModel()
+		wrapper := NewLLMConcurrencyWrapper(wrapped, limiter, nil)
+		wrapper.noStreamQueueTimeout = 10 * time.Millisecond
+
+		release, ok := limiter.TryAcquire()
+		require.True(t, ok)
+		defer release()
+
+		_, err := wrapper.ChatCompletionNoStream(conversation)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 0, limiter.QueueDepth())
+		require.Empty(t, wrapped.received)
+	})
+
+	t.Run("closed queued request never reaches the service", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapped := newScriptedLanguageModel()
+		wrapper := NewLLMConcurrencyWrapper(wrapped, limiter, nil)
+
+		release, ok := limiter.TryAcquire()
+		require.True(t, ok)
+		defer release()
+
+		result, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+		require.Equal(t, 1, <-result.QueuePosition)
+
+		result.Close()
+		require.Equal(t, "", result.ReadAll())
+		require.Equal(t, 0, limiter.QueueDepth())
+		require.Empty(t, wrapped.received)
+	})
+
+	t.Run("closing a dispatched request stops it and everything forwarding it", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapper := NewLLMConcurrencyWrapper(newScriptedLanguageModel(scriptedTurn{Response: "first second third", Hold: true}), limiter, nil)
+
+		result, err := wrapper.ChatCompletion(conversation)
+		require.NoError(t, err)
+		observed := make(chan struct{})
+		result = result.Observe(llm.StreamObserver{OnDone: func() { close(observed) }})
+		require.Equal(t, "first ", <-result.Stream)
+
+		result.Close()
+		select {
+		case <-observed:
+		case <-time.After(time.Second):
+			require.FailNow(t, "the observer never saw the end of the stream")
+		}
+		require.Eventually(t, func() bool {
+			release, ok := limiter.TryAcquire()
+			if ok {
+				release()
+			}
+			return ok
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("no stream", func(t *testing.T) {
+		limiter := NewServiceLimiter(1)
+		wrapper := NewLLMConcurrencyWrapper(newScriptedLanguageModel(scriptedTurn{Response: "hello"}), limiter, nil)
+
+		response, err := wrapper.ChatCompletionNoStream(conversation)
+		require.NoError(t, err)
+		require.Equal(t, "hello", response)
+		require.Equal(t, 0, limiter.QueueDepth())
+	})
+}
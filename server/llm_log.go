@@ -13,18 +13,21 @@ import (
 type LanguageModelLogWrapper struct {
 	log     pluginapi.LogService
 	wrapped llm.LanguageModel
+	// redact hides the secrets of the services from the logged prompts.
+	redact func(text string, extra ...string) string
 }
 
-func NewLanguageModelLogWrapper(log pluginapi.LogService, wrapped llm.LanguageModel) *LanguageModelLogWrapper {
+func NewLanguageModelLogWrapper(log pluginapi.LogService, wrapped llm.LanguageModel, redact func(text string, extra ...string) string) *LanguageModelLogWrapper {
 	return &LanguageModelLogWrapper{
 		log:     log,
 		wrapped: wrapped,
+		redact:  redact,
 	}
 }
 
 func (w *LanguageModelLogWrapper) logInput(conversation llm.BotConversation, opts ...llm.LanguageModelOption) {
 	prompt := fmt.Sprintf("\n%v", conversation)
-	w.log.Info("LLM Call", "prompt", prompt)
+	w.log.Info("LLM Call", "prompt", w.redact(prompt))
 }
 
 func (w *LanguageModelLogWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
@@ -0,0 +1,131 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	anthropicSDK "github.com/anthropics/anthropic-sdk-go"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+	"github.com/mattermost/mattermost-plugin-ai/server/openai"
+	openaiClient "github.com/sashabaranov/go-openai"
+)
+
+// LLMMetricsWrapper records the latency, time to first token and errors of requests to the upstream service.
+type LLMMetricsWrapper struct {
+	wrapped llm.LanguageModel
+	metrics metrics.LLMetrics
+}
+
+func NewLLMMetricsWrapper(wrapped llm.LanguageModel, llmMetrics metrics.LLMetrics) *LLMMetricsWrapper {
+	return &LLMMetricsWrapper{
+		wrapped: wrapped,
+		metrics: llmMetrics,
+	}
+}
+
+func (w *LLMMetricsWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	operation := configFromOptions(opts).Operation
+	start := time.Now()
+
+	result, err := w.wrapped.ChatCompletion(conversation, opts...)
+	if err != nil {
+		w.metrics.ObserveRequestDuration(operation, time.Since(start).Seconds())
+		w.metrics.IncrementErrors(operation, llmErrorType(err))
+		return nil, err
+	}
+
+	receivedFirstToken := false
+	return result.Observe(llm.StreamObserver{
+		OnText: func(text string) {
+			if !receivedFirstToken && text != "" {
+				receivedFirstToken = true
+				w.metrics.ObserveTimeToFirstToken(operation, time.Since(start).Seconds())
+			}
+		},
+		OnError: func(err error) {
+			w.metrics.IncrementErrors(operation, llmErrorType(err))
+		},
+		OnDone: func() {
+			w.metrics.ObserveRequestDuration(operation, time.Since(start).Seconds())
+		},
+	}), nil
+}
+
+func (w *LLMMetricsWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	operation := configFromOptions(opts).Operation
+	start := time.Now()
+
+	response, err := w.wrapped.ChatCompletionNoStream(conversation, opts...)
+	w.metrics.ObserveRequestDuration(operation, time.Since(start).Seconds())
+	if err != nil {
+		w.metrics.IncrementErrors(operation, llmErrorType(err))
+		return "", err
+	}
+
+	return response, nil
+}
+
+func (w *LLMMetricsWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMMetricsWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
+
+// configFromOptions returns the options given for a request, without the defaults of the service.
+func configFromOptions(opts []llm.LanguageModelOption) llm.LanguageModelConfig {
+	var cfg llm.LanguageModelConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// llmErrorType classifies an error returned by an upstream service for the error metrics.
+func llmErrorType(err error) string {
+	if errors.Is(err, llm.ErrToolCall) {
+		return metrics.ErrorTypeTool
+	}
+
+	var netErr net.Error
+	if errors.Is(err, openai.ErrStreamingTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return metrics.ErrorTypeTimeout
+	}
+
+	switch upstreamStatusCode(err) {
+	case http.StatusTooManyRequests:
+		return metrics.ErrorTypeRateLimit
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return metrics.ErrorTypeAuth
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return metrics.ErrorTypeTimeout
+	}
+
+	return metrics.ErrorTypeOther
+}
+
+func upstreamStatusCode(err error) int {
+	var openaiAPIErr *openaiClient.APIError
+	if errors.As(err, &openaiAPIErr) {
+		return openaiAPIErr.HTTPStatusCode
+	}
+	var openaiRequestErr *openaiClient.RequestError
+	if errors.As(err, &openaiRequestErr) {
+		return openaiRequestErr.HTTPStatusCode
+	}
+	var anthropicErr *anthropicSDK.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode
+	}
+	return 0
+}
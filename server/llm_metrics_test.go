@@ -0,0 +1,117 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+	"github.com/mattermost/mattermost-plugin-ai/server/openai"
+	openaiClient "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLLMetrics struct {
+	lock            sync.Mutex
+	durations       map[string]int
+	timesToFirstTok map[string]int
+	errors          map[string]int
+	queueDepth      int
+}
+
+func newFakeLLMetrics() *fakeLLMetrics {
+	return &fakeLLMetrics{
+		durations:       map[string]int{},
+		timesToFirstTok: map[string]int{},
+		errors:          map[string]int{},
+	}
+}
+
+func (f *fakeLLMetrics) IncrementLLMRequests(operation string) {}
+func (f *fakeLLMetrics) SetQueueDepth(depth int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queueDepth = depth
+}
+func (f *fakeLLMetrics) ObserveQueueWaitTime(elapsed float64) {}
+func (f *fakeLLMetrics) ObserveRequestDuration(operation string, elapsed float64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.durations[operation]++
+}
+func (f *fakeLLMetrics) ObserveTimeToFirstToken(operation string, elapsed float64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.timesToFirstTok[operation]++
+}
+func (f *fakeLLMetrics) AddTokens(operation string, input, output int) {}
+func (f *fakeLLMetrics) IncrementErrors(operation, errorType string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.errors[operation+"/"+errorType]++
+}
+func (f *fakeLLMetrics) IncrementToolCalls(tool, status string)       {}
+func (f *fakeLLMetrics) AddRedactions(detector string, count int)     {}
+func (f *fakeLLMetrics) ObserveTranscriptionDuration(elapsed float64) {}
+func (f *fakeLLMetrics) IncrementFeedback(model, rating string)       {}
+
+func TestLLMMetricsWrapper(t *testing.T) {
+	t.Run("successful stream", func(t *testing.T) {
+		llmMetrics := newFakeLLMetrics()
+		wrapper := NewLLMMetricsWrapper(newScriptedLanguageModel(scriptedTurn{Response: "hello"}), llmMetrics)
+
+		result, err := wrapper.ChatCompletion(llm.BotConversation{}, llm.WithOperation(llm.OperationChat))
+		require.NoError(t, err)
+		require.Equal(t, "hello", result.ReadAll())
+
+		require.Eventually(t, func() bool {
+			llmMetrics.lock.Lock()
+			defer llmMetrics.lock.Unlock()
+			return llmMetrics.durations[llm.OperationChat] == 1
+		}, time.Second, time.Millisecond)
+		require.Equal(t, 1, llmMetrics.timesToFirstTok[llm.OperationChat])
+		require.Empty(t, llmMetrics.errors)
+	})
+
+	t.Run("error partway through the stream", func(t *testing.T) {
+		llmMetrics := newFakeLLMetrics()
+		wrapper := NewLLMMetricsWrapper(newScriptedLanguageModel(scriptedTurn{Response: "partial", StreamErr: &openaiClient.APIError{HTTPStatusCode: http.StatusTooManyRequests}}), llmMetrics)
+
+		result, err := wrapper.ChatCompletion(llm.BotConversation{}, llm.WithOperation(llm.OperationSummary))
+		require.NoError(t, err)
+		require.Equal(t, "partial", <-result.Stream)
+		require.Error(t, <-result.Err)
+
+		llmMetrics.lock.Lock()
+		defer llmMetrics.lock.Unlock()
+		require.Equal(t, map[string]int{"summary/rate_limit": 1}, llmMetrics.errors)
+	})
+}
+
+func TestLLMErrorType(t *testing.T) {
+	for name, test := range map[string]struct {
+		err      error
+		expected string
+	}{
+		"tool":             {fmt.Errorf("too many function calls: %w", llm.ErrToolCall), metrics.ErrorTypeTool},
+		"streaming stall":  {openai.ErrStreamingTimeout, metrics.ErrorTypeTimeout},
+		"deadline":         {fmt.Errorf("request: %w", context.DeadlineExceeded), metrics.ErrorTypeTimeout},
+		"rate limit":       {&openaiClient.APIError{HTTPStatusCode: http.StatusTooManyRequests}, metrics.ErrorTypeRateLimit},
+		"unauthorized":     {&openaiClient.RequestError{HTTPStatusCode: http.StatusUnauthorized}, metrics.ErrorTypeAuth},
+		"gateway timeout":  {&openaiClient.APIError{HTTPStatusCode: http.StatusGatewayTimeout}, metrics.ErrorTypeTimeout},
+		"something else":   {errors.New("boom"), metrics.ErrorTypeOther},
+		"server side fail": {&openaiClient.APIError{HTTPStatusCode: http.StatusInternalServerError}, metrics.ErrorTypeOther},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, llmErrorType(test.err))
+		})
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
+)
+
+// Names of the built-in detectors. They label the redaction metrics and the placeholders.
+const (
+	PIIDetectorSecret     = "secret"
+	PIIDetectorEmail      = "email"
+	PIIDetectorCreditCard = "credit_card"
+	PIIDetectorSSN        = "ssn"
+	PIIDetectorPhone      = "phone"
+	PIIDetectorIPAddress  = "ip_address"
+	PIIDetectorCustom     = "custom"
+
+	// PIIDetectorHighEntropy is only used when it is listed, as long random-looking strings are not always
+	// secrets.
+	PIIDetectorHighEntropy = "high_entropy"
+)
+
+// PIIDetector finds one kind of sensitive value in text.
+type PIIDetector struct {
+	Name    string
+	Pattern *regexp.Regexp
+
+	// Validate rejects matches of the pattern that are not actually sensitive. Optional.
+	Validate func(match string) bool
+}
+
+var datePrefixPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\b`)
+
+// builtinPIIDetectors are applied in order, so credentials are found before the numbers they may contain.
+var builtinPIIDetectors = []PIIDetector{
+	{
+		Name: PIIDetectorSecret,
+		Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----` +
+			`|\beyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}` +
+			`|\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}` +
+			`|\b(?:xox[abprs]|gh[pousr]|glpat)[-_][A-Za-z0-9_\-]{16,}` +
+			`|\bAKIA[0-9A-Z]{16}\b`),
+	},
+	{
+		Name:    PIIDetectorEmail,
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		Name:     PIIDetectorCreditCard,
+		Pattern:  regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		Validate: passesLuhn,
+	},
+	{
+		Name:    PIIDetectorSSN,
+		Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	},
+	{
+		Name:    PIIDetectorPhone,
+		Pattern: regexp.MustCompile(`\+?\d[\d \-().]{7,}\d`),
+		Validate: func(match string) bool {
+			return countDigits(match) >= 9 && !datePrefixPattern.MatchString(match)
+		},
+	},
+	{
+		Name:    PIIDetectorIPAddress,
+		Pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`),
+	},
+}
+
+// optInPIIDetectors are only applied when the admin lists them.
+var optInPIIDetectors = []PIIDetector{
+	{
+		Name:     PIIDetectorHighEntropy,
+		Pattern:  regexp.MustCompile(`\b[A-Za-z0-9+/_\-]{40,}={0,2}`),
+		Validate: looksRandom,
+	},
+}
+
+// minSecretEntropy is the Shannon entropy, in bits per character, above which a long token is taken as
+// random. Hex digests such as commit hashes stay below it.
+const minSecretEntropy = 4.5
+
+// looksRandom tells keys and tokens apart from long identifiers such as paths, words or digests.
+func looksRandom(token string) bool {
+	token = strings.TrimRight(token, "=")
+	hasLetter, hasDigit := false, false
+	counts := map[rune]int{}
+	for _, r := range token {
+		counts[r]++
+		hasLetter = hasLetter || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		hasDigit = hasDigit || (r >= '0' && r <= '9')
+	}
+	if !hasLetter || !hasDigit {
+		return false
+	}
+
+	entropy := 0.0
+	length := float64(len(token))
+	for _, count := range counts {
+		frequency := float64(count) / length
+		entropy -= frequency * math.Log2(frequency)
+	}
+	return entropy >= minSecretEntropy
+}
+
+func countDigits(text string) int {
+	digits := 0
+	for _, r := range text {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
+
+// passesLuhn checks the digits of a card number against its check digit.
+func passesLuhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// piiDetectorsFromConfig returns the enabled built-in detectors, then the listed opt-in ones, followed by the
+// custom patterns of the admin. Custom patterns are given one per line.
+func piiDetectorsFromConfig(cfg Config) ([]PIIDetector, error) {
+	var detectors []PIIDetector
+
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(cfg.PIIRedactionDetectors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enabled[name] = true
+		}
+	}
+	for name := range enabled {
+		found := false
+		for _, detector := range slices.Concat(builtinPIIDetectors, optInPIIDetectors) {
+			found = found || detector.Name == name
+		}
+		if !found {
+			return nil, llm.ValidationError{Field: "piiRedactionDetectors", Message: fmt.Sprintf("unknown detector %q", name)}
+		}
+	}
+	for _, detector := range builtinPIIDetectors {
+		if len(enabled) == 0 || enabled[detector.Name] {
+			detectors = append(detectors, detector)
+		}
+	}
+	for _, detector := range optInPIIDetectors {
+		if enabled[detector.Name] {
+			detectors = append(detectors, detector)
+		}
+	}
+
+	for _, line := range strings.Split(cfg.PIIRedactionPatterns, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, llm.ValidationError{Field: "piiRedactionPatterns", Message: fmt.Sprintf("invalid custom pattern %q: %s", line, err)}
+		}
+		detectors = append(detectors, PIIDetector{Name: PIIDetectorCustom, Pattern: pattern})
+	}
+
+	return detectors, nil
+}
+
+// replacePII replaces every value found by the detectors with the result of replace.
+func replacePII(text string, detectors []PIIDetector, replace func(detector, value string) string) string {
+	for _, detector := range detectors {
+		text = detector.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			return replace(detector.Name, match)
+		})
+	}
+	return text
+}
+
+// maskPII irreversibly replaces the values found by the built-in detectors with their kind.
+func maskPII(text string) string {
+	return replacePII(text, builtinPIIDetectors, func(detector, _ string) string {
+		return "[" + strings.ToUpper(detector) + "]"
+	})
+}
+
+// Redactor swaps sensitive values for numbered placeholders and restores them afterwards.
+// The same value always gets the same placeholder so the LLM can still tell values apart.
+type Redactor struct {
+	detectors  []PIIDetector
+	onRedacted func(detector string)
+
+	lock         sync.Mutex
+	placeholders map[string]string
+	originals    map[string]string
+	counters     map[string]int
+}
+
+func NewRedactor(detectors []PIIDetector, onRedacted func(detector string)) *Redactor {
+	return &Redactor{
+		detectors:    detectors,
+		onRedacted:   onRedacted,
+		placeholders: map[string]string{},
+		originals:    map[string]string{},
+		counters:     map[string]int{},
+	}
+}
+
+// placeholderPattern matches the placeholders a Redactor creates.
+var placeholderPattern = regexp.MustCompile(`\[[A-Z_]+_\d+\]`)
+
+// maxPlaceholderLength bounds how much of a stream is held back waiting for the end of a placeholder.
+const maxPlaceholderLength = 32
+
+func (r *Redactor) Redact(text string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return replacePII(text, r.detectors, func(detector, value string) string {
+		if r.onRedacted != nil {
+			r.onRedacted(detector)
+		}
+		if placeholder, ok := r.placeholders[value]; ok {
+			return placeholder
+		}
+		r.counters[detector]++
+		placeholder := fmt.Sprintf("[%s_%d]", strings.ToUpper(detector), r.counters[detector])
+		r.placeholders[value] = placeholder
+		r.originals[placeholder] = value
+		return placeholder
+	})
+}
+
+func (r *Redactor) Restore(text string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := r.originals[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// restoreJSON restores the placeholders within the string values of a JSON document.
+func (r *Redactor) restoreJSON(raw []byte) []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return placeholderPattern.ReplaceAllFunc(raw, func(placeholder []byte) []byte {
+		original, ok := r.originals[string(placeholder)]
+		if !ok {
+			return placeholder
+		}
+		escaped, err := json.Marshal(original)
+		if err != nil {
+			return placeholder
+		}
+		return escaped[1 : len(escaped)-1]
+	})
+}
+
+// LLMRedactionWrapper keeps sensitive values from reaching the upstream service. They are replaced
+// by placeholders in the conversation and in tool results, and put back in the response.
+type LLMRedactionWrapper struct {
+	wrapped   llm.LanguageModel
+	detectors []PIIDetector
+	metrics   metrics.LLMetrics
+}
+
+func NewLLMRedactionWrapper(wrapped llm.LanguageModel, detectors []PIIDetector, llmMetrics metrics.LLMetrics) *LLMRedactionWrapper {
+	return &LLMRedactionWrapper{
+		wrapped:   wrapped,
+		detectors: detectors,
+		metrics:   llmMetrics,
+	}
+}
+
+// redactConversation returns a copy of the conversation with the sensitive values replaced.
+func (w *LLMRedactionWrapper) redactConversation(conversation llm.BotConversation) (llm.BotConversation, *Redactor) {
+	redactor := NewRedactor(w.detectors, func(detector string) {
+		w.metrics.AddRedactions(detector, 1)
+	})
+
+	posts := make([]llm.Post, len(conversation.Posts))
+	for i, post := range conversation.Posts {
+		post.Message = redactor.Redact(post.Message)
+		posts[i] = post
+	}
+	conversation.Posts = posts
+
+	conversation.Tools = conversation.Tools.WithResolverWrapper(func(resolver llm.ToolResolver) llm.ToolResolver {
+		return func(context llm.ConversationContext, argsGetter llm.ToolArgumentGetter) (string, error) {
+			restoringArgsGetter := func(args any) error {
+				var raw json.RawMessage
+				if err := argsGetter(&raw); err != nil {
+					return err
+				}
+				return json.Unmarshal(redactor.restoreJSON(raw), args)
+			}
+			result, err := resolver(context, restoringArgsGetter)
+			return redactor.Redact(result), err
+		}
+	})
+
+	return conversation, redactor
+}
+
+func (w *LLMRedactionWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	redacted, redactor := w.redactConversation(conversation)
+
+	result, err := w.wrapped.ChatCompletion(redacted, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan string)
+	errChan := make(chan error)
+	go func() {
+		defer close(output)
+		defer close(errChan)
+
+		// Text that may be the start of a placeholder is held back until the rest of it arrives.
+		pending := ""
+		send := func(text string) {
+			select {
+			case output <- redactor.Restore(text):
+			case <-result.Canceled:
+			}
+		}
+		stream, errs := result.Stream, result.Err
+		for stream != nil || errs != nil {
+			select {
+			case text, ok := <-stream:
+				if !ok {
+					stream = nil
+					continue
+				}
+				pending += text
+				hold := len(pending)
+				if start := strings.LastIndex(pending, "["); start >= 0 && !strings.Contains(pending[start:], "]") && len(pending)-start < maxPlaceholderLength {
+					hold = start
+				}
+				if hold > 0 {
+					send(pending[:hold])
+					pending = pending[hold:]
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				// Readers stop at the first error, the held back text has to go out before it.
+				if pending != "" {
+					send(pending)
+					pending = ""
+				}
+				select {
+				case errChan <- err:
+				case <-result.Canceled:
+				}
+			}
+		}
+		if pending != "" {
+			send(pending)
+		}
+	}()
+
+	return &llm.TextStreamResult{Stream: output, Err: errChan, QueuePosition: result.QueuePosition, Cancel: result.Cancel, Canceled: result.Canceled, Model: result.Model}, nil
+}
+
+func (w *LLMRedactionWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	redacted, redactor := w.redactConversation(conversation)
+
+	response, err := w.wrapped.ChatCompletionNoStream(redacted, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return redactor.Restore(response), nil
+}
+
+func (w *LLMRedactionWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMRedactionWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
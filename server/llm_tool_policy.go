@@ -0,0 +1,89 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+)
+
+// toolsDisabledResult is returned to the model in place of the result of a tool it is no longer allowed to call.
+const toolsDisabledResult = "Tool calls are disabled for the rest of this request because untrusted content looked like instructions. Answer with the information you already have."
+
+type policyLog interface {
+	Warn(message string, keyValuePairs ...any)
+}
+
+// LLMToolPolicyWrapper takes the tools away from the model once it has seen untrusted content that
+// looks like instructions, so an injected prompt can't make it act on behalf of the user.
+type LLMToolPolicyWrapper struct {
+	wrapped llm.LanguageModel
+	log     policyLog
+}
+
+func NewLLMToolPolicyWrapper(wrapped llm.LanguageModel, log policyLog) *LLMToolPolicyWrapper {
+	return &LLMToolPolicyWrapper{
+		wrapped: wrapped,
+		log:     log,
+	}
+}
+
+func (w *LLMToolPolicyWrapper) applyPolicy(conversation llm.BotConversation) llm.BotConversation {
+	if len(conversation.Tools.GetTools()) == 0 {
+		return conversation
+	}
+
+	for _, post := range conversation.Posts {
+		if llm.ContainsSuspectedInjection(post.Message) {
+			w.logDisabled(conversation, "")
+			conversation.Tools = llm.NewNoTools()
+			return conversation
+		}
+	}
+
+	// Tools may bring in untrusted content themselves, in which case the following calls are refused.
+	var disabled atomic.Bool
+	conversation.Tools = conversation.Tools.WithResolverWrapper(func(resolver llm.ToolResolver) llm.ToolResolver {
+		return func(context llm.ConversationContext, argsGetter llm.ToolArgumentGetter) (string, error) {
+			if disabled.Load() {
+				return toolsDisabledResult, nil
+			}
+			result, err := resolver(context, argsGetter)
+			if llm.ContainsSuspectedInjection(result) && !disabled.Swap(true) {
+				w.logDisabled(conversation, "tool result")
+			}
+			return result, err
+		}
+	})
+
+	return conversation
+}
+
+func (w *LLMToolPolicyWrapper) logDisabled(conversation llm.BotConversation, source string) {
+	keyValuePairs := []any{"bot_id", conversation.Context.BotID}
+	if conversation.Context.Post != nil {
+		keyValuePairs = append(keyValuePairs, "post_id", conversation.Context.Post.Id)
+	}
+	if source != "" {
+		keyValuePairs = append(keyValuePairs, "source", source)
+	}
+	w.log.Warn("Disabled tools after detecting a possible prompt injection", keyValuePairs...)
+}
+
+func (w *LLMToolPolicyWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	return w.wrapped.ChatCompletion(w.applyPolicy(conversation), opts...)
+}
+
+func (w *LLMToolPolicyWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	return w.wrapped.ChatCompletionNoStream(w.applyPolicy(conversation), opts...)
+}
+
+func (w *LLMToolPolicyWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMToolPolicyWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
@@ -5,9 +5,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"os/exec"
+	"slices"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
@@ -45,62 +46,56 @@ func getCaptionsFileIDFromProps(post *model.Post) (fileID string, err error) {
 	return captions[0].(map[string]interface{})["file_id"].(string), nil
 }
 
-func (p *Plugin) createTranscription(recordingFileID string) (*subtitles.Subtitles, error) {
-	if p.ffmpegPath == "" {
-		return nil, errors.New("ffmpeg not installed")
+// transcriptFileExtensions are the extensions of uploaded transcripts that can be summarized.
+var transcriptFileExtensions = []string{"vtt", "srt", "txt"}
+
+// getTranscriptFileID returns the transcript file of a post. Calls and Zoom posts reference it
+// through their captions, other posts qualify when they have exactly one transcript attached.
+func (p *Plugin) getTranscriptFileID(post *model.Post) (string, error) {
+	if fileID, err := getCaptionsFileIDFromProps(post); err == nil {
+		return fileID, nil
 	}
 
-	recordingFileInfo, err := p.pluginAPI.File.GetInfo(recordingFileID)
-	if err != nil {
-		return nil, fmt.Errorf("unable to get calls file info: %w", err)
+	if len(post.FileIds) != 1 {
+		return "", errors.New("no transcript on post")
 	}
 
-	fileReader, err := p.pluginAPI.File.Get(recordingFileID)
+	fileInfo, err := p.pluginAPI.File.GetInfo(post.FileIds[0])
 	if err != nil {
-		return nil, fmt.Errorf("unable to read calls file: %w", err)
+		return "", fmt.Errorf("unable to get file info: %w", err)
 	}
-
-	var cmd *exec.Cmd
-	if recordingFileInfo.Size > WhisperAPILimit {
-		cmd = exec.Command(p.ffmpegPath, "-i", "pipe:0", "-ac", "1", "-map", "0:a:0", "-b:a", "32k", "-ar", "16000", "-f", "mp3", "pipe:1") //nolint:gosec
-	} else {
-		cmd = exec.Command(p.ffmpegPath, "-i", "pipe:0", "-f", "mp3", "pipe:1") //nolint:gosec
+	if !slices.Contains(transcriptFileExtensions, strings.ToLower(fileInfo.Extension)) {
+		return "", errors.New("attached file is not a transcript")
 	}
 
-	cmd.Stdin = fileReader
-
-	audioReader, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("couldn't create stdout pipe: %w", err)
-	}
+	return fileInfo.Id, nil
+}
 
-	errorReader, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("couldn't create stderr pipe: %w", err)
+// parseTranscription parses a transcript in any of the supported formats.
+func parseTranscription(post *model.Post, reader io.Reader) (*subtitles.Subtitles, error) {
+	if post.Type == "custom_zoom_chat" {
+		return subtitles.NewSubtitlesFromZoomChat(reader)
 	}
 
-	if err = cmd.Start(); err != nil {
-		return nil, fmt.Errorf("couldn't run ffmpeg: %w", err)
-	}
+	transcription, _, err := subtitles.NewSubtitlesAutoDetect(reader)
+	return transcription, err
+}
 
-	transcriber := p.getTranscribe()
-	// Limit reader should probably error out instead of just silently failing
-	transcription, err := transcriber.Transcribe(io.LimitReader(audioReader, WhisperAPILimit))
-	if err != nil {
-		return nil, fmt.Errorf("unable to transcribe: %w", err)
+// createTranscription transcribes the recording. The recording is split into segments small enough for
+// the Whisper API limit which are transcribed separately. Segments that could not be transcribed are returned.
+func (p *Plugin) createTranscription(ctx context.Context, recordingFileID string) (*subtitles.Subtitles, []audioSegment, error) {
+	if p.ffmpegPath == "" {
+		return nil, nil, errors.New("ffmpeg not installed")
 	}
 
-	errout, err := io.ReadAll(errorReader)
+	fileReader, err := p.pluginAPI.File.Get(recordingFileID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read stderr from ffmpeg: %w", err)
-	}
-
-	if err := cmd.Wait(); err != nil {
-		p.pluginAPI.Log.Debug("ffmpeg stderr: " + string(errout))
-		return nil, fmt.Errorf("error while waiting for ffmpeg: %w", err)
+		return nil, nil, fmt.Errorf("unable to read calls file: %w", err)
 	}
 
-	return transcription, nil
+	// The size of the encoded audio depends on the recording's duration rather than its file size, so even
+	// small recordings go through segmenting to never exceed the limit.
+	return p.transcribeRecordingInSegments(ctx, fileReader)
 }
 
 func (p *Plugin) newCallRecordingThread(bot *Bot, requestingUser *model.User, recordingPost *model.Post, channel *model.Channel, fileID string) (*model.Post, error) {
@@ -137,71 +132,138 @@ func (p *Plugin) newCallTranscriptionSummaryThread(bot *Bot, requestingUser *mod
 		return nil, err
 	}
 
-	go func() (reterr error) {
-		// Update to an error if we return one.
-		defer func() {
-			if reterr != nil {
-				surePost.Message = T("copilot.summairize_subscription_error", "Sorry! Something went wrong. Check the server logs for details.")
-				if err := p.pluginAPI.Post.UpdatePost(surePost); err != nil {
-					p.API.LogError("Failed to update post in error handling newCallTranscriptionSummaryThread", "error", err)
-				}
-				p.API.LogError("Error in call recording post", "error", reterr)
-			}
-		}()
+	if _, err := p.jobQueue.Enqueue(JobTypeSummarizeTranscription, surePost.Id, requestingUser.Id, bot.mmBot.UserId, summarizeTranscriptionJobPayload{
+		TranscriptionPostID: transcriptionPost.Id,
+		ChannelID:           channel.Id,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to queue transcription summary: %w", err)
+	}
 
-		transcriptionFileID, err := getCaptionsFileIDFromProps(transcriptionPost)
-		if err != nil {
-			return fmt.Errorf("unable to get transcription file id: %w", err)
-		}
-		transcriptionFileInfo, err := p.pluginAPI.File.GetInfo(transcriptionFileID)
+	return surePost, nil
+}
+
+type summarizeTranscriptionJobPayload struct {
+	TranscriptionPostID string `json:"transcription_post_id"`
+	ChannelID           string `json:"channel_id"`
+}
+
+// summarizeTranscriptionJobState remembers the summary post so that retries stream into it again.
+type summarizeTranscriptionJobState struct {
+	SummaryPostID string `json:"summary_post_id,omitempty"`
+}
+
+// runSummarizeTranscriptionJob summarizes an existing transcript as a reply to the job's post.
+func (p *Plugin) runSummarizeTranscriptionJob(jobCtx *JobContext) error {
+	var payload summarizeTranscriptionJobPayload
+	if err := json.Unmarshal([]byte(jobCtx.Job.Payload), &payload); err != nil {
+		return fmt.Errorf("unable to parse job payload: %w", err)
+	}
+
+	bot, requestingUser, channel, err := p.getJobParticipants(jobCtx.Job, payload.ChannelID)
+	if err != nil {
+		return err
+	}
+	T := i18nLocalizerFunc(p.i18n, requestingUser.Locale)
+
+	transcriptionPost, err := p.pluginAPI.Post.GetPost(payload.TranscriptionPostID)
+	if err != nil {
+		return fmt.Errorf("unable to get transcription post: %w", err)
+	}
+	transcriptionFileID, err := p.getTranscriptFileID(transcriptionPost)
+	if err != nil {
+		return fmt.Errorf("unable to get transcription file id: %w", err)
+	}
+	transcriptionFileInfo, err := p.pluginAPI.File.GetInfo(transcriptionFileID)
+	if err != nil {
+		return fmt.Errorf("unable to get transcription file info: %w", err)
+	}
+	transcriptionFilePost, err := p.pluginAPI.Post.GetPost(transcriptionFileInfo.PostId)
+	if err != nil {
+		return fmt.Errorf("unable to get transcription file post: %w", err)
+	}
+	if transcriptionFilePost.ChannelId != channel.Id {
+		return errors.New("strange configuration of calls transcription file")
+	}
+	transcriptionFileReader, err := p.pluginAPI.File.Get(transcriptionFileID)
+	if err != nil {
+		return fmt.Errorf("unable to read calls file: %w", err)
+	}
+
+	transcription, err := parseTranscription(transcriptionFilePost, transcriptionFileReader)
+	if err != nil {
+		return fmt.Errorf("unable to parse transcription file: %w", err)
+	}
+
+	var state summarizeTranscriptionJobState
+	if err := jobCtx.LoadState(&state); err != nil {
+		return err
+	}
+
+	var summaryPost *model.Post
+	if state.SummaryPostID != "" {
+		summaryPost, err = p.pluginAPI.Post.GetPost(state.SummaryPostID)
 		if err != nil {
-			return fmt.Errorf("unable to get transcription file info: %w", err)
+			return fmt.Errorf("unable to get summary post: %w", err)
 		}
-		transcriptionFilePost, err := p.pluginAPI.Post.GetPost(transcriptionFileInfo.PostId)
+		// Start over from what a previous attempt left behind.
+		clearPostInterrupted(summaryPost)
+		summaryPost.Message = ""
+	} else {
+		surePost, err := p.pluginAPI.Post.GetPost(jobCtx.Job.PostID)
 		if err != nil {
-			return fmt.Errorf("unable to get transcription file post: %w", err)
+			return fmt.Errorf("unable to get job post: %w", err)
 		}
-		if transcriptionFilePost.ChannelId != channel.Id {
-			return errors.New("strange configuration of calls transcription file")
+		summaryPost = &model.Post{
+			RootId:    surePost.Id,
+			ChannelId: surePost.ChannelId,
+			Message:   "",
 		}
-		transcriptionFileReader, err := p.pluginAPI.File.Get(transcriptionFileID)
-		if err != nil {
-			return fmt.Errorf("unable to read calls file: %w", err)
+		summaryPost.AddProp(ReferencedTranscriptPostID, transcriptionPost.Id)
+		if err := p.botCreatePost(bot.mmBot.UserId, requestingUser.Id, summaryPost); err != nil {
+			return fmt.Errorf("unable to create summary post: %w", err)
 		}
 
-		var transcription *subtitles.Subtitles
-		if transcriptionFilePost.Type == "custom_zoom_chat" {
-			transcription, err = subtitles.NewSubtitlesFromZoomChat(transcriptionFileReader)
-			if err != nil {
-				return fmt.Errorf("unable to parse transcription file: %w", err)
-			}
-		} else {
-			transcription, err = subtitles.NewSubtitlesFromVTT(transcriptionFileReader)
-			if err != nil {
-				return fmt.Errorf("unable to parse transcription file: %w", err)
-			}
+		state.SummaryPostID = summaryPost.Id
+		if err := jobCtx.SaveState(state); err != nil {
+			return err
 		}
+	}
 
-		context := p.MakeConversationContext(bot, requestingUser, channel, nil)
-		summaryStream, err := p.summarizeTranscription(bot, transcription, context)
+	jobCtx.SetProgress(T("copilot.job_progress_summarizing", "Summarizing transcription..."))
+	conversationContext := p.MakeConversationContext(jobCtx, bot, requestingUser, channel, nil)
+	return p.streamJobResultToPost(jobCtx, summaryPost, requestingUser.Locale, func() (*llm.TextStreamResult, error) {
+		summaryStream, err := p.summarizeTranscription(bot, transcription, conversationContext)
 		if err != nil {
-			return fmt.Errorf("unable to summarize transcription: %w", err)
+			return nil, fmt.Errorf("unable to summarize transcription: %w", err)
 		}
+		return summaryStream, nil
+	})
+}
 
-		summaryPost := &model.Post{
-			RootId:    surePost.Id,
-			ChannelId: surePost.ChannelId,
-			Message:   "",
-		}
-		summaryPost.AddProp(ReferencedTranscriptPostID, transcriptionPost.Id)
-		if err := p.streamResultToNewPost(bot.mmBot.UserId, requestingUser.Id, summaryStream, summaryPost); err != nil {
-			return fmt.Errorf("unable to stream result to post: %w", err)
-		}
+// streamJobResultToPost streams the result of a job into a post. The request to the LLM is only started once
+// the job holds the post, so no failure on the way leaves a response unread. A response stopped by the user
+// completes the job, any other way the stream ends early is returned so the job is retried, or released and
+// resumed into the same post when the server is shutting down.
+func (p *Plugin) streamJobResultToPost(jobCtx *JobContext, post *model.Post, locale string, startStream func() (*llm.TextStreamResult, error)) error {
+	ctx, err := p.getPostStreamingContext(jobCtx, post.Id)
+	if err != nil {
+		return fmt.Errorf("unable to get post streaming context: %w", err)
+	}
+	defer p.finishPostStreaming(post.Id)
 
-		return nil
-	}() //nolint:errcheck
+	stream, err := startStream()
+	if err != nil {
+		return err
+	}
 
-	return surePost, nil
+	err = p.streamResultToPost(ctx, stream, post, locale)
+	if jobCtx.Err() != nil {
+		return context.Cause(jobCtx)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
 }
 
 func (p *Plugin) summarizeCallRecording(bot *Bot, rootID string, requestingUser *model.User, recordingFileID string, channel *model.Channel) error {
@@ -216,53 +278,169 @@ func (p *Plugin) summarizeCallRecording(bot *Bot, rootID string, requestingUser
 		return err
 	}
 
-	go func() (reterr error) {
-		// Update to an error if we return one.
-		defer func() {
-			if reterr != nil {
-				transcriptPost.Message = T("copilot.summarize_call_recording_processing_error", "Sorry! Something went wrong. Check the server logs for details.")
-				if err := p.pluginAPI.Post.UpdatePost(transcriptPost); err != nil {
-					p.API.LogError("Failed to update post in error handling handleCallRecordingPost", "error", err)
-				}
-				p.API.LogError("Error in call recording post", "error", reterr)
-			}
-		}()
+	if _, err := p.jobQueue.Enqueue(JobTypeSummarizeRecording, transcriptPost.Id, requestingUser.Id, bot.mmBot.UserId, summarizeRecordingJobPayload{
+		RecordingFileID: recordingFileID,
+		ChannelID:       channel.Id,
+	}); err != nil {
+		return fmt.Errorf("unable to queue recording summary: %w", err)
+	}
+
+	return nil
+}
+
+type summarizeRecordingJobPayload struct {
+	RecordingFileID string `json:"recording_file_id"`
+	ChannelID       string `json:"channel_id"`
+}
 
-		transcription, err := p.createTranscription(recordingFileID)
+// summarizeRecordingJobState remembers the uploaded transcript so that retries don't transcribe the recording again.
+type summarizeRecordingJobState struct {
+	TranscriptFileID string `json:"transcript_file_id,omitempty"`
+}
+
+// runSummarizeRecordingJob transcribes a recording, attaches the transcript to the job's post and streams the summary into it.
+func (p *Plugin) runSummarizeRecordingJob(jobCtx *JobContext) error {
+	var payload summarizeRecordingJobPayload
+	if err := json.Unmarshal([]byte(jobCtx.Job.Payload), &payload); err != nil {
+		return fmt.Errorf("unable to parse job payload: %w", err)
+	}
+
+	bot, requestingUser, channel, err := p.getJobParticipants(jobCtx.Job, payload.ChannelID)
+	if err != nil {
+		return err
+	}
+	T := i18nLocalizerFunc(p.i18n, requestingUser.Locale)
+
+	var state summarizeRecordingJobState
+	if err = jobCtx.LoadState(&state); err != nil {
+		return err
+	}
+
+	transcription, transcriptFileInfo, err := p.getJobTranscript(state.TranscriptFileID)
+	if err != nil {
+		return err
+	}
+	if transcription == nil {
+		jobCtx.SetProgress(T("copilot.job_progress_transcribing", "Transcribing recording..."))
+		var missingSegments []audioSegment
+		transcription, missingSegments, err = p.createTranscription(jobCtx, payload.RecordingFileID)
 		if err != nil {
 			return fmt.Errorf("failed to create transcription: %w", err)
 		}
+		if jobCtx.Err() != nil {
+			return context.Cause(jobCtx)
+		}
 
-		transcriptFileInfo, err := p.pluginAPI.File.Upload(strings.NewReader(transcription.FormatVTT()), "transcript.txt", channel.Id)
+		transcriptPost, err := p.pluginAPI.Post.GetPost(jobCtx.Job.PostID)
 		if err != nil {
-			return fmt.Errorf("unable to upload transcript: %w", err)
+			return fmt.Errorf("unable to get job post: %w", err)
+		}
+		if len(missingSegments) > 0 {
+			p.reportMissingSegments(bot, requestingUser, transcriptPost.RootId, missingSegments)
 		}
 
-		conversationContext := p.MakeConversationContext(bot, requestingUser, channel, nil)
-		summaryStream, err := p.summarizeTranscription(bot, transcription, conversationContext)
+		transcriptFileInfo, err = p.pluginAPI.File.Upload(strings.NewReader(transcription.FormatVTT()), "transcript.txt", channel.Id)
 		if err != nil {
-			return fmt.Errorf("unable to summarize transcription: %w", err)
+			return fmt.Errorf("unable to upload transcript: %w", err)
 		}
 
-		if err = p.updatePostWithFile(transcriptPost, transcriptFileInfo); err != nil {
-			return fmt.Errorf("unable to update transcript post: %w", err)
+		state.TranscriptFileID = transcriptFileInfo.Id
+		if err = jobCtx.SaveState(state); err != nil {
+			return err
 		}
+	}
 
-		ctx, err := p.getPostStreamingContext(context.Background(), transcriptPost.Id)
+	jobCtx.SetProgress(T("copilot.job_progress_summarizing", "Summarizing transcription..."))
+
+	// Progress updates modify the post, so get the latest version before attaching the transcript.
+	// Attaching it again on a retry also clears what the previous attempt streamed.
+	transcriptPost, err := p.pluginAPI.Post.GetPost(jobCtx.Job.PostID)
+	if err != nil {
+		return fmt.Errorf("unable to get job post: %w", err)
+	}
+	clearPostInterrupted(transcriptPost)
+	if err = p.updatePostWithFile(transcriptPost, transcriptFileInfo); err != nil {
+		return fmt.Errorf("unable to update transcript post: %w", err)
+	}
+
+	conversationContext := p.MakeConversationContext(jobCtx, bot, requestingUser, channel, nil)
+	return p.streamJobResultToPost(jobCtx, transcriptPost, requestingUser.Locale, func() (*llm.TextStreamResult, error) {
+		summaryStream, err := p.summarizeTranscription(bot, transcription, conversationContext)
 		if err != nil {
-			return fmt.Errorf("unable to get post streaming context: %w", err)
+			return nil, fmt.Errorf("unable to summarize transcription: %w", err)
 		}
-		defer p.finishPostStreaming(transcriptPost.Id)
+		return summaryStream, nil
+	})
+}
 
-		p.streamResultToPost(ctx, summaryStream, transcriptPost, requestingUser.Locale)
+// getJobTranscript reads the transcript uploaded by a previous attempt of a job, if there is one.
+func (p *Plugin) getJobTranscript(fileID string) (*subtitles.Subtitles, *model.FileInfo, error) {
+	if fileID == "" {
+		return nil, nil, nil
+	}
 
-		return nil
-	}() //nolint:errcheck
+	fileInfo, err := p.pluginAPI.File.GetInfo(fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get transcript file info: %w", err)
+	}
+	reader, err := p.pluginAPI.File.Get(fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read transcript file: %w", err)
+	}
+	transcription, err := subtitles.NewSubtitlesFromVTT(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse transcript file: %w", err)
+	}
 
-	return nil
+	return transcription, fileInfo, nil
+}
+
+// getJobParticipants resolves the bot, requesting user and channel a job runs for.
+func (p *Plugin) getJobParticipants(job *Job, channelID string) (*Bot, *model.User, *model.Channel, error) {
+	bot := p.GetBotByID(job.BotID)
+	if bot == nil {
+		return nil, nil, nil, fmt.Errorf("bot %s no longer exists", job.BotID)
+	}
+	requestingUser, err := p.pluginAPI.User.Get(job.UserID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to get requesting user: %w", err)
+	}
+	channel, err := p.pluginAPI.Channel.Get(channelID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to get channel: %w", err)
+	}
+
+	return bot, requestingUser, channel, nil
+}
+
+// mapSpeakersToUsers renames transcript speakers to include the Mattermost username when
+// the speaker name uniquely matches a member of the channel.
+func (p *Plugin) mapSpeakersToUsers(transcription *subtitles.Subtitles, channelID string) {
+	names := make(map[string]string)
+	for _, speaker := range transcription.Speakers() {
+		users, err := p.pluginAPI.User.Search(&model.UserSearch{
+			Term:        speaker,
+			InChannelId: channelID,
+			Limit:       2,
+		})
+		if err != nil {
+			p.pluginAPI.Log.Debug("Unable to search for transcript speaker", "error", err)
+			continue
+		}
+		if len(users) != 1 {
+			continue
+		}
+		names[speaker] = fmt.Sprintf("%s (@%s)", speaker, users[0].Username)
+	}
+	transcription.RenameSpeakers(names)
 }
 
 func (p *Plugin) summarizeTranscription(bot *Bot, transcription *subtitles.Subtitles, context llm.ConversationContext) (*llm.TextStreamResult, error) {
+	hasSpeakers := transcription.HasSpeakers()
+	if hasSpeakers && context.Channel != nil {
+		p.mapSpeakersToUsers(transcription, context.Channel.Id)
+	}
+
 	llmFormattedTranscription := transcription.FormatForLLM()
 	tokens := p.getLLM(bot.cfg).CountTokens(llmFormattedTranscription)
 	tokenLimitWithMargin := int(float64(p.getLLM(bot.cfg).InputTokenLimit())*0.75) - ContextTokenMargin
@@ -276,13 +454,13 @@ func (p *Plugin) summarizeTranscription(bot *Bot, transcription *subtitles.Subti
 		summarizedChunks := make([]string, 0, len(chunks))
 		p.pluginAPI.Log.Debug("Split into chunks", "chunks", len(chunks))
 		for _, chunk := range chunks {
-			context.PromptParameters = map[string]string{"TranscriptionChunk": chunk}
+			context.PromptParameters = map[string]string{"TranscriptionChunk": llm.FormatUntrusted(llm.UntrustedSourceTranscription, chunk), "HasSpeakers": fmt.Sprintf("%t", hasSpeakers)}
 			summarizeChunkPrompt, err := p.prompts.ChatCompletion(llm.PromptSummarizeChunk, context, p.getDefaultToolsStore(bot, context.IsDMWithBot()))
 			if err != nil {
 				return nil, fmt.Errorf("unable to get summarize chunk prompt: %w", err)
 			}
 
-			summarizedChunk, err := p.getLLM(bot.cfg).ChatCompletionNoStream(summarizeChunkPrompt)
+			summarizedChunk, err := p.getLLM(bot.cfg).ChatCompletionNoStream(summarizeChunkPrompt, llm.WithTask(bot.cfg, llm.TaskChunkSummary))
 			if err != nil {
 				return nil, fmt.Errorf("unable to get summarized chunk: %w", err)
 			}
@@ -295,13 +473,17 @@ func (p *Plugin) summarizeTranscription(bot *Bot, transcription *subtitles.Subti
 		p.pluginAPI.Log.Debug("Completed chunk summarization", "chunks", len(summarizedChunks), "tokens", p.getLLM(bot.cfg).CountTokens(llmFormattedTranscription))
 	}
 
-	context.PromptParameters = map[string]string{"Transcription": llmFormattedTranscription, "IsChunked": fmt.Sprintf("%t", isChunked)}
+	context.PromptParameters = map[string]string{
+		"Transcription": llm.FormatUntrusted(llm.UntrustedSourceTranscription, llmFormattedTranscription),
+		"IsChunked":     fmt.Sprintf("%t", isChunked),
+		"HasSpeakers":   fmt.Sprintf("%t", hasSpeakers),
+	}
 	summaryPrompt, err := p.prompts.ChatCompletion(llm.PromptMeetingSummary, context, p.getDefaultToolsStore(bot, context.IsDMWithBot()))
 	if err != nil {
 		return nil, fmt.Errorf("unable to get meeting summary prompt: %w", err)
 	}
 
-	summaryStream, err := p.getLLM(bot.cfg).ChatCompletion(summaryPrompt)
+	summaryStream, err := p.getLLM(bot.cfg).ChatCompletion(summaryPrompt, llm.WithTask(bot.cfg, llm.TaskFinalSummary))
 	if err != nil {
 		return nil, fmt.Errorf("unable to get meeting summary: %w", err)
 	}
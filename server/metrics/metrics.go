@@ -19,6 +19,27 @@ const (
 	MetricsVersionLabel           = "version"
 )
 
+// OperationOther labels LLM requests that were not given an operation.
+const OperationOther = "other"
+
+// Error types label failed LLM requests.
+const (
+	ErrorTypeTimeout   = "timeout"
+	ErrorTypeRateLimit = "rate_limit"
+	ErrorTypeAuth      = "auth"
+	ErrorTypeTool      = "tool"
+	ErrorTypeOther     = "other"
+
+	// ErrorTypeFinishReason labels generations that ended for a reason other than completing or calling tools.
+	ErrorTypeFinishReason = "finish_reason"
+)
+
+// Tool call statuses.
+const (
+	ToolCallSucceeded = "success"
+	ToolCallFailed    = "error"
+)
+
 type Metrics interface {
 	GetRegistry() *prometheus.Registry
 
@@ -27,7 +48,7 @@ type Metrics interface {
 	IncrementHTTPRequests()
 	IncrementHTTPErrors()
 
-	GetMetricsForAIService(llmName string) *llmMetrics
+	GetMetricsForAIService(llmName, serviceType string) *llmMetrics
 }
 
 type InstanceInfo struct {
@@ -48,7 +69,18 @@ type metrics struct {
 	httpRequestsTotal prometheus.Counter
 	httpErrorsTotal   prometheus.Counter
 
-	llmRequestsTotal *prometheus.CounterVec
+	llmRequestsTotal         *prometheus.CounterVec
+	llmQueueDepth            *prometheus.GaugeVec
+	llmQueueWaitTime         *prometheus.HistogramVec
+	llmRequestDuration       *prometheus.HistogramVec
+	llmTimeToFirstToken      *prometheus.HistogramVec
+	llmInputTokensTotal      *prometheus.CounterVec
+	llmOutputTokensTotal     *prometheus.CounterVec
+	llmErrorsTotal           *prometheus.CounterVec
+	llmToolCallsTotal        *prometheus.CounterVec
+	llmRedactionsTotal       *prometheus.CounterVec
+	llmTranscriptionDuration *prometheus.HistogramVec
+	llmFeedbackTotal         *prometheus.CounterVec
 }
 
 // NewMetrics Factory method to create a new metrics collector.
@@ -126,9 +158,112 @@ func NewMetrics(info InstanceInfo) Metrics {
 		Name:        "requests_total",
 		Help:        "The total number of LLM requests.",
 		ConstLabels: additionalLabels,
-	}, []string{"llm_name"})
+	}, []string{"llm_name", "service_type", "operation"})
 	m.registry.MustRegister(m.llmRequestsTotal)
 
+	m.llmQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "queue_depth",
+		Help:        "The number of LLM requests waiting for a free slot with the upstream service.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type"})
+	m.registry.MustRegister(m.llmQueueDepth)
+
+	m.llmQueueWaitTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "queue_wait_time_seconds",
+		Help:        "Time LLM requests spent waiting for a free slot with the upstream service.",
+		Buckets:     []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type"})
+	m.registry.MustRegister(m.llmQueueWaitTime)
+
+	m.llmRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "request_duration_seconds",
+		Help:        "Time from sending an LLM request until the upstream service finished the response.",
+		Buckets:     []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "operation"})
+	m.registry.MustRegister(m.llmRequestDuration)
+
+	m.llmTimeToFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "time_to_first_token_seconds",
+		Help:        "Time from sending an LLM request until the first part of the response arrived.",
+		Buckets:     []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 60},
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "operation"})
+	m.registry.MustRegister(m.llmTimeToFirstToken)
+
+	m.llmInputTokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "input_tokens_total",
+		Help:        "The total number of tokens sent to LLMs.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "operation"})
+	m.registry.MustRegister(m.llmInputTokensTotal)
+
+	m.llmOutputTokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "output_tokens_total",
+		Help:        "The total number of tokens generated by LLMs.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "operation"})
+	m.registry.MustRegister(m.llmOutputTokensTotal)
+
+	m.llmErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "errors_total",
+		Help:        "The total number of failed LLM requests.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "operation", "error_type"})
+	m.registry.MustRegister(m.llmErrorsTotal)
+
+	m.llmToolCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "tool_calls_total",
+		Help:        "The total number of tools invoked by LLMs.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "tool", "status"})
+	m.registry.MustRegister(m.llmToolCallsTotal)
+
+	m.llmRedactionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "redactions_total",
+		Help:        "The total number of sensitive values replaced before content was sent to LLMs.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "detector"})
+	m.registry.MustRegister(m.llmRedactionsTotal)
+
+	m.llmTranscriptionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "transcription_duration_seconds",
+		Help:        "Time taken by the upstream service to transcribe audio.",
+		Buckets:     []float64{1, 5, 10, 30, 60, 120, 300, 600},
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type"})
+	m.registry.MustRegister(m.llmTranscriptionDuration)
+
+	m.llmFeedbackTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   MetricsNamespace,
+		Subsystem:   MetricsSubsystemLLM,
+		Name:        "feedback_total",
+		Help:        "The total number of times users rated a response or changed their rating. These are events, the current ratings are in the feedback stats.",
+		ConstLabels: additionalLabels,
+	}, []string{"llm_name", "service_type", "model", "rating"})
+	m.registry.MustRegister(m.llmFeedbackTotal)
+
 	return m
 }
 
@@ -154,26 +289,131 @@ func (m *metrics) IncrementHTTPErrors() {
 	}
 }
 
-func (m *metrics) GetMetricsForAIService(llmName string) *llmMetrics {
+func (m *metrics) GetMetricsForAIService(llmName, serviceType string) *llmMetrics {
 	if m == nil {
 		return nil
 	}
 
+	labels := prometheus.Labels{"llm_name": llmName, "service_type": serviceType}
 	return &llmMetrics{
-		llmRequestsTotal: m.llmRequestsTotal.MustCurryWith(prometheus.Labels{"llm_name": llmName}),
+		llmRequestsTotal:         m.llmRequestsTotal.MustCurryWith(labels),
+		llmQueueDepth:            m.llmQueueDepth.MustCurryWith(labels),
+		llmQueueWaitTime:         m.llmQueueWaitTime.MustCurryWith(labels),
+		llmRequestDuration:       m.llmRequestDuration.MustCurryWith(labels),
+		llmTimeToFirstToken:      m.llmTimeToFirstToken.MustCurryWith(labels),
+		llmInputTokensTotal:      m.llmInputTokensTotal.MustCurryWith(labels),
+		llmOutputTokensTotal:     m.llmOutputTokensTotal.MustCurryWith(labels),
+		llmErrorsTotal:           m.llmErrorsTotal.MustCurryWith(labels),
+		llmToolCallsTotal:        m.llmToolCallsTotal.MustCurryWith(labels),
+		llmRedactionsTotal:       m.llmRedactionsTotal.MustCurryWith(labels),
+		llmTranscriptionDuration: m.llmTranscriptionDuration.MustCurryWith(labels),
+		llmFeedbackTotal:         m.llmFeedbackTotal.MustCurryWith(labels),
 	}
 }
 
 type LLMetrics interface {
-	IncrementLLMRequests()
+	IncrementLLMRequests(operation string)
+	SetQueueDepth(depth int)
+	ObserveQueueWaitTime(elapsed float64)
+	ObserveRequestDuration(operation string, elapsed float64)
+	ObserveTimeToFirstToken(operation string, elapsed float64)
+	AddTokens(operation string, input, output int)
+	IncrementErrors(operation, errorType string)
+	IncrementToolCalls(tool, status string)
+	AddRedactions(detector string, count int)
+	ObserveTranscriptionDuration(elapsed float64)
+	IncrementFeedback(model, rating string)
 }
 
 type llmMetrics struct {
-	llmRequestsTotal *prometheus.CounterVec
+	llmRequestsTotal         *prometheus.CounterVec
+	llmQueueDepth            *prometheus.GaugeVec
+	llmQueueWaitTime         prometheus.ObserverVec
+	llmRequestDuration       prometheus.ObserverVec
+	llmTimeToFirstToken      prometheus.ObserverVec
+	llmInputTokensTotal      *prometheus.CounterVec
+	llmOutputTokensTotal     *prometheus.CounterVec
+	llmErrorsTotal           *prometheus.CounterVec
+	llmToolCallsTotal        *prometheus.CounterVec
+	llmRedactionsTotal       *prometheus.CounterVec
+	llmTranscriptionDuration prometheus.ObserverVec
+	llmFeedbackTotal         *prometheus.CounterVec
+}
+
+func operationLabel(operation string) prometheus.Labels {
+	if operation == "" {
+		operation = OperationOther
+	}
+	return prometheus.Labels{"operation": operation}
+}
+
+func (m *llmMetrics) IncrementLLMRequests(operation string) {
+	if m != nil {
+		m.llmRequestsTotal.With(operationLabel(operation)).Inc()
+	}
+}
+
+func (m *llmMetrics) SetQueueDepth(depth int) {
+	if m != nil {
+		m.llmQueueDepth.With(prometheus.Labels{}).Set(float64(depth))
+	}
+}
+
+func (m *llmMetrics) ObserveQueueWaitTime(elapsed float64) {
+	if m != nil {
+		m.llmQueueWaitTime.With(prometheus.Labels{}).Observe(elapsed)
+	}
+}
+
+func (m *llmMetrics) ObserveRequestDuration(operation string, elapsed float64) {
+	if m != nil {
+		m.llmRequestDuration.With(operationLabel(operation)).Observe(elapsed)
+	}
+}
+
+func (m *llmMetrics) ObserveTimeToFirstToken(operation string, elapsed float64) {
+	if m != nil {
+		m.llmTimeToFirstToken.With(operationLabel(operation)).Observe(elapsed)
+	}
+}
+
+func (m *llmMetrics) AddTokens(operation string, input, output int) {
+	if m != nil {
+		m.llmInputTokensTotal.With(operationLabel(operation)).Add(float64(input))
+		m.llmOutputTokensTotal.With(operationLabel(operation)).Add(float64(output))
+	}
+}
+
+func (m *llmMetrics) IncrementErrors(operation, errorType string) {
+	if m != nil {
+		labels := operationLabel(operation)
+		labels["error_type"] = errorType
+		m.llmErrorsTotal.With(labels).Inc()
+	}
+}
+
+func (m *llmMetrics) IncrementToolCalls(tool, status string) {
+	if m != nil {
+		m.llmToolCallsTotal.With(prometheus.Labels{"tool": tool, "status": status}).Inc()
+	}
+}
+
+func (m *llmMetrics) AddRedactions(detector string, count int) {
+	if m != nil {
+		m.llmRedactionsTotal.With(prometheus.Labels{"detector": detector}).Add(float64(count))
+	}
+}
+
+func (m *llmMetrics) ObserveTranscriptionDuration(elapsed float64) {
+	if m != nil {
+		m.llmTranscriptionDuration.With(prometheus.Labels{}).Observe(elapsed)
+	}
 }
 
-func (m *llmMetrics) IncrementLLMRequests() {
+// IncrementFeedback counts a rating event. A user changing their rating is counted again and removed
+// ratings aren't subtracted, so the totals are not the current ratings of responses.
+func (m *llmMetrics) IncrementFeedback(model, rating string) {
 	if m != nil {
-		m.llmRequestsTotal.With(prometheus.Labels{}).Inc()
+		m.llmFeedbackTotal.With(prometheus.Labels{"model": model, "rating": rating}).Inc()
 	}
 }
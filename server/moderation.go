@@ -0,0 +1,438 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost-plugin-ai/server/openai"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Classifiers that can review responses in addition to the blocklist.
+const (
+	ModerationClassifierNone   = ""
+	ModerationClassifierOpenAI = "openai"
+	ModerationClassifierLLM    = "llm"
+)
+
+// What happens to a response that violates the content policy.
+const (
+	ModerationActionReplace = "replace"
+	ModerationActionRedact  = "redact"
+)
+
+// ModeratedProp marks a response whose content was withheld or redacted by content moderation.
+const ModeratedProp = "llm_moderated"
+
+const (
+	moderationTimeout           = 30 * time.Second
+	moderationRedactedText      = "[removed]"
+	moderationCategoryBlocklist = "blocklist"
+)
+
+// ModerationResult is the verdict of a moderator on a piece of text.
+type ModerationResult struct {
+	Flagged    bool
+	Categories []string
+
+	// Redacted is the text with the violations removed. It is empty if the moderator can't tell where they are.
+	Redacted string
+}
+
+// Moderator reviews what a bot is about to post.
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, text string) (ModerationResult, error)
+}
+
+// parseModerationBlocklist compiles the blocklist of the admin. Each line is a term matched as a
+// whole word regardless of case, or a regular expression if it is enclosed in slashes.
+func parseModerationBlocklist(blocklist string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, line := range strings.Split(blocklist, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var expression string
+		if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			expression = line[1 : len(line)-1]
+		} else {
+			expression = "(?i)" + regexp.QuoteMeta(line)
+			if isWordCharacter(line[0]) {
+				expression = `\b` + expression
+			}
+			if isWordCharacter(line[len(line)-1]) {
+				expression += `\b`
+			}
+		}
+
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, llm.ValidationError{Field: "moderationBlocklist", Message: fmt.Sprintf("invalid pattern %q: %s", line, err)}
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func isWordCharacter(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// BlocklistModerator flags text containing any of the terms the admin blocked.
+type BlocklistModerator struct {
+	patterns []*regexp.Regexp
+}
+
+func NewBlocklistModerator(patterns []*regexp.Regexp) *BlocklistModerator {
+	return &BlocklistModerator{
+		patterns: patterns,
+	}
+}
+
+func (m *BlocklistModerator) Name() string {
+	return "blocklist"
+}
+
+func (m *BlocklistModerator) Moderate(_ context.Context, text string) (ModerationResult, error) {
+	redacted := text
+	for _, pattern := range m.patterns {
+		redacted = pattern.ReplaceAllString(redacted, moderationRedactedText)
+	}
+	if redacted == text {
+		return ModerationResult{}, nil
+	}
+
+	return ModerationResult{
+		Flagged:    true,
+		Categories: []string{moderationCategoryBlocklist},
+		Redacted:   redacted,
+	}, nil
+}
+
+// OpenAIModerator uses the moderation endpoint of an OpenAI service.
+type OpenAIModerator struct {
+	client *openai.OpenAI
+}
+
+func NewOpenAIModerator(client *openai.OpenAI) *OpenAIModerator {
+	return &OpenAIModerator{
+		client: client,
+	}
+}
+
+func (m *OpenAIModerator) Name() string {
+	return "openai"
+}
+
+func (m *OpenAIModerator) Moderate(ctx context.Context, text string) (ModerationResult, error) {
+	flagged, categories, err := m.client.Moderate(ctx, text)
+	if err != nil {
+		return ModerationResult{}, err
+	}
+
+	return ModerationResult{
+		Flagged:    flagged,
+		Categories: categories,
+	}, nil
+}
+
+// LLMModerator asks a bot to classify the response with the moderation_classifier prompt.
+type LLMModerator struct {
+	languageModel llm.LanguageModel
+	prompts       *llm.Prompts
+	botConfig     llm.BotConfig
+	policy        string
+}
+
+func NewLLMModerator(languageModel llm.LanguageModel, prompts *llm.Prompts, botConfig llm.BotConfig, policy string) *LLMModerator {
+	return &LLMModerator{
+		languageModel: languageModel,
+		prompts:       prompts,
+		botConfig:     botConfig,
+		policy:        policy,
+	}
+}
+
+func (m *LLMModerator) Name() string {
+	return "llm:" + m.botConfig.Name
+}
+
+func (m *LLMModerator) Moderate(ctx context.Context, text string) (ModerationResult, error) {
+	conversationContext := llm.ConversationContext{
+		PromptParameters: map[string]string{
+			"Policy":   m.policy,
+			"Response": llm.FormatUntrusted(llm.UntrustedSourceResponse, text),
+		},
+	}.WithTraceContext(ctx)
+
+	prompt, err := m.prompts.ChatCompletion(llm.PromptModerationClassifier, conversationContext, llm.NewNoTools())
+	if err != nil {
+		return ModerationResult{}, fmt.Errorf("failed to format moderation prompt: %w", err)
+	}
+
+	verdict, err := m.languageModel.ChatCompletionNoStream(prompt,
+		llm.WithOperation(llm.OperationModeration),
+		llm.WithMaxGeneratedTokens(50),
+		llm.WithDeterministicSampling(),
+	)
+	if err != nil {
+		return ModerationResult{}, err
+	}
+
+	return parseModerationVerdict(verdict)
+}
+
+// parseModerationVerdict reads "ALLOW" or "BLOCK: category, category" from the classifier.
+func parseModerationVerdict(verdict string) (ModerationResult, error) {
+	verdict = strings.Trim(strings.TrimSpace(verdict), "\"'`.")
+	decision, categoryList, _ := strings.Cut(verdict, ":")
+
+	switch strings.ToUpper(strings.TrimSpace(decision)) {
+	case "ALLOW":
+		return ModerationResult{}, nil
+	case "BLOCK":
+		var categories []string
+		for _, category := range strings.Split(categoryList, ",") {
+			if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		if len(categories) == 0 {
+			categories = []string{"unspecified"}
+		}
+		return ModerationResult{Flagged: true, Categories: categories}, nil
+	default:
+		return ModerationResult{}, fmt.Errorf("unexpected moderation verdict %q", verdict)
+	}
+}
+
+// unavailableModerator stands in for a moderator that could not be set up, so responses are withheld
+// instead of being posted unreviewed.
+type unavailableModerator struct {
+	name string
+	err  error
+}
+
+func (m *unavailableModerator) Name() string {
+	return m.name
+}
+
+func (m *unavailableModerator) Moderate(_ context.Context, _ string) (ModerationResult, error) {
+	return ModerationResult{}, m.err
+}
+
+// moderationVerdict combines the results of every moderator on a response.
+type moderationVerdict struct {
+	Flagged    bool
+	Moderators []string
+	Categories []string
+
+	// Message is what may be posted. It is empty if the response has to be withheld entirely.
+	Message string
+}
+
+// moderate runs text through the moderators in order. With the redact action, violations that a
+// moderator can locate are removed and the remaining moderators review what is left.
+func moderate(ctx context.Context, moderators []Moderator, action string, text string) (moderationVerdict, error) {
+	verdict := moderationVerdict{Message: text}
+	for _, moderator := range moderators {
+		result, err := moderator.Moderate(ctx, verdict.Message)
+		if err != nil {
+			return moderationVerdict{}, fmt.Errorf("moderator %s failed: %w", moderator.Name(), err)
+		}
+		if !result.Flagged {
+			continue
+		}
+
+		verdict.Flagged = true
+		verdict.Moderators = append(verdict.Moderators, moderator.Name())
+		for _, category := range result.Categories {
+			if !slices.Contains(verdict.Categories, category) {
+				verdict.Categories = append(verdict.Categories, category)
+			}
+		}
+
+		if action != ModerationActionRedact || result.Redacted == "" {
+			verdict.Message = ""
+			return verdict, nil
+		}
+		verdict.Message = result.Redacted
+	}
+	return verdict, nil
+}
+
+// postModeration is how the responses streamed to a post are reviewed.
+type postModeration struct {
+	moderators []Moderator
+	action     string
+
+	// buffered responses are only shown once they have been reviewed.
+	buffered bool
+}
+
+// getPostModeration returns nil if responses to the post are not moderated.
+func (p *Plugin) getPostModeration(post *model.Post) *postModeration {
+	cfg := p.getConfiguration()
+	if !cfg.EnableModeration {
+		return nil
+	}
+
+	moderators := p.getModerators(cfg)
+	if len(moderators) == 0 {
+		return nil
+	}
+
+	buffered := false
+	if cfg.ModerationBufferPublicChannels {
+		channel, err := p.pluginAPI.Channel.Get(post.ChannelId)
+		// Err on the side of not showing unreviewed content.
+		buffered = err != nil || channel.Type == model.ChannelTypeOpen
+	}
+
+	action := cfg.ModerationAction
+	if action == "" {
+		action = ModerationActionReplace
+	}
+
+	return &postModeration{
+		moderators: moderators,
+		action:     action,
+		buffered:   buffered,
+	}
+}
+
+func (p *Plugin) getModerators(cfg *configuration) []Moderator {
+	var moderators []Moderator
+	if len(cfg.moderationBlocklist) > 0 {
+		moderators = append(moderators, NewBlocklistModerator(cfg.moderationBlocklist))
+	}
+
+	if cfg.ModerationClassifier == ModerationClassifierNone {
+		return moderators
+	}
+
+	botConfig, err := p.GetBotConfig(cfg.ModerationBot)
+	if err != nil {
+		return append(moderators, &unavailableModerator{
+			name: cfg.ModerationClassifier,
+			err:  fmt.Errorf("moderation bot %q: %w", cfg.ModerationBot, err),
+		})
+	}
+
+	switch cfg.ModerationClassifier {
+	case ModerationClassifierOpenAI:
+		moderators = append(moderators, p.newOpenAIModerator(botConfig))
+	case ModerationClassifierLLM:
+		moderators = append(moderators, NewLLMModerator(p.getLLM(botConfig), p.prompts, botConfig, cfg.ModerationPolicy))
+	default:
+		moderators = append(moderators, &unavailableModerator{
+			name: cfg.ModerationClassifier,
+			err:  errors.New("unknown moderation classifier"),
+		})
+	}
+
+	return moderators
+}
+
+// newOpenAIModerator uses the moderation endpoint of the service of the bot. The client is created like
+// the ones of the bots so that its secrets are resolved.
+func (p *Plugin) newOpenAIModerator(botConfig llm.BotConfig) Moderator {
+	if botConfig.Service.Type != llm.ServiceTypeOpenAI && botConfig.Service.Type != llm.ServiceTypeOpenAICompatible {
+		return &unavailableModerator{
+			name: ModerationClassifierOpenAI,
+			err:  fmt.Errorf("the service of bot %q has no moderation endpoint", botConfig.Name),
+		}
+	}
+	if _, problems := p.resolveBotSecrets(botConfig); len(problems) > 0 {
+		return &unavailableModerator{
+			name: ModerationClassifierOpenAI,
+			err:  problems[0],
+		}
+	}
+
+	llmMetrics := p.metricsService.GetMetricsForAIService(botConfig.Name, botConfig.Service.Type)
+	client, ok := p.newLanguageModel(botConfig, llmMetrics).(*openai.OpenAI)
+	if !ok {
+		return &unavailableModerator{
+			name: ModerationClassifierOpenAI,
+			err:  fmt.Errorf("the service of bot %q has no moderation endpoint", botConfig.Name),
+		}
+	}
+	return NewOpenAIModerator(client)
+}
+
+// moderatePost reviews the message of a post before it is saved for good. Flagged messages are
+// replaced or redacted with an explanation, and the incident is recorded.
+func (p *Plugin) moderatePost(moderation *postModeration, post *model.Post, T TranslationFunc) {
+	// The stream may have been stopped already, the review should still complete.
+	ctx, cancel := context.WithTimeout(context.Background(), moderationTimeout)
+	defer cancel()
+
+	original := post.Message
+	verdict, err := moderate(ctx, moderation.moderators, moderation.action, original)
+	if err != nil {
+		p.pluginAPI.Log.Error("Failed to moderate response, withholding it", "post_id", post.Id, "error", err)
+		post.Message = T("copilot.moderation_failed", "_This response was withheld because it could not be checked against the content policy._")
+		post.AddProp(ModeratedProp, "true")
+		return
+	}
+	if !verdict.Flagged {
+		return
+	}
+
+	if verdict.Message == "" {
+		post.Message = T("copilot.moderation_withheld", "_This response was withheld because it may violate the content policy (%s)._", strings.Join(verdict.Categories, ", "))
+	} else {
+		post.Message = verdict.Message + "\n\n" + T("copilot.moderation_redacted", "_Parts of this response were removed because they may violate the content policy._")
+	}
+
+	post.AddProp(ModeratedProp, "true")
+
+	requesterUserID, _ := post.GetProp(LLMRequesterUserID).(string)
+	p.recordModerationIncident(post, requesterUserID, verdict, original)
+}
+
+func (p *Plugin) recordModerationIncident(post *model.Post, requesterUserID string, verdict moderationVerdict, original string) {
+	p.pluginAPI.Log.Warn("Response flagged by content moderation",
+		"post_id", post.Id,
+		"bot_id", post.UserId,
+		"user_id", requesterUserID,
+		"moderators", strings.Join(verdict.Moderators, ","),
+		"categories", strings.Join(verdict.Categories, ","),
+	)
+
+	cfg := p.getConfiguration()
+	if !cfg.EnableAuditLog {
+		return
+	}
+
+	record := &AuditRecord{
+		ID:        model.NewId(),
+		CreateAt:  model.GetMillis(),
+		UserID:    requesterUserID,
+		BotID:     post.UserId,
+		ChannelID: post.ChannelId,
+		PostID:    post.Id,
+		Operation: llm.OperationModeration,
+		Model:     strings.Join(verdict.Moderators, ","),
+		Status:    AuditStatusFlagged,
+		ErrorType: strings.Join(verdict.Categories, ","),
+		Response:  auditContent(cfg.AuditLogContent, original),
+	}
+	if bot := p.GetBotByID(post.UserId); bot != nil {
+		record.BotName = bot.cfg.Name
+	}
+	p.saveAuditRecordAsync(record)
+}
@@ -12,7 +12,10 @@ import (
 	"image"
 	"image/png"
 	"io"
+	"math"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -33,6 +36,13 @@ type OpenAI struct {
 	metricsService   metrics.LLMetrics
 	sendUserID       bool
 	outputTokenLimit int
+	sampling         llm.SamplingParameters
+
+	// includeUsage asks for the token usage at the end of streams. Not every compatible service supports it.
+	includeUsage bool
+
+	// azure services list their base models rather than the deployments requests are made to.
+	azure bool
 }
 
 const StreamingTimeoutDefault = 10 * time.Second
@@ -41,16 +51,24 @@ const MaxFunctionCalls = 10
 
 const OpenAIMaxImageSize = 20 * 1024 * 1024 // 20 MB
 
+// OpenAI only accepts up to four stop sequences.
+const MaxStopSequences = 4
+
+// DeterministicSeed is the seed used when the caller asks for deterministic sampling without providing one.
+const DeterministicSeed = 42
+
 var ErrStreamingTimeout = errors.New("timeout streaming")
 
 func NewAzure(llmService llm.ServiceConfig, httpClient *http.Client, metricsService metrics.LLMetrics) *OpenAI {
-	return newOpenAI(llmService, httpClient, metricsService,
+	s := newOpenAI(llmService, httpClient, metricsService,
 		func(apiKey string) openaiClient.ClientConfig {
 			config := openaiClient.DefaultAzureConfig(apiKey, strings.TrimSuffix(llmService.APIURL, "/"))
 			config.APIVersion = "2024-06-01"
 			return config
 		},
 	)
+	s.azure = true
+	return s
 }
 
 func NewCompatible(llmService llm.ServiceConfig, httpClient *http.Client, metricsService metrics.LLMetrics) *OpenAI {
@@ -64,13 +82,15 @@ func NewCompatible(llmService llm.ServiceConfig, httpClient *http.Client, metric
 }
 
 func New(llmService llm.ServiceConfig, httpClient *http.Client, metricsService metrics.LLMetrics) *OpenAI {
-	return newOpenAI(llmService, httpClient, metricsService,
+	s := newOpenAI(llmService, httpClient, metricsService,
 		func(apiKey string) openaiClient.ClientConfig {
 			config := openaiClient.DefaultConfig(apiKey)
 			config.OrgID = llmService.OrgID
 			return config
 		},
 	)
+	s.includeUsage = true
+	return s
 }
 
 func newOpenAI(
@@ -101,6 +121,7 @@ func newOpenAI(
 		metricsService:   metricsService,
 		sendUserID:       llmService.SendUserID,
 		outputTokenLimit: llmService.OutputTokenLimit,
+		sampling:         llmService.SamplingParameters,
 	}
 }
 
@@ -210,10 +231,16 @@ type ToolBufferElement struct {
 	args strings.Builder
 }
 
-func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionRequest, conversation llm.BotConversation, output chan<- string, errChan chan<- error) {
+func (s *OpenAI) streamResultToChannels(requestCtx context.Context, request openaiClient.ChatCompletionRequest, conversation llm.BotConversation, operation string, output chan<- string, errChan chan<- error) {
 	request.Stream = true
 
-	ctx, cancel := context.WithCancelCause(context.Background())
+	var usage *openaiClient.Usage
+	var generated strings.Builder
+	defer func(messages []openaiClient.ChatCompletionMessage) {
+		s.recordTokenUsage(operation, messages, usage, generated.String())
+	}(request.Messages)
+
+	ctx, cancel := context.WithCancelCause(requestCtx)
 	defer cancel(nil)
 
 	// watchdog to cancel if the streaming stalls
@@ -251,10 +278,11 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 
 	// Buffering in the case of tool use
 	var toolsBuffer map[int]*ToolBufferElement
+	var finishReason openaiClient.FinishReason
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			return
+			break
 		}
 		if err != nil {
 			if ctxErr := context.Cause(ctx); ctxErr != nil {
@@ -268,78 +296,18 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 		// Ping the watchdog when we receive a response
 		watchdog <- struct{}{}
 
+		// Usage arrives in a last chunk without choices, so the stream is read to the end.
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+
 		if len(response.Choices) == 0 {
 			continue
 		}
 
-		// Check finishing conditions
-		switch response.Choices[0].FinishReason {
-		case "":
-			// Not done yet, keep going
-		case openaiClient.FinishReasonStop:
-			return
-		case openaiClient.FinishReasonToolCalls:
-			// Verify OpenAI functions are not recursing too deep.
-			numFunctionCalls := 0
-			for i := len(request.Messages) - 1; i >= 0; i-- {
-				if request.Messages[i].Role == openaiClient.ChatMessageRoleTool {
-					numFunctionCalls++
-				} else {
-					break
-				}
-			}
-			if numFunctionCalls > MaxFunctionCalls {
-				errChan <- errors.New("too many function calls")
-				return
-			}
-
-			// Transfer the buffered tools into tool calls
-			tools := []openaiClient.ToolCall{}
-			for i, tool := range toolsBuffer {
-				name := tool.name.String()
-				arguments := tool.args.String()
-				toolID := tool.id.String()
-				num := i
-				tools = append(tools, openaiClient.ToolCall{
-					Function: openaiClient.FunctionCall{
-						Name:      name,
-						Arguments: arguments,
-					},
-					ID:    toolID,
-					Index: &num,
-					Type:  openaiClient.ToolTypeFunction,
-				})
-			}
-
-			// Add the tool calls to the request
-			request.Messages = append(request.Messages, openaiClient.ChatCompletionMessage{
-				Role:      openaiClient.ChatMessageRoleAssistant,
-				ToolCalls: tools,
-			})
-
-			// Resolve the tools and create messages for each
-			for _, tool := range tools {
-				name := tool.Function.Name
-				arguments := tool.Function.Arguments
-				toolID := tool.ID
-				toolResult, err := conversation.Tools.ResolveTool(name, createFunctionArgumentResolver(arguments), conversation.Context)
-				if err != nil {
-					fmt.Printf("Error resolving function %s: %s", name, err)
-				}
-				request.Messages = append(request.Messages, openaiClient.ChatCompletionMessage{
-					Role:       openaiClient.ChatMessageRoleTool,
-					Name:       name,
-					Content:    toolResult,
-					ToolCallID: toolID,
-				})
-			}
-
-			// Call ourselves again with the result of the function call
-			s.streamResultToChannels(request, conversation, output, errChan)
-			return
-		default:
-			fmt.Printf("Unknown finish reason: %s", response.Choices[0].FinishReason)
-			return
+		if response.Choices[0].FinishReason != "" {
+			finishReason = response.Choices[0].FinishReason
+			continue
 		}
 
 		delta := response.Choices[0].Delta
@@ -362,26 +330,101 @@ func (s *OpenAI) streamResultToChannels(request openaiClient.ChatCompletionReque
 			}
 		}
 
-		output <- response.Choices[0].Delta.Content
+		generated.WriteString(delta.Content)
+		output <- delta.Content
+	}
+
+	// Check finishing conditions
+	switch finishReason {
+	case "", openaiClient.FinishReasonStop:
+		return
+	case openaiClient.FinishReasonToolCalls:
+		// Verify OpenAI functions are not recursing too deep.
+		numFunctionCalls := 0
+		for i := len(request.Messages) - 1; i >= 0; i-- {
+			if request.Messages[i].Role == openaiClient.ChatMessageRoleTool {
+				numFunctionCalls++
+			} else {
+				break
+			}
+		}
+		if numFunctionCalls > MaxFunctionCalls {
+			errChan <- fmt.Errorf("too many function calls: %w", llm.ErrToolCall)
+			return
+		}
+
+		// Transfer the buffered tools into tool calls
+		tools := []openaiClient.ToolCall{}
+		for i, tool := range toolsBuffer {
+			name := tool.name.String()
+			arguments := tool.args.String()
+			toolID := tool.id.String()
+			num := i
+			tools = append(tools, openaiClient.ToolCall{
+				Function: openaiClient.FunctionCall{
+					Name:      name,
+					Arguments: arguments,
+				},
+				ID:    toolID,
+				Index: &num,
+				Type:  openaiClient.ToolTypeFunction,
+			})
+		}
+
+		// Add the tool calls to the request
+		request.Messages = append(request.Messages, openaiClient.ChatCompletionMessage{
+			Role:      openaiClient.ChatMessageRoleAssistant,
+			ToolCalls: tools,
+		})
+
+		// Resolve the tools and create messages for each
+		for _, tool := range tools {
+			name := tool.Function.Name
+			arguments := tool.Function.Arguments
+			toolID := tool.ID
+			toolResult, err := conversation.Tools.ResolveTool(name, createFunctionArgumentResolver(arguments), conversation.Context)
+			// Tools explain their failures in their result, which lets the model correct itself.
+			if err != nil {
+				s.metricsService.IncrementToolCalls(name, metrics.ToolCallFailed)
+			} else {
+				s.metricsService.IncrementToolCalls(name, metrics.ToolCallSucceeded)
+			}
+			request.Messages = append(request.Messages, openaiClient.ChatCompletionMessage{
+				Role:       openaiClient.ChatMessageRoleTool,
+				Name:       name,
+				Content:    toolResult,
+				ToolCallID: toolID,
+			})
+		}
+
+		// Call ourselves again with the result of the function call
+		s.streamResultToChannels(requestCtx, request, conversation, operation, output, errChan)
+	default:
+		// The output is kept, but a generation cut short by the length limit or a content filter is worth counting.
+		s.metricsService.IncrementErrors(operation, metrics.ErrorTypeFinishReason)
 	}
 }
 
-func (s *OpenAI) streamResult(request openaiClient.ChatCompletionRequest, conversation llm.BotConversation) (*llm.TextStreamResult, error) {
+func (s *OpenAI) streamResult(request openaiClient.ChatCompletionRequest, conversation llm.BotConversation, operation string) (*llm.TextStreamResult, error) {
 	output := make(chan string)
 	errChan := make(chan error)
+	ctx, cancelRequest := context.WithCancel(context.Background())
+	cancel, canceled := llm.NewCancel(cancelRequest)
 	go func() {
 		defer close(output)
 		defer close(errChan)
-		s.streamResultToChannels(request, conversation, output, errChan)
+		defer cancelRequest()
+		s.streamResultToChannels(ctx, request, conversation, operation, output, errChan)
 	}()
 
-	return &llm.TextStreamResult{Stream: output, Err: errChan}, nil
+	return &llm.TextStreamResult{Stream: output, Err: errChan, Cancel: cancel, Canceled: canceled, Model: func() string { return request.Model }}, nil
 }
 
 func (s *OpenAI) GetDefaultConfig() llm.LanguageModelConfig {
 	return llm.LanguageModelConfig{
 		Model:              s.defaultModel,
 		MaxGeneratedTokens: s.outputTokenLimit,
+		SamplingParameters: s.sampling,
 	}
 }
 
@@ -394,30 +437,71 @@ func (s *OpenAI) createConfig(opts []llm.LanguageModelOption) llm.LanguageModelC
 	return cfg
 }
 
-func (s *OpenAI) completionRequestFromConfig(cfg llm.LanguageModelConfig) openaiClient.ChatCompletionRequest {
+func (s *OpenAI) completionRequestFromConfig(cfg llm.LanguageModelConfig) (openaiClient.ChatCompletionRequest, error) {
 	request := openaiClient.ChatCompletionRequest{
 		Model: cfg.Model,
 	}
 
-	if _, ok := openaiClient.O1SeriesModels[cfg.Model]; ok {
+	_, isO1 := openaiClient.O1SeriesModels[cfg.Model]
+	if !isO1 {
+		seed := DeterministicSeed
+		cfg.ApplyDeterministicSampling(&seed)
+	}
+	if isO1 {
 		request.MaxCompletionTokens = cfg.MaxGeneratedTokens
 	} else {
 		request.MaxTokens = cfg.MaxGeneratedTokens
 	}
 
-	return request
+	// o1 series models have temperature and top_p fixed at 1.
+	if isO1 && (cfg.Temperature != nil || cfg.TopP != nil) {
+		return request, fmt.Errorf("model %s does not support temperature or top_p: %w", cfg.Model, llm.ErrUnsupportedSamplingParameter)
+	}
+	if len(cfg.StopSequences) > MaxStopSequences {
+		return request, fmt.Errorf("at most %d stop sequences are supported, got %d: %w", MaxStopSequences, len(cfg.StopSequences), llm.ErrUnsupportedSamplingParameter)
+	}
+
+	if cfg.Temperature != nil {
+		request.Temperature = temperatureForRequest(*cfg.Temperature)
+	}
+	if cfg.TopP != nil {
+		request.TopP = *cfg.TopP
+	}
+	if cfg.Seed != nil {
+		seed := *cfg.Seed
+		request.Seed = &seed
+	}
+	request.Stop = cfg.StopSequences
+
+	return request, nil
+}
+
+// temperatureForRequest works around the temperature field being omitted from the request when zero,
+// which would make the API fall back to its default of 1.
+func temperatureForRequest(temperature float32) float32 {
+	if temperature == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return temperature
 }
 
 func (s *OpenAI) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
-	s.metricsService.IncrementLLMRequests()
+	cfg := s.createConfig(opts)
+	s.metricsService.IncrementLLMRequests(cfg.Operation)
 
-	request := s.completionRequestFromConfig(s.createConfig(opts))
+	request, err := s.completionRequestFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	request = modifyCompletionRequestWithConversation(request, conversation)
 	request.Stream = true
+	if s.includeUsage {
+		request.StreamOptions = &openaiClient.StreamOptions{IncludeUsage: true}
+	}
 	if s.sendUserID {
 		request.User = conversation.Context.RequestingUser.Id
 	}
-	return s.streamResult(request, conversation)
+	return s.streamResult(request, conversation, cfg.Operation)
 }
 
 func (s *OpenAI) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
@@ -429,7 +513,25 @@ func (s *OpenAI) ChatCompletionNoStream(conversation llm.BotConversation, opts .
 	return result.ReadAll(), nil
 }
 
+// recordTokenUsage records the usage reported by the service, or an estimate if it didn't report any.
+func (s *OpenAI) recordTokenUsage(operation string, messages []openaiClient.ChatCompletionMessage, usage *openaiClient.Usage, generated string) {
+	if usage != nil {
+		s.metricsService.AddTokens(operation, usage.PromptTokens, usage.CompletionTokens)
+		return
+	}
+
+	inputTokens := 0
+	for _, message := range messages {
+		inputTokens += s.CountTokens(message.Content)
+		for _, part := range message.MultiContent {
+			inputTokens += s.CountTokens(part.Text)
+		}
+	}
+	s.metricsService.AddTokens(operation, inputTokens, s.CountTokens(generated))
+}
+
 func (s *OpenAI) Transcribe(file io.Reader) (*subtitles.Subtitles, error) {
+	start := time.Now()
 	resp, err := s.client.CreateTranscription(context.Background(), openaiClient.AudioRequest{
 		Model:    openaiClient.Whisper1,
 		Reader:   file,
@@ -439,6 +541,7 @@ func (s *OpenAI) Transcribe(file io.Reader) (*subtitles.Subtitles, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create whisper transcription: %w", err)
 	}
+	s.metricsService.ObserveTranscriptionDuration(time.Since(start).Seconds())
 
 	timedTranscript, err := subtitles.NewSubtitlesFromVTT(strings.NewReader(resp.Text))
 	if err != nil {
@@ -448,6 +551,63 @@ func (s *OpenAI) Transcribe(file io.Reader) (*subtitles.Subtitles, error) {
 	return timedTranscript, nil
 }
 
+// CheckModel lists the models of the service, which fails if the credentials are rejected,
+// and looks for the given one. Services that list no models are trusted to have it.
+func (s *OpenAI) CheckModel(ctx context.Context, model string) error {
+	if model == "" {
+		model = s.defaultModel
+	}
+
+	models, err := s.client.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list models: %w", err)
+	}
+	if s.azure || len(models.Models) == 0 {
+		return nil
+	}
+
+	for _, available := range models.Models {
+		if available.ID == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", llm.ErrModelNotFound, model)
+}
+
+// Moderate checks text with the moderation endpoint of the service and returns the categories it was flagged for.
+func (s *OpenAI) Moderate(ctx context.Context, text string) (bool, []string, error) {
+	resp, err := s.client.Moderations(ctx, openaiClient.ModerationRequest{
+		Input: text,
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("unable to moderate text: %w", err)
+	}
+
+	flagged := false
+	var categories []string
+	for _, result := range resp.Results {
+		flagged = flagged || result.Flagged
+
+		// The categories are only named in their JSON tags.
+		raw, err := json.Marshal(result.Categories)
+		if err != nil {
+			return false, nil, err
+		}
+		var byName map[string]bool
+		if err := json.Unmarshal(raw, &byName); err != nil {
+			return false, nil, err
+		}
+		for name, matched := range byName {
+			if matched && !slices.Contains(categories, name) {
+				categories = append(categories, name)
+			}
+		}
+	}
+	sort.Strings(categories)
+
+	return flagged, categories, nil
+}
+
 func (s *OpenAI) GenerateImage(prompt string) (image.Image, error) {
 	req := openaiClient.ImageRequest{
 		Prompt:         prompt,
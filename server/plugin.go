@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -20,10 +21,12 @@ import (
 	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost-plugin-ai/server/metrics"
 	"github.com/mattermost/mattermost-plugin-ai/server/openai"
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/pluginapi"
 	"github.com/mattermost/mattermost/server/public/shared/httpservice"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 const (
@@ -62,6 +65,29 @@ type Plugin struct {
 	streamingContexts      map[string]PostStreamContext
 	streamingContextsMutex sync.Mutex
 
+	// nodeID identifies this instance of the plugin within the cluster.
+	nodeID string
+
+	jobQueue *JobQueue
+
+	streamSweeperStop chan struct{}
+
+	auditLogRetentionStop chan struct{}
+
+	secrets           secretCache
+	secretRefreshStop chan struct{}
+
+	// shuttingDown is set once deactivation starts so no new work is accepted.
+	shuttingDown    atomic.Bool
+	backgroundTasks sync.WaitGroup
+
+	tracingLock     sync.Mutex
+	tracerProvider  *sdktrace.TracerProvider
+	tracingEndpoint string
+
+	llmLimitersLock sync.Mutex
+	llmLimiters     map[string]*ServiceLimiter
+
 	licenseChecker *enterprise.LicenseChecker
 	metricsService metrics.Metrics
 	metricsHandler http.Handler
@@ -129,13 +155,37 @@ func (p *Plugin) OnActivate() error {
 		p.pluginAPI.Log.Error("ffmpeg not installed, transcriptions will be disabled.", "error", err)
 	}
 
+	p.nodeID = model.NewId()
+
+	if err := p.configureTracing(p.getConfiguration().Config); err != nil {
+		p.pluginAPI.Log.Error("Failed to configure tracing", "error", err)
+	}
+	p.shuttingDown.Store(false)
 	p.streamingContexts = map[string]PostStreamContext{}
 
+	p.jobQueue = NewJobQueue(p)
+	p.jobQueue.RegisterHandler(JobTypeSummarizeRecording, p.runSummarizeRecordingJob)
+	p.jobQueue.RegisterHandler(JobTypeSummarizeTranscription, p.runSummarizeTranscriptionJob)
+	p.jobQueue.Start()
+
+	p.streamSweeperStop = make(chan struct{})
+	go p.runInterruptedStreamSweeper(p.streamSweeperStop)
+
+	p.auditLogRetentionStop = make(chan struct{})
+	go p.runAuditLogRetention(p.auditLogRetentionStop)
+
+	p.secretRefreshStop = make(chan struct{})
+	go p.runSecretRefresh(p.secretRefreshStop)
+
 	return nil
 }
 
-func (p *Plugin) getLLM(llmBotConfig llm.BotConfig) llm.LanguageModel {
-	llmMetrics := p.metricsService.GetMetricsForAIService(llmBotConfig.Name)
+// newLanguageModel creates the client of the service of a bot, without any of the wrappers added by getLLM.
+func (p *Plugin) newLanguageModel(llmBotConfig llm.BotConfig, llmMetrics metrics.LLMetrics) llm.LanguageModel {
+	llmBotConfig, problems := p.resolveBotSecrets(llmBotConfig)
+	for _, problem := range problems {
+		p.pluginAPI.Log.Error("Unable to resolve secret", "bot_name", llmBotConfig.Name, "field", problem.Field, "error", problem.Message)
+	}
 
 	var result llm.LanguageModel
 	switch llmBotConfig.Service.Type {
@@ -150,13 +200,32 @@ func (p *Plugin) getLLM(llmBotConfig llm.BotConfig) llm.LanguageModel {
 	case llm.ServiceTypeAskSage:
 		result = asksage.New(llmBotConfig.Service, p.llmUpstreamHTTPClient, llmMetrics)
 	}
+	return result
+}
+
+func (p *Plugin) getLLM(llmBotConfig llm.BotConfig) llm.LanguageModel {
+	llmMetrics := p.metricsService.GetMetricsForAIService(llmBotConfig.Name, llmBotConfig.Service.Type)
+
+	result := p.newLanguageModel(llmBotConfig, llmMetrics)
+	result = NewLLMMetricsWrapper(result, llmMetrics)
 
 	cfg := p.getConfiguration()
+	if cfg.EnableAuditLog {
+		result = NewLLMAuditWrapper(result, llmBotConfig, cfg.AuditLogContent, p.saveAuditRecordAsync)
+	}
 	if cfg.EnableLLMTrace {
-		result = NewLanguageModelLogWrapper(p.pluginAPI.Log, result)
+		result = NewLanguageModelLogWrapper(p.pluginAPI.Log, result, p.secrets.redact)
+	}
+
+	if cfg.EnablePIIRedaction {
+		result = NewLLMRedactionWrapper(result, cfg.piiDetectors, llmMetrics)
 	}
 
+	result = NewLLMToolPolicyWrapper(result, &p.pluginAPI.Log)
+
+	result = NewLLMConcurrencyWrapper(result, p.getServiceLimiter(llmBotConfig), llmMetrics)
 	result = NewLLMTruncationWrapper(result)
+	result = NewLLMTracingWrapper(result, llmBotConfig)
 
 	return result
 }
@@ -170,7 +239,11 @@ func (p *Plugin) getTranscribe() Transcriber {
 			break
 		}
 	}
-	llmMetrics := p.metricsService.GetMetricsForAIService(botConfig.Name)
+	llmMetrics := p.metricsService.GetMetricsForAIService(botConfig.Name, botConfig.Service.Type)
+	botConfig, problems := p.resolveBotSecrets(botConfig)
+	for _, problem := range problems {
+		p.pluginAPI.Log.Error("Unable to resolve secret", "bot_name", botConfig.Name, "field", problem.Field, "error", problem.Message)
+	}
 	switch botConfig.Service.Type {
 	case "openai":
 		return openai.New(botConfig.Service, p.llmUpstreamHTTPClient, llmMetrics)
@@ -5,10 +5,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -51,7 +53,7 @@ func (t *ThreadData) latestPost() *model.Post {
 }
 
 type PostStreamContext struct {
-	cancel context.CancelFunc
+	cancel context.CancelCauseFunc
 }
 
 func (p *Plugin) getThreadAndMeta(postID string) (*ThreadData, error) {
@@ -93,13 +95,21 @@ func (p *Plugin) getMetadataForPosts(posts *model.PostList) (*ThreadData, error)
 	}, nil
 }
 
+// formatThread renders the posts of a thread as an untrusted block, flagging the posts that look like instructions.
 func formatThread(data *ThreadData) string {
 	result := ""
+	suspectedInjection := false
 	for _, post := range data.Posts {
-		result += fmt.Sprintf("%s: %s\n\n", data.UsersByID[post.UserId].Username, llm.FormatPostBody(post))
+		message := llm.FormatPostBody(post)
+		flag := ""
+		if llm.DetectInjection(message) {
+			suspectedInjection = true
+			flag = llm.SuspectedInjectionFlag
+		}
+		result += fmt.Sprintf("%s: %s%s\n\n", data.UsersByID[post.UserId].Username, flag, llm.EscapeUntrusted(message))
 	}
 
-	return result
+	return llm.WrapUntrusted(llm.UntrustedSourceThread, result, suspectedInjection)
 }
 
 const LLMRequesterUserID = "llm_requester_user_id"
@@ -139,79 +149,86 @@ func (p *Plugin) streamResultToNewPost(botid string, requesterUserID string, str
 		return fmt.Errorf("unable to create post: %w", err)
 	}
 
+	return p.startStreamToNewPost(botid, requesterUserID, stream, post)
+}
+
+func (p *Plugin) streamResultToNewDM(botid string, stream *llm.TextStreamResult, userID string, post *model.Post) error {
+	if err := p.botDM(botid, userID, post); err != nil {
+		return err
+	}
+
+	return p.startStreamToNewPost(botid, userID, stream, post)
+}
+
+// startStreamToNewPost streams the result to a post that was just created for it. If the stream can't
+// start, it is closed and the post explains why instead of staying empty.
+func (p *Plugin) startStreamToNewPost(botid string, userID string, stream *llm.TextStreamResult, post *model.Post) error {
+	locale := p.streamLocale(botid, userID, post)
+
 	ctx, err := p.getPostStreamingContext(context.Background(), post.Id)
 	if err != nil {
+		stream.Close()
+		T := i18nLocalizerFunc(p.i18n, locale)
+		if errors.Is(err, ErrServerShutdown) {
+			markPostInterrupted(post, T("copilot.stream_interrupted_by_restart", "_This response was interrupted by a server restart._"))
+		} else {
+			post.Message = T("copilot.stream_to_post_access_llm_error", "Sorry! An error occurred while accessing the LLM. See server logs for details.")
+		}
+		if updateErr := p.pluginAPI.Post.UpdatePost(post); updateErr != nil {
+			p.API.LogError("Failed to update post that could not be streamed to", "error", updateErr)
+		}
 		return err
 	}
 
+	// Streaming failures are logged and shown on the post, there is no one left to return them to.
 	go func() {
 		defer p.finishPostStreaming(post.Id)
-		user, err := p.pluginAPI.User.Get(requesterUserID)
-		locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
-		if err != nil {
-			p.streamResultToPost(ctx, stream, post, locale)
-			return
-		}
-
-		channel, err := p.pluginAPI.Channel.Get(post.ChannelId)
-		if err != nil {
-			p.streamResultToPost(ctx, stream, post, locale)
-			return
-		}
-
-		if channel.Type == model.ChannelTypeDirect {
-			if channel.Name == botid+"__"+user.Id || channel.Name == user.Id+"__"+botid {
-				p.streamResultToPost(ctx, stream, post, user.Locale)
-				return
-			}
-		}
-		p.streamResultToPost(ctx, stream, post, locale)
+		_ = p.streamResultToPost(ctx, stream, post, locale)
 	}()
 
 	return nil
 }
 
-func (p *Plugin) streamResultToNewDM(botid string, stream *llm.TextStreamResult, userID string, post *model.Post) error {
-	if err := p.botDM(botid, userID, post); err != nil {
-		return err
+// streamLocale returns the locale of the user in their DM with the bot, and the server default elsewhere.
+func (p *Plugin) streamLocale(botid string, userID string, post *model.Post) string {
+	locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
+	user, err := p.pluginAPI.User.Get(userID)
+	if err != nil {
+		return locale
 	}
 
-	ctx, err := p.getPostStreamingContext(context.Background(), post.Id)
+	channel, err := p.pluginAPI.Channel.Get(post.ChannelId)
 	if err != nil {
-		return err
+		return locale
 	}
 
-	go func() {
-		defer p.finishPostStreaming(post.Id)
-		user, err := p.pluginAPI.User.Get(userID)
-		locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
-		if err != nil {
-			p.streamResultToPost(ctx, stream, post, locale)
-			return
-		}
-
-		channel, err := p.pluginAPI.Channel.Get(post.ChannelId)
-		if err != nil {
-			p.streamResultToPost(ctx, stream, post, locale)
-			return
-		}
-
-		if channel.Type == model.ChannelTypeDirect {
-			if channel.Name == botid+"__"+user.Id || channel.Name == user.Id+"__"+botid {
-				p.streamResultToPost(ctx, stream, post, user.Locale)
-				return
-			}
+	if channel.Type == model.ChannelTypeDirect {
+		if channel.Name == botid+"__"+user.Id || channel.Name == user.Id+"__"+botid {
+			return user.Locale
 		}
-		p.streamResultToPost(ctx, stream, post, locale)
-	}()
-
-	return nil
+	}
+	return locale
 }
 
-func (p *Plugin) sendPostStreamingUpdateEvent(post *model.Post, message string) {
+// sendPostStreamingUpdateEvent sends the full message of a streaming post.
+func (p *Plugin) sendPostStreamingUpdateEvent(post *model.Post, message string, seq int) {
 	p.API.PublishWebSocketEvent("postupdate", map[string]interface{}{
 		"post_id": post.Id,
 		"next":    message,
+		"seq":     seq,
+	}, &model.WebsocketBroadcast{
+		ChannelId: post.ChannelId,
+	})
+}
+
+// sendPostStreamingDeltaEvent sends the text added to a streaming post since the previous event.
+// Clients apply it only if they have seen the event with the previous sequence number,
+// otherwise they wait for the next full update.
+func (p *Plugin) sendPostStreamingDeltaEvent(post *model.Post, delta string, seq int) {
+	p.API.PublishWebSocketEvent("postupdate", map[string]interface{}{
+		"post_id": post.Id,
+		"delta":   delta,
+		"seq":     seq,
 	}, &model.WebsocketBroadcast{
 		ChannelId: post.ChannelId,
 	})
@@ -230,32 +247,60 @@ func (p *Plugin) sendPostStreamingControlEvent(post *model.Post, control string)
 	})
 }
 
+// stopPostStreaming stops the stream to a post on whichever node of the cluster it is running.
 func (p *Plugin) stopPostStreaming(postID string) {
+	p.stopLocalPostStreaming(postID)
+
+	if err := p.API.PublishPluginClusterEvent(model.PluginClusterEvent{
+		Id:   ClusterEventStopPostStreaming,
+		Data: []byte(postID),
+	}, model.PluginClusterEventSendOptions{
+		SendType: model.PluginClusterEventSendTypeReliable,
+	}); err != nil {
+		p.API.LogError("Failed to publish stop streaming cluster event", "error", err)
+	}
+}
+
+func (p *Plugin) stopLocalPostStreaming(postID string) {
 	p.streamingContextsMutex.Lock()
 	defer p.streamingContextsMutex.Unlock()
 	if streamContext, ok := p.streamingContexts[postID]; ok {
-		streamContext.cancel()
+		streamContext.cancel(nil)
 	}
 	delete(p.streamingContexts, postID)
 }
 
 var ErrAlreadyStreamingToPost = fmt.Errorf("already streaming to post")
 
+// getPostStreamingContext claims the post for streaming across the cluster and returns a context
+// that is canceled when the stream is stopped.
 func (p *Plugin) getPostStreamingContext(inCtx context.Context, postID string) (context.Context, error) {
-	p.streamingContextsMutex.Lock()
-	defer p.streamingContextsMutex.Unlock()
+	if p.isShuttingDown() {
+		return nil, ErrServerShutdown
+	}
 
-	if _, ok := p.streamingContexts[postID]; ok {
+	p.streamingContextsMutex.Lock()
+	_, ok := p.streamingContexts[postID]
+	p.streamingContextsMutex.Unlock()
+	if ok {
 		return nil, ErrAlreadyStreamingToPost
 	}
 
-	ctx, cancel := context.WithCancel(inCtx)
+	if err := p.acquirePostStreamLease(postID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(inCtx)
 
 	streamingContext := PostStreamContext{
 		cancel: cancel,
 	}
 
+	p.streamingContextsMutex.Lock()
 	p.streamingContexts[postID] = streamingContext
+	p.streamingContextsMutex.Unlock()
+
+	go p.renewPostStreamLease(ctx, cancel, postID)
 
 	return ctx, nil
 }
@@ -264,60 +309,188 @@ func (p *Plugin) getPostStreamingContext(inCtx context.Context, postID string) (
 // It is safe to call multiple times, must be called at least once.
 func (p *Plugin) finishPostStreaming(postID string) {
 	p.streamingContextsMutex.Lock()
-	defer p.streamingContextsMutex.Unlock()
+	if streamContext, ok := p.streamingContexts[postID]; ok {
+		streamContext.cancel(nil)
+	}
 	delete(p.streamingContexts, postID)
+	p.streamingContextsMutex.Unlock()
+
+	p.releasePostStreamLease(postID)
+}
+
+// Streaming updates are coalesced and sent as deltas. The partial message is saved to the post
+// periodically so little is lost if the node goes away, and the full message is sent along with
+// every checkpoint so clients that missed a delta can catch up.
+const (
+	StreamUpdateInterval     = 100 * time.Millisecond
+	StreamUpdateMaxBytes     = 1024
+	StreamCheckpointInterval = 5 * time.Second
+)
+
+// postStreamWriter accumulates a streamed message and decides when to notify clients and persist it.
+type postStreamWriter struct {
+	p    *Plugin
+	post *model.Post
+
+	seq                 int
+	sentLength          int
+	lastCheckpoint      time.Time
+	checkpointedMessage string
+
+	// buffered writers keep the message from clients and the database until it is complete.
+	buffered bool
+}
+
+func newPostStreamWriter(p *Plugin, post *model.Post) *postStreamWriter {
+	return &postStreamWriter{
+		p:                   p,
+		post:                post,
+		sentLength:          len(post.Message),
+		lastCheckpoint:      time.Now(),
+		checkpointedMessage: post.Message,
+	}
+}
+
+func (w *postStreamWriter) append(text string) {
+	w.post.Message += text
+	if len(w.post.Message)-w.sentLength >= StreamUpdateMaxBytes {
+		w.flush()
+	}
+}
+
+// flush sends the pending text to clients and checkpoints the post if it is time to.
+func (w *postStreamWriter) flush() {
+	if w.buffered {
+		return
+	}
+
+	if len(w.post.Message) > w.sentLength {
+		w.seq++
+		w.p.sendPostStreamingDeltaEvent(w.post, w.post.Message[w.sentLength:], w.seq)
+		w.sentLength = len(w.post.Message)
+	}
+
+	if time.Since(w.lastCheckpoint) >= StreamCheckpointInterval {
+		w.checkpoint()
+	}
+}
+
+func (w *postStreamWriter) checkpoint() {
+	w.lastCheckpoint = time.Now()
+	if w.post.Message == w.checkpointedMessage {
+		return
+	}
+
+	if err := w.p.pluginAPI.Post.UpdatePost(w.post); err != nil {
+		w.p.API.LogError("Failed to checkpoint streaming post", "error", err)
+		return
+	}
+	w.checkpointedMessage = w.post.Message
+	w.sendFull(w.post.Message)
+}
+
+// sendFull sends a full message to clients, which may differ from the post message for status updates.
+func (w *postStreamWriter) sendFull(message string) {
+	w.seq++
+	w.p.sendPostStreamingUpdateEvent(w.post, message, w.seq)
+	w.sentLength = len(w.post.Message)
 }
 
 // streamResultToPost streams the result of a TextStreamResult to a post.
-// it will internally handle logging needs and updating the post.
-func (p *Plugin) streamResultToPost(ctx context.Context, stream *llm.TextStreamResult, post *model.Post, userLocale string) {
+// it will internally handle logging needs and updating the post. It returns an error when the response
+// wasn't completed: the error of the LLM, the cause of the cancellation of ctx or the failure to save the post.
+func (p *Plugin) streamResultToPost(ctx context.Context, stream *llm.TextStreamResult, post *model.Post, userLocale string) error {
 	T := i18nLocalizerFunc(p.i18n, userLocale)
 	p.sendPostStreamingControlEvent(post, PostStreamingControlStart)
 	defer func() {
 		p.sendPostStreamingControlEvent(post, PostStreamingControlEnd)
 	}()
 
+	writer := newPostStreamWriter(p, post)
+	ticker := time.NewTicker(StreamUpdateInterval)
+	defer ticker.Stop()
+
+	moderation := p.getPostModeration(post)
+	if moderation != nil && moderation.buffered {
+		writer.buffered = true
+	}
+	// showMessage sends what clients should see of the message so far.
+	showMessage := func() {
+		if writer.buffered {
+			writer.sendFull(T("copilot.moderation_reviewing", "Reviewing the response..."))
+			return
+		}
+		writer.sendFull(post.Message)
+	}
+	// Clients only apply deltas on top of a full message, which also replaces whatever they displayed
+	// before the stream started.
+	showMessage()
+
 	for {
 		select {
 		case next := <-stream.Stream:
-			post.Message += next
-			p.sendPostStreamingUpdateEvent(post, post.Message)
+			writer.append(next)
+		case <-ticker.C:
+			writer.flush()
+		case position := <-stream.QueuePosition:
+			if position > 0 {
+				writer.sendFull(T("copilot.stream_to_post_waiting_in_queue", "Waiting in queue (position %d)...", position))
+			} else {
+				showMessage()
+			}
 		case err, ok := <-stream.Err:
 			// Stream has closed cleanly
 			if !ok {
 				if strings.TrimSpace(post.Message) == "" {
 					p.API.LogError("LLM closed stream with no result")
 					post.Message = T("copilot.stream_to_post_llm_not_return", "Sorry! The LLM did not return a result.")
-					p.sendPostStreamingUpdateEvent(post, post.Message)
+				} else if moderation != nil {
+					p.moderatePost(moderation, post, T)
 				}
+				writer.sendFull(post.Message)
+				setResponseModel(post, stream)
 				if err = p.pluginAPI.Post.UpdatePost(post); err != nil {
 					p.API.LogError("Streaming failed to update post", "error", err)
-					return
+					return fmt.Errorf("unable to save streamed post: %w", err)
 				}
-				return
-			}
-			// Handle partial results
-			if strings.TrimSpace(post.Message) == "" {
-				post.Message = ""
-			} else {
-				post.Message += "\n\n"
+				return nil
 			}
+			// Keep the partial response so it can be continued.
 			p.API.LogError("Streaming result to post failed partway", "error", err)
-			post.Message = T("copilot.stream_to_post_access_llm_error", "Sorry! An error occurred while accessing the LLM. See server logs for details.")
+			writer.flush()
+			if moderation != nil && strings.TrimSpace(post.Message) != "" {
+				p.moderatePost(moderation, post, T)
+			}
+			markPostInterrupted(post, T("copilot.stream_to_post_access_llm_error", "Sorry! An error occurred while accessing the LLM. See server logs for details."))
+			setResponseModel(post, stream)
 
-			if err := p.pluginAPI.Post.UpdatePost(post); err != nil {
-				p.API.LogError("Error recovering from streaming error", "error", err)
-				return
+			if updateErr := p.pluginAPI.Post.UpdatePost(post); updateErr != nil {
+				p.API.LogError("Error recovering from streaming error", "error", updateErr)
 			}
-			p.sendPostStreamingUpdateEvent(post, post.Message)
-			return
+			writer.sendFull(post.Message)
+			return fmt.Errorf("streaming result to post failed: %w", err)
 		case <-ctx.Done():
+			stream.Close()
+			if errors.Is(context.Cause(ctx), errPostStreamLeaseLost) {
+				// The post was marked as interrupted or belongs to another stream now, leave it as is.
+				return context.Cause(ctx)
+			}
+			writer.flush()
+			if moderation != nil && strings.TrimSpace(post.Message) != "" {
+				p.moderatePost(moderation, post, T)
+				writer.sendFull(post.Message)
+			}
+			if errors.Is(context.Cause(ctx), ErrServerShutdown) {
+				markPostInterrupted(post, T("copilot.stream_interrupted_by_restart", "_This response was interrupted by a server restart._"))
+				writer.sendFull(post.Message)
+			}
+			setResponseModel(post, stream)
 			if err := p.pluginAPI.Post.UpdatePost(post); err != nil {
 				p.API.LogError("Error updating post on stop signaled", "error", err)
-				return
+				return context.Cause(ctx)
 			}
 			p.sendPostStreamingControlEvent(post, PostStreamingControlCancel)
-			return
+			return context.Cause(ctx)
 		}
 	}
 }
@@ -430,7 +603,7 @@ func (p *Plugin) PostToAIPost(bot *Bot, post *model.Post) llm.Post {
 		}
 
 		if content != "" {
-			fileContent := fmt.Sprintf("File Name: %s\nContent: %s", fileInfo.Name, content)
+			fileContent := llm.FormatUntrusted(llm.UntrustedSourceFile, fmt.Sprintf("File Name: %s\nContent: %s", fileInfo.Name, content))
 			extractedFileContents = append(extractedFileContents, fileContent)
 		}
 
@@ -465,6 +638,8 @@ func (p *Plugin) PostToAIPost(bot *Bot, post *model.Post) llm.Post {
 	}
 }
 
+// ThreadToBotConversation converts the posts of a thread. A regenerated response only contributes the
+// version it displays, the other versions are kept aside in LLM_ResponseVersions.
 func (p *Plugin) ThreadToBotConversation(bot *Bot, posts []*model.Post) llm.BotConversation {
 	result := llm.BotConversation{
 		Posts: make([]llm.Post, 0, len(posts)),
@@ -0,0 +1,143 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostStreamWriter(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	var events []map[string]interface{}
+	e.mockAPI.On("PublishWebSocketEvent", "postupdate", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(map[string]interface{}))
+	})
+
+	post := &model.Post{Id: "postid", ChannelId: "channelid"}
+	writer := newPostStreamWriter(e.plugin, post)
+
+	t.Run("small updates are coalesced until flushed", func(t *testing.T) {
+		writer.append("Hello")
+		writer.append(" world")
+		require.Empty(t, events)
+
+		writer.flush()
+		require.Len(t, events, 1)
+		require.Equal(t, "Hello world", events[0]["delta"])
+		require.Equal(t, 1, events[0]["seq"])
+
+		writer.flush()
+		require.Len(t, events, 1)
+	})
+
+	t.Run("large updates are sent right away", func(t *testing.T) {
+		events = nil
+		writer.append(strings.Repeat("a", StreamUpdateMaxBytes))
+		require.Len(t, events, 1)
+		require.Equal(t, 2, events[0]["seq"])
+	})
+
+	t.Run("checkpoint saves the post and sends the full message", func(t *testing.T) {
+		events = nil
+		e.mockAPI.On("UpdatePost", post).Return(func(updated *model.Post) (*model.Post, *model.AppError) {
+			return updated.Clone(), nil
+		}).Once()
+		writer.append("!")
+		writer.lastCheckpoint = time.Now().Add(-StreamCheckpointInterval)
+		writer.flush()
+
+		require.Len(t, events, 2)
+		require.Equal(t, "!", events[0]["delta"])
+		require.Equal(t, post.Message, events[1]["next"])
+		require.Equal(t, 4, events[1]["seq"])
+
+		// Nothing new to checkpoint
+		writer.lastCheckpoint = time.Now().Add(-StreamCheckpointInterval)
+		writer.flush()
+		require.Len(t, events, 2)
+	})
+}
+
+func TestStreamResultToPostStartsWithFullMessage(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.plugin.i18n = i18nInit()
+
+	var events []map[string]interface{}
+	e.mockAPI.On("PublishWebSocketEvent", "postupdate", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(1).(map[string]interface{}))
+	})
+	e.mockAPI.On("UpdatePost", mock.Anything).Return(func(updated *model.Post) (*model.Post, *model.AppError) {
+		return updated.Clone(), nil
+	})
+
+	post := &model.Post{Id: "postid", ChannelId: "channelid", Message: "Header\n"}
+	stream := newScriptedLanguageModel(scriptedTurn{Response: "answer"})
+	result, err := stream.ChatCompletion(llm.BotConversation{})
+	require.NoError(t, err)
+	require.NoError(t, e.plugin.streamResultToPost(context.Background(), result, post, "en"))
+
+	require.GreaterOrEqual(t, len(events), 3)
+	require.Equal(t, PostStreamingControlStart, events[0]["control"])
+	require.Equal(t, "Header\n", events[1]["next"])
+	require.Equal(t, 1, events[1]["seq"])
+	require.Equal(t, "Header\nanswer", post.Message)
+	require.Equal(t, scriptedModelName, responseModelOf(post), "the model of the first generation is recorded")
+}
+
+func TestStreamResultToPostReportsFailure(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.plugin.i18n = i18nInit()
+
+	e.mockAPI.On("PublishWebSocketEvent", "postupdate", mock.Anything, mock.Anything)
+	e.mockAPI.On("LogError", mock.Anything, mock.Anything, mock.Anything).Maybe()
+	e.mockAPI.On("UpdatePost", mock.Anything).Return(func(updated *model.Post) (*model.Post, *model.AppError) {
+		return updated.Clone(), nil
+	})
+
+	t.Run("without a response", func(t *testing.T) {
+		errChan := make(chan error, 1)
+		errChan <- errors.New("upstream failed")
+		stream := &llm.TextStreamResult{Stream: make(chan string), Err: errChan}
+		post := &model.Post{Id: "postid", ChannelId: "channelid"}
+
+		err := e.plugin.streamResultToPost(context.Background(), stream, post, "en")
+		require.ErrorContains(t, err, "upstream failed")
+		require.Equal(t, "Sorry! An error occurred while accessing the LLM. See server logs for details.", post.Message)
+		require.Equal(t, StreamInterruptedEmpty, post.GetProp(StreamInterruptedProp))
+	})
+
+	t.Run("the partial response is kept", func(t *testing.T) {
+		textChan := make(chan string, 1)
+		errChan := make(chan error)
+		stream := &llm.TextStreamResult{Stream: textChan, Err: errChan}
+		post := &model.Post{Id: "postid", ChannelId: "channelid"}
+
+		textChan <- "Half of the answer"
+		go func() {
+			require.Eventually(t, func() bool { return len(textChan) == 0 }, time.Second, time.Millisecond)
+			errChan <- errors.New("upstream failed")
+		}()
+
+		err := e.plugin.streamResultToPost(context.Background(), stream, post, "en")
+		require.ErrorContains(t, err, "upstream failed")
+		require.Equal(t, "Half of the answer\n\nSorry! An error occurred while accessing the LLM. See server logs for details.", post.Message)
+		require.Equal(t, StreamInterruptedPartial, post.GetProp(StreamInterruptedProp))
+
+		clearPostInterrupted(post)
+		require.Equal(t, "Half of the answer", post.Message)
+	})
+}
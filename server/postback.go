@@ -0,0 +1,138 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// ReferencedChannelIDProp marks a response about a channel, such as a summary of its unread posts.
+const ReferencedChannelIDProp = "referenced_channel"
+
+// Props of the posts shared from a bot DM.
+const (
+	PostbackPostType         = "custom_llm_postback"
+	PostbackUserIDProp       = "userid"
+	PostbackEditedProp       = "postback_edited"
+	PostbackSourcePostIDProp = "postback_source_post"
+)
+
+var (
+	errNoDefaultPostbackTarget = errors.New("response doesn't refer to a channel or thread")
+	errPostbackModerated       = errors.New("responses withheld or redacted by content moderation can't be shared")
+	errPostbackFlagged         = errors.New("message may violate the content policy")
+)
+
+// PostbackTarget is where a bot response is shared. An empty RootID shares it as a new post in the channel.
+type PostbackTarget struct {
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
+}
+
+// defaultPostbackTarget returns where the response is about: the thread a meeting summary or thread
+// analysis came from, or the channel a summary of unreads came from. The references are looked up on the
+// response and then on the root of its conversation.
+func (p *Plugin) defaultPostbackTarget(post *model.Post) (PostbackTarget, error) {
+	candidates := []*model.Post{post}
+	if post.RootId != "" {
+		root, err := p.pluginAPI.Post.GetPost(post.RootId)
+		if err != nil {
+			return PostbackTarget{}, fmt.Errorf("unable to get conversation root post: %w", err)
+		}
+		candidates = append(candidates, root)
+	}
+
+	for _, candidate := range candidates {
+		if transcriptionPostID, ok := candidate.GetProp(ReferencedTranscriptPostID).(string); ok && transcriptionPostID != "" {
+			transcriptionPost, err := p.pluginAPI.Post.GetPost(transcriptionPostID)
+			if err != nil {
+				return PostbackTarget{}, fmt.Errorf("unable to get transcription post: %w", err)
+			}
+			return PostbackTarget{ChannelID: transcriptionPost.ChannelId, RootID: transcriptionPost.RootId}, nil
+		}
+
+		if threadID, ok := candidate.GetProp(ThreadIDProp).(string); ok && threadID != "" {
+			return p.requestedPostbackTarget("", threadID)
+		}
+
+		if channelID, ok := candidate.GetProp(ReferencedChannelIDProp).(string); ok && channelID != "" {
+			return PostbackTarget{ChannelID: channelID}, nil
+		}
+	}
+
+	return PostbackTarget{}, errNoDefaultPostbackTarget
+}
+
+// requestedPostbackTarget checks the target chosen by the user. A reply is shared to the root of its
+// thread, and the channel is taken from the thread when it isn't given.
+func (p *Plugin) requestedPostbackTarget(channelID, rootID string) (PostbackTarget, error) {
+	if rootID == "" {
+		if channelID == "" {
+			return PostbackTarget{}, errors.New("a channel or thread is required")
+		}
+		return PostbackTarget{ChannelID: channelID}, nil
+	}
+
+	root, err := p.pluginAPI.Post.GetPost(rootID)
+	if err != nil {
+		return PostbackTarget{}, fmt.Errorf("unable to get thread: %w", err)
+	}
+	if root.RootId != "" {
+		if root, err = p.pluginAPI.Post.GetPost(root.RootId); err != nil {
+			return PostbackTarget{}, fmt.Errorf("unable to get thread: %w", err)
+		}
+	}
+	if root.DeleteAt != 0 {
+		return PostbackTarget{}, errors.New("thread was deleted")
+	}
+	if channelID != "" && root.ChannelId != channelID {
+		return PostbackTarget{}, errors.New("thread is not in the channel")
+	}
+
+	return PostbackTarget{ChannelID: root.ChannelId, RootID: root.Id}, nil
+}
+
+// postbackMessage adds the attribution to a shared message so that it shows wherever the post is
+// rendered, not only in the webapp.
+func postbackMessage(T TranslationFunc, message string, botUsername string, username string, edited bool) string {
+	if edited {
+		return message + "\n\n" + T("copilot.postback_edited_attribution", "_This response was created by @%s then edited and posted by @%s._", botUsername, username)
+	}
+	return message + "\n\n" + T("copilot.postback_attribution", "_This response was created by @%s and posted by @%s._", botUsername, username)
+}
+
+// moderatePostback reviews a message before it is shared under the bot's identity. Responses that
+// moderation already withheld or redacted can't be shared, and flagged messages are refused.
+func (p *Plugin) moderatePostback(source *model.Post, postback *model.Post, userID string) error {
+	if source.GetProp(ModeratedProp) == "true" {
+		return errPostbackModerated
+	}
+
+	cfg := p.getConfiguration()
+	if !cfg.EnableModeration {
+		return nil
+	}
+	moderators := p.getModerators(cfg)
+	if len(moderators) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), moderationTimeout)
+	defer cancel()
+
+	verdict, err := moderate(ctx, moderators, cfg.ModerationAction, postback.Message)
+	if err != nil {
+		return fmt.Errorf("unable to moderate message: %w", err)
+	}
+	if verdict.Flagged {
+		p.recordModerationIncident(postback, userID, verdict, postback.Message)
+		return errPostbackFlagged
+	}
+
+	return nil
+}
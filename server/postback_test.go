@@ -0,0 +1,129 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPostbackTarget(t *testing.T) {
+	withProp := func(post *model.Post, key string, value string) *model.Post {
+		post.AddProp(key, value)
+		return post
+	}
+
+	for name, test := range map[string]struct {
+		post           *model.Post
+		posts          []*model.Post
+		expectedTarget PostbackTarget
+		expectedErr    error
+	}{
+		"meeting summary goes to the call thread": {
+			post: withProp(&model.Post{Id: "responseid", RootId: "rootid"}, ReferencedTranscriptPostID, "transcriptionid"),
+			posts: []*model.Post{
+				{Id: "rootid"},
+				{Id: "transcriptionid", ChannelId: "callchannel", RootId: "callthread"},
+			},
+			expectedTarget: PostbackTarget{ChannelID: "callchannel", RootID: "callthread"},
+		},
+		"thread analysis goes to the root of the analyzed thread": {
+			post: withProp(&model.Post{Id: "responseid"}, ThreadIDProp, "replyid"),
+			posts: []*model.Post{
+				{Id: "replyid", ChannelId: "townsquare", RootId: "threadid"},
+				{Id: "threadid", ChannelId: "townsquare"},
+			},
+			expectedTarget: PostbackTarget{ChannelID: "townsquare", RootID: "threadid"},
+		},
+		"reply in a summary of unreads goes to the channel": {
+			post: &model.Post{Id: "responseid", RootId: "rootid"},
+			posts: []*model.Post{
+				withProp(&model.Post{Id: "rootid"}, ReferencedChannelIDProp, "townsquare"),
+			},
+			expectedTarget: PostbackTarget{ChannelID: "townsquare"},
+		},
+		"plain conversation has no default": {
+			post:        &model.Post{Id: "responseid", RootId: "rootid"},
+			posts:       []*model.Post{{Id: "rootid"}},
+			expectedErr: errNoDefaultPostbackTarget,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := SetupTestEnvironment(t)
+			defer e.Cleanup(t)
+
+			for _, post := range test.posts {
+				e.mockAPI.On("GetPost", post.Id).Return(post, nil)
+			}
+
+			target, err := e.plugin.defaultPostbackTarget(test.post)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedTarget, target)
+		})
+	}
+}
+
+func TestRequestedPostbackTarget(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	e.mockAPI.On("GetPost", "threadid").Return(&model.Post{Id: "threadid", ChannelId: "townsquare"}, nil)
+	e.mockAPI.On("GetPost", "replyid").Return(&model.Post{Id: "replyid", ChannelId: "townsquare", RootId: "threadid"}, nil)
+
+	target, err := e.plugin.requestedPostbackTarget("", "replyid")
+	require.NoError(t, err)
+	require.Equal(t, PostbackTarget{ChannelID: "townsquare", RootID: "threadid"}, target)
+
+	target, err = e.plugin.requestedPostbackTarget("offtopic", "")
+	require.NoError(t, err)
+	require.Equal(t, PostbackTarget{ChannelID: "offtopic"}, target)
+
+	_, err = e.plugin.requestedPostbackTarget("offtopic", "threadid")
+	require.Error(t, err)
+
+	_, err = e.plugin.requestedPostbackTarget("", "")
+	require.Error(t, err)
+}
+
+func TestModeratePostback(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	config := makeConfig(Config{EnableModeration: true})
+	var err error
+	config.moderationBlocklist, err = parseModerationBlocklist("falcon")
+	require.NoError(t, err)
+	e.plugin.setConfiguration(config)
+	e.mockAPI.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	source := &model.Post{Id: "responseid", Message: "Project falcon ships"}
+
+	err = e.plugin.moderatePostback(source, &model.Post{ChannelId: "townsquare", Message: "All good"}, "userid")
+	require.NoError(t, err)
+
+	err = e.plugin.moderatePostback(source, &model.Post{ChannelId: "townsquare", Message: "Project falcon ships"}, "userid")
+	require.ErrorIs(t, err, errPostbackFlagged)
+
+	moderated := &model.Post{Id: "responseid", Message: "_This response was withheld._"}
+	moderated.AddProp(ModeratedProp, "true")
+	err = e.plugin.moderatePostback(moderated, &model.Post{ChannelId: "townsquare", Message: "Project ships"}, "userid")
+	require.ErrorIs(t, err, errPostbackModerated)
+}
+
+func TestPostbackMessage(t *testing.T) {
+	T := func(_ string, defaultMessage string, args ...any) string {
+		return fmt.Sprintf(defaultMessage, args...)
+	}
+
+	require.Equal(t, "Summary\n\n_This response was created by @ai and posted by @alice._", postbackMessage(T, "Summary", "ai", "alice", false))
+	require.Equal(t, "Summary\n\n_This response was created by @ai then edited and posted by @alice._", postbackMessage(T, "Summary", "ai", "alice", true))
+}
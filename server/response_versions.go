@@ -0,0 +1,205 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Props of a regenerated response: the version it displays and how many versions it has.
+const (
+	ResponseVersionProp      = "llm_response_version"
+	ResponseVersionCountProp = "llm_response_versions"
+)
+
+// ResponseModelProp records the model that generated the last response streamed to a post.
+const ResponseModelProp = "llm_response_model"
+
+// How the generation of a response version ended.
+const (
+	ResponseVersionStatusCompleted   = "completed"
+	ResponseVersionStatusModerated   = "moderated"
+	ResponseVersionStatusStopped     = "stopped"
+	ResponseVersionStatusInterrupted = "interrupted"
+	ResponseVersionStatusFailed      = "failed"
+)
+
+var errResponseVersionNotFound = errors.New("response version not found")
+
+// ResponseVersion is one generation of a bot response. Versions are numbered from 1 in the order they
+// were generated.
+type ResponseVersion struct {
+	PostID          string `json:"post_id"`
+	Version         int    `json:"version"`
+	Message         string `json:"message"`
+	Model           string `json:"model"`
+	Status          string `json:"status"`
+	RequesterUserID string `json:"requester_user_id"`
+	CreateAt        int64  `json:"create_at"`
+}
+
+func (p *Plugin) getResponseVersions(postID string) ([]ResponseVersion, error) {
+	var versions []ResponseVersion
+	if err := p.doQuery(&versions, p.builder.Select("*").
+		From("LLM_ResponseVersions").
+		Where(sq.Eq{"PostID": postID}).
+		OrderBy("Version ASC"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to get response versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (p *Plugin) getResponseVersion(postID string, version int) (ResponseVersion, error) {
+	var versions []ResponseVersion
+	if err := p.doQuery(&versions, p.builder.Select("*").
+		From("LLM_ResponseVersions").
+		Where(sq.Eq{"PostID": postID, "Version": version}),
+	); err != nil {
+		return ResponseVersion{}, fmt.Errorf("failed to get response version: %w", err)
+	}
+	if len(versions) == 0 {
+		return ResponseVersion{}, errResponseVersionNotFound
+	}
+	return versions[0], nil
+}
+
+func (p *Plugin) saveResponseVersion(version ResponseVersion) error {
+	_, err := p.execBuilder(p.builder.Insert("LLM_ResponseVersions").
+		SetMap(map[string]interface{}{
+			"PostID":          version.PostID,
+			"Version":         version.Version,
+			"Message":         version.Message,
+			"Model":           version.Model,
+			"Status":          version.Status,
+			"RequesterUserID": version.RequesterUserID,
+			"CreateAt":        version.CreateAt,
+		}).
+		Suffix("ON CONFLICT (PostID, Version) DO UPDATE SET Message = EXCLUDED.Message, Status = EXCLUDED.Status"))
+	if err != nil {
+		return fmt.Errorf("failed to save response version: %w", err)
+	}
+	return nil
+}
+
+// responseVersionOf returns the version displayed by the post, 0 if it was never regenerated.
+func responseVersionOf(post *model.Post) int {
+	prop, _ := post.GetProp(ResponseVersionProp).(string)
+	version, _ := strconv.Atoi(prop)
+	return version
+}
+
+func setResponseVersion(post *model.Post, version, count int) {
+	post.AddProp(ResponseVersionProp, strconv.Itoa(version))
+	post.AddProp(ResponseVersionCountProp, strconv.Itoa(count))
+}
+
+// startResponseVersion prepares the post for a new generation. The response as it was before its first
+// regeneration is kept as version 1.
+func (p *Plugin) startResponseVersion(post *model.Post) error {
+	versions, err := p.getResponseVersions(post.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		requesterUserID, _ := post.GetProp(LLMRequesterUserID).(string)
+		original := ResponseVersion{
+			PostID:          post.Id,
+			Version:         1,
+			Message:         post.Message,
+			Model:           responseModelOf(post),
+			Status:          responseVersionStatus(post, nil),
+			RequesterUserID: requesterUserID,
+			CreateAt:        post.CreateAt,
+		}
+		if err := p.saveResponseVersion(original); err != nil {
+			return err
+		}
+		versions = append(versions, original)
+	}
+
+	next := versions[len(versions)-1].Version + 1
+	setResponseVersion(post, next, next)
+	return nil
+}
+
+// responseVersionStatus tells how the generation displayed by the post ended from the error of streaming it.
+func responseVersionStatus(post *model.Post, streamErr error) string {
+	switch {
+	case errors.Is(streamErr, ErrServerShutdown):
+		return ResponseVersionStatusInterrupted
+	case errors.Is(streamErr, context.Canceled):
+		return ResponseVersionStatusStopped
+	case streamErr != nil && !errors.Is(streamErr, errPostStreamLeaseLost):
+		// Failed responses are also marked as interrupted so they can be continued.
+		return ResponseVersionStatusFailed
+	case post.GetProp(StreamInterruptedProp) != nil:
+		return ResponseVersionStatusInterrupted
+	case streamErr != nil:
+		return ResponseVersionStatusFailed
+	case post.GetProp(ModeratedProp) != nil:
+		return ResponseVersionStatusModerated
+	}
+	return ResponseVersionStatusCompleted
+}
+
+// generatedModel returns the model a response was generated with. Services that don't report it are
+// assumed to have used the model configured for the task.
+func generatedModel(result *llm.TextStreamResult, botConfig llm.BotConfig, task llm.Task) string {
+	if result.Model != nil {
+		if modelName := result.Model(); modelName != "" {
+			return modelName
+		}
+	}
+	return botConfig.ModelForTask(task)
+}
+
+// setResponseModel records the model the stream was generated with on the post.
+func setResponseModel(post *model.Post, stream *llm.TextStreamResult) {
+	if stream.Model == nil {
+		return
+	}
+	if modelName := stream.Model(); modelName != "" {
+		post.AddProp(ResponseModelProp, modelName)
+	}
+}
+
+// responseModelOf returns the model recorded on the post, empty for responses streamed before it was recorded.
+func responseModelOf(post *model.Post) string {
+	modelName, _ := post.GetProp(ResponseModelProp).(string)
+	return modelName
+}
+
+// saveDisplayedResponseVersion stores the message of the post as the version it displays once a generation
+// is finished, along with how the generation ended. A continued version only gets its message and status
+// updated. Nothing is saved when another stream took over the post.
+func (p *Plugin) saveDisplayedResponseVersion(post *model.Post, modelName string, streamErr error, requesterUserID string) {
+	if errors.Is(streamErr, errPostStreamLeaseLost) {
+		return
+	}
+	version := responseVersionOf(post)
+	if version == 0 {
+		return
+	}
+
+	if err := p.saveResponseVersion(ResponseVersion{
+		PostID:          post.Id,
+		Version:         version,
+		Message:         post.Message,
+		Model:           modelName,
+		Status:          responseVersionStatus(post, streamErr),
+		RequesterUserID: requesterUserID,
+		CreateAt:        model.GetMillis(),
+	}); err != nil {
+		p.pluginAPI.Log.Error("Unable to save response version", "post_id", post.Id, "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseVersionProps(t *testing.T) {
+	post := &model.Post{}
+	require.Equal(t, 0, responseVersionOf(post))
+
+	setResponseVersion(post, 2, 3)
+	require.Equal(t, 2, responseVersionOf(post))
+	require.Equal(t, "3", post.GetProp(ResponseVersionCountProp))
+
+	post.AddProp(ResponseVersionProp, 1)
+	require.Equal(t, 0, responseVersionOf(post), "only props saved by the plugin are read")
+}
+
+func TestResponseVersionStatus(t *testing.T) {
+	require.Equal(t, ResponseVersionStatusCompleted, responseVersionStatus(&model.Post{}, nil))
+	require.Equal(t, ResponseVersionStatusStopped, responseVersionStatus(&model.Post{}, context.Canceled))
+	require.Equal(t, ResponseVersionStatusInterrupted, responseVersionStatus(&model.Post{}, ErrServerShutdown))
+	require.Equal(t, ResponseVersionStatusFailed, responseVersionStatus(&model.Post{}, errors.New("rate limited")))
+
+	moderated := &model.Post{}
+	moderated.AddProp(ModeratedProp, "true")
+	require.Equal(t, ResponseVersionStatusModerated, responseVersionStatus(moderated, nil))
+
+	interrupted := &model.Post{}
+	markPostInterrupted(interrupted, "interrupted")
+	require.Equal(t, ResponseVersionStatusInterrupted, responseVersionStatus(interrupted, nil))
+	require.Equal(t, ResponseVersionStatusInterrupted, responseVersionStatus(interrupted, errPostStreamLeaseLost))
+	require.Equal(t, ResponseVersionStatusFailed, responseVersionStatus(interrupted, errors.New("rate limited")))
+}
+
+func TestGeneratedModel(t *testing.T) {
+	botConfig := llm.BotConfig{Service: llm.ServiceConfig{DefaultModel: "configured"}}
+
+	reported := &llm.TextStreamResult{Model: func() string { return "reported" }}
+	require.Equal(t, "reported", generatedModel(reported, botConfig, llm.TaskChat))
+
+	require.Equal(t, "configured", generatedModel(&llm.TextStreamResult{}, botConfig, llm.TaskChat))
+	require.Equal(t, "configured", generatedModel(&llm.TextStreamResult{Model: func() string { return "" }}, botConfig, llm.TaskChat), "queued requests don't know their model yet")
+}
+
+func TestResponseModelProp(t *testing.T) {
+	post := &model.Post{}
+	setResponseModel(post, &llm.TextStreamResult{})
+	require.Empty(t, responseModelOf(post))
+
+	setResponseModel(post, &llm.TextStreamResult{Model: func() string { return "reported" }})
+	require.Equal(t, "reported", responseModelOf(post))
+
+	setResponseModel(post, &llm.TextStreamResult{Model: func() string { return "" }})
+	require.Equal(t, "reported", responseModelOf(post), "a model that isn't known yet doesn't replace the recorded one")
+}
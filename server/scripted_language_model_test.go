@@ -0,0 +1,194 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedTurn is one response of a scriptedLanguageModel. When Expect is set, the conversation it
+// answers must contain it, which catches prompts that lost part of their input.
+type scriptedTurn struct {
+	Expect   string `json:"expect,omitempty"`
+	Response string `json:"response"`
+	Err      string `json:"error,omitempty"`
+
+	// Tool is resolved through the tools of the conversation before responding, like the providers do,
+	// and its result is appended to the response.
+	Tool string `json:"tool,omitempty"`
+
+	// Chunks replaces the word by word streaming of the response.
+	Chunks []string `json:"-"`
+
+	// StreamErr is sent once the response has been streamed.
+	StreamErr error `json:"-"`
+
+	// Hold keeps the stream open after the response until the request is canceled.
+	Hold bool `json:"-"`
+}
+
+// scriptedLanguageModel is the language model used by tests. It replays responses in order, streamed
+// word by word like a real service, and keeps the conversations it was sent.
+type scriptedLanguageModel struct {
+	lock     sync.Mutex
+	turns    []scriptedTurn
+	received []llm.BotConversation
+}
+
+// scriptedModelName is the model scriptedLanguageModel reports generating its streams with.
+const scriptedModelName = "scripted"
+
+func newScriptedLanguageModel(turns ...scriptedTurn) *scriptedLanguageModel {
+	return &scriptedLanguageModel{turns: turns}
+}
+
+func (s *scriptedLanguageModel) next(conversation llm.BotConversation) (scriptedTurn, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.received = append(s.received, conversation)
+	if len(s.turns) == 0 {
+		return scriptedTurn{}, fmt.Errorf("script exhausted after %d requests", len(s.received)-1)
+	}
+	turn := s.turns[0]
+	s.turns = s.turns[1:]
+
+	if turn.Expect != "" && !strings.Contains(conversationText(conversation), turn.Expect) {
+		return scriptedTurn{}, fmt.Errorf("request %d doesn't contain %q", len(s.received), turn.Expect)
+	}
+	if turn.Err != "" {
+		return scriptedTurn{}, fmt.Errorf("%s", turn.Err)
+	}
+	if turn.Tool != "" {
+		result, err := conversation.Tools.ResolveTool(turn.Tool, func(args any) error { return nil }, conversation.Context)
+		if err != nil {
+			return scriptedTurn{}, err
+		}
+		turn.Response += " " + result
+	}
+	return turn, nil
+}
+
+func (s *scriptedLanguageModel) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	turn, err := s.next(conversation)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := turn.Chunks
+	if chunks == nil {
+		chunks = strings.SplitAfter(turn.Response, " ")
+	}
+	output := make(chan string)
+	errChan := make(chan error)
+	cancel, canceled := llm.NewCancel()
+	go func() {
+		defer close(output)
+		defer close(errChan)
+		for _, chunk := range chunks {
+			select {
+			case output <- chunk:
+			case <-canceled:
+				return
+			}
+		}
+		if turn.StreamErr != nil {
+			select {
+			case errChan <- turn.StreamErr:
+			case <-canceled:
+				return
+			}
+		}
+		if turn.Hold {
+			<-canceled
+		}
+	}()
+	return &llm.TextStreamResult{Stream: output, Err: errChan, Cancel: cancel, Canceled: canceled, Model: func() string { return scriptedModelName }}, nil
+}
+
+func (s *scriptedLanguageModel) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	turn, err := s.next(conversation)
+	if err != nil {
+		return "", err
+	}
+	if turn.StreamErr != nil {
+		return "", turn.StreamErr
+	}
+	return turn.Response, nil
+}
+
+// lastReceived returns the last conversation the model was sent.
+func (s *scriptedLanguageModel) lastReceived() *llm.BotConversation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return &s.received[len(s.received)-1]
+}
+
+func (s *scriptedLanguageModel) CountTokens(text string) int { return len(text) / 4 }
+func (s *scriptedLanguageModel) InputTokenLimit() int        { return 100000 }
+
+// conversationText joins the messages of a conversation the way they are sent to the service.
+func conversationText(conversation llm.BotConversation) string {
+	messages := make([]string, 0, len(conversation.Posts))
+	for _, post := range conversation.Posts {
+		messages = append(messages, post.Message)
+	}
+	return strings.Join(messages, "\n\n")
+}
+
+func TestScriptedLanguageModel(t *testing.T) {
+	languageModel := newScriptedLanguageModel(
+		scriptedTurn{Expect: "deploy", Response: "Deploy on Friday."},
+		scriptedTurn{Response: "Second answer."},
+	)
+	question := llm.BotConversation{Posts: []llm.Post{{Role: llm.PostRoleUser, Message: "When do we deploy?"}}}
+
+	result, err := languageModel.ChatCompletion(question)
+	require.NoError(t, err)
+	require.Equal(t, "Deploy on Friday.", result.ReadAll())
+
+	response, err := languageModel.ChatCompletionNoStream(question)
+	require.NoError(t, err)
+	require.Equal(t, "Second answer.", response)
+
+	_, err = languageModel.ChatCompletionNoStream(question)
+	require.ErrorContains(t, err, "script exhausted")
+	require.Len(t, languageModel.received, 3)
+
+	mismatch := newScriptedLanguageModel(scriptedTurn{Expect: "transcript", Response: "unused"})
+	_, err = mismatch.ChatCompletion(question)
+	require.ErrorContains(t, err, "doesn't contain")
+
+	t.Run("tool calls and stream errors", func(t *testing.T) {
+		tools := llm.NewNoTools()
+		tools.AddTools([]llm.Tool{{
+			Name: "lookup",
+			Resolver: func(context llm.ConversationContext, argsGetter llm.ToolArgumentGetter) (string, error) {
+				return "found", nil
+			},
+		}})
+		languageModel := newScriptedLanguageModel(
+			scriptedTurn{Response: "Looked it up:", Tool: "lookup"},
+			scriptedTurn{Chunks: []string{"par", "tial"}, StreamErr: errors.New("connection reset")},
+		)
+
+		response, err := languageModel.ChatCompletionNoStream(llm.BotConversation{Tools: tools})
+		require.NoError(t, err)
+		require.Equal(t, "Looked it up: found", response)
+
+		result, err := languageModel.ChatCompletion(question)
+		require.NoError(t, err)
+		require.Equal(t, "par", <-result.Stream)
+		require.Equal(t, "tial", <-result.Stream)
+		require.EqualError(t, <-result.Err, "connection reset")
+		require.Equal(t, question, *languageModel.lastReceived())
+	})
+}
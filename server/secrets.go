@@ -0,0 +1,157 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+)
+
+// Referenced secrets are read again periodically so rotated keys are picked up without a restart.
+const secretRefreshInterval = time.Minute
+
+// Secrets shorter than this aren't redacted from text, replacing them would mangle unrelated words.
+const minRedactedSecretLength = 4
+
+// secretCache holds the values of the secrets referenced by the configuration, by reference.
+type secretCache struct {
+	mu     sync.RWMutex
+	values map[string]string
+	// plaintext holds the secrets stored in the configuration itself, which are redacted too.
+	plaintext []string
+	// failures holds the last error of each reference that couldn't be resolved, to only report it once.
+	failures map[string]string
+}
+
+// secretRefresh is the outcome of reading the referenced secrets again.
+type secretRefresh struct {
+	// Failed holds the error of each reference that can't be resolved since the last refresh.
+	Failed  map[string]string
+	Rotated []string
+}
+
+// refresh resolves every secret referenced by the bots. A secret that can't be read any more keeps its
+// previous value so a file being rewritten doesn't take the bot down.
+func (c *secretCache) refresh(bots []llm.BotConfig) secretRefresh {
+	values := map[string]string{}
+	failures := map[string]string{}
+	var plaintext []string
+	result := secretRefresh{Failed: map[string]string{}}
+
+	c.mu.RLock()
+	previousValues := c.values
+	previousFailures := c.failures
+	c.mu.RUnlock()
+
+	for _, bot := range bots {
+		plaintext = append(plaintext, bot.Service.SecretValues()...)
+		for _, reference := range bot.Service.SecretReferences() {
+			if _, ok := values[reference]; ok {
+				continue
+			}
+			if _, ok := failures[reference]; ok {
+				continue
+			}
+
+			value, err := llm.ResolveSecret(reference)
+			if err != nil {
+				failures[reference] = err.Error()
+				if previousFailures[reference] != err.Error() {
+					result.Failed[reference] = err.Error()
+				}
+				if previous, ok := previousValues[reference]; ok {
+					values[reference] = previous
+				}
+				continue
+			}
+			if previous, ok := previousValues[reference]; ok && previous != value {
+				result.Rotated = append(result.Rotated, reference)
+			}
+			values[reference] = value
+		}
+	}
+
+	c.mu.Lock()
+	c.values = values
+	c.plaintext = plaintext
+	c.failures = failures
+	c.mu.Unlock()
+
+	return result
+}
+
+// resolve returns the value of a reference. Only the references of the saved configuration are resolved,
+// a bot being tested before it is saved can't read secrets the configuration doesn't already use.
+func (c *secretCache) resolve(reference string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if value, ok := c.values[reference]; ok {
+		return value, nil
+	}
+	if failure, ok := c.failures[reference]; ok {
+		return "", errors.New(failure)
+	}
+	return "", fmt.Errorf("secret reference %s isn't used by the saved configuration", reference)
+}
+
+// redact hides every known secret, and the extra ones given, in text shown in logs and admin views.
+func (c *secretCache) redact(text string, extra ...string) string {
+	c.mu.RLock()
+	secrets := make([]string, 0, len(c.values)+len(c.plaintext)+len(extra))
+	for _, value := range c.values {
+		secrets = append(secrets, value)
+	}
+	secrets = append(secrets, c.plaintext...)
+	c.mu.RUnlock()
+	secrets = append(secrets, extra...)
+
+	for _, secret := range secrets {
+		if len(secret) >= minRedactedSecretLength {
+			text = strings.ReplaceAll(text, secret, llm.RedactedSecret)
+		}
+	}
+	return text
+}
+
+// resolveBotSecrets returns the bot with the secret references of its service replaced by their values.
+func (p *Plugin) resolveBotSecrets(botConfig llm.BotConfig) (llm.BotConfig, []llm.ValidationError) {
+	service, problems := botConfig.Service.ResolveSecrets(p.secrets.resolve)
+	botConfig.Service = service
+	for i := range problems {
+		problems[i].Bot = botConfig.Name
+	}
+	return botConfig, problems
+}
+
+// runSecretRefresh periodically reads the referenced secrets again.
+func (p *Plugin) runSecretRefresh(stop <-chan struct{}) {
+	ticker := time.NewTicker(secretRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		result := p.secrets.refresh(p.getConfiguration().Bots)
+		p.logSecretRefresh(result)
+	}
+}
+
+func (p *Plugin) logSecretRefresh(result secretRefresh) {
+	for reference, err := range result.Failed {
+		p.pluginAPI.Log.Warn("Unable to resolve secret", "reference", reference, "error", err)
+	}
+	for _, reference := range result.Rotated {
+		p.pluginAPI.Log.Info("Secret rotated", "reference", reference)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretCache(t *testing.T) {
+	secretsDir := t.TempDir()
+	t.Setenv(llm.SecretsDirEnv, secretsDir)
+	secretFile := filepath.Join(secretsDir, "openai")
+	require.NoError(t, os.WriteFile(secretFile, []byte("sk-first"), 0600))
+	bots := []llm.BotConfig{
+		{Name: "ai", Service: llm.ServiceConfig{APIKey: "file:" + secretFile}},
+		{Name: "other", Service: llm.ServiceConfig{APIKey: "sk-plaintext"}},
+	}
+
+	var cache secretCache
+	result := cache.refresh(bots)
+	require.Empty(t, result.Failed)
+	require.Empty(t, result.Rotated)
+
+	value, err := cache.resolve("file:" + secretFile)
+	require.NoError(t, err)
+	require.Equal(t, "sk-first", value)
+
+	t.Run("rotated secrets are picked up", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(secretFile, []byte("sk-second\n"), 0600))
+		result := cache.refresh(bots)
+		require.Equal(t, []string{"file:" + secretFile}, result.Rotated)
+
+		value, err := cache.resolve("file:" + secretFile)
+		require.NoError(t, err)
+		require.Equal(t, "sk-second", value)
+	})
+
+	t.Run("secrets that disappear keep their value", func(t *testing.T) {
+		require.NoError(t, os.Remove(secretFile))
+		result := cache.refresh(bots)
+		require.Contains(t, result.Failed, "file:"+secretFile)
+
+		value, err := cache.resolve("file:" + secretFile)
+		require.NoError(t, err)
+		require.Equal(t, "sk-second", value)
+
+		result = cache.refresh(bots)
+		require.Empty(t, result.Failed, "failures are only reported once")
+	})
+
+	t.Run("references missing from the saved configuration are not read", func(t *testing.T) {
+		otherFile := filepath.Join(secretsDir, "other")
+		require.NoError(t, os.WriteFile(otherFile, []byte("sk-other"), 0600))
+
+		_, err := cache.resolve("file:" + otherFile)
+		require.ErrorContains(t, err, "isn't used by the saved configuration")
+	})
+
+	t.Run("secrets are redacted", func(t *testing.T) {
+		require.Equal(t, "keys ******** ******** ********", cache.redact("keys sk-second sk-plaintext sk-extra", "sk-extra"))
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// ErrServerShutdown is the cause given to contexts canceled because the plugin is shutting down.
+var ErrServerShutdown = errors.New("server is shutting down")
+
+// On deactivation streams get a chance to finish before they are canceled. Canceled streams
+// still need a moment to save their partial response.
+const (
+	ShutdownDrainTimeout      = 10 * time.Second
+	ShutdownCancelTimeout     = 5 * time.Second
+	ShutdownBackgroundTimeout = 5 * time.Second
+	ffmpegTerminateTimeout    = 5 * time.Second
+)
+
+// StreamInterruptedLengthProp is the length of the partial response of an interrupted post,
+// without the note explaining the interruption.
+const StreamInterruptedLengthProp = "llm_stream_interrupted_length"
+
+func (p *Plugin) OnDeactivate() error {
+	p.shuttingDown.Store(true)
+
+	if p.streamSweeperStop != nil {
+		close(p.streamSweeperStop)
+	}
+	if p.auditLogRetentionStop != nil {
+		close(p.auditLogRetentionStop)
+	}
+	if p.secretRefreshStop != nil {
+		close(p.secretRefreshStop)
+	}
+
+	// Jobs are stopped first so their streams are released and resumed into the same post rather than
+	// recorded as finished.
+	if p.jobQueue != nil {
+		p.jobQueue.Stop()
+	}
+
+	if !p.waitForPostStreams(ShutdownDrainTimeout) {
+		p.cancelPostStreams(ErrServerShutdown)
+		if !p.waitForPostStreams(ShutdownCancelTimeout) {
+			p.pluginAPI.Log.Warn("Streams did not finish before shutdown")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.backgroundTasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ShutdownBackgroundTimeout):
+		p.pluginAPI.Log.Warn("Background tasks did not finish before shutdown")
+	}
+
+	p.stopTracing()
+
+	return nil
+}
+
+func (p *Plugin) isShuttingDown() bool {
+	return p.shuttingDown.Load()
+}
+
+// goBackground runs a task that shutdown waits on for a short while.
+func (p *Plugin) goBackground(f func()) {
+	p.backgroundTasks.Add(1)
+	go func() {
+		defer p.backgroundTasks.Done()
+		f()
+	}()
+}
+
+// rejectDuringShutdown refuses new requests once the plugin has started shutting down.
+func (p *Plugin) rejectDuringShutdown(c *gin.Context) {
+	if p.isShuttingDown() {
+		c.AbortWithError(http.StatusServiceUnavailable, ErrServerShutdown)
+		return
+	}
+}
+
+// waitForPostStreams waits for the streams running on this node to finish and reports if they did.
+func (p *Plugin) waitForPostStreams(timeout time.Duration) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		p.streamingContextsMutex.Lock()
+		remaining := len(p.streamingContexts)
+		p.streamingContextsMutex.Unlock()
+		if remaining == 0 {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// cancelPostStreams cancels every stream running on this node. The streams stay registered
+// until they have saved their partial response.
+func (p *Plugin) cancelPostStreams(cause error) {
+	p.streamingContextsMutex.Lock()
+	defer p.streamingContextsMutex.Unlock()
+
+	for _, streamContext := range p.streamingContexts {
+		streamContext.cancel(cause)
+	}
+}
+
+// markPostInterrupted flags a post whose stream was cut off so the requester can continue it.
+// The note is appended to the partial response and removed again when continuing.
+func markPostInterrupted(post *model.Post, note string) {
+	if strings.TrimSpace(post.Message) == "" {
+		post.AddProp(StreamInterruptedProp, StreamInterruptedEmpty)
+		post.Message = note
+		return
+	}
+
+	post.AddProp(StreamInterruptedProp, StreamInterruptedPartial)
+	post.AddProp(StreamInterruptedLengthProp, strconv.Itoa(len(post.Message)))
+	post.Message += "\n\n" + note
+}
+
+// clearPostInterrupted removes the interruption flags and note from a post.
+func clearPostInterrupted(post *model.Post) {
+	lengthProp, _ := post.GetProp(StreamInterruptedLengthProp).(string)
+	if length, err := strconv.Atoi(lengthProp); err == nil && length <= len(post.Message) {
+		post.Message = post.Message[:length]
+	}
+	post.DelProp(StreamInterruptedProp)
+	post.DelProp(StreamInterruptedLengthProp)
+}
+
+// ffmpegCommand creates an ffmpeg command that is asked to terminate when the context is canceled
+// and is killed if it doesn't.
+func (p *Plugin) ffmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, p.ffmpegPath, args...) //nolint:gosec
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = ffmpegTerminateTimeout
+	return cmd
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectDuringShutdown(t *testing.T) {
+	// This just makes gin not output a whole bunch of debug stuff.
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.mockAPI.On("LogError", mock.Anything).Maybe()
+
+	e.plugin.shuttingDown.Store(true)
+
+	request := httptest.NewRequest(http.MethodGet, "/ai_bots", nil)
+	request.Header.Add("Mattermost-User-ID", "userid")
+	recorder := httptest.NewRecorder()
+	e.plugin.ServeHTTP(&plugin.Context{}, recorder, request)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Result().StatusCode)
+
+	err := e.plugin.handleMessages(&model.Post{UserId: "userid", Message: "hello"})
+	require.ErrorIs(t, err, ErrNoResponse)
+
+	_, err = e.plugin.getPostStreamingContext(context.Background(), "postid")
+	require.ErrorIs(t, err, ErrServerShutdown)
+}
+
+func TestMarkPostInterrupted(t *testing.T) {
+	t.Run("partial response keeps its text", func(t *testing.T) {
+		post := &model.Post{Message: "Partial answer"}
+		markPostInterrupted(post, "_Interrupted._")
+		require.Equal(t, "Partial answer\n\n_Interrupted._", post.Message)
+		require.Equal(t, StreamInterruptedPartial, post.GetProp(StreamInterruptedProp))
+
+		clearPostInterrupted(post)
+		require.Equal(t, "Partial answer", post.Message)
+		require.Nil(t, post.GetProp(StreamInterruptedProp))
+		require.Nil(t, post.GetProp(StreamInterruptedLengthProp))
+	})
+
+	t.Run("empty response", func(t *testing.T) {
+		post := &model.Post{Message: " "}
+		markPostInterrupted(post, "_Interrupted._")
+		require.Equal(t, "_Interrupted._", post.Message)
+		require.Equal(t, StreamInterruptedEmpty, post.GetProp(StreamInterruptedProp))
+	})
+}
+
+func TestStreamCanceledByShutdown(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.plugin.i18n = i18nInit()
+
+	e.mockAPI.On("PublishWebSocketEvent", "postupdate", mock.Anything, mock.Anything)
+	var saved *model.Post
+	e.mockAPI.On("UpdatePost", mock.Anything).Return(func(updated *model.Post) (*model.Post, *model.AppError) {
+		saved = updated.Clone()
+		return updated.Clone(), nil
+	})
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrServerShutdown)
+
+	post := &model.Post{Id: "postid", ChannelId: "channelid", Message: "Partial answer"}
+	stream := &llm.TextStreamResult{Stream: make(chan string), Err: make(chan error)}
+	err := e.plugin.streamResultToPost(ctx, stream, post, "en")
+	require.ErrorIs(t, err, ErrServerShutdown)
+
+	require.NotNil(t, saved)
+	require.Equal(t, "Partial answer\n\n_This response was interrupted by a server restart._", saved.Message)
+	require.Equal(t, StreamInterruptedPartial, saved.GetProp(StreamInterruptedProp))
+}
+
+func TestJobStreamNotStartedWithoutPost(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+
+	e.plugin.shuttingDown.Store(true)
+
+	jobCtx := &JobContext{Context: context.Background(), Job: &Job{}, plugin: e.plugin}
+	err := e.plugin.streamJobResultToPost(jobCtx, &model.Post{Id: "postid"}, "en", func() (*llm.TextStreamResult, error) {
+		require.FailNow(t, "the LLM request was started without holding the post")
+		return nil, nil
+	})
+	require.ErrorIs(t, err, ErrServerShutdown)
+}
+
+func TestNewPostStreamClosedDuringShutdown(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.plugin.i18n = i18nInit()
+
+	e.plugin.shuttingDown.Store(true)
+
+	locale := "en"
+	e.mockAPI.On("GetConfig").Return(&model.Config{LocalizationSettings: model.LocalizationSettings{DefaultServerLocale: &locale}})
+	e.mockAPI.On("CreatePost", mock.Anything).Return(func(post *model.Post) (*model.Post, *model.AppError) {
+		created := post.Clone()
+		created.Id = "postid"
+		return created, nil
+	})
+	e.mockAPI.On("GetUser", "userid").Return(&model.User{Id: "userid", Locale: "en"}, nil)
+	e.mockAPI.On("GetChannel", "channelid").Return(&model.Channel{Id: "channelid", Type: model.ChannelTypeOpen}, nil)
+	var saved *model.Post
+	e.mockAPI.On("UpdatePost", mock.Anything).Return(func(updated *model.Post) (*model.Post, *model.AppError) {
+		saved = updated.Clone()
+		return updated.Clone(), nil
+	})
+
+	closed := false
+	stream := &llm.TextStreamResult{Stream: make(chan string), Err: make(chan error), Cancel: func() { closed = true }}
+	err := e.plugin.streamResultToNewPost("botid", "userid", stream, &model.Post{ChannelId: "channelid"})
+	require.ErrorIs(t, err, ErrServerShutdown)
+
+	require.True(t, closed)
+	require.NotNil(t, saved)
+	require.Equal(t, "_This response was interrupted by a server restart._", saved.Message)
+	require.Equal(t, StreamInterruptedEmpty, saved.GetProp(StreamInterruptedProp))
+}
@@ -5,7 +5,10 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"errors"
 
@@ -68,6 +71,108 @@ func (p *Plugin) SetupTables() error {
 		return fmt.Errorf("can't create llm titles table: %w", err)
 	}
 
+	if _, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_Jobs (
+			ID TEXT NOT NULL PRIMARY KEY,
+			Type TEXT NOT NULL,
+			Status TEXT NOT NULL,
+			PostID TEXT NOT NULL REFERENCES Posts(ID) ON DELETE CASCADE,
+			UserID TEXT NOT NULL,
+			BotID TEXT NOT NULL,
+			Payload TEXT NOT NULL,
+			Progress TEXT NOT NULL DEFAULT '',
+			State TEXT NOT NULL DEFAULT '',
+			Error TEXT NOT NULL DEFAULT '',
+			Attempts INTEGER NOT NULL DEFAULT 0,
+			MaxAttempts INTEGER NOT NULL,
+			RunAt BIGINT NOT NULL,
+			LockedBy TEXT NOT NULL DEFAULT '',
+			LockedUntil BIGINT NOT NULL DEFAULT 0,
+			CreateAt BIGINT NOT NULL,
+			UpdateAt BIGINT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_jobs_status_runat ON LLM_Jobs(Status, RunAt);
+		CREATE INDEX IF NOT EXISTS idx_llm_jobs_postid ON LLM_Jobs(PostID);
+	`); err != nil {
+		return fmt.Errorf("can't create llm jobs table: %w", err)
+	}
+
+	if _, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_PostStreams (
+			PostID TEXT NOT NULL REFERENCES Posts(ID) ON DELETE CASCADE PRIMARY KEY,
+			NodeID TEXT NOT NULL,
+			ExpiresAt BIGINT NOT NULL
+		);
+	`); err != nil {
+		return fmt.Errorf("can't create llm post streams table: %w", err)
+	}
+
+	if _, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_AuditLog (
+			ID TEXT NOT NULL PRIMARY KEY,
+			CreateAt BIGINT NOT NULL,
+			UserID TEXT NOT NULL,
+			BotID TEXT NOT NULL,
+			BotName TEXT NOT NULL,
+			ChannelID TEXT NOT NULL,
+			PostID TEXT NOT NULL,
+			Operation TEXT NOT NULL,
+			Model TEXT NOT NULL,
+			ToolsUsed TEXT NOT NULL,
+			InputTokens INTEGER NOT NULL,
+			OutputTokens INTEGER NOT NULL,
+			DurationMs BIGINT NOT NULL,
+			Status TEXT NOT NULL,
+			ErrorType TEXT NOT NULL,
+			Prompt TEXT NOT NULL,
+			Response TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_auditlog_createat ON LLM_AuditLog(CreateAt);
+		CREATE INDEX IF NOT EXISTS idx_llm_auditlog_userid_createat ON LLM_AuditLog(UserID, CreateAt);
+	`); err != nil {
+		return fmt.Errorf("can't create llm audit log table: %w", err)
+	}
+
+	if _, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_ResponseVersions (
+			PostID TEXT NOT NULL REFERENCES Posts(ID) ON DELETE CASCADE,
+			Version INTEGER NOT NULL,
+			Message TEXT NOT NULL,
+			Model TEXT NOT NULL,
+			Status TEXT NOT NULL,
+			RequesterUserID TEXT NOT NULL,
+			CreateAt BIGINT NOT NULL,
+			PRIMARY KEY (PostID, Version)
+		);
+	`); err != nil {
+		return fmt.Errorf("can't create llm response versions table: %w", err)
+	}
+
+	if _, err := p.db.Exec(`
+		CREATE TABLE IF NOT EXISTS LLM_Feedback (
+			PostID TEXT NOT NULL REFERENCES Posts(ID) ON DELETE CASCADE,
+			UserID TEXT NOT NULL,
+			BotID TEXT NOT NULL,
+			BotName TEXT NOT NULL,
+			ChannelID TEXT NOT NULL,
+			RootID TEXT NOT NULL,
+			PromptTemplate TEXT NOT NULL,
+			Model TEXT NOT NULL,
+			Rating TEXT NOT NULL,
+			Comment TEXT NOT NULL,
+			CreateAt BIGINT NOT NULL,
+			UpdateAt BIGINT NOT NULL,
+			PRIMARY KEY (PostID, UserID)
+		);
+		CREATE INDEX IF NOT EXISTS idx_llm_feedback_updateat ON LLM_Feedback(UpdateAt);
+	`); err != nil {
+		return fmt.Errorf("can't create llm feedback table: %w", err)
+	}
+
+	if _, err := p.db.Exec(`ALTER TABLE LLM_PostMeta ADD COLUMN IF NOT EXISTS Archived BOOLEAN NOT NULL DEFAULT FALSE;`); err != nil {
+		return fmt.Errorf("can't add archived column to llm postmeta table: %w", err)
+	}
+
 	// This fixes data retention issues when a post is deleted for an older version of the postmeta table.
 	// Migrate from the old table using `"INSERT INTO LLM_PostMeta(RootPostID, Title) SELECT RootPostID, Title from LLM_Threads"`
 	if _, err := p.db.Exec(`ALTER TABLE IF EXISTS LLM_Threads DROP CONSTRAINT IF EXISTS llm_threads_rootpostid_fkey;`); err != nil {
@@ -78,11 +183,11 @@ func (p *Plugin) SetupTables() error {
 }
 
 func (p *Plugin) saveTitleAsync(threadID, title string) {
-	go func() {
+	p.goBackground(func() {
 		if err := p.saveTitle(threadID, title); err != nil {
 			p.API.LogError("failed to save title: " + err.Error())
 		}
-	}()
+	})
 }
 
 func (p *Plugin) saveTitle(threadID, title string) error {
@@ -93,37 +198,133 @@ func (p *Plugin) saveTitle(threadID, title string) error {
 	return err
 }
 
+// getThreadTitle returns the title of a conversation, empty if it has none.
+func (p *Plugin) getThreadTitle(threadID string) (string, error) {
+	var titles []string
+	if err := p.doQuery(&titles, p.builder.
+		Select("Title").
+		From("LLM_PostMeta").
+		Where(sq.Eq{"RootPostID": threadID}),
+	); err != nil {
+		return "", fmt.Errorf("failed to get title: %w", err)
+	}
+	if len(titles) == 0 {
+		return "", nil
+	}
+	return titles[0], nil
+}
+
 type AIThread struct {
 	ID         string
 	Message    string
 	ChannelID  string
 	Title      string
 	ReplyCount int
+	CreateAt   int64
 	UpdateAt   int64
+	Archived   bool
 }
 
-func (p *Plugin) getAIThreads(dmChannelIDs []string) ([]AIThread, error) {
-	var posts []AIThread
-	if err := p.doQuery(&posts, p.builder.
+// AIThreadFilter restricts the conversations returned by getAIThreads.
+type AIThreadFilter struct {
+	ChannelIDs []string
+	// Search is matched against the titles and the messages of the conversations with full-text search.
+	Search string
+	// Since and Until bound when the conversations were started.
+	Since    int64
+	Until    int64
+	Archived bool
+}
+
+// aiThreadCursor points to the last conversation of a page. Conversations are ordered by when they were
+// started, newest first, and the ID breaks ties.
+type aiThreadCursor struct {
+	CreateAt int64
+	ID       string
+}
+
+func (c aiThreadCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.CreateAt, c.ID)))
+}
+
+func parseAIThreadCursor(cursor string) (aiThreadCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return aiThreadCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	createAt, id, ok := strings.Cut(string(decoded), ":")
+	if !ok || !model.IsValidId(id) {
+		return aiThreadCursor{}, errors.New("invalid cursor")
+	}
+	result := aiThreadCursor{ID: id}
+	if result.CreateAt, err = strconv.ParseInt(createAt, 10, 64); err != nil {
+		return aiThreadCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return result, nil
+}
+
+// getAIThreads returns a page of the conversations in the given DM channels, starting after the cursor if
+// there is one.
+func (p *Plugin) getAIThreads(filter AIThreadFilter, after *aiThreadCursor, limit int) ([]AIThread, error) {
+	query := p.builder.
 		Select(
 			"p.Id",
 			"p.Message",
 			"p.ChannelID",
 			"COALESCE(t.Title, '') as Title",
 			"(SELECT COUNT(*) FROM Posts WHERE Posts.RootId = p.Id AND DeleteAt = 0) AS ReplyCount",
+			"p.CreateAt",
 			"p.UpdateAt",
+			"COALESCE(t.Archived, FALSE) as Archived",
 		).
 		From("Posts as p").
-		Where(sq.Eq{"ChannelID": dmChannelIDs}).
-		Where(sq.Eq{"RootId": ""}).
-		Where(sq.Eq{"DeleteAt": 0}).
+		Where(sq.Eq{"p.ChannelID": filter.ChannelIDs}).
+		Where(sq.Eq{"p.RootId": ""}).
+		Where(sq.Eq{"p.DeleteAt": 0}).
+		Where(sq.Expr("COALESCE(t.Archived, FALSE) = ?", filter.Archived)).
 		LeftJoin("LLM_PostMeta as t ON t.RootPostID = p.Id").
-		OrderBy("CreateAt DESC").
-		Limit(60).
-		Offset(0),
-	); err != nil {
+		OrderBy("p.CreateAt DESC", "p.Id DESC").
+		Limit(uint64(limit))
+
+	if after != nil {
+		query = query.Where(sq.Or{
+			sq.Lt{"p.CreateAt": after.CreateAt},
+			sq.And{sq.Eq{"p.CreateAt": after.CreateAt}, sq.Lt{"p.Id": after.ID}},
+		})
+	}
+	if filter.Since != 0 {
+		query = query.Where(sq.GtOrEq{"p.CreateAt": filter.Since})
+	}
+	if filter.Until != 0 {
+		query = query.Where(sq.Lt{"p.CreateAt": filter.Until})
+	}
+	if filter.Search != "" {
+		// Matches the expression of the full-text index Mattermost keeps on the posts.
+		query = query.Where(sq.Or{
+			sq.Expr("to_tsvector('english', COALESCE(t.Title, '')) @@ plainto_tsquery('english', ?)", filter.Search),
+			sq.Expr("to_tsvector('english', p.Message) @@ plainto_tsquery('english', ?)", filter.Search),
+			sq.Expr("EXISTS (SELECT 1 FROM Posts AS r WHERE r.RootId = p.Id AND r.DeleteAt = 0 AND to_tsvector('english', r.Message) @@ plainto_tsquery('english', ?))", filter.Search),
+		})
+	}
+
+	var posts []AIThread
+	if err := p.doQuery(&posts, query); err != nil {
 		return nil, fmt.Errorf("failed to get posts for bot DM: %w", err)
 	}
 
 	return posts, nil
 }
+
+func (p *Plugin) setThreadArchived(threadID string, archived bool) error {
+	_, err := p.execBuilder(p.builder.Insert("LLM_PostMeta").
+		Columns("RootPostID", "Title", "Archived").
+		Values(threadID, "", archived).
+		Suffix("ON CONFLICT (RootPostID) DO UPDATE SET Archived = ?", archived))
+	return err
+}
+
+func (p *Plugin) deleteThreadMeta(threadID string) error {
+	_, err := p.execBuilder(p.builder.Delete("LLM_PostMeta").
+		Where(sq.Eq{"RootPostID": threadID}))
+	return err
+}
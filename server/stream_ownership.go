@@ -0,0 +1,149 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const ClusterEventStopPostStreaming = "stop_post_streaming"
+
+// errPostStreamLeaseLost cancels a stream whose post is no longer owned by this node.
+var errPostStreamLeaseLost = errors.New("post stream lease lost")
+
+// StreamInterruptedProp marks a post whose stream was cut off by its node going away.
+// The value tells if the partial response was kept and can be continued.
+const (
+	StreamInterruptedProp    = "llm_stream_interrupted"
+	StreamInterruptedPartial = "partial"
+	StreamInterruptedEmpty   = "empty"
+)
+
+// A node streaming to a post holds a lease on it in the database so no other node starts
+// a second stream to the same post. The lease expires if the node goes away mid-stream.
+const (
+	postStreamLeaseDuration      = time.Minute
+	postStreamLeaseRenewInterval = 20 * time.Second
+)
+
+func (p *Plugin) OnPluginClusterEvent(c *plugin.Context, ev model.PluginClusterEvent) {
+	switch ev.Id {
+	case ClusterEventStopPostStreaming:
+		p.stopLocalPostStreaming(string(ev.Data))
+	}
+}
+
+func (p *Plugin) acquirePostStreamLease(postID string) error {
+	now := model.GetMillis()
+	result, err := p.execBuilder(p.builder.Insert("LLM_PostStreams").
+		Columns("PostID", "NodeID", "ExpiresAt").
+		Values(postID, p.nodeID, now+postStreamLeaseDuration.Milliseconds()).
+		Suffix("ON CONFLICT (PostID) DO UPDATE SET NodeID = EXCLUDED.NodeID, ExpiresAt = EXCLUDED.ExpiresAt WHERE LLM_PostStreams.ExpiresAt < ?", now))
+	if err != nil {
+		return fmt.Errorf("unable to acquire post stream lease: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAlreadyStreamingToPost
+	}
+
+	return nil
+}
+
+// renewPostStreamLease keeps the lease of the stream until ctx is done. The stream is canceled with
+// errPostStreamLeaseLost if the lease expired and was swept or taken over by another node.
+func (p *Plugin) renewPostStreamLease(ctx context.Context, cancel context.CancelCauseFunc, postID string) {
+	ticker := time.NewTicker(postStreamLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := p.execBuilder(p.builder.Update("LLM_PostStreams").
+				Set("ExpiresAt", model.GetMillis()+postStreamLeaseDuration.Milliseconds()).
+				Where(sq.Eq{"PostID": postID, "NodeID": p.nodeID}))
+			if err != nil {
+				p.pluginAPI.Log.Warn("Unable to renew post stream lease", "post_id", postID, "error", err)
+				continue
+			}
+			if rows, _ := result.RowsAffected(); rows == 0 {
+				p.pluginAPI.Log.Warn("Lost the lease of a post stream", "post_id", postID)
+				cancel(errPostStreamLeaseLost)
+				return
+			}
+		}
+	}
+}
+
+func (p *Plugin) releasePostStreamLease(postID string) {
+	if _, err := p.execBuilder(p.builder.Delete("LLM_PostStreams").
+		Where(sq.Eq{"PostID": postID, "NodeID": p.nodeID})); err != nil {
+		p.pluginAPI.Log.Warn("Unable to release post stream lease", "post_id", postID, "error", err)
+	}
+}
+
+// runInterruptedStreamSweeper periodically looks for streams whose node stopped renewing the lease.
+func (p *Plugin) runInterruptedStreamSweeper(stop <-chan struct{}) {
+	ticker := time.NewTicker(postStreamLeaseDuration)
+	defer ticker.Stop()
+
+	for {
+		p.markInterruptedStreams()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// markInterruptedStreams flags the posts of abandoned streams so the requester can continue them.
+// The leases are deleted as they are claimed so only one node handles each post.
+func (p *Plugin) markInterruptedStreams() {
+	var postIDs []string
+	sqlString, args, err := p.builder.Delete("LLM_PostStreams").
+		Where(sq.Lt{"ExpiresAt": model.GetMillis()}).
+		Suffix("RETURNING PostID").
+		ToSql()
+	if err != nil {
+		p.pluginAPI.Log.Error("Failed to build interrupted streams query", "error", err)
+		return
+	}
+	if err := p.db.Select(&postIDs, sqlString, args...); err != nil {
+		p.pluginAPI.Log.Error("Failed to get interrupted streams", "error", err)
+		return
+	}
+
+	for _, postID := range postIDs {
+		post, err := p.pluginAPI.Post.GetPost(postID)
+		if err != nil {
+			p.pluginAPI.Log.Warn("Unable to get interrupted post", "post_id", postID, "error", err)
+			continue
+		}
+
+		locale := *p.API.GetConfig().LocalizationSettings.DefaultServerLocale
+		if requesterID, ok := post.GetProp(LLMRequesterUserID).(string); ok {
+			if requester, userErr := p.pluginAPI.User.Get(requesterID); userErr == nil {
+				locale = requester.Locale
+			}
+		}
+		T := i18nLocalizerFunc(p.i18n, locale)
+
+		markPostInterrupted(post, T("copilot.stream_interrupted", "_This response was interrupted before it was finished._"))
+		if err := p.pluginAPI.Post.UpdatePost(post); err != nil {
+			p.pluginAPI.Log.Warn("Unable to mark post as interrupted", "post_id", postID, "error", err)
+			continue
+		}
+		p.sendPostStreamingControlEvent(post, PostStreamingControlEnd)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopPostStreaming(t *testing.T) {
+	setupStream := func(e *TestEnvironment, postID string) context.Context {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		e.plugin.streamingContexts = map[string]PostStreamContext{
+			postID: {cancel: cancel},
+		}
+		return ctx
+	}
+
+	t.Run("stop publishes to the other nodes", func(t *testing.T) {
+		e := SetupTestEnvironment(t)
+		defer e.Cleanup(t)
+
+		ctx := setupStream(e, "postid")
+		e.mockAPI.On("PublishPluginClusterEvent", model.PluginClusterEvent{
+			Id:   ClusterEventStopPostStreaming,
+			Data: []byte("postid"),
+		}, mock.Anything).Return(nil)
+
+		e.plugin.stopPostStreaming("postid")
+
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+		require.NotContains(t, e.plugin.streamingContexts, "postid")
+	})
+
+	t.Run("cluster event stops the local stream", func(t *testing.T) {
+		e := SetupTestEnvironment(t)
+		defer e.Cleanup(t)
+
+		ctx := setupStream(e, "postid")
+		e.plugin.OnPluginClusterEvent(nil, model.PluginClusterEvent{
+			Id:   ClusterEventStopPostStreaming,
+			Data: []byte("otherpostid"),
+		})
+		require.NoError(t, ctx.Err())
+
+		e.plugin.OnPluginClusterEvent(nil, model.PluginClusterEvent{
+			Id:   ClusterEventStopPostStreaming,
+			Data: []byte("postid"),
+		})
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
+
+func TestStreamLeaseLost(t *testing.T) {
+	e := SetupTestEnvironment(t)
+	defer e.Cleanup(t)
+	e.plugin.i18n = i18nInit()
+	e.mockAPI.On("PublishWebSocketEvent", "postupdate", mock.Anything, mock.Anything)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errPostStreamLeaseLost)
+
+	post := &model.Post{Id: "postid", ChannelId: "channelid", Message: "Partial answer"}
+	stream := &llm.TextStreamResult{Stream: make(chan string), Err: make(chan error)}
+	err := e.plugin.streamResultToPost(ctx, stream, post, "en")
+
+	require.ErrorIs(t, err, errPostStreamLeaseLost)
+	e.mockAPI.AssertNotCalled(t, "UpdatePost", mock.Anything)
+}
@@ -39,7 +39,7 @@ func (p *Plugin) analyzeThread(bot *Bot, postIDToAnalyze string, analysisType st
 	if err != nil {
 		return nil, err
 	}
-	analysisStream, err := p.getLLM(bot.cfg).ChatCompletion(prompt)
+	analysisStream, err := p.getLLM(bot.cfg).ChatCompletion(prompt, llm.WithTask(bot.cfg, llm.TaskThreadAnalysis))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,254 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Formats a conversation can be exported to.
+const (
+	ThreadExportFormatMarkdown = "markdown"
+	ThreadExportFormatJSON     = "json"
+	ThreadExportFormatHTML     = "html"
+)
+
+// Roles of the authors of exported messages.
+const (
+	ExportRoleUser      = "user"
+	ExportRoleAssistant = "assistant"
+)
+
+const threadExportTimeFormat = "2006-01-02 15:04 MST"
+
+var threadExportContentTypes = map[string]string{
+	ThreadExportFormatMarkdown: "text/markdown; charset=utf-8",
+	ThreadExportFormatJSON:     "application/json",
+	ThreadExportFormatHTML:     "text/html; charset=utf-8",
+}
+
+var threadExportExtensions = map[string]string{
+	ThreadExportFormatMarkdown: "md",
+	ThreadExportFormatJSON:     "json",
+	ThreadExportFormatHTML:     "html",
+}
+
+// ThreadExport is a conversation as it is exported, independent of the format.
+type ThreadExport struct {
+	ThreadID   string            `json:"thread_id"`
+	ChannelID  string            `json:"channel_id"`
+	Title      string            `json:"title"`
+	ExportedAt int64             `json:"exported_at"`
+	Messages   []ExportedMessage `json:"messages"`
+}
+
+type ExportedMessage struct {
+	ID          string         `json:"id"`
+	Role        string         `json:"role"`
+	UserID      string         `json:"user_id"`
+	Username    string         `json:"username"`
+	DisplayName string         `json:"display_name"`
+	CreateAt    int64          `json:"create_at"`
+	Message     string         `json:"message"`
+	ToolCalls   []string       `json:"tool_calls,omitempty"`
+	Files       []ExportedFile `json:"files,omitempty"`
+}
+
+type ExportedFile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// buildThreadExport reconstructs the thread of rootID. Tool calls come from the audit log, so they are
+// only known for requests made while it was enabled.
+func (p *Plugin) buildThreadExport(rootID string) (*ThreadExport, error) {
+	threadData, err := p.getThreadAndMeta(rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	if len(threadData.Posts) == 0 {
+		return nil, fmt.Errorf("thread %s has no posts", rootID)
+	}
+
+	title, err := p.getThreadTitle(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	postIDs := make([]string, 0, len(threadData.Posts))
+	for _, post := range threadData.Posts {
+		postIDs = append(postIDs, post.Id)
+	}
+	toolsByRequest := map[string][]string{}
+	if p.getConfiguration().EnableAuditLog {
+		if toolsByRequest, err = p.getToolsUsedByPost(postIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	export := &ThreadExport{
+		ThreadID:   rootID,
+		ChannelID:  threadData.Posts[0].ChannelId,
+		Title:      title,
+		ExportedAt: model.GetMillis(),
+		Messages:   make([]ExportedMessage, 0, len(threadData.Posts)),
+	}
+
+	// Tools are recorded against the request and belong to the response that follows it.
+	var pendingTools []string
+	for _, post := range threadData.Posts {
+		message := ExportedMessage{
+			ID:       post.Id,
+			Role:     ExportRoleUser,
+			UserID:   post.UserId,
+			CreateAt: post.CreateAt,
+			Message:  post.Message,
+		}
+		if user := threadData.UsersByID[post.UserId]; user != nil {
+			message.Username = user.Username
+			message.DisplayName = user.GetDisplayName(model.ShowNicknameFullName)
+		}
+
+		if p.IsAnyBot(post.UserId) {
+			message.Role = ExportRoleAssistant
+			message.ToolCalls = pendingTools
+			pendingTools = nil
+		} else {
+			pendingTools = append(pendingTools, toolsByRequest[post.Id]...)
+		}
+
+		for _, fileID := range post.FileIds {
+			fileInfo, err := p.pluginAPI.File.GetInfo(fileID)
+			if err != nil {
+				p.pluginAPI.Log.Warn("Unable to get file of exported post", "file_id", fileID, "error", err)
+				continue
+			}
+			message.Files = append(message.Files, ExportedFile{
+				ID:       fileInfo.Id,
+				Name:     fileInfo.Name,
+				MimeType: fileInfo.MimeType,
+				Size:     fileInfo.Size,
+			})
+		}
+
+		export.Messages = append(export.Messages, message)
+	}
+
+	return export, nil
+}
+
+// Render returns the export in the given format.
+func (e *ThreadExport) Render(format string) ([]byte, error) {
+	switch format {
+	case ThreadExportFormatMarkdown:
+		return []byte(e.markdown()), nil
+	case ThreadExportFormatJSON:
+		return json.MarshalIndent(e, "", "  ")
+	case ThreadExportFormatHTML:
+		var buf bytes.Buffer
+		if err := threadExportHTMLTemplate.Execute(&buf, e); err != nil {
+			return nil, fmt.Errorf("failed to render conversation: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// DisplayTitle returns the title of the conversation, or a generic one if it has none.
+func (e *ThreadExport) DisplayTitle() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return "Conversation"
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Filename returns a name for the export file based on the title of the conversation.
+func (e *ThreadExport) Filename(format string) string {
+	name := strings.Trim(unsafeFilenameCharacters.ReplaceAllString(strings.ToLower(e.DisplayTitle()), "-"), "-")
+	if name == "" {
+		name = "conversation"
+	}
+	return name + "." + threadExportExtensions[format]
+}
+
+func formatExportTime(millis int64) string {
+	return time.UnixMilli(millis).UTC().Format(threadExportTimeFormat)
+}
+
+// Author returns the most readable name known for the author of the message.
+func (m ExportedMessage) Author() string {
+	if m.DisplayName != "" {
+		return m.DisplayName
+	}
+	if m.Username != "" {
+		return m.Username
+	}
+	return m.UserID
+}
+
+func (e *ThreadExport) markdown() string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "# %s\n\n", e.DisplayTitle())
+	fmt.Fprintf(&result, "_Exported on %s_\n", formatExportTime(e.ExportedAt))
+
+	for _, message := range e.Messages {
+		fmt.Fprintf(&result, "\n---\n\n**%s** (%s) · %s\n\n", message.Author(), message.Role, formatExportTime(message.CreateAt))
+		if len(message.ToolCalls) > 0 {
+			fmt.Fprintf(&result, "_Tools used: %s_\n\n", strings.Join(message.ToolCalls, ", "))
+		}
+		result.WriteString(message.Message)
+		result.WriteString("\n")
+		for _, file := range message.Files {
+			fmt.Fprintf(&result, "\n- Attachment: %s (%s, %d bytes)", file.Name, file.MimeType, file.Size)
+		}
+		if len(message.Files) > 0 {
+			result.WriteString("\n")
+		}
+	}
+
+	return result.String()
+}
+
+var threadExportHTMLTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"time": formatExportTime,
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.DisplayTitle}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; max-width: 800px; margin: 40px auto; padding: 0 16px; color: #3f4350; }
+.meta { color: #6b6f78; font-size: 13px; }
+.message { border-top: 1px solid #e0e1e3; padding: 16px 0; }
+.message.assistant { background: #f7f8fa; padding: 16px; }
+.author { font-weight: 600; }
+.content { white-space: pre-wrap; margin-top: 8px; }
+ul { margin: 8px 0 0; }
+</style>
+</head>
+<body>
+<h1>{{.DisplayTitle}}</h1>
+<p class="meta">Exported on {{time .ExportedAt}}</p>
+{{range .Messages}}<div class="message {{.Role}}">
+<div><span class="author">{{.Author}}</span> <span class="meta">{{.Role}} · {{time .CreateAt}}</span></div>
+{{if .ToolCalls}}<div class="meta">Tools used: {{join .ToolCalls ", "}}</div>
+{{end}}<div class="content">{{.Message}}</div>
+{{if .Files}}<ul>{{range .Files}}<li>{{.Name}} ({{.MimeType}}, {{.Size}} bytes)</li>{{end}}</ul>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,75 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadExportRender(t *testing.T) {
+	export := &ThreadExport{
+		ThreadID:   "threadid",
+		ChannelID:  "channelid",
+		Title:      "Deploy <plan> for Q3?",
+		ExportedAt: 1700000000000,
+		Messages: []ExportedMessage{
+			{
+				ID:          "post1",
+				Role:        ExportRoleUser,
+				UserID:      "userid",
+				Username:    "alice",
+				DisplayName: "Alice Smith",
+				CreateAt:    1699999990000,
+				Message:     "How do we <script>deploy</script>?",
+				Files:       []ExportedFile{{ID: "fileid", Name: "plan.pdf", MimeType: "application/pdf", Size: 1024}},
+			},
+			{
+				ID:        "post2",
+				Role:      ExportRoleAssistant,
+				UserID:    "botid",
+				Username:  "ai",
+				CreateAt:  1699999995000,
+				Message:   "Use the pipeline.",
+				ToolCalls: []string{"SearchServer"},
+			},
+		},
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		rendered, err := export.Render(ThreadExportFormatMarkdown)
+		require.NoError(t, err)
+		require.Contains(t, string(rendered), "# Deploy <plan> for Q3?")
+		require.Contains(t, string(rendered), "**Alice Smith** (user) · 2023-11-14 22:13 UTC")
+		require.Contains(t, string(rendered), "- Attachment: plan.pdf (application/pdf, 1024 bytes)")
+		require.Contains(t, string(rendered), "_Tools used: SearchServer_")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rendered, err := export.Render(ThreadExportFormatJSON)
+		require.NoError(t, err)
+		var decoded ThreadExport
+		require.NoError(t, json.Unmarshal(rendered, &decoded))
+		require.Equal(t, *export, decoded)
+	})
+
+	t.Run("html is escaped", func(t *testing.T) {
+		rendered, err := export.Render(ThreadExportFormatHTML)
+		require.NoError(t, err)
+		require.Contains(t, string(rendered), "<title>Deploy &lt;plan&gt; for Q3?</title>")
+		require.Contains(t, string(rendered), "How do we &lt;script&gt;deploy&lt;/script&gt;?")
+		require.NotContains(t, string(rendered), "<script>")
+		require.Contains(t, string(rendered), "Tools used: SearchServer")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := export.Render("pdf")
+		require.Error(t, err)
+	})
+
+	require.Equal(t, "deploy-plan-for-q3.html", export.Filename(ThreadExportFormatHTML))
+	require.Equal(t, "conversation.md", (&ThreadExport{Title: "???"}).Filename(ThreadExportFormatMarkdown))
+}
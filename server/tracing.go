@@ -0,0 +1,204 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracingShutdownTimeout = 5 * time.Second
+
+// configureTracing exports spans to the configured OTLP endpoint, or drops them if tracing is disabled.
+// The exporter is only rebuilt when the endpoint changes.
+func (p *Plugin) configureTracing(cfg Config) error {
+	endpoint := ""
+	if cfg.EnableTracing {
+		endpoint = cfg.TracingEndpoint
+	}
+
+	p.tracingLock.Lock()
+	defer p.tracingLock.Unlock()
+
+	if p.tracerProvider != nil && endpoint == p.tracingEndpoint {
+		return nil
+	}
+	if p.tracerProvider == nil && endpoint == "" {
+		return nil
+	}
+
+	var provider *sdktrace.TracerProvider
+	if endpoint != "" {
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+		if err != nil {
+			return fmt.Errorf("unable to create tracing exporter: %w", err)
+		}
+		provider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+				semconv.ServiceName(manifest.Id),
+				semconv.ServiceVersion(manifest.Version),
+				semconv.ServiceInstanceID(p.nodeID),
+			)),
+		)
+		otel.SetTracerProvider(provider)
+	} else {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}
+
+	p.shutdownTracerProvider()
+	p.tracerProvider = provider
+	p.tracingEndpoint = endpoint
+
+	return nil
+}
+
+// shutdownTracerProvider flushes the pending spans. Must be called with the tracing lock held.
+func (p *Plugin) shutdownTracerProvider() {
+	if p.tracerProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := p.tracerProvider.Shutdown(ctx); err != nil {
+		p.pluginAPI.Log.Warn("Failed to flush traces", "error", err)
+	}
+	p.tracerProvider = nil
+}
+
+// stopTracing flushes the pending spans and stops tracing.
+func (p *Plugin) stopTracing() {
+	p.tracingLock.Lock()
+	defer p.tracingLock.Unlock()
+
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	p.shutdownTracerProvider()
+	p.tracingEndpoint = ""
+}
+
+// tracingMiddleware starts a span for every API request. Handlers find it in the request context.
+func (p *Plugin) tracingMiddleware(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	ctx, span := llm.Tracer().Start(c.Request.Context(), c.Request.Method+" "+route, trace.WithAttributes(
+		attribute.String("http.request.method", c.Request.Method),
+		attribute.String("http.route", route),
+		attribute.String("user.id", c.GetHeader("Mattermost-User-Id")),
+	), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if postID := c.Param("postid"); postID != "" {
+		span.SetAttributes(attribute.String("post.id", postID))
+	}
+	if channelID := c.Param("channelid"); channelID != "" {
+		span.SetAttributes(attribute.String("channel.id", channelID))
+	}
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.String("http.response.status_code", strconv.Itoa(status)))
+	if status >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+}
+
+// LLMTracingWrapper records a span for every request to a language model, lasting until the response is complete.
+type LLMTracingWrapper struct {
+	wrapped     llm.LanguageModel
+	botName     string
+	serviceType string
+}
+
+func NewLLMTracingWrapper(wrapped llm.LanguageModel, botConfig llm.BotConfig) *LLMTracingWrapper {
+	return &LLMTracingWrapper{
+		wrapped:     wrapped,
+		botName:     botConfig.Name,
+		serviceType: botConfig.Service.Type,
+	}
+}
+
+// startSpan starts the span of a request. Tools called while handling the request are traced under it.
+func (w *LLMTracingWrapper) startSpan(name string, conversation *llm.BotConversation, opts []llm.LanguageModelOption) trace.Span {
+	cfg := configFromOptions(opts)
+	attributes := []attribute.KeyValue{
+		attribute.String("llm.bot", w.botName),
+		attribute.String("llm.service_type", w.serviceType),
+		attribute.String("llm.model", cfg.Model),
+		attribute.String("llm.operation", cfg.Operation),
+	}
+	if conversation.Context.RequestingUser != nil {
+		attributes = append(attributes, attribute.String("user.id", conversation.Context.RequestingUser.Id))
+	}
+	if conversation.Context.Post != nil {
+		attributes = append(attributes, attribute.String("post.id", conversation.Context.Post.Id))
+	}
+
+	ctx, span := llm.Tracer().Start(conversation.Context.TraceContext(), name, trace.WithAttributes(attributes...), trace.WithSpanKind(trace.SpanKindClient))
+	conversation.Context = conversation.Context.WithTraceContext(ctx)
+	return span
+}
+
+func (w *LLMTracingWrapper) ChatCompletion(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (*llm.TextStreamResult, error) {
+	span := w.startSpan("LanguageModel.ChatCompletion", &conversation, opts)
+
+	result, err := w.wrapped.ChatCompletion(conversation, opts...)
+	if err != nil {
+		llm.EndSpan(span, err)
+		return nil, err
+	}
+
+	var streamErr error
+	receivedFirstToken := false
+	return result.Observe(llm.StreamObserver{
+		OnText: func(text string) {
+			if !receivedFirstToken && text != "" {
+				receivedFirstToken = true
+				span.AddEvent("first_token")
+			}
+		},
+		OnError: func(err error) {
+			streamErr = err
+		},
+		OnDone: func() {
+			llm.EndSpan(span, streamErr)
+		},
+	}), nil
+}
+
+func (w *LLMTracingWrapper) ChatCompletionNoStream(conversation llm.BotConversation, opts ...llm.LanguageModelOption) (string, error) {
+	span := w.startSpan("LanguageModel.ChatCompletionNoStream", &conversation, opts)
+
+	response, err := w.wrapped.ChatCompletionNoStream(conversation, opts...)
+	llm.EndSpan(span, err)
+
+	return response, err
+}
+
+func (w *LLMTracingWrapper) CountTokens(text string) int {
+	return w.wrapped.CountTokens(text)
+}
+
+func (w *LLMTracingWrapper) InputTokenLimit() int {
+	return w.wrapped.InputTokenLimit()
+}
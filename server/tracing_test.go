@@ -0,0 +1,58 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestLLMTracingWrapper(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	tools := llm.NewNoTools()
+	tools.AddTools([]llm.Tool{{
+		Name: "lookup",
+		Resolver: func(context llm.ConversationContext, argsGetter llm.ToolArgumentGetter) (string, error) {
+			return "secret tool output", nil
+		},
+	}})
+
+	parentCtx, parent := llm.Tracer().Start(context.Background(), "handleMessages")
+	conversationContext := llm.NewConversationContext("botid", &model.User{Id: "userid"}, &model.Channel{Id: "channelid"}, &model.Post{Id: "postid", Message: "secret question"})
+	conversation := llm.BotConversation{
+		Posts:   []llm.Post{{Role: llm.PostRoleUser, Message: "secret question"}},
+		Tools:   tools,
+		Context: conversationContext.WithTraceContext(parentCtx),
+	}
+
+	wrapper := NewLLMTracingWrapper(newScriptedLanguageModel(scriptedTurn{Response: "secret answer", Tool: "lookup"}), llm.BotConfig{Name: "ai", Service: llm.ServiceConfig{Type: "openai"}})
+	response, err := wrapper.ChatCompletionNoStream(conversation, llm.WithOperation(llm.OperationChat))
+	require.NoError(t, err)
+	require.Equal(t, "secret answer secret tool output", response)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		for _, attr := range span.Attributes() {
+			require.NotContains(t, attr.Value.Emit(), "secret", "span %s leaks content in %s", span.Name(), attr.Key)
+		}
+	}
+	require.Len(t, spans, 3)
+
+	llmSpan := spans["LanguageModel.ChatCompletionNoStream"]
+	require.Equal(t, parent.SpanContext().SpanID(), llmSpan.Parent().SpanID())
+	require.Equal(t, llmSpan.SpanContext().SpanID(), spans["ToolStore.ResolveTool"].Parent().SpanID())
+}
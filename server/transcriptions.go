@@ -4,11 +4,243 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mattermost/mattermost-plugin-ai/server/llm"
 	"github.com/mattermost/mattermost-plugin-ai/server/llm/subtitles"
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 type Transcriber interface {
 	Transcribe(file io.Reader) (*subtitles.Subtitles, error)
 }
+
+// serviceSupportsTranscription reports if getTranscribe can create a Transcriber for the service type.
+func serviceSupportsTranscription(serviceType string) bool {
+	switch serviceType {
+	case llm.ServiceTypeOpenAI, llm.ServiceTypeOpenAICompatible, llm.ServiceTypeAzure:
+		return true
+	}
+	return false
+}
+
+const (
+	// At 32kbps mono a 20 minute segment is around 5MB, well under the Whisper API limit.
+	TranscriptionSegmentMaxDuration = 20 * time.Minute
+	// How far back from the maximum segment end to look for silence to cut at.
+	TranscriptionSegmentSilenceWindow  = 2 * time.Minute
+	MaxConcurrentSegmentTranscriptions = 3
+	TranscriptionSegmentAttempts       = 2
+	MissingTranscriptionText           = "[Transcription unavailable for this part of the recording]"
+)
+
+type audioSegment struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (s audioSegment) String() string {
+	return subtitles.FormatTimestamp(s.Start) + " to " + subtitles.FormatTimestamp(s.End)
+}
+
+var (
+	ffmpegDurationRegex     = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	ffmpegSilenceStartRegex = regexp.MustCompile(`silence_start: (-?\d+(?:\.\d+)?)`)
+	ffmpegSilenceEndRegex   = regexp.MustCompile(`silence_end: (\d+(?:\.\d+)?)`)
+)
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// parseFFmpegDuration extracts the input duration from ffmpeg's stderr output.
+func parseFFmpegDuration(output string) (time.Duration, error) {
+	match := ffmpegDurationRegex.FindStringSubmatch(output)
+	if match == nil {
+		return 0, errors.New("duration not found in ffmpeg output")
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + secondsToDuration(seconds), nil
+}
+
+// parseSilenceMidpoints extracts the middle of each silence reported by ffmpeg's silencedetect filter.
+func parseSilenceMidpoints(output string) []time.Duration {
+	var midpoints []time.Duration
+	var start float64
+	inSilence := false
+	for _, line := range strings.Split(output, "\n") {
+		if match := ffmpegSilenceStartRegex.FindStringSubmatch(line); match != nil {
+			start, _ = strconv.ParseFloat(match[1], 64)
+			inSilence = true
+			continue
+		}
+		if match := ffmpegSilenceEndRegex.FindStringSubmatch(line); match != nil && inSilence {
+			end, _ := strconv.ParseFloat(match[1], 64)
+			midpoints = append(midpoints, secondsToDuration((max(start, 0)+end)/2))
+			inSilence = false
+		}
+	}
+	return midpoints
+}
+
+// planAudioSegments splits the audio into segments no longer than maxDuration. Where possible segments are
+// cut at a silence in the window before the maximum end so that words are not split between segments.
+// silences must be sorted in ascending order.
+func planAudioSegments(total time.Duration, silences []time.Duration, maxDuration, window time.Duration) []audioSegment {
+	var segments []audioSegment
+	start := time.Duration(0)
+	for total-start > maxDuration {
+		limit := start + maxDuration
+		cut := limit
+		for _, silence := range silences {
+			if silence > limit {
+				break
+			}
+			if silence > start && silence >= limit-window {
+				cut = silence
+			}
+		}
+		segments = append(segments, audioSegment{Start: start, End: cut})
+		start = cut
+	}
+	return append(segments, audioSegment{Start: start, End: total})
+}
+
+func (p *Plugin) runFFmpeg(ctx context.Context, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := p.ffmpegCommand(ctx, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		p.pluginAPI.Log.Debug("ffmpeg stderr: " + stderr.String())
+		return nil, nil, fmt.Errorf("error running ffmpeg: %w", err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
+
+func formatFFmpegSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// transcribeRecordingInSegments splits a recording into segments small enough for a single transcription request
+// at silence boundaries, transcribes them concurrently and stitches the results back together.
+func (p *Plugin) transcribeRecordingInSegments(ctx context.Context, recording io.Reader) (*subtitles.Subtitles, []audioSegment, error) {
+	// ffmpeg needs a seekable input to extract segments
+	recordingFile, err := os.CreateTemp("", "recording-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create temporary recording file: %w", err)
+	}
+	defer os.Remove(recordingFile.Name())
+	defer recordingFile.Close()
+
+	if _, err = io.Copy(recordingFile, recording); err != nil {
+		return nil, nil, fmt.Errorf("unable to write temporary recording file: %w", err)
+	}
+
+	_, silenceOutput, err := p.runFFmpeg(ctx, "-i", recordingFile.Name(), "-vn", "-af", "silencedetect=noise=-30dB:d=0.5", "-f", "null", "-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to detect silences: %w", err)
+	}
+	total, err := parseFFmpegDuration(string(silenceOutput))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to determine recording duration: %w", err)
+	}
+	segments := planAudioSegments(total, parseSilenceMidpoints(string(silenceOutput)), TranscriptionSegmentMaxDuration, TranscriptionSegmentSilenceWindow)
+	p.pluginAPI.Log.Debug("Transcribing recording in segments", "segments", len(segments), "duration", total.String())
+
+	transcriber := p.getTranscribe()
+	if transcriber == nil {
+		return nil, nil, errors.New("no transcription service configured")
+	}
+
+	results := make([]*subtitles.Subtitles, len(segments))
+	semaphore := make(chan struct{}, MaxConcurrentSegmentTranscriptions)
+	var wg sync.WaitGroup
+	for i, segment := range segments {
+		wg.Add(1)
+		go func(i int, segment audioSegment) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			for attempt := 1; attempt <= TranscriptionSegmentAttempts && ctx.Err() == nil; attempt++ {
+				transcription, err := p.transcribeSegment(ctx, transcriber, recordingFile.Name(), segment)
+				if err == nil {
+					results[i] = transcription
+					return
+				}
+				p.pluginAPI.Log.Warn("Failed to transcribe recording segment", "segment", segment.String(), "attempt", attempt, "error", err)
+			}
+		}(i, segment)
+	}
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	transcription := subtitles.NewEmptySubtitles()
+	var missing []audioSegment
+	for i, segment := range segments {
+		if results[i] == nil {
+			missing = append(missing, segment)
+			transcription.AppendText(segment.Start, segment.End, MissingTranscriptionText)
+			continue
+		}
+		transcription.Append(results[i], segment.Start)
+	}
+
+	if len(missing) == len(segments) {
+		return nil, nil, errors.New("unable to transcribe any segment of the recording")
+	}
+
+	return transcription, missing, nil
+}
+
+func (p *Plugin) transcribeSegment(ctx context.Context, transcriber Transcriber, recordingPath string, segment audioSegment) (*subtitles.Subtitles, error) {
+	audio, _, err := p.runFFmpeg(
+		ctx,
+		"-ss", formatFFmpegSeconds(segment.Start),
+		"-t", formatFFmpegSeconds(segment.End-segment.Start),
+		"-i", recordingPath,
+		"-vn", "-ac", "1", "-b:a", "32k", "-ar", "16000", "-f", "mp3", "pipe:1",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract segment audio: %w", err)
+	}
+	if len(audio) > WhisperAPILimit {
+		return nil, fmt.Errorf("segment audio is %d bytes, larger than the transcription limit", len(audio))
+	}
+
+	return transcriber.Transcribe(bytes.NewReader(audio))
+}
+
+// reportMissingSegments lets the requesting user know which parts of a recording could not be transcribed.
+func (p *Plugin) reportMissingSegments(bot *Bot, requestingUser *model.User, rootID string, missing []audioSegment) {
+	T := i18nLocalizerFunc(p.i18n, requestingUser.Locale)
+	ranges := make([]string, 0, len(missing))
+	for _, segment := range missing {
+		ranges = append(ranges, "- "+segment.String())
+	}
+
+	warningPost := &model.Post{
+		RootId:  rootID,
+		Message: T("copilot.transcription_missing_segments", "Some parts of the recording could not be transcribed and will be missing from the summary:\n%s", strings.Join(ranges, "\n")),
+	}
+	warningPost.AddProp(NoRegen, "true")
+	if err := p.botDM(bot.mmBot.UserId, requestingUser.Id, warningPost); err != nil {
+		p.API.LogError("Failed to report missing transcription segments", "error", err)
+	}
+}
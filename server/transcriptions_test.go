@@ -0,0 +1,79 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSilenceDetectOutput = `Input #0, matroska,webm, from 'recording.webm':
+  Duration: 01:05:30.50, start: 0.000000, bitrate: 120 kb/s
+[silencedetect @ 0x55d5] silence_start: -0.01
+[silencedetect @ 0x55d5] silence_end: 1.5 | silence_duration: 1.51
+[silencedetect @ 0x55d5] silence_start: 1150
+[silencedetect @ 0x55d5] silence_end: 1152 | silence_duration: 2
+[silencedetect @ 0x55d5] silence_start: 2390.5
+[silencedetect @ 0x55d5] silence_end: 2391.5 | silence_duration: 1
+size=N/A time=01:05:30.50 bitrate=N/A speed= 500x`
+
+func TestParseFFmpegOutput(t *testing.T) {
+	duration, err := parseFFmpegDuration(testSilenceDetectOutput)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour+5*time.Minute+30*time.Second+500*time.Millisecond, duration)
+
+	_, err = parseFFmpegDuration("no duration here")
+	require.Error(t, err)
+
+	require.Equal(t, []time.Duration{
+		750 * time.Millisecond,
+		1151 * time.Second,
+		2391 * time.Second,
+	}, parseSilenceMidpoints(testSilenceDetectOutput))
+}
+
+func TestPlanAudioSegments(t *testing.T) {
+	for name, test := range map[string]struct {
+		total    time.Duration
+		silences []time.Duration
+		expected []audioSegment
+	}{
+		"short recording is a single segment": {
+			total:    10 * time.Minute,
+			expected: []audioSegment{{Start: 0, End: 10 * time.Minute}},
+		},
+		"cut at silences inside the window": {
+			total:    50 * time.Minute,
+			silences: []time.Duration{5 * time.Minute, 19 * time.Minute, 37 * time.Minute},
+			expected: []audioSegment{
+				{Start: 0, End: 19 * time.Minute},
+				{Start: 19 * time.Minute, End: 37 * time.Minute},
+				{Start: 37 * time.Minute, End: 50 * time.Minute},
+			},
+		},
+		"latest silence in the window wins": {
+			total:    30 * time.Minute,
+			silences: []time.Duration{18*time.Minute + 30*time.Second, 19 * time.Minute, 21 * time.Minute},
+			expected: []audioSegment{
+				{Start: 0, End: 19 * time.Minute},
+				{Start: 19 * time.Minute, End: 30 * time.Minute},
+			},
+		},
+		"hard cut without silence": {
+			total:    45 * time.Minute,
+			silences: []time.Duration{time.Minute},
+			expected: []audioSegment{
+				{Start: 0, End: 20 * time.Minute},
+				{Start: 20 * time.Minute, End: 40 * time.Minute},
+				{Start: 40 * time.Minute, End: 45 * time.Minute},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, planAudioSegments(test.total, test.silences, 20*time.Minute, 2*time.Minute))
+		})
+	}
+}
@@ -126,12 +126,168 @@ export async function doRegenerate(postid: string) {
     });
 }
 
-export async function doPostbackSummary(postid: string) {
-    const url = `${postRoute(postid)}/postback_summary`;
+export async function doContinue(postid: string) {
+    const url = `${postRoute(postid)}/continue`;
     const response = await fetch(url, Client4.getOptions({
         method: 'POST',
     }));
 
+    if (response.ok) {
+        return;
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function doSelectResponseVersion(postid: string, version: number) {
+    const url = `${postRoute(postid)}/versions/${version}/select`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export type Feedback = {rating: '' | 'up' | 'down', comment: string};
+
+const noFeedback: Feedback = {rating: '', comment: ''};
+
+export async function getFeedbackForPosts(postids: string[]): Promise<Record<string, Feedback>> {
+    const url = `${baseRoute()}/feedback/ids`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify({post_ids: postids}),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+// The server accepts at most this many posts per request.
+const feedbackBatchSize = 200;
+
+type FeedbackRequest = {
+    postid: string;
+    resolve: (feedback: Feedback) => void;
+    reject: (error: unknown) => void;
+};
+
+let pendingFeedbackRequests: FeedbackRequest[] = [];
+
+function flushFeedbackRequests() {
+    const requests = pendingFeedbackRequests;
+    pendingFeedbackRequests = [];
+
+    const postids = Array.from(new Set(requests.map((request) => request.postid)));
+    for (let i = 0; i < postids.length; i += feedbackBatchSize) {
+        const batchPostids = postids.slice(i, i + feedbackBatchSize);
+        const batch = requests.filter((request) => batchPostids.includes(request.postid));
+        getFeedbackForPosts(batchPostids).then((feedback) => {
+            batch.forEach((request) => request.resolve(feedback[request.postid] ?? noFeedback));
+        }).catch((error) => {
+            batch.forEach((request) => request.reject(error));
+        });
+    }
+}
+
+// getFeedback returns the rating of the current user on a response. Posts rendered together have their
+// feedback fetched in a single request.
+export function getFeedback(postid: string): Promise<Feedback> {
+    return new Promise((resolve, reject) => {
+        pendingFeedbackRequests.push({postid, resolve, reject});
+        if (pendingFeedbackRequests.length === 1) {
+            setTimeout(flushFeedbackRequests, 0);
+        }
+    });
+}
+
+export async function saveFeedback(postid: string, rating: 'up' | 'down', comment: string) {
+    const url = `${postRoute(postid)}/feedback`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify({rating, comment}),
+    }));
+
+    if (response.ok) {
+        return;
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function deleteFeedback(postid: string) {
+    const url = `${postRoute(postid)}/feedback`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'DELETE',
+    }));
+
+    if (response.ok) {
+        return;
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export interface PostbackTarget {
+    channel_id: string;
+    root_id: string;
+}
+
+export async function getPostbackTarget(postid: string): Promise<PostbackTarget> {
+    const url = `${postRoute(postid)}/postback`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'GET',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+// doPostback shares a bot response. Without a target it goes to the channel or thread the response is about.
+export async function doPostback(postid: string, target?: PostbackTarget, message?: string) {
+    const url = `${postRoute(postid)}/postback`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify({
+            ...target,
+            message: message ?? '',
+        }),
+    }));
+
     if (response.ok) {
         return response.json();
     }
@@ -179,8 +335,23 @@ export async function getBotDirectChannel(currentUserId: string, botUserID: stri
     return dm.id;
 }
 
-export async function getAIThreads() {
-    const url = `${baseRoute()}/ai_threads`;
+export type AIThreadsQuery = {
+    cursor?: string
+    search?: string
+    bot?: string
+    archived?: boolean
+    since?: number
+    until?: number
+}
+
+export async function getAIThreads(query: AIThreadsQuery = {}) {
+    const params = new URLSearchParams();
+    Object.entries(query).forEach(([key, value]) => {
+        if (value !== undefined && value !== '') {
+            params.set(key, String(value));
+        }
+    });
+    const url = `${baseRoute()}/ai_threads?${params.toString()}`;
     const response = await fetch(url, Client4.getOptions({
         method: 'GET',
     }));
@@ -196,6 +367,69 @@ export async function getAIThreads() {
     });
 }
 
+export function threadExportURL(postID: string, format: string, botUsername: string) {
+    return `${postRoute(postID)}/export?format=${encodeURIComponent(format)}&botUsername=${encodeURIComponent(botUsername)}`;
+}
+
+export async function attachThreadExport(postID: string, format: string, botUsername: string) {
+    const url = `${postRoute(postID)}/export/attach?botUsername=${encodeURIComponent(botUsername)}`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify({format}),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+function aiThreadRoute(threadID: string): string {
+    return `${baseRoute()}/ai_threads/${threadID}`;
+}
+
+async function doAIThreadAction(url: string, method: string, body?: any) {
+    const response = await fetch(url, Client4.getOptions({
+        method,
+        body: body ? JSON.stringify(body) : undefined,
+    }));
+
+    if (response.ok) {
+        return response.status === 200 && response.headers.get('Content-Type')?.includes('application/json') ? response.json() : null;
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function renameAIThread(threadID: string, title: string) {
+    return doAIThreadAction(`${aiThreadRoute(threadID)}/rename`, 'POST', {title});
+}
+
+export async function regenerateAIThreadTitle(threadID: string) {
+    return doAIThreadAction(`${aiThreadRoute(threadID)}/regenerate_title`, 'POST');
+}
+
+export async function archiveAIThread(threadID: string) {
+    return doAIThreadAction(`${aiThreadRoute(threadID)}/archive`, 'POST');
+}
+
+export async function unarchiveAIThread(threadID: string) {
+    return doAIThreadAction(`${aiThreadRoute(threadID)}/unarchive`, 'POST');
+}
+
+export async function deleteAIThread(threadID: string) {
+    return doAIThreadAction(aiThreadRoute(threadID), 'DELETE');
+}
+
 export async function getAIBots() {
     const url = `${baseRoute()}/ai_bots`;
     const response = await fetch(url, Client4.getOptions({
@@ -213,6 +447,62 @@ export async function getAIBots() {
     });
 }
 
+export async function getHealth() {
+    const url = `${baseRoute()}/admin/health`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'GET',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export async function getFeedbackStats() {
+    const url = `${baseRoute()}/admin/feedback/stats`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'GET',
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
+export function feedbackExportURL() {
+    return `${baseRoute()}/admin/feedback/export`;
+}
+
+export async function testBotConnection(bot: any) {
+    const url = `${baseRoute()}/admin/health/test`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify(bot),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
+
 export async function createPost(post: any) {
     const created = await Client4.createPost(post);
     return created;
@@ -292,3 +582,21 @@ export async function searchTeams(term: string) {
 export function getTeamIconUrl(teamId: string, lastTeamIconUpdate: number) {
     return Client4.getTeamIconUrl(teamId, lastTeamIconUpdate);
 }
+
+export async function validateConfig(config: any) {
+    const url = `${baseRoute()}/admin/config/validation`;
+    const response = await fetch(url, Client4.getOptions({
+        method: 'POST',
+        body: JSON.stringify(config),
+    }));
+
+    if (response.ok) {
+        return response.json();
+    }
+
+    throw new ClientError(Client4.url, {
+        message: '',
+        status_code: response.status,
+        url,
+    });
+}
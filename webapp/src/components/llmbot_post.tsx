@@ -2,22 +2,23 @@
 // See LICENSE.txt for license information.
 
 import React, {useEffect, useRef, useState} from 'react';
-import {FormattedMessage} from 'react-intl';
+import {FormattedMessage, useIntl} from 'react-intl';
 import {useSelector} from 'react-redux';
 import styled from 'styled-components';
 
 import {WebSocketMessage} from '@mattermost/client';
 import {GlobalState} from '@mattermost/types/store';
 
-import {SendIcon} from '@mattermost/compass-icons/components';
+import {ChevronLeftIcon, ChevronRightIcon, SendIcon, ThumbsDownIcon, ThumbsUpIcon} from '@mattermost/compass-icons/components';
 
-import {doPostbackSummary, doRegenerate, doStopGenerating} from '@/client';
+import {deleteFeedback, doContinue, doPostback, doRegenerate, doSelectResponseVersion, doStopGenerating, getFeedback, saveFeedback} from '@/client';
 
 import {useSelectNotAIPost} from '@/hooks';
 
 import {PostMessagePreview} from '@/mm_webapp';
 
 import PostText from './post_text';
+import {PostbackForm} from './postback_form';
 import IconRegenerate from './assets/icon_regenerate';
 import IconCancel from './assets/icon_cancel';
 
@@ -76,6 +77,36 @@ const PostSummaryButton = styled(GenerationButton)`
 const StopGeneratingButton = styled(GenerationButton)`
 `;
 
+const VersionSwitcher = styled.div`
+	display: flex;
+	align-items: center;
+	gap: 2px;
+	font-size: 12px;
+	color: rgba(var(--center-channel-color-rgb), 0.64);
+`;
+
+const VersionButton = styled.button`
+	display: flex;
+	border: none;
+	padding: 0;
+	background: none;
+	color: inherit;
+
+	:disabled {
+		opacity: 0.32;
+	}
+`;
+
+const FeedbackButton = styled(VersionButton)<{selected: boolean}>`
+	padding: 4px;
+	border-radius: 4px;
+	color: ${(props) => (props.selected ? 'var(--button-bg)' : 'rgba(var(--center-channel-color-rgb), 0.56)')};
+
+	:hover {
+		background: rgba(var(--center-channel-color-rgb), 0.08);
+	}
+`;
+
 const PostSummaryHelpMessage = styled.div`
 	font-size: 14px;
 	font-style: italic;
@@ -89,7 +120,9 @@ const PostSummaryHelpMessage = styled.div`
 `;
 
 export interface PostUpdateWebsocketMessage {
-    next: string
+    next?: string
+    delta?: string
+    seq?: number
     post_id: string
     control?: string
 }
@@ -101,6 +134,7 @@ interface Props {
 }
 
 export const LLMBotPost = (props: Props) => {
+    const intl = useIntl();
     const selectPost = useSelectNotAIPost();
     const [message, setMessage] = useState(props.post.message);
 
@@ -113,7 +147,14 @@ export const LLMBotPost = (props: Props) => {
     const stoppedRef = useRef(stopped);
     stoppedRef.current = stopped;
 
+    // Sequence number of the last update applied, deltas are only applied in order.
+    const seqRef = useRef<number | null>(null);
+
+    const [sharing, setSharing] = useState(false);
+    const [rating, setRating] = useState<'up' | 'down' | null>(null);
+
     const currentUserId = useSelector<GlobalState, string>((state) => state.entities.users.currentUserId);
+    const channelType = useSelector<GlobalState, string>((state) => state.entities.channels.channels[props.post.channel_id]?.type);
     const rootPost = useSelector<GlobalState, any>((state) => state.entities.posts.posts[props.post.root_id]);
 
     useEffect(() => {
@@ -122,11 +163,20 @@ export const LLMBotPost = (props: Props) => {
             const data = msg.data;
             if (!data.control && !stoppedRef.current) {
                 setGenerating(true);
-                setMessage(data.next);
+                if (typeof data.next === 'string') {
+                    seqRef.current = data.seq ?? null;
+                    setMessage(data.next);
+                } else if (typeof data.delta === 'string' && seqRef.current !== null && data.seq === seqRef.current + 1) {
+                    const delta = data.delta;
+                    seqRef.current = data.seq;
+                    setMessage((current: string) => current + delta);
+                }
             } else if (data.control === 'end') {
                 setGenerating(false);
                 setStopped(false);
             } else if (data.control === 'start') {
+                // Wait for the full message the stream starts with before applying deltas.
+                seqRef.current = null;
                 setGenerating(true);
                 setStopped(false);
             }
@@ -136,6 +186,20 @@ export const LLMBotPost = (props: Props) => {
         };
     }, []);
 
+    useEffect(() => {
+        let canceled = false;
+        getFeedback(props.post.id).then((feedback) => {
+            if (!canceled) {
+                setRating(feedback.rating || null);
+            }
+        }).catch(() => {
+            // Without the previous rating the buttons start unselected.
+        });
+        return () => {
+            canceled = true;
+        };
+    }, [props.post.id]);
+
     const regnerate = () => {
         setGenerating(true);
         setStopped(false);
@@ -143,6 +207,12 @@ export const LLMBotPost = (props: Props) => {
         doRegenerate(props.post.id);
     };
 
+    const continueGenerating = () => {
+        setGenerating(true);
+        setStopped(false);
+        doContinue(props.post.id);
+    };
+
     const stopGenerating = () => {
         setStopped(true);
         setGenerating(false);
@@ -150,7 +220,30 @@ export const LLMBotPost = (props: Props) => {
     };
 
     const postSummary = async () => {
-        const result = await doPostbackSummary(props.post.id);
+        const result = await doPostback(props.post.id);
+        selectPost(result.rootid, result.channelid);
+    };
+
+    const selectVersion = async (version: number) => {
+        const selected = await doSelectResponseVersion(props.post.id, version);
+        setMessage(selected.message);
+    };
+
+    // Rating a response again with the same rating removes the rating.
+    const rate = async (newRating: 'up' | 'down') => {
+        if (rating === newRating) {
+            await deleteFeedback(props.post.id);
+            setRating(null);
+            return;
+        }
+
+        const comment = window.prompt(intl.formatMessage({defaultMessage: 'Tell us more about this response (optional)'})) ?? '';
+        await saveFeedback(props.post.id, newRating, comment);
+        setRating(newRating);
+    };
+
+    const onShared = (result: {rootid: string, channelid: string}) => {
+        setSharing(false);
         selectPost(result.rootid, result.channelid);
     };
 
@@ -172,10 +265,18 @@ export const LLMBotPost = (props: Props) => {
         }
     }
 
+    const selectedVersion = parseInt(props.post.props?.llm_response_version, 10) || 0;
+    const versionCount = parseInt(props.post.props?.llm_response_versions, 10) || 0;
+
+    const isInterrupted = Boolean(props.post.props?.llm_stream_interrupted);
+    const showContinue = !generating && requesterIsCurrentUser && isInterrupted;
     const showRegenerate = !generating && requesterIsCurrentUser && !isNoShowRegen;
     const showPostbackButton = !generating && requesterIsCurrentUser && isTranscriptionResult;
+    const showShareButton = !generating && requesterIsCurrentUser && channelType === 'D' && !sharing;
     const showStopGeneratingButton = generating && requesterIsCurrentUser;
-    const showControlsBar = (showRegenerate || showPostbackButton || showStopGeneratingButton) && message !== '';
+    const showVersionSwitcher = !generating && requesterIsCurrentUser && versionCount > 1 && selectedVersion > 0;
+    const showFeedback = !generating;
+    const showControlsBar = (showContinue || showRegenerate || showPostbackButton || showShareButton || showStopGeneratingButton || showVersionSwitcher || showFeedback) && message !== '';
 
     return (
         <PostBody
@@ -208,6 +309,46 @@ export const LLMBotPost = (props: Props) => {
                     <FormattedMessage defaultMessage='Stop Generating'/>
                 </StopGeneratingButton>
                 }
+                { showFeedback &&
+                <>
+                    <FeedbackButton
+                        data-testid='feedback-up-button'
+                        selected={rating === 'up'}
+                        title={intl.formatMessage({defaultMessage: 'Good response'})}
+                        onClick={() => rate('up')}
+                    >
+                        <ThumbsUpIcon size={16}/>
+                    </FeedbackButton>
+                    <FeedbackButton
+                        data-testid='feedback-down-button'
+                        selected={rating === 'down'}
+                        title={intl.formatMessage({defaultMessage: 'Bad response'})}
+                        onClick={() => rate('down')}
+                    >
+                        <ThumbsDownIcon size={16}/>
+                    </FeedbackButton>
+                </>
+                }
+                { showVersionSwitcher &&
+                <VersionSwitcher data-testid='response-version-switcher'>
+                    <VersionButton
+                        disabled={selectedVersion <= 1}
+                        onClick={() => selectVersion(selectedVersion - 1)}
+                    >
+                        <ChevronLeftIcon size={16}/>
+                    </VersionButton>
+                    <FormattedMessage
+                        defaultMessage='{selected} / {count}'
+                        values={{selected: selectedVersion, count: versionCount}}
+                    />
+                    <VersionButton
+                        disabled={selectedVersion >= versionCount}
+                        onClick={() => selectVersion(selectedVersion + 1)}
+                    >
+                        <ChevronRightIcon size={16}/>
+                    </VersionButton>
+                </VersionSwitcher>
+                }
                 {showPostbackButton &&
                 <PostSummaryButton
                     data-testid='llm-bot-post-summary'
@@ -217,6 +358,24 @@ export const LLMBotPost = (props: Props) => {
                     <FormattedMessage defaultMessage='Post summary'/>
                 </PostSummaryButton>
                 }
+                { showShareButton &&
+                <GenerationButton
+                    data-testid='share-button'
+                    onClick={() => setSharing(true)}
+                >
+                    <SendIcon/>
+                    <FormattedMessage defaultMessage='Share'/>
+                </GenerationButton>
+                }
+                { showContinue &&
+                <GenerationButton
+                    data-testid='continue-button'
+                    onClick={continueGenerating}
+                >
+                    <IconRegenerate/>
+                    <FormattedMessage defaultMessage='Continue'/>
+                </GenerationButton>
+                }
                 { showRegenerate &&
                 <GenerationButton
                     data-testid='regenerate-button'
@@ -228,6 +387,14 @@ export const LLMBotPost = (props: Props) => {
                 }
             </ControlsBar>
             }
+            { sharing &&
+            <PostbackForm
+                postID={props.post.id}
+                message={message}
+                onPosted={onShared}
+                onCancel={() => setSharing(false)}
+            />
+            }
         </PostBody>
     );
 };
@@ -0,0 +1,166 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useEffect, useState} from 'react';
+import {FormattedMessage, useIntl} from 'react-intl';
+import {useSelector} from 'react-redux';
+import styled from 'styled-components';
+
+import {GlobalState} from '@mattermost/types/store';
+
+import {doPostback, getPostbackTarget, PostbackTarget} from '@/client';
+
+import {PrimaryButton, TertiaryButton} from './assets/buttons';
+
+const Form = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 8px;
+	margin-top: 8px;
+	padding: 12px;
+	border: 1px solid rgba(var(--center-channel-color-rgb), 0.16);
+	border-radius: 4px;
+`;
+
+const Field = styled.input`
+	padding: 4px 8px;
+	border: 1px solid rgba(var(--center-channel-color-rgb), 0.16);
+	border-radius: 4px;
+	background: var(--center-channel-bg);
+	color: var(--center-channel-color);
+`;
+
+const MessageField = styled(Field).attrs({as: 'textarea'})`
+	min-height: 120px;
+	resize: vertical;
+`;
+
+const Buttons = styled.div`
+	display: flex;
+	justify-content: flex-end;
+	gap: 8px;
+`;
+
+const ErrorText = styled.div`
+	color: var(--error-text);
+`;
+
+type TargetKind = 'default' | 'current' | 'thread';
+
+// Links to a post end with /pl/<post id>.
+const permalinkPattern = /\/pl\/([a-z0-9]{26})/;
+
+interface Props {
+    postID: string;
+    message: string;
+    onPosted: (result: {rootid: string, channelid: string}) => void;
+    onCancel: () => void;
+}
+
+export const PostbackForm = (props: Props) => {
+    const intl = useIntl();
+    const currentChannelId = useSelector<GlobalState, string>((state) => state.entities.channels.currentChannelId);
+    const currentChannelName = useSelector<GlobalState, string>((state) => state.entities.channels.channels[currentChannelId]?.display_name);
+    const currentChannelType = useSelector<GlobalState, string>((state) => state.entities.channels.channels[currentChannelId]?.type);
+
+    const [defaultTarget, setDefaultTarget] = useState<PostbackTarget | null>(null);
+    const [kind, setKind] = useState<TargetKind>('current');
+    const [permalink, setPermalink] = useState('');
+    const [message, setMessage] = useState(props.message);
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        getPostbackTarget(props.postID).then((target) => {
+            if (target.channel_id) {
+                setDefaultTarget(target);
+                setKind('default');
+            }
+        });
+    }, [props.postID]);
+
+    // The current channel is the DM with the bot when the response is opened from it.
+    const canPostToCurrent = Boolean(currentChannelId) && currentChannelType !== 'D';
+    const isAvailable = (kind === 'default' && defaultTarget) || (kind === 'current' && canPostToCurrent);
+    const selected: TargetKind = isAvailable ? kind : 'thread';
+
+    const submit = async () => {
+        let target: PostbackTarget | undefined;
+        if (selected === 'current') {
+            target = {channel_id: currentChannelId, root_id: ''};
+        } else if (selected === 'thread') {
+            const match = permalink.match(permalinkPattern);
+            if (!match) {
+                setError(intl.formatMessage({defaultMessage: 'Paste a link to a message of the thread.'}));
+                return;
+            }
+            target = {channel_id: '', root_id: match[1]};
+        }
+
+        try {
+            const result = await doPostback(props.postID, target, message === props.message ? '' : message);
+            props.onPosted(result);
+        } catch (e) {
+            setError(intl.formatMessage({defaultMessage: 'Unable to post the response there.'}));
+        }
+    };
+
+    return (
+        <Form data-testid='llm-bot-postback-form'>
+            {defaultTarget &&
+            <label>
+                <input
+                    type='radio'
+                    checked={selected === 'default'}
+                    onChange={() => setKind('default')}
+                />
+                {' '}
+                <FormattedMessage defaultMessage='Original thread or channel'/>
+            </label>
+            }
+            {canPostToCurrent &&
+            <label>
+                <input
+                    type='radio'
+                    checked={selected === 'current'}
+                    onChange={() => setKind('current')}
+                />
+                {' '}
+                <FormattedMessage
+                    defaultMessage='Current channel ({channelName})'
+                    values={{channelName: currentChannelName}}
+                />
+            </label>
+            }
+            <label>
+                <input
+                    type='radio'
+                    checked={selected === 'thread'}
+                    onChange={() => setKind('thread')}
+                />
+                {' '}
+                <FormattedMessage defaultMessage='Another thread'/>
+            </label>
+            {selected === 'thread' &&
+            <Field
+                type='text'
+                placeholder={intl.formatMessage({defaultMessage: 'Link to a message of the thread'})}
+                value={permalink}
+                onChange={(e) => setPermalink(e.target.value)}
+            />
+            }
+            <MessageField
+                value={message}
+                onChange={(e: React.ChangeEvent<HTMLTextAreaElement>) => setMessage(e.target.value)}
+            />
+            {error && <ErrorText>{error}</ErrorText>}
+            <Buttons>
+                <TertiaryButton onClick={props.onCancel}>
+                    <FormattedMessage defaultMessage='Cancel'/>
+                </TertiaryButton>
+                <PrimaryButton onClick={submit}>
+                    <FormattedMessage defaultMessage='Post'/>
+                </PrimaryButton>
+            </Buttons>
+        </Form>
+    );
+};
@@ -10,11 +10,25 @@ import {GlobalState} from '@mattermost/types/store';
 
 import manifest from '@/manifest';
 
-import {getAIThreads, updateRead} from '@/client';
+import {DotsHorizontalIcon} from '@mattermost/compass-icons/components';
+
+import {
+    archiveAIThread,
+    attachThreadExport,
+    deleteAIThread,
+    getAIThreads,
+    regenerateAIThreadTitle,
+    renameAIThread,
+    threadExportURL,
+    unarchiveAIThread,
+    updateRead,
+} from '@/client';
 
 import {useBotlist} from '@/bots';
 
 import RHSImage from '../assets/rhs_image';
+import DotMenu, {DropdownMenuItem} from '../dot_menu';
+import {TertiaryButton} from '../assets/buttons';
 
 import {ThreadViewer as UnstyledThreadViewer} from '@/mm_webapp';
 
@@ -51,13 +65,43 @@ const RHSBullet = styled.li`
 	margin-bottom: 8px;
 `;
 
+const ThreadsFilters = styled.div`
+	display: flex;
+	align-items: center;
+	gap: 8px;
+	padding: 12px 16px;
+	border-bottom: 1px solid rgba(var(--center-channel-color-rgb), 0.12);
+`;
+
+const SearchInput = styled.input`
+	flex-grow: 1;
+	padding: 4px 8px;
+	border: 1px solid rgba(var(--center-channel-color-rgb), 0.16);
+	border-radius: 4px;
+	background: var(--center-channel-bg);
+	color: var(--center-channel-color);
+`;
+
+const LoadMore = styled.div`
+	display: flex;
+	justify-content: center;
+	padding: 16px;
+`;
+
 export interface AIThread {
     ID: string;
     Message: string;
     ChannelID: string;
     Title: string;
     ReplyCount: number;
+    CreateAt: number;
     UpdateAt: number;
+    Archived: boolean;
+}
+
+interface AIThreadsPage {
+    threads: AIThread[];
+    next_cursor: string;
 }
 
 const twentyFourHoursInMS = 24 * 60 * 60 * 1000;
@@ -71,14 +115,65 @@ export default function RHS() {
     const currentTeamId = useSelector<GlobalState, string>((state) => state.entities.teams.currentTeamId);
 
     const [threads, setThreads] = useState<AIThread[] | null>(null);
+    const [nextCursor, setNextCursor] = useState('');
+    const [search, setSearch] = useState('');
+    const [showArchived, setShowArchived] = useState(false);
+
+    const fetchThreads = useCallback(async (cursor?: string) => {
+        const page: AIThreadsPage = await getAIThreads({cursor, search, archived: showArchived});
+        setThreads((previous) => (cursor && previous ? [...previous, ...page.threads] : page.threads));
+        setNextCursor(page.next_cursor);
+    }, [search, showArchived]);
 
     useEffect(() => {
-        const fetchThreads = async () => {
-            setThreads(await getAIThreads());
-        };
-        if (currentTab === 'threads') {
-            fetchThreads();
-        } else if (currentTab === 'thread' && Boolean(selectedPostId)) {
+        if (currentTab !== 'threads') {
+            return undefined;
+        }
+
+        // Wait for the user to stop typing before searching.
+        const timeout = setTimeout(() => fetchThreads(), search ? 300 : 0);
+        return () => clearTimeout(timeout);
+    }, [currentTab, fetchThreads]);
+
+    const removeThread = (threadID: string) => {
+        setThreads((previous) => previous?.filter((thread) => thread.ID !== threadID) ?? null);
+    };
+
+    const updateThreadTitle = (threadID: string, title: string) => {
+        setThreads((previous) => previous?.map((thread) => (thread.ID === threadID ? {...thread, Title: title} : thread)) ?? null);
+    };
+
+    const renameThread = async (thread: AIThread) => {
+        const title = window.prompt(intl.formatMessage({defaultMessage: 'Rename conversation'}), thread.Title);
+        if (title && title.trim()) {
+            await renameAIThread(thread.ID, title.trim());
+            updateThreadTitle(thread.ID, title.trim());
+        }
+    };
+
+    const regenerateThreadTitle = async (thread: AIThread) => {
+        const result = await regenerateAIThreadTitle(thread.ID);
+        updateThreadTitle(thread.ID, result.title);
+    };
+
+    const toggleThreadArchived = async (thread: AIThread) => {
+        if (thread.Archived) {
+            await unarchiveAIThread(thread.ID);
+        } else {
+            await archiveAIThread(thread.ID);
+        }
+        removeThread(thread.ID);
+    };
+
+    const deleteThread = async (thread: AIThread) => {
+        if (window.confirm(intl.formatMessage({defaultMessage: 'Delete this conversation? This can\'t be undone.'}))) {
+            await deleteAIThread(thread.ID);
+            removeThread(thread.ID);
+        }
+    };
+
+    useEffect(() => {
+        if (currentTab === 'thread' && Boolean(selectedPostId)) {
             // Update read for the thread to tommorow. We don't really want the unreads thing to show up.
             updateRead(currentUserId, currentTeamId, selectedPostId, Date.now() + twentyFourHoursInMS);
         }
@@ -140,19 +235,72 @@ export default function RHS() {
                 <ThreadsList
                     data-testid='rhs-threads-list'
                 >
-                    {threads.map((p) => (
-                        <ThreadItem
-                            key={p.ID}
-                            postTitle={p.Title}
-                            postMessage={p.Message}
-                            repliesCount={p.ReplyCount}
-                            lastActivityDate={p.UpdateAt}
-                            label={bots.find((bot) => bot.dmChannelID === p.ChannelID)?.displayName ?? ''}
-                            onClick={() => {
-                                setCurrentTab('thread');
-                                selectPost(p.ID);
-                            }}
-                        />))}
+                    <ThreadsFilters>
+                        <SearchInput
+                            type='search'
+                            placeholder={intl.formatMessage({defaultMessage: 'Search conversations'})}
+                            value={search}
+                            onChange={(e) => setSearch(e.target.value)}
+                        />
+                        <TertiaryButton onClick={() => setShowArchived(!showArchived)}>
+                            {showArchived ? <FormattedMessage defaultMessage='Show active'/> : <FormattedMessage defaultMessage='Show archived'/>}
+                        </TertiaryButton>
+                    </ThreadsFilters>
+                    {threads.map((p) => {
+                        const threadBot = bots.find((bot) => bot.dmChannelID === p.ChannelID);
+                        return (
+                            <ThreadItem
+                                key={p.ID}
+                                postTitle={p.Title}
+                                postMessage={p.Message}
+                                repliesCount={p.ReplyCount}
+                                lastActivityDate={p.UpdateAt}
+                                label={threadBot?.displayName ?? ''}
+                                onClick={() => {
+                                    setCurrentTab('thread');
+                                    selectPost(p.ID);
+                                }}
+                                actions={(
+                                    <DotMenu
+                                        icon={<DotsHorizontalIcon size={16}/>}
+                                        title={intl.formatMessage({defaultMessage: 'Conversation actions'})}
+                                    >
+                                        <DropdownMenuItem onClick={() => renameThread(p)}>
+                                            <FormattedMessage defaultMessage='Rename'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => regenerateThreadTitle(p)}>
+                                            <FormattedMessage defaultMessage='Regenerate title'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => toggleThreadArchived(p)}>
+                                            {p.Archived ? <FormattedMessage defaultMessage='Unarchive'/> : <FormattedMessage defaultMessage='Archive'/>}
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => window.open(threadExportURL(p.ID, 'markdown', threadBot?.username ?? ''))}>
+                                            <FormattedMessage defaultMessage='Export as Markdown'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => window.open(threadExportURL(p.ID, 'json', threadBot?.username ?? ''))}>
+                                            <FormattedMessage defaultMessage='Export as JSON'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => window.open(threadExportURL(p.ID, 'html', threadBot?.username ?? ''))}>
+                                            <FormattedMessage defaultMessage='Export as HTML'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => attachThreadExport(p.ID, 'markdown', threadBot?.username ?? '')}>
+                                            <FormattedMessage defaultMessage='Send export to direct message'/>
+                                        </DropdownMenuItem>
+                                        <DropdownMenuItem onClick={() => deleteThread(p)}>
+                                            <FormattedMessage defaultMessage='Delete'/>
+                                        </DropdownMenuItem>
+                                    </DotMenu>
+                                )}
+                            />
+                        );
+                    })}
+                    {nextCursor && (
+                        <LoadMore>
+                            <TertiaryButton onClick={() => fetchThreads(nextCursor)}>
+                                <FormattedMessage defaultMessage='Load more'/>
+                            </TertiaryButton>
+                        </LoadMore>
+                    )}
                 </ThreadsList>
             );
         } else {
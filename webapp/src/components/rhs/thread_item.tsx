@@ -75,6 +75,7 @@ type Props = {
     lastActivityDate: number;
     label: string;
     onClick: () => void;
+    actions?: React.ReactNode;
 }
 
 const DefaultTitle = 'Conversation with Copilot';
@@ -93,6 +94,7 @@ export default function ThreadItem(props: Props) {
                         day={'numeric'}
                     />
                 </LastActivityDate>
+                {props.actions}
             </Title>
             <Preview>{props.postMessage}</Preview>
             <Footer>
@@ -15,6 +15,7 @@ import {ButtonIcon} from '../assets/buttons';
 import {BooleanItem, ItemList, SelectionItem, SelectionItemOption, TextItem} from './item';
 import AvatarItem from './avatar';
 import {ChannelAccessLevelItem, UserAccessLevelItem} from './llm_access';
+import {TestConnection} from './health';
 
 export type LLMService = {
     type: string
@@ -28,6 +29,11 @@ export type LLMService = {
     streamingTimeoutSeconds: number
     sendUserId: boolean
     outputTokenLimit: number
+    maxConcurrentRequests: number
+    temperature?: number
+    topP?: number
+    seed?: number
+    stopSequences?: string[]
 }
 
 export enum ChannelAccessLevel {
@@ -44,11 +50,21 @@ export enum UserAccessLevel {
     None,
 }
 
+export type TaskModels = {
+    chat?: string
+    title?: string
+    emoji?: string
+    chunkSummary?: string
+    finalSummary?: string
+    threadAnalysis?: string
+}
+
 export type LLMBotConfig = {
     id: string
     name: string
     displayName: string
     service: LLMService
+    taskModels?: TaskModels
     customInstructions: string
     enableVision: boolean
     disableTools: boolean
@@ -163,6 +179,10 @@ const Bot = (props: Props) => {
                             service={props.bot.service}
                             onChange={(service) => props.onChange({...props.bot, service})}
                         />
+                        <TaskModelsItem
+                            taskModels={props.bot.taskModels ?? {}}
+                            onChange={(taskModels) => props.onChange({...props.bot, taskModels})}
+                        />
                         <TextItem
                             label={intl.formatMessage({defaultMessage: 'Custom instructions'})}
                             placeholder={intl.formatMessage({defaultMessage: 'How would you like the AI to respond?'})}
@@ -208,6 +228,7 @@ const Bot = (props: Props) => {
                             teamIDs={props.bot.teamIDs ?? []}
                             onChangeIDs={(userIds: string[], teamIds: string[]) => props.onChange({...props.bot, userIDs: userIds, teamIDs: teamIds})}
                         />
+                        <TestConnection bot={props.bot}/>
 
                     </ItemList>
                 </ItemListContainer>
@@ -234,6 +255,13 @@ const ServiceItem = (props: ServiceItemProps) => {
     const hasAPIKey = type !== 'asksage';
     const isOpenAIType = type === 'openai' || type === 'openaicompatible' || type === 'azure';
 
+    const [stopSequences, setStopSequences] = useState((props.service.stopSequences ?? []).join('\n'));
+
+    const parseOptionalNumber = (value: string) => {
+        const parsed = parseFloat(value);
+        return isNaN(parsed) ? undefined : parsed;
+    };
+
     const getDefaultOutputTokenLimit = () => {
         switch (type) {
         case 'anthropic':
@@ -243,6 +271,8 @@ const ServiceItem = (props: ServiceItemProps) => {
         }
     };
 
+    const secretHelpText = intl.formatMessage({defaultMessage: 'To keep the secret out of the configuration, reference an environment variable with env:MM_PLUGIN_AI_VARIABLE_NAME or a file of the secrets directory with file:/run/secrets/name. The directory can be changed with the MM_PLUGIN_AI_SECRETS_DIR environment variable of the server. Referenced secrets are read again every minute.'});
+
     return (
         <>
             {(type === 'openaicompatible' || type === 'azure') && (
@@ -258,6 +288,7 @@ const ServiceItem = (props: ServiceItemProps) => {
                     type='password'
                     value={props.service.apiKey}
                     onChange={(e) => props.onChange({...props.service, apiKey: e.target.value})}
+                    helptext={secretHelpText}
                 />
             )}
             {isOpenAIType && (
@@ -266,6 +297,7 @@ const ServiceItem = (props: ServiceItemProps) => {
                         label={intl.formatMessage({defaultMessage: 'Organization ID'})}
                         value={props.service.orgId}
                         onChange={(e) => props.onChange({...props.service, orgId: e.target.value})}
+                        helptext={secretHelpText}
                     />
                     <BooleanItem
                         label={intl.formatMessage({defaultMessage: 'Send User ID'})}
@@ -284,8 +316,10 @@ const ServiceItem = (props: ServiceItemProps) => {
                     />
                     <TextItem
                         label={intl.formatMessage({defaultMessage: 'Password'})}
+                        type='password'
                         value={props.service.password}
                         onChange={(e) => props.onChange({...props.service, password: e.target.value})}
+                        helptext={secretHelpText}
                     />
                 </>
             )}
@@ -326,6 +360,91 @@ const ServiceItem = (props: ServiceItemProps) => {
                     }}
                 />
             )}
+            <TextItem
+                label={intl.formatMessage({defaultMessage: 'Max concurrent requests'})}
+                type='number'
+                value={props.service.maxConcurrentRequests?.toString() || '0'}
+                onChange={(e) => {
+                    const value = parseInt(e.target.value, 10);
+                    const maxConcurrentRequests = isNaN(value) ? 0 : value;
+                    props.onChange({...props.service, maxConcurrentRequests});
+                }}
+                helptext={intl.formatMessage({defaultMessage: 'Maximum number of requests sent to the service at the same time. Further requests wait in a queue. 0 uses the default of 10.'})}
+            />
+            <TextItem
+                label={intl.formatMessage({defaultMessage: 'Temperature'})}
+                type='number'
+                value={props.service.temperature?.toString() ?? ''}
+                onChange={(e) => props.onChange({...props.service, temperature: parseOptionalNumber(e.target.value)})}
+                helptext={type === 'anthropic' ? intl.formatMessage({defaultMessage: 'Between 0 and 1. Leave empty to use the service default.'}) : intl.formatMessage({defaultMessage: 'Between 0 and 2. Leave empty to use the service default.'})}
+            />
+            {type !== 'asksage' && (
+                <>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Top P'})}
+                        type='number'
+                        value={props.service.topP?.toString() ?? ''}
+                        onChange={(e) => props.onChange({...props.service, topP: parseOptionalNumber(e.target.value)})}
+                        helptext={intl.formatMessage({defaultMessage: 'Greater than 0 and at most 1. Leave empty to use the service default.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Stop sequences'})}
+                        multiline={true}
+                        value={stopSequences}
+                        onChange={(e) => {
+                            setStopSequences(e.target.value);
+                            props.onChange({...props.service, stopSequences: e.target.value.split('\n').filter((sequence) => sequence !== '')});
+                        }}
+                        helptext={intl.formatMessage({defaultMessage: 'One sequence per line. The response stops when the model generates one of them.'})}
+                    />
+                </>
+            )}
+            {isOpenAIType && (
+                <TextItem
+                    label={intl.formatMessage({defaultMessage: 'Seed'})}
+                    type='number'
+                    value={props.service.seed?.toString() ?? ''}
+                    onChange={(e) => {
+                        const value = parseInt(e.target.value, 10);
+                        props.onChange({...props.service, seed: isNaN(value) ? undefined : value});
+                    }}
+                    helptext={intl.formatMessage({defaultMessage: 'Makes sampling repeatable on models that support it. Leave empty for random sampling.'})}
+                />
+            )}
+        </>
+    );
+};
+
+type TaskModelsItemProps = {
+    taskModels: TaskModels
+    onChange: (taskModels: TaskModels) => void
+}
+
+const TaskModelsItem = (props: TaskModelsItemProps) => {
+    const intl = useIntl();
+    const placeholder = intl.formatMessage({defaultMessage: 'Default model'});
+
+    const tasks: Array<{task: keyof TaskModels, label: string}> = [
+        {task: 'chat', label: intl.formatMessage({defaultMessage: 'Chat model'})},
+        {task: 'title', label: intl.formatMessage({defaultMessage: 'Title model'})},
+        {task: 'emoji', label: intl.formatMessage({defaultMessage: 'Emoji model'})},
+        {task: 'chunkSummary', label: intl.formatMessage({defaultMessage: 'Summary chunk model'})},
+        {task: 'finalSummary', label: intl.formatMessage({defaultMessage: 'Final summary model'})},
+        {task: 'threadAnalysis', label: intl.formatMessage({defaultMessage: 'Thread analysis model'})},
+    ];
+
+    return (
+        <>
+            {tasks.map(({task, label}) => (
+                <TextItem
+                    key={task}
+                    label={label}
+                    placeholder={placeholder}
+                    value={props.taskModels[task] ?? ''}
+                    onChange={(e) => props.onChange({...props.taskModels, [task]: e.target.value})}
+                    helptext={task === 'chat' ? intl.formatMessage({defaultMessage: 'Overrides the default model for one task, for example a smaller model for titles. Leave empty to use the default model.'}) : undefined}
+                />
+            ))}
         </>
     );
 };
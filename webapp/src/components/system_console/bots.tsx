@@ -30,6 +30,7 @@ const defaultNewBot: LLMBotConfig = {
         streamingTimeoutSeconds: 0,
         sendUserId: false,
         outputTokenLimit: 0,
+        maxConcurrentRequests: 0,
     },
     enableVision: false,
     disableTools: false,
@@ -13,6 +13,9 @@ import Bots, {firstNewBot} from './bots';
 import {LLMBotConfig} from './bot';
 import {BooleanItem, ItemList, SelectionItem, SelectionItemOption, TextItem} from './item';
 import NoBotsPage from './no_bots_page';
+import HealthPanel from './health';
+import ConfigValidationPanel from './config_validation';
+import FeedbackPanel from './feedback';
 
 type Config = {
     services: ServiceData[],
@@ -20,6 +23,21 @@ type Config = {
     defaultBotName: string,
     transcriptBackend: string,
     enableLLMTrace: boolean,
+    enableTracing: boolean,
+    tracingEndpoint: string,
+    enableAuditLog: boolean,
+    auditLogContent: string,
+    auditLogRetentionDays: number,
+    enablePIIRedaction: boolean,
+    piiRedactionDetectors: string,
+    piiRedactionPatterns: string,
+    enableModeration: boolean,
+    moderationBlocklist: string,
+    moderationClassifier: string,
+    moderationBot: string,
+    moderationPolicy: string,
+    moderationAction: string,
+    moderationBufferPublicChannels: boolean,
     enableCallSummary: boolean,
     allowedUpstreamHostnames: string
 }
@@ -179,6 +197,132 @@ const Config = (props: Props) => {
                     />
                 </ItemList>
             </Panel>
+            <ConfigValidationPanel config={value}/>
+            <HealthPanel/>
+            <FeedbackPanel/>
+            <Panel
+                title={intl.formatMessage({defaultMessage: 'PII Redaction'})}
+                subtitle={intl.formatMessage({defaultMessage: 'Replace sensitive values with placeholders before content is sent to an LLM. The original values are put back in the responses.'})}
+            >
+                <ItemList>
+                    <BooleanItem
+                        label={intl.formatMessage({defaultMessage: 'Enable PII Redaction'})}
+                        value={value.enablePIIRedaction}
+                        onChange={(to) => props.onChange(props.id, {...value, enablePIIRedaction: to})}
+                        helpText={intl.formatMessage({defaultMessage: 'Applies to conversations, channel and thread summaries, and the results of tools.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Built-in Detectors (csv)'})}
+                        value={value.piiRedactionDetectors}
+                        onChange={(e) => props.onChange(props.id, {...value, piiRedactionDetectors: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Comma separated list of the detectors to use among secret, email, credit_card, ssn, phone and ip_address. Leave empty to use all of them. Add high_entropy to also redact long random-looking strings.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Custom Patterns'})}
+                        multiline={true}
+                        value={value.piiRedactionPatterns}
+                        onChange={(e) => props.onChange(props.id, {...value, piiRedactionPatterns: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Additional regular expressions to redact, one per line. For instance PROJ-[0-9]+ to hide internal ticket numbers.'})}
+                    />
+                </ItemList>
+            </Panel>
+            <Panel
+                title={intl.formatMessage({defaultMessage: 'Content Moderation'})}
+                subtitle={intl.formatMessage({defaultMessage: 'Review what bots post against a content policy. Violating responses are withheld or redacted with an explanation, and the incident is recorded in the audit log.'})}
+            >
+                <ItemList>
+                    <BooleanItem
+                        label={intl.formatMessage({defaultMessage: 'Enable Content Moderation'})}
+                        value={value.enableModeration}
+                        onChange={(to) => props.onChange(props.id, {...value, enableModeration: to})}
+                        helpText={intl.formatMessage({defaultMessage: 'Responses that cannot be reviewed, for instance because the classifier is unreachable, are withheld.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Blocklist'})}
+                        multiline={true}
+                        value={value.moderationBlocklist}
+                        onChange={(e) => props.onChange(props.id, {...value, moderationBlocklist: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'Terms that must not appear in responses, one per line. Terms match whole words regardless of case. Enclose a line in slashes to use a regular expression, for instance /project-[0-9]+/'})}
+                    />
+                    <SelectionItem
+                        label={intl.formatMessage({defaultMessage: 'Classifier'})}
+                        value={value.moderationClassifier || ''}
+                        onChange={(e) => props.onChange(props.id, {...value, moderationClassifier: e.target.value})}
+                    >
+                        <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'Blocklist only'})}</SelectionItemOption>
+                        <SelectionItemOption value='openai'>{intl.formatMessage({defaultMessage: 'OpenAI moderation endpoint'})}</SelectionItemOption>
+                        <SelectionItemOption value='llm'>{intl.formatMessage({defaultMessage: 'LLM classifier'})}</SelectionItemOption>
+                    </SelectionItem>
+                    <SelectionItem
+                        label={intl.formatMessage({defaultMessage: 'Classifier Bot'})}
+                        value={value.moderationBot || ''}
+                        onChange={(e) => props.onChange(props.id, {...value, moderationBot: e.target.value})}
+                    >
+                        <SelectionItemOption value=''>{intl.formatMessage({defaultMessage: 'None'})}</SelectionItemOption>
+                        {props.value.bots.map((bot: LLMBotConfig) => (
+                            <SelectionItemOption
+                                key={bot.name}
+                                value={bot.name}
+                            >
+                                {bot.displayName}
+                            </SelectionItemOption>
+                        ))}
+                    </SelectionItem>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Additional Policy'})}
+                        multiline={true}
+                        value={value.moderationPolicy}
+                        onChange={(e) => props.onChange(props.id, {...value, moderationPolicy: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'What else the LLM classifier should block, in plain language. Only used by the LLM classifier. The OpenAI moderation endpoint requires a bot using the OpenAI or an OpenAI compatible service.'})}
+                    />
+                    <SelectionItem
+                        label={intl.formatMessage({defaultMessage: 'Action on Violation'})}
+                        value={value.moderationAction || 'replace'}
+                        onChange={(e) => props.onChange(props.id, {...value, moderationAction: e.target.value})}
+                    >
+                        <SelectionItemOption value='replace'>{intl.formatMessage({defaultMessage: 'Withhold the response'})}</SelectionItemOption>
+                        <SelectionItemOption value='redact'>{intl.formatMessage({defaultMessage: 'Redact blocklisted terms, withhold otherwise'})}</SelectionItemOption>
+                    </SelectionItem>
+                    <BooleanItem
+                        label={intl.formatMessage({defaultMessage: 'Buffer Responses in Public Channels'})}
+                        value={value.moderationBufferPublicChannels}
+                        onChange={(to) => props.onChange(props.id, {...value, moderationBufferPublicChannels: to})}
+                        helpText={intl.formatMessage({defaultMessage: 'Only show responses in public channels once they have been reviewed. Otherwise responses are streamed as usual and reviewed when they are complete.'})}
+                    />
+                </ItemList>
+            </Panel>
+            <Panel
+                title={intl.formatMessage({defaultMessage: 'Audit Log'})}
+                subtitle={intl.formatMessage({defaultMessage: 'Record who used which bot, for what, with which tools and how many tokens. System admins can search and export the records through the plugin API.'})}
+            >
+                <ItemList>
+                    <BooleanItem
+                        label={intl.formatMessage({defaultMessage: 'Enable Audit Log'})}
+                        value={value.enableAuditLog}
+                        onChange={(to) => props.onChange(props.id, {...value, enableAuditLog: to})}
+                        helpText={intl.formatMessage({defaultMessage: 'Store a record of every request made to an LLM in the database. Prompts and responses are only kept if selected below. Redacted content has email addresses, long numbers and credentials masked.'})}
+                    />
+                    <SelectionItem
+                        label={intl.formatMessage({defaultMessage: 'Prompts and Responses'})}
+                        value={value.auditLogContent || 'none'}
+                        onChange={(e) => props.onChange(props.id, {...value, auditLogContent: e.target.value})}
+                    >
+                        <SelectionItemOption value='none'>{intl.formatMessage({defaultMessage: 'Do not store'})}</SelectionItemOption>
+                        <SelectionItemOption value='redacted'>{intl.formatMessage({defaultMessage: 'Store redacted'})}</SelectionItemOption>
+                        <SelectionItemOption value='full'>{intl.formatMessage({defaultMessage: 'Store in full'})}</SelectionItemOption>
+                    </SelectionItem>
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'Retention Days'})}
+                        type='number'
+                        value={(value.auditLogRetentionDays || 90).toString()}
+                        onChange={(e) => {
+                            const days = parseInt(e.target.value, 10);
+                            props.onChange(props.id, {...value, auditLogRetentionDays: isNaN(days) ? 0 : days});
+                        }}
+                        helptext={intl.formatMessage({defaultMessage: 'Records older than this are deleted.'})}
+                    />
+                </ItemList>
+            </Panel>
             <Panel
                 title={intl.formatMessage({defaultMessage: 'Debug'})}
                 subtitle=''
@@ -190,6 +334,18 @@ const Config = (props: Props) => {
                         onChange={(to) => props.onChange(props.id, {...value, enableLLMTrace: to})}
                         helpText={intl.formatMessage({defaultMessage: 'Enable tracing of LLM requests. Outputs full conversation data to the logs.'})}
                     />
+                    <BooleanItem
+                        label={intl.formatMessage({defaultMessage: 'Enable OpenTelemetry Tracing'})}
+                        value={value.enableTracing}
+                        onChange={(to) => props.onChange(props.id, {...value, enableTracing: to})}
+                        helpText={intl.formatMessage({defaultMessage: 'Export spans for request handling, LLM calls and tools to an OTLP collector. Spans only contain IDs, never message content.'})}
+                    />
+                    <TextItem
+                        label={intl.formatMessage({defaultMessage: 'OTLP Traces Endpoint'})}
+                        value={value.tracingEndpoint}
+                        onChange={(e) => props.onChange(props.id, {...value, tracingEndpoint: e.target.value})}
+                        helptext={intl.formatMessage({defaultMessage: 'URL of the OTLP/HTTP traces endpoint of your collector. For instance http://otel-collector:4318/v1/traces'})}
+                    />
                 </ItemList>
             </Panel>
         </ConfigContainer>
@@ -0,0 +1,118 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useState} from 'react';
+import styled from 'styled-components';
+import {FormattedMessage, useIntl} from 'react-intl';
+
+import {validateConfig} from '@/client';
+
+import {TertiaryButton} from '../assets/buttons';
+import {DangerPill, GrayPill} from '../pill';
+
+import Panel from './panel';
+
+type ValidationError = {
+    bot?: string
+    field: string
+    message: string
+}
+
+type ConfigValidation = {
+    errors: ValidationError[]
+    warnings: ValidationError[]
+}
+
+const ProblemList = (props: {problems: ValidationError[], pill: React.ReactNode}) => (
+    <>
+        {props.problems.map((problem) => (
+            <ProblemRow key={`${problem.bot ?? ''}.${problem.field}.${problem.message}`}>
+                {props.pill}
+                <ProblemField>{problem.bot ? `${problem.bot}: ${problem.field}` : problem.field}</ProblemField>
+                <ProblemMessage>{problem.message}</ProblemMessage>
+            </ProblemRow>
+        ))}
+    </>
+);
+
+// ConfigValidationPanel checks the configuration as it is being edited. Saving a configuration with errors
+// is rejected by the server, while warnings only disable the bot or feature they concern.
+const ConfigValidationPanel = (props: {config: any}) => {
+    const intl = useIntl();
+    const [running, setRunning] = useState(false);
+    const [validation, setValidation] = useState<ConfigValidation | null>(null);
+    const [error, setError] = useState('');
+
+    const run = async () => {
+        setRunning(true);
+        setError('');
+        try {
+            setValidation(await validateConfig(props.config));
+        } catch (e) {
+            setValidation(null);
+            setError(String(e));
+        }
+        setRunning(false);
+    };
+
+    return (
+        <Panel
+            title={intl.formatMessage({defaultMessage: 'Configuration Check'})}
+            subtitle={intl.formatMessage({defaultMessage: 'Check the configuration before saving it. Errors prevent it from being saved, warnings disable the bot or feature they concern.'})}
+        >
+            <Vertical>
+                <div>
+                    <TertiaryButton
+                        onClick={run}
+                        disabled={running}
+                    >
+                        {running ? <FormattedMessage defaultMessage='Checking...'/> : <FormattedMessage defaultMessage='Check configuration'/>}
+                    </TertiaryButton>
+                </div>
+                {error && <ProblemMessage>{error}</ProblemMessage>}
+                {validation && validation.errors.length === 0 && validation.warnings.length === 0 && (
+                    <ProblemMessage><FormattedMessage defaultMessage='No problems were found.'/></ProblemMessage>
+                )}
+                {validation && (
+                    <ProblemList
+                        problems={validation.errors}
+                        pill={<DangerPill><FormattedMessage defaultMessage='Error'/></DangerPill>}
+                    />
+                )}
+                {validation && (
+                    <ProblemList
+                        problems={validation.warnings}
+                        pill={<GrayPill><FormattedMessage defaultMessage='Warning'/></GrayPill>}
+                    />
+                )}
+            </Vertical>
+        </Panel>
+    );
+};
+
+const Vertical = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 8px;
+`;
+
+const ProblemRow = styled.div`
+	display: flex;
+	flex-direction: row;
+	align-items: center;
+	gap: 8px;
+`;
+
+const ProblemField = styled.div`
+	font-size: 14px;
+	font-weight: 600;
+	min-width: 180px;
+`;
+
+const ProblemMessage = styled.div`
+	font-size: 14px;
+	color: rgba(var(--center-channel-color-rgb), 0.72);
+	word-break: break-word;
+`;
+
+export default ConfigValidationPanel;
@@ -0,0 +1,113 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useState} from 'react';
+import styled from 'styled-components';
+import {FormattedMessage, useIntl} from 'react-intl';
+
+import {feedbackExportURL, getFeedbackStats} from '@/client';
+
+import {TertiaryButton} from '../assets/buttons';
+
+import Panel from './panel';
+
+type FeedbackStats = {
+    bot_name: string
+    model: string
+    prompt_template: string
+    up: number
+    down: number
+    satisfaction: number
+}
+
+// FeedbackPanel shows how satisfied users are with the responses of each bot, model and prompt template.
+const FeedbackPanel = () => {
+    const intl = useIntl();
+    const [stats, setStats] = useState<FeedbackStats[] | null>(null);
+    const [error, setError] = useState('');
+
+    const load = async () => {
+        setError('');
+        try {
+            setStats(await getFeedbackStats());
+        } catch (e) {
+            setStats(null);
+            setError(String(e));
+        }
+    };
+
+    return (
+        <Panel
+            title={intl.formatMessage({defaultMessage: 'Response Feedback'})}
+            subtitle={intl.formatMessage({defaultMessage: 'Ratings users gave to responses. Export them with their conversations to tune custom instructions and compare models.'})}
+        >
+            <Vertical>
+                <Buttons>
+                    <TertiaryButton onClick={load}>
+                        <FormattedMessage defaultMessage='Show satisfaction'/>
+                    </TertiaryButton>
+                    <TertiaryButton onClick={() => window.open(feedbackExportURL())}>
+                        <FormattedMessage defaultMessage='Export as JSONL'/>
+                    </TertiaryButton>
+                </Buttons>
+                {error && <Message>{error}</Message>}
+                {stats && stats.length === 0 && (
+                    <Message><FormattedMessage defaultMessage='No feedback yet.'/></Message>
+                )}
+                {stats && stats.length > 0 && (
+                    <Table>
+                        <thead>
+                            <tr>
+                                <th><FormattedMessage defaultMessage='Bot'/></th>
+                                <th><FormattedMessage defaultMessage='Model'/></th>
+                                <th><FormattedMessage defaultMessage='Prompt template'/></th>
+                                <th><FormattedMessage defaultMessage='Thumbs up'/></th>
+                                <th><FormattedMessage defaultMessage='Thumbs down'/></th>
+                                <th><FormattedMessage defaultMessage='Satisfaction'/></th>
+                            </tr>
+                        </thead>
+                        <tbody>
+                            {stats.map((row) => (
+                                <tr key={`${row.bot_name}/${row.model}/${row.prompt_template}`}>
+                                    <td>{row.bot_name}</td>
+                                    <td>{row.model}</td>
+                                    <td>{row.prompt_template}</td>
+                                    <td>{row.up}</td>
+                                    <td>{row.down}</td>
+                                    <td>{`${Math.round(row.satisfaction * 100)}%`}</td>
+                                </tr>
+                            ))}
+                        </tbody>
+                    </Table>
+                )}
+            </Vertical>
+        </Panel>
+    );
+};
+
+const Vertical = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 16px;
+`;
+
+const Buttons = styled.div`
+	display: flex;
+	gap: 8px;
+`;
+
+const Message = styled.div`
+	font-size: 14px;
+	color: rgba(var(--center-channel-color-rgb), 0.72);
+`;
+
+const Table = styled.table`
+	font-size: 14px;
+
+	th, td {
+		padding: 4px 12px 4px 0;
+		text-align: left;
+	}
+`;
+
+export default FeedbackPanel;
@@ -0,0 +1,192 @@
+// Copyright (c) 2023-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+import React, {useState} from 'react';
+import styled from 'styled-components';
+import {FormattedMessage, useIntl} from 'react-intl';
+
+import {getHealth, testBotConnection} from '@/client';
+
+import {TertiaryButton} from '../assets/buttons';
+import {DangerPill, GrayPill, Pill} from '../pill';
+
+import Panel from './panel';
+import {LLMBotConfig} from './bot';
+
+export type HealthCheck = {
+    name: string
+    target?: string
+    status: 'ok' | 'error' | 'skipped'
+    message?: string
+    duration_ms: number
+}
+
+export type BotHealth = {
+    bot_name: string
+    display_name: string
+    service_type: string
+    model: string
+    healthy: boolean
+    checks: HealthCheck[]
+}
+
+type HealthReport = {
+    healthy: boolean
+    bots: BotHealth[]
+    ffmpeg: HealthCheck
+    upstream_hostnames: HealthCheck[]
+}
+
+const StatusPill = (props: {status: HealthCheck['status']}) => {
+    switch (props.status) {
+    case 'ok':
+        return <Pill><FormattedMessage defaultMessage='OK'/></Pill>;
+    case 'error':
+        return <DangerPill><FormattedMessage defaultMessage='Failed'/></DangerPill>;
+    default:
+        return <GrayPill><FormattedMessage defaultMessage='Skipped'/></GrayPill>;
+    }
+};
+
+export const HealthCheckList = (props: {checks: HealthCheck[]}) => (
+    <CheckList>
+        {props.checks.map((check) => (
+            <CheckRow key={check.name + (check.target ?? '')}>
+                <StatusPill status={check.status}/>
+                <CheckName>{check.target ? `${check.name} (${check.target})` : check.name}</CheckName>
+                <CheckMessage>{check.message}</CheckMessage>
+            </CheckRow>
+        ))}
+    </CheckList>
+);
+
+// TestConnection checks the configuration of a bot as it is being edited, before it is saved.
+export const TestConnection = (props: {bot: LLMBotConfig}) => {
+    const [running, setRunning] = useState(false);
+    const [result, setResult] = useState<BotHealth | null>(null);
+    const [error, setError] = useState('');
+
+    const run = async () => {
+        setRunning(true);
+        setError('');
+        try {
+            setResult(await testBotConnection(props.bot));
+        } catch (e) {
+            setResult(null);
+            setError(String(e));
+        }
+        setRunning(false);
+    };
+
+    return (
+        <Vertical>
+            <div>
+                <TertiaryButton
+                    onClick={run}
+                    disabled={running}
+                >
+                    {running ? <FormattedMessage defaultMessage='Testing...'/> : <FormattedMessage defaultMessage='Test connection'/>}
+                </TertiaryButton>
+            </div>
+            {result && <HealthCheckList checks={result.checks}/>}
+            {error && <CheckMessage>{error}</CheckMessage>}
+        </Vertical>
+    );
+};
+
+// HealthPanel checks the saved configuration of every bot and what the plugin needs regardless of the bot.
+const HealthPanel = () => {
+    const intl = useIntl();
+    const [running, setRunning] = useState(false);
+    const [report, setReport] = useState<HealthReport | null>(null);
+    const [error, setError] = useState('');
+
+    const run = async () => {
+        setRunning(true);
+        setError('');
+        try {
+            setReport(await getHealth());
+        } catch (e) {
+            setReport(null);
+            setError(String(e));
+        }
+        setRunning(false);
+    };
+
+    return (
+        <Panel
+            title={intl.formatMessage({defaultMessage: 'Health Checks'})}
+            subtitle={intl.formatMessage({defaultMessage: 'Test the credentials, model and a short completion of every saved bot, along with the tools transcriptions and integrations rely on.'})}
+        >
+            <Vertical>
+                <div>
+                    <TertiaryButton
+                        onClick={run}
+                        disabled={running}
+                    >
+                        {running ? <FormattedMessage defaultMessage='Running checks...'/> : <FormattedMessage defaultMessage='Run health checks'/>}
+                    </TertiaryButton>
+                </div>
+                {error && <CheckMessage>{error}</CheckMessage>}
+                {report && (
+                    <>
+                        {report.bots.map((bot) => (
+                            <Section key={bot.bot_name}>
+                                <SectionTitle>{`${bot.display_name} (${bot.model || bot.service_type})`}</SectionTitle>
+                                <HealthCheckList checks={bot.checks}/>
+                            </Section>
+                        ))}
+                        <Section>
+                            <SectionTitle><FormattedMessage defaultMessage='Plugin'/></SectionTitle>
+                            <HealthCheckList checks={[report.ffmpeg, ...(report.upstream_hostnames ?? [])]}/>
+                        </Section>
+                    </>
+                )}
+            </Vertical>
+        </Panel>
+    );
+};
+
+const Vertical = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 16px;
+`;
+
+const Section = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 8px;
+`;
+
+const SectionTitle = styled.div`
+	font-size: 14px;
+	font-weight: 600;
+`;
+
+const CheckList = styled.div`
+	display: flex;
+	flex-direction: column;
+	gap: 6px;
+`;
+
+const CheckRow = styled.div`
+	display: flex;
+	flex-direction: row;
+	align-items: center;
+	gap: 8px;
+`;
+
+const CheckName = styled.div`
+	font-size: 14px;
+	font-weight: 600;
+	min-width: 180px;
+`;
+
+const CheckMessage = styled.div`
+	font-size: 14px;
+	color: rgba(var(--center-channel-color-rgb), 0.72);
+	word-break: break-word;
+`;
+
+export default HealthPanel;